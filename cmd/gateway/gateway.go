@@ -15,6 +15,25 @@ type root interface {
 }
 
 func main() {
+	// gateway reconcile [--apply] reports drift between reservations and library stock instead of starting the server
+	if len(os.Args) >= 2 && os.Args[1] == "reconcile" {
+		apply := len(os.Args) == 3 && os.Args[2] == "--apply"
+		err := manager.Reconcile(context.Background(), apply)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// gateway expire reports the overdue reservations counted in business days of their libraries
+	if len(os.Args) >= 2 && os.Args[1] == "expire" {
+		err := manager.Expire(context.Background())
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
@@ -15,6 +15,25 @@ type root interface {
 }
 
 func main() {
+	// library-system geocode <file.csv> imports library coordinates instead of starting the server
+	if len(os.Args) == 3 && os.Args[1] == "geocode" {
+		err := manager.Geocode(context.Background(), os.Args[2])
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// library-system import-catalog <file.csv|file.jsonl> [--dry-run] imports books and library stock
+	if len(os.Args) >= 3 && os.Args[1] == "import-catalog" {
+		dryRun := len(os.Args) == 4 && os.Args[3] == "--dry-run"
+		err := manager.ImportCatalog(context.Background(), os.Args[2], dryRun)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
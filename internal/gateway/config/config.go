@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
 	"gopkg.in/yaml.v3"
 	"os"
 	"time"
@@ -12,12 +13,23 @@ type Server struct {
 	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
 }
 
+// ServiceAccount is the identity provider client the gateway calls the services with on its own behalf: the jobs
+// and the steps of reader requests that readers may not take themselves. Its tokens must carry the service role.
+// The client id and secret come from the environment, which the chart fills from a Secret.
+type ServiceAccount struct {
+	TokenURL     string `yaml:"token_url"`
+	ClientID     string `env:"SERVICE_CLIENT_ID"`
+	ClientSecret string `env:"SERVICE_CLIENT_SECRET"`
+}
+
 type Config struct {
-	Server               Server `yaml:"server"`
-	ReservationSystemURL string `yaml:"reservation_system_url"`
-	LibrarySystemURL     string `yaml:"library_system_url"`
-	RatingSystemURL      string `yaml:"rating_system_url"`
-	JWKSURI              string `yaml:"jwks_uri"`
+	Server               Server         `yaml:"server"`
+	ReservationSystemURL string         `yaml:"reservation_system_url"`
+	LibrarySystemURL     string         `yaml:"library_system_url"`
+	RatingSystemURL      string         `yaml:"rating_system_url"`
+	JWKSURI              string         `yaml:"jwks_uri"`
+	MaxUnpaidFines       int            `yaml:"max_unpaid_fines"`
+	ServiceAccount       ServiceAccount `yaml:"service_account"`
 }
 
 func New() (*Config, error) {
@@ -31,5 +43,13 @@ func New() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	cfg.ServiceAccount.ClientID = os.Getenv("SERVICE_CLIENT_ID")
+	cfg.ServiceAccount.ClientSecret = os.Getenv("SERVICE_CLIENT_SECRET")
 	return cfg, err
 }
+
+// ServiceTokens returns the source of the service account tokens, fetched with the client.
+func (c *Config) ServiceTokens(httpClient auth.HTTPClient) *auth.TokenSource {
+	return auth.NewTokenSource(httpClient, c.ServiceAccount.TokenURL, c.ServiceAccount.ClientID, c.ServiceAccount.ClientSecret)
+}
@@ -0,0 +1,186 @@
+package expiry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Erlendum/rsoi-lab-02/internal/gateway/config"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	rentedStatus = "RENTED"
+	calendarDays = 366
+)
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type tokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+type Job struct {
+	httpClient    httpClient
+	serviceTokens tokenSource
+	config        *config.Config
+}
+
+func NewJob(httpClient httpClient, config *config.Config) *Job {
+	return &Job{httpClient: httpClient, serviceTokens: config.ServiceTokens(httpClient), config: config}
+}
+
+// Run finds the rented reservations that are overdue today. Days are counted with the calendar of the
+// library the book was taken from, a library whose calendar can not be loaded is counted every day in UTC
+// and the error is reported. Days within the grace period of the lending policy are not overdue.
+func (j *Job) Run(ctx context.Context) (Report, error) {
+	loans := make([]reservation, 0)
+	err := j.get(ctx, j.config.ReservationSystemURL+"/reservations?status="+rentedStatus, &loans)
+	if err != nil {
+		return Report{}, fmt.Errorf("get rented reservations: %w", err)
+	}
+
+	report := Report{Overdue: make([]OverdueLoan, 0)}
+
+	byLibrary := map[string][]reservation{}
+	for _, l := range loans {
+		byLibrary[l.LibraryUid] = append(byLibrary[l.LibraryUid], l)
+	}
+
+	graceDays := map[string]int{}
+	for libraryUid, libraryLoans := range byLibrary {
+		tillDates := make(map[string]my_time.Date, len(libraryLoans))
+		var from *my_time.Date
+		for _, l := range libraryLoans {
+			tillDate, err := my_time.NewDate(l.TillDate)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("reservation %s: %s", l.ReservationUid, err))
+				continue
+			}
+			tillDates[l.ReservationUid] = *tillDate
+			if from == nil || tillDate.Before(*from) {
+				from = tillDate
+			}
+		}
+		if from == nil {
+			continue
+		}
+
+		calendar, err := j.calendar(ctx, libraryUid, *from)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("get calendar of library %s: %s", libraryUid, err))
+		}
+
+		today := calendar.Today()
+		for _, l := range libraryLoans {
+			tillDate, ok := tillDates[l.ReservationUid]
+			if !ok {
+				continue
+			}
+
+			days := calendar.DaysOverdue(tillDate, today)
+			if days <= 0 {
+				continue
+			}
+
+			days -= j.graceDays(ctx, l.LibraryUid, l.BookUid, graceDays, &report)
+			if days <= 0 {
+				continue
+			}
+			report.Overdue = append(report.Overdue, OverdueLoan{
+				ReservationUid: l.ReservationUid,
+				UserName:       l.UserName,
+				BookUid:        l.BookUid,
+				LibraryUid:     l.LibraryUid,
+				TillDate:       tillDate.String(),
+				DaysOverdue:    days,
+			})
+		}
+	}
+
+	sort.Slice(report.Overdue, func(i, k int) bool {
+		if report.Overdue[i].DaysOverdue != report.Overdue[k].DaysOverdue {
+			return report.Overdue[i].DaysOverdue > report.Overdue[k].DaysOverdue
+		}
+		return report.Overdue[i].ReservationUid < report.Overdue[k].ReservationUid
+	})
+	sort.Strings(report.Errors)
+
+	return report, nil
+}
+
+// graceDays returns the grace period of the lending policy for the book, looked up once per library and book.
+// A policy that can not be loaded gives no grace and the error is reported.
+func (j *Job) graceDays(ctx context.Context, libraryUid, bookUid string, cache map[string]int, report *Report) int {
+	key := libraryUid + "/" + bookUid
+	if days, ok := cache[key]; ok {
+		return days
+	}
+
+	policy := lendingPolicy{}
+	err := j.get(ctx, j.config.LibrarySystemURL+"/libraries/"+url.PathEscape(libraryUid)+"/books/"+url.PathEscape(bookUid)+"/policy", &policy)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("get policy of book %s in library %s: %s", bookUid, libraryUid, err))
+	}
+
+	days := 0
+	if policy.GraceDays != nil {
+		days = *policy.GraceDays
+	}
+	cache[key] = days
+	return days
+}
+
+// calendar loads the business days of the library from the earliest due date on, it falls back to a calendar
+// where every day in UTC is a business day.
+func (j *Job) calendar(ctx context.Context, libraryUid string, from my_time.Date) (*my_time.Calendar, error) {
+	fallback := my_time.NewCalendar(time.UTC, nil, nil)
+
+	query := url.Values{}
+	query.Set("from", from.String())
+	query.Set("to", from.AddDays(calendarDays).String())
+
+	calendar := &my_time.Calendar{}
+	err := j.get(ctx, j.config.LibrarySystemURL+"/libraries/"+url.PathEscape(libraryUid)+"/calendar?"+query.Encode(), calendar)
+	if err != nil {
+		return fallback, err
+	}
+
+	return calendar, nil
+}
+
+// get sends the request with the service token and decodes the response into result.
+func (j *Job) get(ctx context.Context, reqURL string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	token, err := j.serviceTokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("get service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code = %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return json.Unmarshal(respBody, result)
+}
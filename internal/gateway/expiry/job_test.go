@@ -0,0 +1,67 @@
+package expiry
+
+import (
+	"bytes"
+	"context"
+	"github.com/Erlendum/rsoi-lab-02/internal/gateway/config"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type httpClientStub struct {
+	responses map[string]string
+}
+
+const tokenCall = "POST http://keycloak/token"
+
+func (h *httpClientStub) Do(req *http.Request) (*http.Response, error) {
+	call := req.Method + " " + req.URL.String()
+	body, ok := h.responses[call]
+	if call != tokenCall && req.Header.Get("Authorization") != "Bearer service-token" {
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(bytes.NewBufferString("{}"))}, nil
+	}
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(bytes.NewBufferString("{}"))}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+func Test_Run(t *testing.T) {
+	cfg := &config.Config{ReservationSystemURL: "http://reservation", LibrarySystemURL: "http://library",
+		ServiceAccount: config.ServiceAccount{TokenURL: "http://keycloak/token", ClientID: "gateway", ClientSecret: "secret"}}
+
+	today := my_time.Today(time.UTC)
+	overdue := today.AddDays(-3)
+	notDue := today.AddDays(1)
+	late := today.AddDays(-10)
+
+	stub := &httpClientStub{responses: map[string]string{
+		"GET http://reservation/reservations?status=RENTED": `[
+			{"reservationUid": "r1", "username": "u1", "libraryUid": "l1", "bookUid": "b1", "tillDate": "` + overdue.String() + `"},
+			{"reservationUid": "r2", "username": "u2", "libraryUid": "l1", "bookUid": "b1", "tillDate": "` + notDue.String() + `"},
+			{"reservationUid": "r3", "username": "u3", "libraryUid": "l2", "bookUid": "b2", "tillDate": "` + late.String() + `"}
+		]`,
+		"GET http://library/libraries/l1/calendar?from=" + overdue.String() + "&to=" + overdue.AddDays(calendarDays).String(): `{
+			"timezone": "UTC",
+			"closedWeekdays": [],
+			"holidays": ["` + today.AddDays(-1).String() + `"]
+		}`,
+		"GET http://library/libraries/l1/books/b1/policy": `{"graceDays": 1}`,
+		tokenCall: `{"access_token": "service-token", "expires_in": 300}`,
+	}}
+
+	report, err := NewJob(stub, cfg).Run(context.Background())
+
+	require.NoError(t, err)
+	require.Equal(t, []OverdueLoan{
+		{ReservationUid: "r3", UserName: "u3", BookUid: "b2", LibraryUid: "l2", TillDate: late.String(), DaysOverdue: 10},
+		{ReservationUid: "r1", UserName: "u1", BookUid: "b1", LibraryUid: "l1", TillDate: overdue.String(), DaysOverdue: 1},
+	}, report.Overdue)
+	require.Len(t, report.Errors, 2)
+	require.Contains(t, report.Errors[0], "get calendar of library l2")
+	require.Contains(t, report.Errors[1], "get policy of book b2 in library l2")
+}
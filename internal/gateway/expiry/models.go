@@ -0,0 +1,29 @@
+package expiry
+
+type reservation struct {
+	ReservationUid string `json:"reservationUid"`
+	UserName       string `json:"username"`
+	BookUid        string `json:"bookUid"`
+	LibraryUid     string `json:"libraryUid"`
+	TillDate       string `json:"tillDate"`
+}
+
+// OverdueLoan is a rented reservation whose due date and grace period have passed, days are counted in
+// business days of the library after the grace period.
+type OverdueLoan struct {
+	ReservationUid string `json:"reservationUid"`
+	UserName       string `json:"username"`
+	BookUid        string `json:"bookUid"`
+	LibraryUid     string `json:"libraryUid"`
+	TillDate       string `json:"tillDate"`
+	DaysOverdue    int    `json:"daysOverdue"`
+}
+
+type lendingPolicy struct {
+	GraceDays *int `json:"graceDays"`
+}
+
+type Report struct {
+	Overdue []OverdueLoan `json:"overdue"`
+	Errors  []string      `json:"errors,omitempty"`
+}
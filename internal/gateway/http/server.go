@@ -15,10 +15,49 @@ type librarySystemHandler interface {
 	Register(echo *echo.Echo)
 	GetLibraries(c echo.Context) error
 	GetBooksByLibrary(c echo.Context) error
+	GetNearbyLibraries(c echo.Context) error
+	CreateLibrary(c echo.Context) error
+	UpdateLibrary(c echo.Context) error
+	CloseLibrary(c echo.Context) error
+	SearchBooks(c echo.Context) error
+	GetBookAvailability(c echo.Context) error
+	GetBookByISBN(c echo.Context) error
+	GetCopy(c echo.Context) error
+	CheckoutCopyAtDesk(c echo.Context) error
+	ReturnCopyAtDesk(c echo.Context) error
+	GetInventory(c echo.Context) error
+	GetBookCalendar(c echo.Context) error
+	GetReservationHistoryByUser(c echo.Context) error
+	GetLibrarySchedule(c echo.Context) error
+	SetLibraryOpeningHours(c echo.Context) error
+	SetLibraryClosure(c echo.Context) error
+	DeleteLibraryClosure(c echo.Context) error
+	GetLibraryPolicies(c echo.Context) error
+	GetBookLendingPolicy(c echo.Context) error
+	SetLibraryPolicy(c echo.Context) error
+	DeleteLibraryPolicy(c echo.Context) error
+	GetTransfers(c echo.Context) error
+	GetTransfer(c echo.Context) error
+	CreateTransfer(c echo.Context) error
+	DispatchTransfer(c echo.Context) error
+	ReceiveTransfer(c echo.Context) error
+	CreateBook(c echo.Context) error
+	ImportCatalog(c echo.Context) error
+	UpdateBook(c echo.Context) error
+	UpsertLibraryBook(c echo.Context) error
+	AdjustLibraryBook(c echo.Context) error
+	DeleteLibraryBook(c echo.Context) error
 	GetBooksByUser(c echo.Context) error
 	ReserveBookByUser(c echo.Context) error
 	ReturnBookByUser(c echo.Context) error
+	RenewBookByUser(c echo.Context) error
 	GetRatingByUser(c echo.Context) error
+	GetRatingHistoryByUser(c echo.Context) error
+	GetTierByUser(c echo.Context) error
+	SetLeaderboardOptInByUser(c echo.Context) error
+	GetLeaderboard(c echo.Context) error
+	GetFinesByUser(c echo.Context) error
+	PayFinesByUser(c echo.Context) error
 }
 
 type server struct {
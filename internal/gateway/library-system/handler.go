@@ -9,6 +9,7 @@ import (
 	"github.com/Erlendum/rsoi-lab-02/internal/gateway/config"
 	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
 	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 	"io"
@@ -27,17 +28,40 @@ type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+type tokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
 type handler struct {
-	httpClient httpClient
-	config     *config.Config
+	httpClient    httpClient
+	serviceTokens tokenSource
+	config        *config.Config
 }
 
 const (
+	bookedStatus   = "BOOKED"
 	rentedStatus   = "RENTED"
 	expiredStatus  = "EXPIRED"
 	returnedStatus = "RETURNED"
+	canceledStatus = "CANCELED"
+)
+
+const (
+	returnEvent  = "RETURN"
+	reserveEvent = "RESERVE"
 )
 
+const returnReason = "RETURN"
+
+// calendarDays is the longest range library-system serves a calendar for.
+const calendarDays = 366
+
+// maxReservationDays is how far after today a due date may be, reservation-system allows the same.
+const maxReservationDays = 366
+
+// detailsBatchSize is how many books or libraries one request to library-system asks for.
+const detailsBatchSize = 50
+
 var (
 	errNotOkStatusCode = errors.New("not ok status code")
 	conditionMap       = map[string]int{
@@ -48,12 +72,17 @@ var (
 )
 
 func NewHandler(config *config.Config) *handler {
+	return newHandler(&http.Client{
+		Timeout:   defaultTimeout,
+		Transport: &http.Transport{MaxConnsPerHost: defaultMaxConnsPerHost},
+	}, config)
+}
+
+func newHandler(httpClient httpClient, config *config.Config) *handler {
 	return &handler{
-		httpClient: &http.Client{
-			Timeout:   defaultTimeout,
-			Transport: &http.Transport{MaxConnsPerHost: defaultMaxConnsPerHost},
-		},
-		config: config,
+		httpClient:    httpClient,
+		serviceTokens: config.ServiceTokens(httpClient),
+		config:        config,
 	}
 }
 
@@ -80,10 +109,53 @@ func (h *handler) Register(echo *echo.Echo) {
 
 	api.GET("/libraries", h.GetLibraries)
 	api.GET("/libraries/:libraryUid/books", h.GetBooksByLibrary)
+	api.GET("/libraries/nearby", h.GetNearbyLibraries)
+	api.POST("/libraries", h.CreateLibrary, auth.RequireRole(auth.AdminRole))
+	api.PUT("/libraries/:libraryUid", h.UpdateLibrary, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryUid", h.CloseLibrary, auth.RequireRole(auth.AdminRole))
+	api.GET("/books/search", h.SearchBooks)
+	api.GET("/books/:bookUid/availability", h.GetBookAvailability)
+	api.GET("/books/isbn/:isbn", h.GetBookByISBN)
+	api.POST("/books", h.CreateBook, auth.RequireRole(auth.AdminRole))
+	api.POST("/catalog/import", h.ImportCatalog, auth.RequireRole(auth.AdminRole))
+	api.PUT("/books/:bookUid", h.UpdateBook, auth.RequireRole(auth.AdminRole))
+	api.POST("/libraries/:libraryUid/books", h.UpsertLibraryBook, auth.RequireRole(auth.AdminRole))
+	api.PATCH("/libraries/:libraryUid/books/:bookUid", h.AdjustLibraryBook, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryUid/books/:bookUid", h.DeleteLibraryBook, auth.RequireRole(auth.AdminRole))
+	api.GET("/libraries/:libraryUid/books/:bookUid/inventory", h.GetInventory, auth.RequireRole(auth.LibrarianRole, auth.AdminRole))
+	api.GET("/libraries/:libraryUid/books/:bookUid/calendar", h.GetBookCalendar)
+	api.GET("/libraries/:libraryUid/schedule", h.GetLibrarySchedule)
+	api.PUT("/libraries/:libraryUid/opening-hours", h.SetLibraryOpeningHours, auth.RequireRole(auth.AdminRole))
+	api.PUT("/libraries/:libraryUid/closures/:date", h.SetLibraryClosure, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryUid/closures/:date", h.DeleteLibraryClosure, auth.RequireRole(auth.AdminRole))
+	api.GET("/libraries/:libraryUid/policies", h.GetLibraryPolicies)
+	api.GET("/libraries/:libraryUid/books/:bookUid/policy", h.GetBookLendingPolicy)
+	api.PUT("/libraries/:libraryUid/policy", h.SetLibraryPolicy, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryUid/policy", h.DeleteLibraryPolicy, auth.RequireRole(auth.AdminRole))
+	api.PUT("/libraries/:libraryUid/policy/genres/:genre", h.SetLibraryPolicy, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryUid/policy/genres/:genre", h.DeleteLibraryPolicy, auth.RequireRole(auth.AdminRole))
+	api.PUT("/libraries/:libraryUid/policy/books/:bookUid", h.SetLibraryPolicy, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryUid/policy/books/:bookUid", h.DeleteLibraryPolicy, auth.RequireRole(auth.AdminRole))
+	api.GET("/transfers", h.GetTransfers, auth.RequireRole(auth.LibrarianRole, auth.AdminRole))
+	api.GET("/transfers/:transferUid", h.GetTransfer, auth.RequireRole(auth.LibrarianRole, auth.AdminRole))
+	api.POST("/transfers", h.CreateTransfer, auth.RequireRole(auth.LibrarianRole, auth.AdminRole))
+	api.POST("/transfers/:transferUid/dispatch", h.DispatchTransfer, auth.RequireRole(auth.LibrarianRole, auth.AdminRole))
+	api.POST("/transfers/:transferUid/receive", h.ReceiveTransfer, auth.RequireRole(auth.LibrarianRole, auth.AdminRole))
 	api.GET("/reservations", h.GetBooksByUser)
+	api.GET("/reservations/history", h.GetReservationHistoryByUser)
 	api.POST("/reservations", h.ReserveBookByUser)
 	api.POST("/reservations/:reservationUid/return", h.ReturnBookByUser)
+	api.POST("/reservations/:reservationUid/renew", h.RenewBookByUser)
+	api.GET("/desk/copies/:barcode", h.GetCopy, auth.RequireRole(auth.LibrarianRole))
+	api.POST("/desk/checkout", h.CheckoutCopyAtDesk, auth.RequireRole(auth.LibrarianRole))
+	api.POST("/desk/return", h.ReturnCopyAtDesk, auth.RequireRole(auth.LibrarianRole))
 	api.GET("/rating", h.GetRatingByUser)
+	api.GET("/rating/history", h.GetRatingHistoryByUser)
+	api.GET("/rating/tier", h.GetTierByUser)
+	api.PUT("/rating/leaderboard", h.SetLeaderboardOptInByUser)
+	api.GET("/leaderboard", h.GetLeaderboard)
+	api.GET("/fines", h.GetFinesByUser)
+	api.POST("/fines/payments", h.PayFinesByUser)
 }
 
 func (h *handler) setToken(ctx context.Context, req *http.Request) {
@@ -91,11 +163,35 @@ func (h *handler) setToken(ctx context.Context, req *http.Request) {
 	req.Header.Set("Authorization", "Bearer "+token)
 }
 
+// setServiceToken authorizes the request as the gateway itself, for calls the reader may not make directly.
+func (h *handler) setServiceToken(ctx context.Context, req *http.Request) error {
+	token, err := h.serviceTokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// setStaffToken authorizes calls only staff and services may make, such as lending and returning copies or
+// closing reservations: a librarian at the desk acts with their own token, for a reader the gateway acts itself
+// once it has checked the reservation is theirs.
+func (h *handler) setStaffToken(ctx context.Context, req *http.Request) error {
+	if auth.HasRole(ctx, auth.LibrarianRole) {
+		h.setToken(ctx, req)
+		return nil
+	}
+	return h.setServiceToken(ctx, req)
+}
+
 func (h *handler) GetLibraries(c echo.Context) error {
 	queryParams := url.Values{}
 	queryParams.Add("city", c.QueryParam("city"))
 	queryParams.Add("page", c.QueryParam("page"))
 	queryParams.Add("size", c.QueryParam("size"))
+	if after := c.QueryParam("after"); after != "" {
+		queryParams.Add("after", after)
+	}
 	reqURL, err := url.Parse(h.config.LibrarySystemURL + "/libraries")
 	if err != nil {
 		log.Err(err).Msg("failed to parse request to library service")
@@ -128,20 +224,9 @@ func (h *handler) GetLibraries(c echo.Context) error {
 	return c.String(resp.StatusCode, string(body))
 }
 
-func (h *handler) GetBooksByLibrary(c echo.Context) error {
-	queryParams := url.Values{}
-	queryParams.Add("page", c.QueryParam("page"))
-	queryParams.Add("size", c.QueryParam("size"))
-	queryParams.Add("showAll", c.QueryParam("showAll"))
-	reqURL, err := url.Parse(h.config.LibrarySystemURL + "/libraries/" + c.Param("libraryUid") + "/books")
-	if err != nil {
-		log.Err(err).Msg("failed to parse request to library service")
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
-	}
-
-	reqURL.RawQuery = queryParams.Encode()
-
-	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+// forwardToLibrarySystem passes the request body to the library service and answers with its response as is.
+func (h *handler) forwardToLibrarySystem(c echo.Context, method, path string) error {
+	req, err := http.NewRequest(method, h.config.LibrarySystemURL+path, c.Request().Body)
 	if err != nil {
 		log.Err(err).Msg("failed to process request to library service")
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to process request"})
@@ -161,168 +246,140 @@ func (h *handler) GetBooksByLibrary(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
+	if len(body) == 0 {
+		return c.NoContent(resp.StatusCode)
+	}
+
 	c.Response().Header().Set("Content-Type", "application/json")
 	return c.String(resp.StatusCode, string(body))
 }
 
-type bookResp struct {
-	BookUid string `json:"bookUid"`
-	Name    string `json:"name"`
-	Author  string `json:"author"`
-	Genre   string `json:"genre"`
+func (h *handler) CreateLibrary(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPost, "/libraries")
 }
 
-func (h *handler) getBooksByUids(ctx context.Context, uids []string) (map[string]bookResp, error) {
-	reqURL, err := url.Parse(h.config.LibrarySystemURL + "/books/")
-	if err != nil {
-		return nil, err
-	}
-
-	q := reqURL.Query()
-	for _, bookUid := range uids {
-		q.Add("bookUids", bookUid)
-	}
-	reqURL.RawQuery = q.Encode()
-
-	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	h.setToken(ctx, req)
+func (h *handler) UpdateLibrary(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPut, "/libraries/"+url.PathEscape(c.Param("libraryUid")))
+}
 
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
+func (h *handler) CloseLibrary(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodDelete, "/libraries/"+url.PathEscape(c.Param("libraryUid")))
+}
 
-	type booksResp struct {
-		Data []bookResp `json:"data"`
-	}
+func (h *handler) GetLibrarySchedule(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodGet, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+"/schedule?"+c.QueryString())
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (h *handler) SetLibraryOpeningHours(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPut, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+"/opening-hours")
+}
 
-	var booksRespData booksResp
-	err = json.Unmarshal(body, &booksRespData)
-	if err != nil {
-		return nil, err
-	}
-	booksMap := map[string]bookResp{}
-	for _, book := range booksRespData.Data {
-		booksMap[book.BookUid] = book
-	}
+func (h *handler) SetLibraryClosure(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPut, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+
+		"/closures/"+url.PathEscape(c.Param("date")))
+}
 
-	return booksMap, nil
+func (h *handler) DeleteLibraryClosure(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodDelete, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+
+		"/closures/"+url.PathEscape(c.Param("date")))
 }
 
-type libraryResp struct {
-	LibraryUid string `json:"libraryUid"`
-	Name       string `json:"name"`
-	Address    string `json:"address"`
-	City       string `json:"city"`
+func (h *handler) GetLibraryPolicies(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodGet, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+"/policies")
 }
 
-func (h *handler) getLibrariesByUids(ctx context.Context, uids []string) (map[string]libraryResp, error) {
-	reqURL, err := url.Parse(h.config.LibrarySystemURL + "/libraries/by-uids")
-	if err != nil {
-		return nil, err
-	}
+func (h *handler) GetBookLendingPolicy(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodGet, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+
+		"/books/"+url.PathEscape(c.Param("bookUid"))+"/policy")
+}
 
-	q := reqURL.Query()
-	for _, libraryUid := range uids {
-		q.Add("libraryUids", libraryUid)
+// policyPath addresses the policy of the library, of a genre or of a book the same way library-system does.
+func policyPath(c echo.Context) string {
+	path := "/libraries/" + url.PathEscape(c.Param("libraryUid")) + "/policy"
+	if genre := c.Param("genre"); genre != "" {
+		return path + "/genres/" + url.PathEscape(genre)
 	}
-	reqURL.RawQuery = q.Encode()
-
-	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
-	if err != nil {
-		return nil, err
+	if bookUid := c.Param("bookUid"); bookUid != "" {
+		return path + "/books/" + url.PathEscape(bookUid)
 	}
+	return path
+}
 
-	h.setToken(ctx, req)
-
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
+func (h *handler) SetLibraryPolicy(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPut, policyPath(c))
+}
 
-	type librariesResp struct {
-		Data []libraryResp `json:"data"`
-	}
+func (h *handler) DeleteLibraryPolicy(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodDelete, policyPath(c))
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (h *handler) GetTransfers(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodGet, "/transfers?"+c.QueryString())
+}
 
-	var librariesRespData librariesResp
-	err = json.Unmarshal(body, &librariesRespData)
-	if err != nil {
-		return nil, err
-	}
+func (h *handler) GetTransfer(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodGet, "/transfers/"+url.PathEscape(c.Param("transferUid")))
+}
 
-	librariesMap := map[string]libraryResp{}
-	for _, library := range librariesRespData.Data {
-		librariesMap[library.LibraryUid] = library
-	}
+func (h *handler) CreateTransfer(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPost, "/transfers")
+}
 
-	return librariesMap, nil
+func (h *handler) DispatchTransfer(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPost, "/transfers/"+url.PathEscape(c.Param("transferUid"))+"/dispatch")
 }
 
-type reservationResp struct {
-	ReservationUid string `json:"reservationUid"`
-	Status         string `json:"status"`
-	StartDate      string `json:"startDate"`
-	TillDate       string `json:"tillDate"`
-	BookUid        string `json:"bookUid"`
-	LibraryUid     string `json:"libraryUid"`
+func (h *handler) ReceiveTransfer(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPost, "/transfers/"+url.PathEscape(c.Param("transferUid"))+"/receive")
 }
 
-func (h *handler) getReservationsByUser(ctx context.Context, userName string) ([]reservationResp, int, error) {
-	reqURL, err := url.Parse(h.config.ReservationSystemURL + "/reservations/by-user/" + userName)
+func (h *handler) SearchBooks(c echo.Context) error {
+	queryParams := url.Values{}
+	for _, param := range []string{"q", "genre", "author", "city", "page", "size"} {
+		if value := c.QueryParam(param); value != "" {
+			queryParams.Add(param, value)
+		}
+	}
+	reqURL, err := url.Parse(h.config.LibrarySystemURL + "/books/search")
 	if err != nil {
-		return nil, 0, err
+		log.Err(err).Msg("failed to parse request to library service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
 	}
 
-	q := reqURL.Query()
-	q.Add("status", rentedStatus)
-	reqURL.RawQuery = q.Encode()
+	reqURL.RawQuery = queryParams.Encode()
 
 	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
 	if err != nil {
-		return nil, 0, err
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to process request"})
 	}
 
-	h.setToken(ctx, req)
+	h.setToken(c.Request().Context(), req)
 
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
-		return nil, 0, err
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, resp.StatusCode, errors.Join(err, fmt.Errorf("%s", string(body)))
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, resp.StatusCode, errNotOkStatusCode
-	}
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(resp.StatusCode, string(body))
+}
 
-	var reservations []reservationResp
-	err = json.Unmarshal(body, &reservations)
+func (h *handler) getFromLibrarySystem(ctx context.Context, path string, queryParams url.Values) (int, []byte, error) {
+	reqURL, err := url.Parse(h.config.LibrarySystemURL + path)
 	if err != nil {
-		return nil, resp.StatusCode, err
+		return 0, nil, err
 	}
+	reqURL.RawQuery = queryParams.Encode()
 
-	return reservations, http.StatusOK, nil
-}
-
-func (h *handler) getReservationsByUid(ctx context.Context, uid string) (int, []byte, error) {
-	req, err := http.NewRequest(http.MethodGet, h.config.ReservationSystemURL+"/reservations/"+uid, nil)
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -336,7 +393,7 @@ func (h *handler) getReservationsByUid(ctx context.Context, uid string) (int, []
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, nil, err
+		return resp.StatusCode, nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -346,84 +403,1226 @@ func (h *handler) getReservationsByUid(ctx context.Context, uid string) (int, []
 	return resp.StatusCode, body, nil
 }
 
-func (h *handler) GetBooksByUser(c echo.Context) error {
-	reservations, statusCode, err := h.getReservationsByUser(c.Request().Context(), auth.GetUser(c.Request().Context()))
+func (h *handler) GetBookAvailability(c echo.Context) error {
+	queryParams := url.Values{}
+	if city := c.QueryParam("city"); city != "" {
+		queryParams.Add("city", city)
+	}
+
+	statusCode, body, err := h.getFromLibrarySystem(c.Request().Context(), "/books/"+url.PathEscape(c.Param("bookUid"))+"/availability", queryParams)
 	if err != nil {
-		log.Err(err).Msg("failed to process request to reservation service")
+		log.Err(err).Msg("failed to process request to library service")
 		if errors.Is(err, errNotOkStatusCode) {
-			return c.JSON(statusCode, echo.Map{"message": err.Error()})
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
 		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	booksUids := make([]string, 0, len(reservations))
-	librariesUids := make([]string, 0, len(reservations))
-	for _, r := range reservations {
-		booksUids = append(booksUids, r.BookUid)
-		librariesUids = append(librariesUids, r.LibraryUid)
-	}
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
 
-	booksMap, err := h.getBooksByUids(c.Request().Context(), booksUids)
+func (h *handler) GetBookByISBN(c echo.Context) error {
+	statusCode, body, err := h.getFromLibrarySystem(c.Request().Context(), "/books/isbn/"+url.PathEscape(c.Param("isbn")), url.Values{})
 	if err != nil {
 		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	librariesMap, err := h.getLibrariesByUids(c.Request().Context(), librariesUids)
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
+
+type nearbyLibraryResp struct {
+	libraryResp
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	DistanceKm     float64 `json:"distanceKm"`
+	AvailableCount *int    `json:"availableCount,omitempty"`
+}
+
+// GetNearbyLibraries answers with libraries around the point, when bookUid is set only the ones holding
+// the book are kept, still the closest first, together with the available count.
+func (h *handler) GetNearbyLibraries(c echo.Context) error {
+	queryParams := url.Values{}
+	for _, param := range []string{"lat", "lon", "radius", "size"} {
+		if value := c.QueryParam(param); value != "" {
+			queryParams.Add(param, value)
+		}
+	}
+
+	statusCode, body, err := h.getFromLibrarySystem(c.Request().Context(), "/libraries/nearby", queryParams)
 	if err != nil {
 		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	type reservationExtended struct {
-		ReservationUid string      `json:"reservationUid"`
-		Status         string      `json:"status"`
-		StartDate      string      `json:"startDate"`
-		TillDate       string      `json:"tillDate"`
-		Book           bookResp    `json:"book"`
-		Library        libraryResp `json:"library"`
-	}
-
-	reservationsExtended := make([]reservationExtended, 0, len(reservations))
-	for _, r := range reservations {
-		reservationsExtended = append(reservationsExtended, reservationExtended{
-			ReservationUid: r.ReservationUid,
-			Status:         r.Status,
-			StartDate:      r.StartDate,
-			TillDate:       r.TillDate,
-			Book:           booksMap[r.BookUid],
-			Library:        librariesMap[r.LibraryUid],
-		})
+	bookUid := c.QueryParam("bookUid")
+	if bookUid == "" {
+		c.Response().Header().Set("Content-Type", "application/json")
+		return c.String(http.StatusOK, string(body))
 	}
 
-	return c.JSON(http.StatusOK, reservationsExtended)
-}
-
-func (h *handler) createUser(ctx context.Context, userName string) (int, []byte, error) {
-	type createUserReq struct {
-		UserName string `json:"userName"`
+	nearby := struct {
+		Items []nearbyLibraryResp `json:"items"`
+	}{}
+	err = json.Unmarshal(body, &nearby)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	reqBody, err := json.Marshal(createUserReq{UserName: userName})
+	statusCode, body, err = h.getFromLibrarySystem(c.Request().Context(), "/books/"+url.PathEscape(bookUid)+"/availability", url.Values{})
 	if err != nil {
-		return 0, nil, err
+		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	req, err := http.NewRequest(http.MethodPost, h.config.RatingSystemURL+"/rating/", bytes.NewBuffer(reqBody))
+	availability := struct {
+		Book      bookResp `json:"book"`
+		Libraries []struct {
+			LibraryUid     string `json:"libraryUid"`
+			AvailableCount int    `json:"availableCount"`
+		} `json:"libraries"`
+	}{}
+	err = json.Unmarshal(body, &availability)
 	if err != nil {
-		return 0, nil, err
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	h.setToken(ctx, req)
+	counts := make(map[string]int, len(availability.Libraries))
+	for _, v := range availability.Libraries {
+		counts[v.LibraryUid] = v.AvailableCount
+	}
 
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return 0, nil, err
+	type response struct {
+		Book  bookResp            `json:"book"`
+		Items []nearbyLibraryResp `json:"items"`
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return resp.StatusCode, nil, err
+	res := response{Book: availability.Book, Items: make([]nearbyLibraryResp, 0, len(nearby.Items))}
+	for _, v := range nearby.Items {
+		count, ok := counts[v.LibraryUid]
+		if !ok {
+			continue
+		}
+		v.AvailableCount = &count
+		res.Items = append(res.Items, v)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *handler) ImportCatalog(c echo.Context) error {
+	queryParams := url.Values{}
+	queryParams.Add("format", c.QueryParam("format"))
+	if dryRun := c.QueryParam("dryRun"); dryRun != "" {
+		queryParams.Add("dryRun", dryRun)
+	}
+	return h.forwardToLibrarySystem(c, http.MethodPost, "/catalog/import?"+queryParams.Encode())
+}
+
+func (h *handler) CreateBook(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPost, "/books")
+}
+
+func (h *handler) UpdateBook(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPut, "/books/"+url.PathEscape(c.Param("bookUid")))
+}
+
+func (h *handler) UpsertLibraryBook(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPost, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+"/books")
+}
+
+func (h *handler) AdjustLibraryBook(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodPut, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+
+		"/books/"+url.PathEscape(c.Param("bookUid"))+"?countDiff="+url.QueryEscape(c.QueryParam("countDiff")))
+}
+
+func (h *handler) GetInventory(c echo.Context) error {
+	queryParams := url.Values{}
+	if at := c.QueryParam("at"); at != "" {
+		queryParams.Add("at", at)
+	}
+
+	statusCode, body, err := h.getFromLibrarySystem(c.Request().Context(), "/libraries/"+url.PathEscape(c.Param("libraryUid"))+
+		"/books/"+url.PathEscape(c.Param("bookUid"))+"/inventory", queryParams)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
+
+func (h *handler) getFromReservationSystem(ctx context.Context, path string, queryParams url.Values) (int, []byte, error) {
+	reqURL, err := url.Parse(h.config.ReservationSystemURL + path)
+	if err != nil {
+		return 0, nil, err
+	}
+	reqURL.RawQuery = queryParams.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// GetBookCalendar shows on which days the library has a copy of the book free and from which day it is,
+// reservation-system counts the stock against the loans and bookings.
+func (h *handler) GetBookCalendar(c echo.Context) error {
+	queryParams := url.Values{}
+	queryParams.Add("libraryUid", c.Param("libraryUid"))
+	queryParams.Add("bookUid", c.Param("bookUid"))
+	if from := c.QueryParam("from"); from != "" {
+		queryParams.Add("from", from)
+	}
+	if to := c.QueryParam("to"); to != "" {
+		queryParams.Add("to", to)
+	}
+
+	statusCode, body, err := h.getFromReservationSystem(c.Request().Context(), "/reservations/availability", queryParams)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Reservation Service unavailable"})
+	}
+
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
+
+func (h *handler) DeleteLibraryBook(c echo.Context) error {
+	return h.forwardToLibrarySystem(c, http.MethodDelete, "/libraries/"+url.PathEscape(c.Param("libraryUid"))+
+		"/books/"+url.PathEscape(c.Param("bookUid")))
+}
+
+func (h *handler) GetBooksByLibrary(c echo.Context) error {
+	queryParams := url.Values{}
+	queryParams.Add("page", c.QueryParam("page"))
+	queryParams.Add("size", c.QueryParam("size"))
+	queryParams.Add("showAll", c.QueryParam("showAll"))
+	if after := c.QueryParam("after"); after != "" {
+		queryParams.Add("after", after)
+	}
+	reqURL, err := url.Parse(h.config.LibrarySystemURL + "/libraries/" + c.Param("libraryUid") + "/books")
+	if err != nil {
+		log.Err(err).Msg("failed to parse request to library service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
+	}
+
+	reqURL.RawQuery = queryParams.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to process request"})
+	}
+
+	h.setToken(c.Request().Context(), req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(resp.StatusCode, string(body))
+}
+
+type bookResp struct {
+	BookUid     string  `json:"bookUid"`
+	Name        string  `json:"name"`
+	Author      string  `json:"author"`
+	Genre       string  `json:"genre"`
+	ISBN        *string `json:"isbn,omitempty"`
+	Publisher   *string `json:"publisher,omitempty"`
+	Year        *int    `json:"year,omitempty"`
+	Language    *string `json:"language,omitempty"`
+	PageCount   *int    `json:"pageCount,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+func (h *handler) getBooksByUids(ctx context.Context, uids []string) (map[string]bookResp, error) {
+	reqURL, err := url.Parse(h.config.LibrarySystemURL + "/books/")
+	if err != nil {
+		return nil, err
+	}
+
+	q := reqURL.Query()
+	for _, bookUid := range uids {
+		q.Add("bookUids", bookUid)
+	}
+	reqURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// library-system answers 404 when none of the books is found
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]bookResp{}, nil
+	}
+
+	type booksResp struct {
+		Data []bookResp `json:"data"`
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var booksRespData booksResp
+	err = json.Unmarshal(body, &booksRespData)
+	if err != nil {
+		return nil, err
+	}
+	booksMap := map[string]bookResp{}
+	for _, book := range booksRespData.Data {
+		booksMap[book.BookUid] = book
+	}
+
+	return booksMap, nil
+}
+
+type libraryResp struct {
+	LibraryUid string `json:"libraryUid"`
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	City       string `json:"city"`
+}
+
+func (h *handler) getLibrariesByUids(ctx context.Context, uids []string) (map[string]libraryResp, error) {
+	reqURL, err := url.Parse(h.config.LibrarySystemURL + "/libraries/by-uids")
+	if err != nil {
+		return nil, err
+	}
+
+	q := reqURL.Query()
+	for _, libraryUid := range uids {
+		q.Add("libraryUids", libraryUid)
+	}
+	reqURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]libraryResp{}, nil
+	}
+
+	type librariesResp struct {
+		Data []libraryResp `json:"data"`
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var librariesRespData librariesResp
+	err = json.Unmarshal(body, &librariesRespData)
+	if err != nil {
+		return nil, err
+	}
+
+	librariesMap := map[string]libraryResp{}
+	for _, library := range librariesRespData.Data {
+		librariesMap[library.LibraryUid] = library
+	}
+
+	return librariesMap, nil
+}
+
+type reservationResp struct {
+	ReservationUid string `json:"reservationUid"`
+	UserName       string `json:"username"`
+	Status         string `json:"status"`
+	StartDate      string `json:"startDate"`
+	TillDate       string `json:"tillDate"`
+	BookUid        string `json:"bookUid"`
+	LibraryUid     string `json:"libraryUid"`
+	CopyBarcode    string `json:"copyBarcode"`
+	Renewals       int    `json:"renewals"`
+}
+
+func (h *handler) getReservationsByUser(ctx context.Context, userName, status string) ([]reservationResp, int, error) {
+	reqURL, err := url.Parse(h.config.ReservationSystemURL + "/reservations/by-user/" + userName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	q := reqURL.Query()
+	q.Add("status", status)
+	reqURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, errors.Join(err, fmt.Errorf("%s", string(body)))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, errNotOkStatusCode
+	}
+
+	var reservations []reservationResp
+	err = json.Unmarshal(body, &reservations)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+
+	return reservations, http.StatusOK, nil
+}
+
+func (h *handler) getReservationsByUid(ctx context.Context, uid string) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, h.config.ReservationSystemURL+"/reservations/"+uid, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+func (h *handler) GetBooksByUser(c echo.Context) error {
+	reservations, statusCode, err := h.getReservationsByUser(c.Request().Context(), auth.GetUser(c.Request().Context()), rentedStatus)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.JSON(statusCode, echo.Map{"message": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	booksUids := make([]string, 0, len(reservations))
+	librariesUids := make([]string, 0, len(reservations))
+	for _, r := range reservations {
+		booksUids = append(booksUids, r.BookUid)
+		librariesUids = append(librariesUids, r.LibraryUid)
+	}
+
+	booksMap, err := h.getBooksByUids(c.Request().Context(), booksUids)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	librariesMap, err := h.getLibrariesByUids(c.Request().Context(), librariesUids)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	type reservationExtended struct {
+		ReservationUid string      `json:"reservationUid"`
+		Status         string      `json:"status"`
+		StartDate      string      `json:"startDate"`
+		TillDate       string      `json:"tillDate"`
+		Book           bookResp    `json:"book"`
+		Library        libraryResp `json:"library"`
+	}
+
+	reservationsExtended := make([]reservationExtended, 0, len(reservations))
+	for _, r := range reservations {
+		reservationsExtended = append(reservationsExtended, reservationExtended{
+			ReservationUid: r.ReservationUid,
+			Status:         r.Status,
+			StartDate:      r.StartDate,
+			TillDate:       r.TillDate,
+			Book:           booksMap[r.BookUid],
+			Library:        librariesMap[r.LibraryUid],
+		})
+	}
+
+	return c.JSON(http.StatusOK, reservationsExtended)
+}
+
+// getReservationDetails fetches the books and the libraries of the reservations, each of them once and
+// detailsBatchSize at a time.
+func (h *handler) getReservationDetails(ctx context.Context, reservations []reservationResp) (map[string]bookResp, map[string]libraryResp, error) {
+	booksUids := make([]string, 0, len(reservations))
+	librariesUids := make([]string, 0, len(reservations))
+	seen := map[string]bool{}
+	for _, r := range reservations {
+		if !seen[r.BookUid] {
+			seen[r.BookUid] = true
+			booksUids = append(booksUids, r.BookUid)
+		}
+		if !seen[r.LibraryUid] {
+			seen[r.LibraryUid] = true
+			librariesUids = append(librariesUids, r.LibraryUid)
+		}
+	}
+
+	booksMap := map[string]bookResp{}
+	for start := 0; start < len(booksUids); start += detailsBatchSize {
+		batch, err := h.getBooksByUids(ctx, booksUids[start:min(start+detailsBatchSize, len(booksUids))])
+		if err != nil {
+			return nil, nil, err
+		}
+		for uid, book := range batch {
+			booksMap[uid] = book
+		}
+	}
+
+	librariesMap := map[string]libraryResp{}
+	for start := 0; start < len(librariesUids); start += detailsBatchSize {
+		batch, err := h.getLibrariesByUids(ctx, librariesUids[start:min(start+detailsBatchSize, len(librariesUids))])
+		if err != nil {
+			return nil, nil, err
+		}
+		for uid, library := range batch {
+			librariesMap[uid] = library
+		}
+	}
+
+	return booksMap, librariesMap, nil
+}
+
+// GetReservationHistoryByUser returns a page of all reservations of the reader with their books and libraries.
+// Filters and sorting are the ones of reservation-system: status, from, to, libraryUid and sort.
+func (h *handler) GetReservationHistoryByUser(c echo.Context) error {
+	queryParams := url.Values{}
+	for _, name := range []string{"page", "size", "from", "to", "libraryUid", "sort"} {
+		if value := c.QueryParam(name); value != "" {
+			queryParams.Add(name, value)
+		}
+	}
+	for _, status := range c.QueryParams()["status"] {
+		queryParams.Add("status", status)
+	}
+
+	statusCode, body, err := h.getFromReservationSystem(c.Request().Context(),
+		"/reservations/by-user/"+url.PathEscape(auth.GetUser(c.Request().Context()))+"/history", queryParams)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Reservation Service unavailable"})
+	}
+
+	history := struct {
+		Page          int               `json:"page"`
+		PageSize      int               `json:"pageSize"`
+		TotalElements int               `json:"totalElements"`
+		Items         []reservationResp `json:"items"`
+	}{}
+	err = json.Unmarshal(body, &history)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	booksMap, librariesMap, err := h.getReservationDetails(c.Request().Context(), history.Items)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	type reservationExtended struct {
+		ReservationUid string      `json:"reservationUid"`
+		Status         string      `json:"status"`
+		StartDate      string      `json:"startDate"`
+		TillDate       string      `json:"tillDate"`
+		Renewals       int         `json:"renewals"`
+		Book           bookResp    `json:"book"`
+		Library        libraryResp `json:"library"`
+	}
+	type response struct {
+		Page          int                   `json:"page"`
+		PageSize      int                   `json:"pageSize"`
+		TotalElements int                   `json:"totalElements"`
+		Items         []reservationExtended `json:"items"`
+	}
+
+	items := make([]reservationExtended, 0, len(history.Items))
+	for _, r := range history.Items {
+		items = append(items, reservationExtended{
+			ReservationUid: r.ReservationUid,
+			Status:         r.Status,
+			StartDate:      r.StartDate,
+			TillDate:       r.TillDate,
+			Renewals:       r.Renewals,
+			Book:           booksMap[r.BookUid],
+			Library:        librariesMap[r.LibraryUid],
+		})
+	}
+
+	return c.JSON(http.StatusOK, response{
+		Page:          history.Page,
+		PageSize:      history.PageSize,
+		TotalElements: history.TotalElements,
+		Items:         items,
+	})
+}
+
+// provisionUser gets or creates the rating record, the rating service answers 201 for a new reader and 200 otherwise.
+func (h *handler) provisionUser(ctx context.Context, userName string) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPut, h.config.RatingSystemURL+"/rating/"+userName, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+func (h *handler) createReservation(ctx context.Context, reqBody []byte, userName string) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, h.config.ReservationSystemURL+"/reservations/", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, nil, err
+	}
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, errors.Join(err, fmt.Errorf("%s", string(body)))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+type reservationReq struct {
+	BookUid    string `json:"bookUid" validate:"required,uuid"`
+	LibraryUid string `json:"libraryUid" validate:"required,uuid"`
+	StartDate  string `json:"startDate"`
+	TillDate   string `json:"tillDate"`
+}
+
+// validateReservationRequest checks a new reservation field by field: uids must be UUIDs of a library and a book
+// library-system knows, the start date must fall within a year from today, today when it is left out, and
+// the due date within a year after the start.
+func (h *handler) validateReservationRequest(c echo.Context, reqData reservationReq) (my_time.Date, my_time.Date, []validation.FieldError, error) {
+	fieldErrors := validation.FieldErrors(c.Validate(reqData))
+	var tillDate my_time.Date
+	startDate, dateErr := validation.DateFrom("startDate", reqData.StartDate, my_time.Today(time.UTC), maxReservationDays)
+	if dateErr == nil {
+		tillDate, dateErr = validation.DateWindow("tillDate", reqData.TillDate, startDate, maxReservationDays)
+	}
+	if dateErr != nil {
+		fieldErrors = append(fieldErrors, *dateErr)
+	}
+	if len(fieldErrors) > 0 {
+		return my_time.Date{}, my_time.Date{}, fieldErrors, nil
+	}
+
+	libraries, err := h.getLibrariesByUids(c.Request().Context(), []string{reqData.LibraryUid})
+	if err != nil {
+		return my_time.Date{}, my_time.Date{}, nil, err
+	}
+	if _, ok := libraries[reqData.LibraryUid]; !ok {
+		fieldErrors = append(fieldErrors, validation.FieldError{Field: "libraryUid", Message: "library not found"})
+	}
+
+	books, err := h.getBooksByUids(c.Request().Context(), []string{reqData.BookUid})
+	if err != nil {
+		return my_time.Date{}, my_time.Date{}, nil, err
+	}
+	if _, ok := books[reqData.BookUid]; !ok {
+		fieldErrors = append(fieldErrors, validation.FieldError{Field: "bookUid", Message: "book not found"})
+	}
+
+	return startDate, tillDate, fieldErrors, nil
+}
+
+func (h *handler) ReserveBookByUser(c echo.Context) error {
+	reqBody, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
+	}
+
+	reqData := reservationReq{}
+	err = json.Unmarshal(reqBody, &reqData)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
+	}
+
+	// the request is checked before any service is called, the same way the reservation service checks it
+	startDate, tillDate, fieldErrors, err := h.validateReservationRequest(c, reqData)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Library Service unavailable"})
+	}
+	if len(fieldErrors) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "request is invalid", "errors": fieldErrors})
+	}
+
+	reservations, statusCode, err := h.getReservationsByUser(c.Request().Context(), auth.GetUser(c.Request().Context()), rentedStatus)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.JSON(statusCode, echo.Map{"message": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	bookings, statusCode, err := h.getReservationsByUser(c.Request().Context(), auth.GetUser(c.Request().Context()), bookedStatus)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.JSON(statusCode, echo.Map{"message": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	// bookings overlapping the new one hold books at the same time and count towards the limits like loans
+	reservations = append(reservations, overlapping(bookings, startDate, tillDate)...)
+
+	finesBalance, statusCode, err := h.getFinesBalance(c.Request().Context(), auth.GetUser(c.Request().Context()))
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.JSON(statusCode, echo.Map{"message": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	if finesBalance > h.config.MaxUnpaidFines {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "unpaid fines over limit"})
+	}
+
+	// the rating service creates the reader when it is not found
+	statusCode, body, err := h.provisionUser(c.Request().Context(), auth.GetUser(c.Request().Context()))
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	}
+
+	// the rating policy sets the reservation limit, the rating service answers whether one more book may be reserved
+	statusCode, body, err = h.reportRatingEvent(c.Request().Context(), auth.GetUser(c.Request().Context()), ratingEventReq{
+		Type:         reserveEvent,
+		Reservations: len(reservations),
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	}
+
+	reserveOutcome := ratingEventResp{}
+	err = json.Unmarshal(body, &reserveOutcome)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	if !reserveOutcome.Allowed {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": reserveOutcome.Reason})
+	}
+	stars := reserveOutcome.Stars
+
+	statusCode, body, err = h.getTier(c.Request().Context(), auth.GetUser(c.Request().Context()))
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	}
+
+	userTier := tierResp{}
+	err = json.Unmarshal(body, &userTier)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	if len(reservations) >= userTier.MaxLoans {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": fmt.Sprintf("%s tier allows at most %d loans", userTier.Name, userTier.MaxLoans)})
+	}
+
+	// the loan length is counted from the start of the reservation rather than from today
+	if tillDate.Sub(startDate) > userTier.MaxLoanDays {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": fmt.Sprintf("%s tier allows loans of at most %d days", userTier.Name, userTier.MaxLoanDays)})
+	}
+
+	policy, statusCode, body, err := h.getLendingPolicy(c.Request().Context(), reqData.LibraryUid, reqData.BookUid)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	if reasons := policy.checkReserve(reservations, reqData.LibraryUid, startDate, tillDate); len(reasons) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "reservation is not allowed by the library lending policy", "reasons": reasons})
+	}
+
+	statusCode, body, err = h.createReservation(c.Request().Context(), reqBody, auth.GetUser(c.Request().Context()))
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	type createReservationResp struct {
+		ReservationUid string `json:"reservationUid"`
+		Status         string `json:"status"`
+		StartDate      string `json:"startDate"`
+		TillDate       string `json:"tillDate"`
+		BookUid        string `json:"bookUid"`
+		LibraryUid     string `json:"libraryUid"`
+	}
+
+	createdReservation := createReservationResp{}
+	err = json.Unmarshal(body, &createdReservation)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	// a copy for a future booking is lent at the desk on its start date
+	lentCopy := copyResp{}
+	if createdReservation.Status != bookedStatus {
+		statusCode, body, err = h.checkoutCopy(c.Request().Context(), createdReservation.LibraryUid, createdReservation.BookUid, createdReservation.ReservationUid, "")
+		if err != nil {
+			log.Err(err).Msg("failed to process request to library service")
+			h.cancelReservation(c.Request().Context(), createdReservation.ReservationUid, auth.GetUser(c.Request().Context()))
+			if errors.Is(err, errNotOkStatusCode) {
+				return c.String(statusCode, string(body))
+			}
+			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+		}
+
+		err = json.Unmarshal(body, &lentCopy)
+		if err != nil {
+			log.Err(err).Msg("failed to process request to library service")
+			h.cancelReservation(c.Request().Context(), createdReservation.ReservationUid, auth.GetUser(c.Request().Context()))
+			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+		}
+
+		statusCode, body, err = h.setReservationCopy(c.Request().Context(), createdReservation.ReservationUid, lentCopy.Barcode)
+		if err != nil {
+			log.Err(err).Msg("failed to process request to reservation service")
+			h.takeBackCopy(c.Request().Context(), lentCopy.Barcode)
+			h.cancelReservation(c.Request().Context(), createdReservation.ReservationUid, auth.GetUser(c.Request().Context()))
+			if errors.Is(err, errNotOkStatusCode) {
+				return c.String(statusCode, string(body))
+			}
+			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+		}
+	}
+
+	type response struct {
+		ReservationUid string      `json:"reservationUid"`
+		Status         string      `json:"status"`
+		StartDate      string      `json:"startDate"`
+		TillDate       string      `json:"tillDate"`
+		CopyBarcode    string      `json:"copyBarcode,omitempty"`
+		Book           bookResp    `json:"book"`
+		Library        libraryResp `json:"library"`
+		Rating         struct {
+			Stars int `json:"stars"`
+		} `json:"rating"`
+	}
+
+	books, err := h.getBooksByUids(c.Request().Context(), []string{createdReservation.BookUid})
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	libraries, err := h.getLibrariesByUids(c.Request().Context(), []string{createdReservation.LibraryUid})
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	return c.JSON(http.StatusOK, response{
+		ReservationUid: createdReservation.ReservationUid,
+		Status:         createdReservation.Status,
+		StartDate:      createdReservation.StartDate,
+		TillDate:       createdReservation.TillDate,
+		CopyBarcode:    lentCopy.Barcode,
+		Book:           books[createdReservation.BookUid],
+		Library:        libraries[createdReservation.LibraryUid],
+		Rating: struct {
+			Stars int `json:"stars"`
+		}{
+			Stars: stars,
+		},
+	})
+}
+
+func (h *handler) updateAvailableCount(ctx context.Context, libraryUid, bookUid string, countDiff int, reason string) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPut, h.config.LibrarySystemURL+"/libraries/"+libraryUid+"/books/"+bookUid+
+		"?countDiff="+strconv.Itoa(countDiff)+"&reason="+reason, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// the gateway changes the count itself on return, readers are not allowed to
+	if err = h.setServiceToken(ctx, req); err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+type copyResp struct {
+	Barcode        string `json:"barcode"`
+	LibraryUid     string `json:"libraryUid"`
+	BookUid        string `json:"bookUid"`
+	Condition      string `json:"condition"`
+	Status         string `json:"status"`
+	ReservationUid string `json:"reservationUid"`
+}
+
+// checkoutCopy lends a copy for the reservation, an empty barcode lets the library pick any available copy.
+func (h *handler) checkoutCopy(ctx context.Context, libraryUid, bookUid, reservationUid, barcode string) (int, []byte, error) {
+	reqBody, err := json.Marshal(struct {
+		ReservationUid string `json:"reservationUid"`
+		Barcode        string `json:"barcode,omitempty"`
+	}{ReservationUid: reservationUid, Barcode: barcode})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.config.LibrarySystemURL+"/libraries/"+libraryUid+"/books/"+bookUid+"/checkout", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err = h.setStaffToken(ctx, req); err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+func (h *handler) returnCopy(ctx context.Context, barcode, condition string) (int, []byte, error) {
+	reqBody, err := json.Marshal(struct {
+		Condition string `json:"condition,omitempty"`
+	}{Condition: condition})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.config.LibrarySystemURL+"/copies/"+url.PathEscape(barcode)+"/return", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err = h.setStaffToken(ctx, req); err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+func (h *handler) renewReservation(ctx context.Context, reservationUid string, reqBody []byte) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, h.config.ReservationSystemURL+"/reservations/"+reservationUid+"/renew", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = h.setServiceToken(ctx, req); err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// RenewBookByUser extends a reservation, the due date is limited by the tier of the reader as when reserving
+// and the loan length and the number of renewals by the lending policy of the library. When the library is
+// closed on the new due date, the reservation service moves it to the next business day.
+func (h *handler) RenewBookByUser(c echo.Context) error {
+	reqBody, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
+	}
+
+	reqData := struct {
+		TillDate string `json:"tillDate"`
+	}{}
+	err = json.Unmarshal(reqBody, &reqData)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
+	}
+
+	tillDate, err := my_time.NewDate(reqData.TillDate)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "tillDate is wrong"})
+	}
+
+	statusCode, body, err := h.getTier(c.Request().Context(), auth.GetUser(c.Request().Context()))
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	}
+
+	userTier := tierResp{}
+	err = json.Unmarshal(body, &userTier)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	today := my_time.Today(time.UTC)
+	if tillDate.Sub(today) > userTier.MaxLoanDays {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": fmt.Sprintf("%s tier allows loans of at most %d days", userTier.Name, userTier.MaxLoanDays)})
+	}
+
+	statusCode, body, err = h.getReservationsByUid(c.Request().Context(), c.Param("reservationUid"))
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	reservation := reservationResp{}
+	err = json.Unmarshal(body, &reservation)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	// a reservation of another reader is not disclosed through the rules of its library
+	if reservation.UserName != auth.GetUser(c.Request().Context()) {
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "reservation not found"})
+	}
+
+	policy, statusCode, body, err := h.getLendingPolicy(c.Request().Context(), reservation.LibraryUid, reservation.BookUid)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	if reasons := policy.checkRenew(reservation, today, *tillDate); len(reasons) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "renewal is not allowed by the library lending policy", "reasons": reasons})
+	}
+
+	statusCode, body, err = h.renewReservation(c.Request().Context(), c.Param("reservationUid"), reqBody)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
+
+func (h *handler) setReservationCopy(ctx context.Context, reservationUid, barcode string) (int, []byte, error) {
+	reqBody, err := json.Marshal(struct {
+		CopyBarcode string `json:"copyBarcode"`
+	}{CopyBarcode: barcode})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, h.config.ReservationSystemURL+"/reservations/"+reservationUid+"/copy", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = h.setStaffToken(ctx, req); err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -433,12 +1632,14 @@ func (h *handler) createUser(ctx context.Context, userName string) (int, []byte,
 	return resp.StatusCode, body, nil
 }
 
-func (h *handler) createReservation(ctx context.Context, reqBody []byte, userName string) (int, []byte, error) {
-	req, err := http.NewRequest(http.MethodPost, h.config.ReservationSystemURL+"/reservations/", bytes.NewBuffer(reqBody))
+func (h *handler) updateReservationStatus(ctx context.Context, reservationUid, status, username string) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPut, h.config.ReservationSystemURL+"/reservations/"+reservationUid+"/status?status="+status, nil)
 	if err != nil {
 		return 0, nil, err
 	}
-	h.setToken(ctx, req)
+	if err = h.setStaffToken(ctx, req); err != nil {
+		return 0, nil, err
+	}
 
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
@@ -447,7 +1648,7 @@ func (h *handler) createReservation(ctx context.Context, reqBody []byte, userNam
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return resp.StatusCode, nil, errors.Join(err, fmt.Errorf("%s", string(body)))
+		return resp.StatusCode, nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -457,152 +1658,512 @@ func (h *handler) createReservation(ctx context.Context, reqBody []byte, userNam
 	return resp.StatusCode, body, nil
 }
 
-func (h *handler) ReserveBookByUser(c echo.Context) error {
-	reservations, statusCode, err := h.getReservationsByUser(c.Request().Context(), auth.GetUser(c.Request().Context()))
+// cancelReservation undoes a reservation whose copy could not be lent, so it holds no stock and does not count
+// against the reader. A failure is only logged, the reconcile job reports the loan left without a copy.
+func (h *handler) cancelReservation(ctx context.Context, reservationUid, username string) {
+	_, body, err := h.updateReservationStatus(ctx, reservationUid, canceledStatus, username)
+	if err != nil {
+		log.Err(err).Str("reservationUid", reservationUid).Str("response", string(body)).Msg("failed to cancel reservation")
+	}
+}
+
+// takeBackCopy returns a lent copy whose reservation could not record it. A failure is only logged, the reconcile
+// job returns the orphaned copy.
+func (h *handler) takeBackCopy(ctx context.Context, barcode string) {
+	_, body, err := h.returnCopy(ctx, barcode, "")
+	if err != nil {
+		log.Err(err).Str("barcode", barcode).Str("response", string(body)).Msg("failed to take back copy")
+	}
+}
+
+type ratingEventReq struct {
+	Type           string `json:"type"`
+	ReservationUid string `json:"reservationUid,omitempty"`
+	DaysLate       int    `json:"daysLate"`
+	Condition      string `json:"condition,omitempty"`
+	Reservations   int    `json:"reservations"`
+}
+
+type ratingEventResp struct {
+	Stars   int    `json:"stars"`
+	Delta   int    `json:"delta"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+func (h *handler) reportRatingEvent(ctx context.Context, username string, event ratingEventReq) (int, []byte, error) {
+	reqBody, err := json.Marshal(event)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.config.RatingSystemURL+"/rating/"+username+"/events", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err = h.setServiceToken(ctx, req); err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// ReturnBookByUser closes a loan or cancels a booking of the reader. Reservations of other readers are not
+// found, librarians return books of any reader at the desk.
+func (h *handler) ReturnBookByUser(c echo.Context) error {
+	statusCode, body, err := h.getReservationsByUid(c.Request().Context(), c.Param("reservationUid"))
 	if err != nil {
 		log.Err(err).Msg("failed to process request to reservation service")
 		if errors.Is(err, errNotOkStatusCode) {
-			return c.JSON(statusCode, echo.Map{"message": err.Error()})
+			return c.String(statusCode, string(body))
 		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	statusCode, body, err := h.getRatingByUser(c.Request().Context(), auth.GetUser(c.Request().Context()))
-	if err != nil && !errors.Is(err, errNotOkStatusCode) {
-		log.Err(err).Msg("failed to process request to rating service")
-		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	reservation := reservationResp{}
+	err = json.Unmarshal(body, &reservation)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	// a reservation of another reader looks the same as a missing one
+	if reservation.UserName != auth.GetUser(c.Request().Context()) {
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "reservation not found"})
+	}
+
+	type req struct {
+		Condition string `json:"condition"`
+		Date      string `json:"date"`
+	}
+
+	reqBody, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
 	}
 
-	if statusCode != http.StatusOK && statusCode != http.StatusNotFound {
-		return c.String(statusCode, string(body))
+	reqData := req{}
+	err = json.Unmarshal(reqBody, &reqData)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
 	}
 
-	stars := 0
-	// если пользователь не найден, создаем его
-	if statusCode == http.StatusNotFound {
-		statusCode, body, err = h.createUser(c.Request().Context(), auth.GetUser(c.Request().Context()))
+	// a booking that is not lent yet is just canceled: it has no copy and can not be late
+	if reservation.Status == bookedStatus {
+		statusCode, body, err = h.updateReservationStatus(c.Request().Context(), reservation.ReservationUid, canceledStatus, auth.GetUser(c.Request().Context()))
 		if err != nil {
-			log.Err(err).Msg("failed to process request to rating service")
+			log.Err(err).Msg("failed to process request to reservation service")
 			if errors.Is(err, errNotOkStatusCode) {
 				return c.String(statusCode, string(body))
 			}
 			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 		}
-		type createUserResp struct {
-			ID       int    `json:"id"`
-			UserName string `json:"userName"`
-			Stars    int    `json:"stars"`
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	return h.closeReservation(c, reservation, auth.GetUser(c.Request().Context()), reqData.Condition, reqData.Date)
+}
+
+// getLibraryCalendar returns the business days of the library for a year from the day. When library-system
+// cannot tell, every day is a business day in UTC, as it was before libraries kept a schedule.
+func (h *handler) getLibraryCalendar(ctx context.Context, libraryUid string, from my_time.Date) *my_time.Calendar {
+	queryParams := url.Values{}
+	queryParams.Add("from", from.String())
+	queryParams.Add("to", from.AddDays(calendarDays).String())
+
+	calendar := &my_time.Calendar{}
+	_, body, err := h.getFromLibrarySystem(ctx, "/libraries/"+url.PathEscape(libraryUid)+"/calendar", queryParams)
+	if err == nil {
+		err = json.Unmarshal(body, calendar)
+	}
+	if err != nil {
+		log.Err(err).Str("libraryUid", libraryUid).Msg("failed to get library calendar")
+		return my_time.NewCalendar(time.UTC, nil, nil)
+	}
+
+	return calendar
+}
+
+// lendingPolicyResp holds the rules of the library for a book, a nil rule is not limited.
+type lendingPolicyResp struct {
+	MaxLoanDays        *int `json:"maxLoanDays"`
+	MaxRenewals        *int `json:"maxRenewals"`
+	MaxConcurrentLoans *int `json:"maxConcurrentLoans"`
+	GraceDays          *int `json:"graceDays"`
+}
+
+func (h *handler) getLendingPolicy(ctx context.Context, libraryUid, bookUid string) (lendingPolicyResp, int, []byte, error) {
+	statusCode, body, err := h.getFromLibrarySystem(ctx, "/libraries/"+url.PathEscape(libraryUid)+
+		"/books/"+url.PathEscape(bookUid)+"/policy", url.Values{})
+	if err != nil {
+		return lendingPolicyResp{}, statusCode, body, err
+	}
+
+	policy := lendingPolicyResp{}
+	err = json.Unmarshal(body, &policy)
+	if err != nil {
+		return lendingPolicyResp{}, statusCode, body, err
+	}
+
+	return policy, statusCode, body, nil
+}
+
+func (p lendingPolicyResp) checkLoanDays(today, tillDate my_time.Date) []string {
+	if p.MaxLoanDays != nil && tillDate.Sub(today) > *p.MaxLoanDays {
+		return []string{fmt.Sprintf("the library lends this book for at most %d days", *p.MaxLoanDays)}
+	}
+	return nil
+}
+
+// overlapping returns the bookings whose dates meet the range from startDate to tillDate. A booking with dates
+// that can not be parsed is counted as overlapping.
+func overlapping(bookings []reservationResp, startDate, tillDate my_time.Date) []reservationResp {
+	res := make([]reservationResp, 0, len(bookings))
+	for _, b := range bookings {
+		bookingStart, startErr := my_time.NewDate(b.StartDate)
+		bookingTill, tillErr := my_time.NewDate(b.TillDate)
+		if startErr == nil && tillErr == nil && (bookingStart.After(tillDate) || bookingTill.Before(startDate)) {
+			continue
+		}
+		res = append(res, b)
+	}
+	return res
+}
+
+// checkReserve returns the reasons the policy rejects a new loan, loans are the rented reservations of the reader
+// and the bookings overlapping the new one.
+func (p lendingPolicyResp) checkReserve(loans []reservationResp, libraryUid string, today, tillDate my_time.Date) []string {
+	reasons := p.checkLoanDays(today, tillDate)
+
+	if p.MaxConcurrentLoans != nil {
+		count := 0
+		for _, l := range loans {
+			if l.LibraryUid == libraryUid {
+				count++
+			}
+		}
+		if count >= *p.MaxConcurrentLoans {
+			reasons = append(reasons, fmt.Sprintf("the library allows at most %d books on loan at once, you have %d", *p.MaxConcurrentLoans, count))
+		}
+	}
+
+	return reasons
+}
+
+// checkRenew returns the reasons the policy rejects moving the due date of the reservation to tillDate.
+func (p lendingPolicyResp) checkRenew(reservation reservationResp, today, tillDate my_time.Date) []string {
+	reasons := p.checkLoanDays(today, tillDate)
+
+	if p.MaxRenewals != nil && reservation.Renewals >= *p.MaxRenewals {
+		if *p.MaxRenewals == 0 {
+			reasons = append(reasons, "the library does not renew loans of this book")
+		} else {
+			reasons = append(reasons, fmt.Sprintf("all renewals the library allows for this book are used (%d)", *p.MaxRenewals))
 		}
-		createdUser := createUserResp{}
-		err = json.Unmarshal(body, &createdUser)
+	}
+
+	return reasons
+}
+
+func (p lendingPolicyResp) graceDays() int {
+	if p.GraceDays == nil {
+		return 0
+	}
+	return *p.GraceDays
+}
+
+// closeReservation finishes a loan for the reader: the reservation is closed, a late return is fined,
+// the copy goes back on the shelf and the rating service learns about the return. Lateness is counted
+// in business days of the library, an empty date is today in its time zone.
+func (h *handler) closeReservation(c echo.Context, reservation reservationResp, username, condition, date string) error {
+	targetStatus := returnedStatus
+	tillDate, err := my_time.NewDate(reservation.TillDate)
+	if err != nil {
+		log.Err(err).Msg("failed to parse till date")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	calendar := h.getLibraryCalendar(c.Request().Context(), reservation.LibraryUid, *tillDate)
+	if date == "" {
+		date = calendar.Today().String()
+	}
+	reqDate, err := my_time.NewDate(date)
+	if err != nil {
+		log.Err(err).Msg("failed to parse date")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+	daysLate := calendar.DaysOverdue(*tillDate, *reqDate)
+
+	// the grace period of the library is not overdue, without a policy there is none
+	graceDays := 0
+	if daysLate > 0 {
+		policy, _, _, err := h.getLendingPolicy(c.Request().Context(), reservation.LibraryUid, reservation.BookUid)
 		if err != nil {
-			log.Err(err).Msg("failed to process request to rating service")
-			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+			log.Err(err).Str("libraryUid", reservation.LibraryUid).Msg("failed to get lending policy")
 		}
-		stars = createdUser.Stars
+		graceDays = policy.graceDays()
+	}
+
+	daysLate -= graceDays
+	if daysLate > 0 {
+		targetStatus = expiredStatus
 	} else {
-		type ratingResp struct {
-			Stars int `json:"stars"`
+		daysLate = 0
+	}
+
+	statusCode, body, err := h.updateReservationStatus(c.Request().Context(), reservation.ReservationUid, targetStatus, username)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
 		}
-		rating := ratingResp{}
-		err = json.Unmarshal(body, &rating)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	if targetStatus == expiredStatus {
+		statusCode, body, err = h.accrueFine(c.Request().Context(), reservation.ReservationUid, date)
 		if err != nil {
-			log.Err(err).Msg("failed to process request to rating service")
+			log.Err(err).Msg("failed to process request to reservation service")
+			if errors.Is(err, errNotOkStatusCode) {
+				return c.String(statusCode, string(body))
+			}
 			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 		}
-		stars = rating.Stars
 	}
 
-	// количество текущих бронирований + 1 (которое сейчас хочет сделать пользователь) не должно превышать количество звезд (макс. количество одновременных бронирований)
-	if len(reservations)+1 > stars {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "reservations over limit"})
+	// reservations made before copies were tracked do not know their copy, the book comes back as a new copy
+	if reservation.CopyBarcode != "" {
+		statusCode, body, err = h.returnCopy(c.Request().Context(), reservation.CopyBarcode, condition)
+	} else {
+		statusCode, body, err = h.updateAvailableCount(c.Request().Context(), reservation.LibraryUid, reservation.BookUid, 1, returnReason)
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	statusCode, body, err = h.reportRatingEvent(c.Request().Context(), username, ratingEventReq{
+		Type:           returnEvent,
+		ReservationUid: reservation.ReservationUid,
+		DaysLate:       daysLate,
+		Condition:      condition,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *handler) getRatingByUser(ctx context.Context, userName string) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, h.config.RatingSystemURL+"/rating/"+userName, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil, errors.Join(errNotOkStatusCode, fmt.Errorf("status code = %d", resp.StatusCode))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+type tierResp struct {
+	Name        string `json:"name"`
+	MaxLoans    int    `json:"maxLoans"`
+	MaxLoanDays int    `json:"maxLoanDays"`
+}
+
+func (h *handler) getTier(ctx context.Context, userName string) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, h.config.RatingSystemURL+"/rating/"+userName+"/tier", nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	h.setToken(ctx, req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, body, errNotOkStatusCode
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+func (h *handler) GetTierByUser(c echo.Context) error {
+	statusCode, body, err := h.getTier(c.Request().Context(), auth.GetUser(c.Request().Context()))
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		if errors.Is(err, errNotOkStatusCode) {
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	}
+
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
+
+func (h *handler) SetLeaderboardOptInByUser(c echo.Context) error {
+	req, err := http.NewRequest(http.MethodPut, h.config.RatingSystemURL+"/rating/"+auth.GetUser(c.Request().Context())+"/leaderboard", c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to process request"})
+	}
+
+	h.setToken(c.Request().Context(), req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	reqBody, err := io.ReadAll(c.Request().Body)
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(resp.StatusCode, string(body))
+}
+
+func (h *handler) GetLeaderboard(c echo.Context) error {
+	reqURL, err := url.Parse(h.config.RatingSystemURL + "/leaderboard")
 	if err != nil {
-		log.Err(err).Msg("failed to parse request")
+		log.Err(err).Msg("failed to parse request to rating service")
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
 	}
 
-	statusCode, body, err = h.createReservation(c.Request().Context(), reqBody, auth.GetUser(c.Request().Context()))
+	if size := c.QueryParam("size"); size != "" {
+		queryParams := url.Values{}
+		queryParams.Add("size", size)
+		reqURL.RawQuery = queryParams.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
 	if err != nil {
-		log.Err(err).Msg("failed to process request to reservation service")
-		if errors.Is(err, errNotOkStatusCode) {
-			return c.String(statusCode, string(body))
-		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to process request"})
 	}
 
-	type createReservationResp struct {
-		ReservationUid string `json:"reservationUid"`
-		Status         string `json:"status"`
-		StartDate      string `json:"startDate"`
-		TillDate       string `json:"tillDate"`
-		BookUid        string `json:"bookUid"`
-		LibraryUid     string `json:"libraryUid"`
+	h.setToken(c.Request().Context(), req)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
 	}
 
-	createdReservation := createReservationResp{}
-	err = json.Unmarshal(body, &createdReservation)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Err(err).Msg("failed to process request to reservation service")
+		log.Err(err).Msg("failed to process request to rating service")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	statusCode, body, err = h.updateAvailableCount(c.Request().Context(), createdReservation.LibraryUid, createdReservation.BookUid, -1)
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(resp.StatusCode, string(body))
+}
+
+func (h *handler) GetRatingByUser(c echo.Context) error {
+	statusCode, body, err := h.getRatingByUser(c.Request().Context(), auth.GetUser(c.Request().Context()))
 	if err != nil {
-		log.Err(err).Msg("failed to process request to library service")
+		log.Err(err).Msg("failed to process request to rating service")
 		if errors.Is(err, errNotOkStatusCode) {
 			return c.String(statusCode, string(body))
 		}
-		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
 	}
 
-	type response struct {
-		ReservationUid string      `json:"reservationUid"`
-		Status         string      `json:"status"`
-		StartDate      string      `json:"startDate"`
-		TillDate       string      `json:"tillDate"`
-		Book           bookResp    `json:"book"`
-		Library        libraryResp `json:"library"`
-		Rating         struct {
-			Stars int `json:"stars"`
-		} `json:"rating"`
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
+
+func (h *handler) GetRatingHistoryByUser(c echo.Context) error {
+	queryParams := url.Values{}
+	queryParams.Add("page", c.QueryParam("page"))
+	queryParams.Add("size", c.QueryParam("size"))
+	reqURL, err := url.Parse(h.config.RatingSystemURL + "/rating/" + auth.GetUser(c.Request().Context()) + "/history")
+	if err != nil {
+		log.Err(err).Msg("failed to parse request to rating service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
 	}
 
-	books, err := h.getBooksByUids(c.Request().Context(), []string{createdReservation.BookUid})
+	reqURL.RawQuery = queryParams.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
 	if err != nil {
-		log.Err(err).Msg("failed to process request to library service")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to process request"})
 	}
 
-	libraries, err := h.getLibrariesByUids(c.Request().Context(), []string{createdReservation.LibraryUid})
+	h.setToken(c.Request().Context(), req)
+
+	resp, err := h.httpClient.Do(req)
 	if err != nil {
-		log.Err(err).Msg("failed to process request to library service")
+		log.Err(err).Msg("failed to process request to rating service")
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to rating service")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	return c.JSON(http.StatusOK, response{
-		ReservationUid: createdReservation.ReservationUid,
-		Status:         createdReservation.Status,
-		StartDate:      createdReservation.StartDate,
-		TillDate:       createdReservation.TillDate,
-		Book:           books[createdReservation.BookUid],
-		Library:        libraries[createdReservation.LibraryUid],
-		Rating: struct {
-			Stars int `json:"stars"`
-		}{
-			Stars: stars,
-		},
-	})
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(resp.StatusCode, string(body))
 }
 
-func (h *handler) updateAvailableCount(ctx context.Context, libraryUid, bookUid string, countDiff int) (int, []byte, error) {
-	req, err := http.NewRequest(http.MethodPut, h.config.LibrarySystemURL+"/libraries/"+libraryUid+"/books/"+bookUid+"?countDiff="+strconv.Itoa(countDiff), nil)
+func (h *handler) getFines(ctx context.Context, userName string) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, h.config.ReservationSystemURL+"/fines/"+userName, nil)
 	if err != nil {
 		return 0, nil, err
 	}
-
 	h.setToken(ctx, req)
 
 	resp, err := h.httpClient.Do(req)
@@ -622,37 +2183,43 @@ func (h *handler) updateAvailableCount(ctx context.Context, libraryUid, bookUid
 	return resp.StatusCode, body, nil
 }
 
-func (h *handler) updateReservationStatus(ctx context.Context, reservationUid, status, username string) (int, []byte, error) {
-	req, err := http.NewRequest(http.MethodPut, h.config.ReservationSystemURL+"/reservations/"+reservationUid+"/status?status="+status, nil)
+func (h *handler) getFinesBalance(ctx context.Context, userName string) (int, int, error) {
+	statusCode, body, err := h.getFines(ctx, userName)
 	if err != nil {
-		return 0, nil, err
+		return 0, statusCode, err
 	}
-	h.setToken(ctx, req)
 
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return 0, nil, err
+	type finesResp struct {
+		Balance int `json:"balance"`
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	fines := finesResp{}
+	err = json.Unmarshal(body, &fines)
 	if err != nil {
-		return resp.StatusCode, nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return resp.StatusCode, body, errNotOkStatusCode
+		return 0, statusCode, err
 	}
 
-	return resp.StatusCode, body, nil
+	return fines.Balance, statusCode, nil
 }
 
-func (h *handler) updateUserRating(ctx context.Context, username string, starsDiff int) (int, []byte, error) {
-	req, err := http.NewRequest(http.MethodPut, h.config.RatingSystemURL+"/rating/"+username+"?starsDiff="+strconv.Itoa(starsDiff), nil)
+func (h *handler) accrueFine(ctx context.Context, reservationUid, date string) (int, []byte, error) {
+	type accrueFineReq struct {
+		ReservationUid string `json:"reservationUid"`
+		Date           string `json:"date"`
+	}
+
+	reqBody, err := json.Marshal(accrueFineReq{ReservationUid: reservationUid, Date: date})
 	if err != nil {
 		return 0, nil, err
 	}
 
-	h.setToken(ctx, req)
+	req, err := http.NewRequest(http.MethodPost, h.config.ReservationSystemURL+"/fines/accrue", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = h.setServiceToken(ctx, req); err != nil {
+		return 0, nil, err
+	}
 
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
@@ -671,8 +2238,8 @@ func (h *handler) updateUserRating(ctx context.Context, username string, starsDi
 	return resp.StatusCode, body, nil
 }
 
-func (h *handler) ReturnBookByUser(c echo.Context) error {
-	statusCode, body, err := h.getReservationsByUid(c.Request().Context(), c.Param("reservationUid"))
+func (h *handler) GetFinesByUser(c echo.Context) error {
+	statusCode, body, err := h.getFines(c.Request().Context(), auth.GetUser(c.Request().Context()))
 	if err != nil {
 		log.Err(err).Msg("failed to process request to reservation service")
 		if errors.Is(err, errNotOkStatusCode) {
@@ -681,53 +2248,76 @@ func (h *handler) ReturnBookByUser(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	reservation := reservationResp{}
-	err = json.Unmarshal(body, &reservation)
-	if err != nil {
-		log.Err(err).Msg("failed to process request to reservation service")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
-	}
-
-	type req struct {
-		Condition string `json:"condition"`
-		Date      string `json:"date"`
-	}
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
 
+func (h *handler) PayFinesByUser(c echo.Context) error {
 	reqBody, err := io.ReadAll(c.Request().Body)
 	if err != nil {
 		log.Err(err).Msg("failed to parse request")
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
 	}
 
-	reqData := req{}
-	err = json.Unmarshal(reqBody, &reqData)
+	req, err := http.NewRequest(http.MethodPost, h.config.ReservationSystemURL+"/fines/"+auth.GetUser(c.Request().Context())+"/payments", bytes.NewBuffer(reqBody))
 	if err != nil {
-		log.Err(err).Msg("failed to parse request")
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
+		log.Err(err).Msg("failed to process request to reservation service")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to process request"})
 	}
 
-	starsDiff := 0
-	targetStatus := returnedStatus
-	tillDate, err := my_time.NewDate(reservation.TillDate)
+	h.setToken(c.Request().Context(), req)
+	// a payment repeated with the same key is not charged twice
+	if key := c.Request().Header.Get("Idempotency-Key"); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := h.httpClient.Do(req)
 	if err != nil {
-		log.Err(err).Msg("failed to parse till date")
+		log.Err(err).Msg("failed to process request to reservation service")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
-	reqDate, err := my_time.NewDate(reqData.Date)
+
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Err(err).Msg("failed to parse date")
+		log.Err(err).Msg("failed to process request to reservation service")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
-	if time.Time(*reqDate).After(time.Time(*tillDate)) {
-		targetStatus = expiredStatus
-		starsDiff -= 10
+
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(resp.StatusCode, string(body))
+}
+
+func (h *handler) GetCopy(c echo.Context) error {
+	statusCode, body, err := h.getFromLibrarySystem(c.Request().Context(), "/copies/"+url.PathEscape(c.Param("barcode")), url.Values{})
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	if starsDiff == 0 {
-		starsDiff = 1
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
+
+// CheckoutCopyAtDesk lends the scanned copy for a reservation, replacing the copy picked when it was made online.
+// A booking is picked up this way from its start date on and becomes a loan.
+func (h *handler) CheckoutCopyAtDesk(c echo.Context) error {
+	reqData := struct {
+		ReservationUid string `json:"reservationUid"`
+		Barcode        string `json:"barcode"`
+	}{}
+	reqBody, err := io.ReadAll(c.Request().Body)
+	if err == nil {
+		err = json.Unmarshal(reqBody, &reqData)
+	}
+	if err != nil || reqData.ReservationUid == "" || reqData.Barcode == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
 	}
 
-	statusCode, body, err = h.updateReservationStatus(c.Request().Context(), reservation.ReservationUid, targetStatus, auth.GetUser(c.Request().Context()))
+	statusCode, body, err := h.getReservationsByUid(c.Request().Context(), reqData.ReservationUid)
 	if err != nil {
 		log.Err(err).Msg("failed to process request to reservation service")
 		if errors.Is(err, errNotOkStatusCode) {
@@ -736,61 +2326,120 @@ func (h *handler) ReturnBookByUser(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	statusCode, body, err = h.updateAvailableCount(c.Request().Context(), reservation.LibraryUid, reservation.BookUid, 1)
+	reservation := reservationResp{}
+	err = json.Unmarshal(body, &reservation)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+
+	if reservation.Status != rentedStatus && reservation.Status != bookedStatus {
+		return c.JSON(http.StatusConflict, echo.Map{"message": "reservation is closed"})
+	}
+
+	if reservation.Status == bookedStatus {
+		startDate, err := my_time.NewDate(reservation.StartDate)
+		if err != nil {
+			log.Err(err).Msg("failed to parse start date")
+			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+		}
+		if startDate.After(my_time.Today(time.UTC)) {
+			return c.JSON(http.StatusConflict, echo.Map{"message": "booking starts on " + startDate.String()})
+		}
+	}
+
+	statusCode, body, err = h.checkoutCopy(c.Request().Context(), reservation.LibraryUid, reservation.BookUid, reservation.ReservationUid, reqData.Barcode)
 	if err != nil {
 		log.Err(err).Msg("failed to process request to library service")
 		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
 			return c.String(statusCode, string(body))
 		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
+	lentCopy := body
+
+	// the copy is recorded only on a rented reservation
+	if reservation.Status == bookedStatus {
+		statusCode, body, err = h.updateReservationStatus(c.Request().Context(), reservation.ReservationUid, rentedStatus, reservation.UserName)
+		if err != nil {
+			log.Err(err).Msg("failed to process request to reservation service")
+			h.takeBackCopy(c.Request().Context(), reqData.Barcode)
+			if errors.Is(err, errNotOkStatusCode) {
+				return c.String(statusCode, string(body))
+			}
+			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+		}
+	}
 
-	statusCode, body, err = h.updateUserRating(c.Request().Context(), auth.GetUser(c.Request().Context()), starsDiff)
+	// when the copy can not be recorded it goes back on the shelf and the reservation stays rented, so the
+	// librarian can scan it again
+	statusCode, body, err = h.setReservationCopy(c.Request().Context(), reservation.ReservationUid, reqData.Barcode)
 	if err != nil {
-		log.Err(err).Msg("failed to process request to rating service")
+		log.Err(err).Msg("failed to process request to reservation service")
+		h.takeBackCopy(c.Request().Context(), reqData.Barcode)
 		if errors.Is(err, errNotOkStatusCode) {
 			return c.String(statusCode, string(body))
 		}
-		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	return c.NoContent(http.StatusNoContent)
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(lentCopy))
 }
 
-func (h *handler) getRatingByUser(ctx context.Context, userName string) (int, []byte, error) {
-	req, err := http.NewRequest(http.MethodGet, h.config.RatingSystemURL+"/rating/"+userName, nil)
-	if err != nil {
-		return 0, nil, err
+// ReturnCopyAtDesk closes the loan of the scanned copy on behalf of its reader, dated today in the time
+// zone of the library.
+func (h *handler) ReturnCopyAtDesk(c echo.Context) error {
+	reqData := struct {
+		Barcode   string `json:"barcode"`
+		Condition string `json:"condition"`
+	}{}
+	reqBody, err := io.ReadAll(c.Request().Body)
+	if err == nil {
+		err = json.Unmarshal(reqBody, &reqData)
 	}
-	h.setToken(ctx, req)
-
-	resp, err := h.httpClient.Do(req)
-	if err != nil {
-		return 0, nil, err
+	if err != nil || reqData.Barcode == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to parse request"})
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return resp.StatusCode, nil, errors.Join(errNotOkStatusCode, fmt.Errorf("status code = %d", resp.StatusCode))
+	statusCode, body, err := h.getFromLibrarySystem(c.Request().Context(), "/copies/"+url.PathEscape(reqData.Barcode), url.Values{})
+	if err != nil {
+		log.Err(err).Msg("failed to process request to library service")
+		if errors.Is(err, errNotOkStatusCode) {
+			c.Response().Header().Set("Content-Type", "application/json")
+			return c.String(statusCode, string(body))
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	scanned := copyResp{}
+	err = json.Unmarshal(body, &scanned)
 	if err != nil {
-		return resp.StatusCode, nil, err
+		log.Err(err).Msg("failed to process request to library service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	return resp.StatusCode, body, nil
-}
+	if scanned.ReservationUid == "" {
+		return c.JSON(http.StatusConflict, echo.Map{"message": "copy is not checked out"})
+	}
 
-func (h *handler) GetRatingByUser(c echo.Context) error {
-	statusCode, body, err := h.getRatingByUser(c.Request().Context(), auth.GetUser(c.Request().Context()))
+	statusCode, body, err = h.getReservationsByUid(c.Request().Context(), scanned.ReservationUid)
 	if err != nil {
-		log.Err(err).Msg("failed to process request to rating service")
+		log.Err(err).Msg("failed to process request to reservation service")
 		if errors.Is(err, errNotOkStatusCode) {
 			return c.String(statusCode, string(body))
 		}
-		return c.JSON(http.StatusServiceUnavailable, echo.Map{"message": "Bonus Service unavailable"})
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
 	}
 
-	c.Response().Header().Set("Content-Type", "application/json")
-	return c.String(http.StatusOK, string(body))
+	reservation := reservationResp{}
+	err = json.Unmarshal(body, &reservation)
+	if err != nil {
+		log.Err(err).Msg("failed to process request to reservation service")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to process request"})
+	}
+	reservation.CopyBarcode = scanned.Barcode
+
+	return h.closeReservation(c, reservation, reservation.UserName, reqData.Condition, "")
 }
@@ -2,14 +2,22 @@ package library_system
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"github.com/Erlendum/rsoi-lab-02/internal/gateway/config"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
+	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 type httpClientStub struct {
@@ -21,6 +29,13 @@ func (h *httpClientStub) Do(req *http.Request) (*http.Response, error) {
 	return &http.Response{StatusCode: h.statusCode, Body: io.NopCloser(bytes.NewBufferString("test"))}, h.err
 }
 
+// httpClientFunc answers every request with the function, so a test can tell requests apart.
+type httpClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
 func Test_SendEvent(t *testing.T) {
 	var tests = []struct {
 		TestName string
@@ -66,3 +81,731 @@ func Test_SendEvent(t *testing.T) {
 		})
 	}
 }
+
+func Test_LendingPolicy(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	today := my_time.Date(time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC))
+
+	policy := lendingPolicyResp{MaxLoanDays: intPtr(14), MaxRenewals: intPtr(1), MaxConcurrentLoans: intPtr(2)}
+	loans := []reservationResp{{LibraryUid: "l1"}, {LibraryUid: "l1"}, {LibraryUid: "l2"}}
+
+	t.Run("reserve within the policy", func(t *testing.T) {
+		require.Empty(t, policy.checkReserve(loans, "l2", today, today.AddDays(14)))
+	})
+
+	t.Run("reserve breaks every rule", func(t *testing.T) {
+		require.Equal(t, []string{
+			"the library lends this book for at most 14 days",
+			"the library allows at most 2 books on loan at once, you have 2",
+		}, policy.checkReserve(loans, "l1", today, today.AddDays(15)))
+	})
+
+	t.Run("no policy, no limits", func(t *testing.T) {
+		require.Empty(t, lendingPolicyResp{}.checkReserve(loans, "l1", today, today.AddDays(365)))
+		require.Empty(t, lendingPolicyResp{}.checkRenew(reservationResp{Renewals: 10}, today, today.AddDays(365)))
+	})
+
+	t.Run("renewals used up", func(t *testing.T) {
+		require.Empty(t, policy.checkRenew(reservationResp{}, today, today.AddDays(7)))
+		require.Equal(t, []string{"all renewals the library allows for this book are used (1)"},
+			policy.checkRenew(reservationResp{Renewals: 1}, today, today.AddDays(7)))
+		require.Equal(t, []string{"the library does not renew loans of this book"},
+			lendingPolicyResp{MaxRenewals: intPtr(0)}.checkRenew(reservationResp{}, today, today.AddDays(7)))
+	})
+
+	t.Run("overlapping bookings count as loans", func(t *testing.T) {
+		booking := func(uid string, from, till int) reservationResp {
+			return reservationResp{ReservationUid: uid, LibraryUid: "l2", StartDate: today.AddDays(from).String(), TillDate: today.AddDays(till).String()}
+		}
+		bookings := []reservationResp{booking("before", 1, 4), booking("meets", 5, 8), booking("inside", 7, 9), booking("after", 11, 20)}
+
+		met := overlapping(bookings, today.AddDays(5), today.AddDays(10))
+		require.Equal(t, []reservationResp{bookings[1], bookings[2]}, met)
+		require.Equal(t, []string{"the library allows at most 2 books on loan at once, you have 2"},
+			policy.checkReserve(append([]reservationResp{{LibraryUid: "l1"}}, met...), "l2", today.AddDays(5), today.AddDays(10)))
+	})
+}
+
+func Test_ValidateReservationRequest(t *testing.T) {
+	const (
+		bookUid    = "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+		libraryUid = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+	)
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+	today := my_time.Today(time.UTC)
+
+	newContext := func() echo.Context {
+		return e.NewContext(httptest.NewRequest(http.MethodPost, "/test", nil), httptest.NewRecorder())
+	}
+
+	t.Run("wrong fields", func(t *testing.T) {
+		h := handler{httpClient: &httpClientStub{err: errors.New("must not be called")}, config: &config.Config{}}
+
+		_, _, fieldErrors, err := h.validateReservationRequest(newContext(), reservationReq{BookUid: "book", TillDate: today.String()})
+
+		require.NoError(t, err)
+		require.Equal(t, []validation.FieldError{
+			{Field: "bookUid", Message: "must be a UUID"},
+			{Field: "libraryUid", Message: "is required"},
+			{Field: "tillDate", Message: "must be after " + today.String()},
+		}, fieldErrors)
+	})
+
+	t.Run("booking dates", func(t *testing.T) {
+		h := handler{httpClient: &httpClientStub{err: errors.New("must not be called")}, config: &config.Config{}}
+		startDate := today.AddDays(7)
+
+		_, _, fieldErrors, err := h.validateReservationRequest(newContext(), reservationReq{
+			BookUid:    bookUid,
+			LibraryUid: libraryUid,
+			StartDate:  today.AddDays(-1).String(),
+			TillDate:   today.AddDays(7).String(),
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []validation.FieldError{{Field: "startDate", Message: "must not be before " + today.String()}}, fieldErrors)
+
+		_, _, fieldErrors, err = h.validateReservationRequest(newContext(), reservationReq{
+			BookUid:    bookUid,
+			LibraryUid: libraryUid,
+			StartDate:  startDate.String(),
+			TillDate:   startDate.AddDays(maxReservationDays + 1).String(),
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []validation.FieldError{
+			{Field: "tillDate", Message: "must be at most 366 days after " + startDate.String()},
+		}, fieldErrors)
+	})
+
+	t.Run("unknown library and book", func(t *testing.T) {
+		h := handler{httpClient: &httpClientStub{statusCode: http.StatusNotFound}, config: &config.Config{}}
+
+		_, _, fieldErrors, err := h.validateReservationRequest(newContext(), reservationReq{
+			BookUid:    bookUid,
+			LibraryUid: libraryUid,
+			TillDate:   today.AddDays(7).String(),
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []validation.FieldError{
+			{Field: "libraryUid", Message: "library not found"},
+			{Field: "bookUid", Message: "book not found"},
+		}, fieldErrors)
+	})
+
+	t.Run("library service unavailable", func(t *testing.T) {
+		h := handler{httpClient: &httpClientStub{err: errors.New("")}, config: &config.Config{}}
+
+		_, _, _, err := h.validateReservationRequest(newContext(), reservationReq{
+			BookUid:    bookUid,
+			LibraryUid: libraryUid,
+			TillDate:   today.AddDays(7).String(),
+		})
+
+		require.Error(t, err)
+	})
+}
+
+func Test_GetReservationDetails(t *testing.T) {
+	var booksRequests, librariesRequests [][]string
+	h := handler{config: &config.Config{LibrarySystemURL: "http://library"}, httpClient: httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		var body string
+		switch req.URL.Path {
+		case "/books/":
+			uids := req.URL.Query()["bookUids"]
+			booksRequests = append(booksRequests, uids)
+			items := make([]string, 0, len(uids))
+			for _, uid := range uids {
+				items = append(items, `{"bookUid":"`+uid+`","name":"`+uid+`"}`)
+			}
+			body = `{"data":[` + strings.Join(items, ",") + `]}`
+		case "/libraries/by-uids":
+			uids := req.URL.Query()["libraryUids"]
+			librariesRequests = append(librariesRequests, uids)
+			body = `{"data":[{"libraryUid":"` + uids[0] + `","name":"first"}]}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+	})}
+
+	reservations := make([]reservationResp, 0)
+	for i := 0; i < detailsBatchSize+10; i++ {
+		book := fmt.Sprintf("book-%d", i)
+		// every book appears twice but is requested once
+		reservations = append(reservations, reservationResp{BookUid: book, LibraryUid: "library"}, reservationResp{BookUid: book, LibraryUid: "library"})
+	}
+
+	books, libraries, err := h.getReservationDetails(context.Background(), reservations)
+
+	require.NoError(t, err)
+	require.Len(t, booksRequests, 2)
+	require.Len(t, booksRequests[0], detailsBatchSize)
+	require.Len(t, booksRequests[1], 10)
+	require.Equal(t, [][]string{{"library"}}, librariesRequests)
+	require.Len(t, books, detailsBatchSize+10)
+	require.Equal(t, "book-59", books["book-59"].Name)
+	require.Equal(t, "first", libraries["library"].Name)
+}
+
+func Test_ReturnBookByUser(t *testing.T) {
+	const reservationUid = "0f2c7e2e-5c1f-4d43-9a0b-2f8a3c6c9d11"
+
+	reservationBody := func(username, status string) string {
+		return `{"reservationUid":"` + reservationUid + `","username":"` + username + `","status":"` + status +
+			`","startDate":"2030-01-10","tillDate":"2030-01-20","bookUid":"book","libraryUid":"library"}`
+	}
+
+	tests := []struct {
+		name                 string
+		reservationCode      int
+		reservationBody      string
+		expectedHTTPCode     int
+		expectedRequests     []string
+		expectedResponseBody string
+	}{
+		{
+			name:             "http-code 404: unknown reservation",
+			reservationCode:  http.StatusNotFound,
+			reservationBody:  `{"message":"reservation not found"}`,
+			expectedHTTPCode: http.StatusNotFound,
+			expectedRequests: []string{"GET /reservations/" + reservationUid},
+		},
+		{
+			name:             "http-code 404: reservation of another reader is not touched",
+			reservationCode:  http.StatusOK,
+			reservationBody:  reservationBody("owner", rentedStatus),
+			expectedHTTPCode: http.StatusNotFound,
+			expectedRequests: []string{"GET /reservations/" + reservationUid},
+			expectedResponseBody: `{"message":"reservation not found"}
+`,
+		},
+		{
+			name:             "http-code 204: own booking is canceled",
+			reservationCode:  http.StatusOK,
+			reservationBody:  reservationBody("test", bookedStatus),
+			expectedHTTPCode: http.StatusNoContent,
+			expectedRequests: []string{
+				"GET /reservations/" + reservationUid,
+				"PUT /reservations/" + reservationUid + "/status?status=" + canceledStatus,
+			},
+		},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make([]string, 0)
+			h := newHandler(withTokenEndpoint(func(req *http.Request) (*http.Response, error) {
+				requests = append(requests, req.Method+" "+req.URL.RequestURI())
+				if req.Method == http.MethodGet {
+					return &http.Response{StatusCode: tt.reservationCode, Body: io.NopCloser(bytes.NewBufferString(tt.reservationBody))}, nil
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(""))}, nil
+			}), &config.Config{ReservationSystemURL: "http://reservation", ServiceAccount: serviceAccount})
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(`{"condition":"GOOD"}`))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("reservationUid")
+			c.SetParamValues(reservationUid)
+			c.SetRequest(c.Request().WithContext(auth.SetUser(c.Request().Context(), "test")))
+
+			err := h.ReturnBookByUser(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedHTTPCode, rec.Code)
+			require.Equal(t, tt.expectedRequests, requests)
+			if tt.expectedResponseBody != "" {
+				require.Equal(t, tt.expectedResponseBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+// stubResponse is the answer of a stubbed service to "METHOD URL" without query, other requests get 200 with {}.
+type stubResponse struct {
+	code int
+	body string
+}
+
+// serviceAccount is the gateway client the token endpoint of withTokenEndpoint knows.
+var serviceAccount = config.ServiceAccount{TokenURL: "http://keycloak/token", ClientID: "gateway", ClientSecret: "secret"}
+
+// withTokenEndpoint answers the token requests of serviceAccount with service-token and passes the rest to client.
+func withTokenEndpoint(client httpClientFunc) httpClientFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != serviceAccount.TokenURL {
+			return client(req)
+		}
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+		if req.PostForm.Get("client_id") != serviceAccount.ClientID || req.PostForm.Get("client_secret") != serviceAccount.ClientSecret {
+			return &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(bytes.NewBufferString(`{"error":"invalid_client"}`))}, nil
+		}
+		body := `{"access_token":"service-token","expires_in":300}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+	}
+}
+
+// deskClient answers with the stubbed responses and records every request with its token.
+func deskClient(responses map[string]stubResponse, requests *[]string) httpClientFunc {
+	return withTokenEndpoint(func(req *http.Request) (*http.Response, error) {
+		*requests = append(*requests, req.Method+" "+req.URL.String()+" "+req.Header.Get("Authorization"))
+		res, ok := responses[req.Method+" "+req.URL.Scheme+"://"+req.URL.Host+req.URL.Path]
+		if !ok {
+			res = stubResponse{code: http.StatusOK, body: "{}"}
+		}
+		return &http.Response{StatusCode: res.code, Body: io.NopCloser(bytes.NewBufferString(res.body))}, nil
+	})
+}
+
+func deskContext(c echo.Context) context.Context {
+	ctx := auth.SetUser(c.Request().Context(), "librarian")
+	ctx = auth.SetRoles(ctx, []string{auth.LibrarianRole})
+	return auth.SetToken(ctx, "librarian-token")
+}
+
+func Test_CheckoutCopyAtDesk(t *testing.T) {
+	const reservationUid = "0f2c7e2e-5c1f-4d43-9a0b-2f8a3c6c9d11"
+
+	reservationBody := func(status, startDate string) string {
+		return `{"reservationUid":"` + reservationUid + `","username":"reader","status":"` + status +
+			`","startDate":"` + startDate + `","tillDate":"2999-01-20","bookUid":"book","libraryUid":"library"}`
+	}
+	today := my_time.Today(time.UTC).String()
+	copyBody := `{"barcode":"B-1","status":"CHECKED_OUT","reservationUid":"` + reservationUid + `"}`
+
+	tests := []struct {
+		name                 string
+		body                 string
+		responses            map[string]stubResponse
+		expectedHTTPCode     int
+		expectedRequests     []string
+		expectedResponseBody string
+	}{
+		{
+			name:             "http-code 400: no barcode",
+			body:             `{"reservationUid":"` + reservationUid + `"}`,
+			expectedHTTPCode: http.StatusBadRequest,
+			expectedRequests: []string{},
+		},
+		{
+			name: "http-code 404: unknown reservation",
+			body: `{"reservationUid":"` + reservationUid + `","barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://reservation/reservations/" + reservationUid: {code: http.StatusNotFound, body: `{"message":"reservation not found"}`},
+			},
+			expectedHTTPCode: http.StatusNotFound,
+			expectedRequests: []string{
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+			},
+		},
+		{
+			name: "http-code 409: reservation is closed",
+			body: `{"reservationUid":"` + reservationUid + `","barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://reservation/reservations/" + reservationUid: {code: http.StatusOK, body: reservationBody(returnedStatus, today)},
+			},
+			expectedHTTPCode: http.StatusConflict,
+			expectedRequests: []string{
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+			},
+		},
+		{
+			name: "http-code 409: booking has not started",
+			body: `{"reservationUid":"` + reservationUid + `","barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://reservation/reservations/" + reservationUid: {code: http.StatusOK, body: reservationBody(bookedStatus, "2999-01-10")},
+			},
+			expectedHTTPCode: http.StatusConflict,
+			expectedRequests: []string{
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+			},
+			expectedResponseBody: `{"message":"booking starts on 2999-01-10"}
+`,
+		},
+		{
+			name: "http-code 409: copy is not available",
+			body: `{"reservationUid":"` + reservationUid + `","barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://reservation/reservations/" + reservationUid:     {code: http.StatusOK, body: reservationBody(rentedStatus, today)},
+				"POST http://library/libraries/library/books/book/checkout": {code: http.StatusConflict, body: `{"message":"copy is not available"}`},
+			},
+			expectedHTTPCode: http.StatusConflict,
+			expectedRequests: []string{
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+				"POST http://library/libraries/library/books/book/checkout Bearer librarian-token",
+			},
+			expectedResponseBody: `{"message":"copy is not available"}`,
+		},
+		{
+			name: "http-code 200: scanned copy replaces the picked one",
+			body: `{"reservationUid":"` + reservationUid + `","barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://reservation/reservations/" + reservationUid:     {code: http.StatusOK, body: reservationBody(rentedStatus, today)},
+				"POST http://library/libraries/library/books/book/checkout": {code: http.StatusOK, body: copyBody},
+			},
+			expectedHTTPCode: http.StatusOK,
+			expectedRequests: []string{
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+				"POST http://library/libraries/library/books/book/checkout Bearer librarian-token",
+				"PUT http://reservation/reservations/" + reservationUid + "/copy Bearer librarian-token",
+			},
+			expectedResponseBody: copyBody,
+		},
+		{
+			name: "http-code 200: booking is picked up on its start date",
+			body: `{"reservationUid":"` + reservationUid + `","barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://reservation/reservations/" + reservationUid:     {code: http.StatusOK, body: reservationBody(bookedStatus, today)},
+				"POST http://library/libraries/library/books/book/checkout": {code: http.StatusOK, body: copyBody},
+			},
+			expectedHTTPCode: http.StatusOK,
+			expectedRequests: []string{
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+				"POST http://library/libraries/library/books/book/checkout Bearer librarian-token",
+				"PUT http://reservation/reservations/" + reservationUid + "/status?status=" + rentedStatus + " Bearer librarian-token",
+				"PUT http://reservation/reservations/" + reservationUid + "/copy Bearer librarian-token",
+			},
+			expectedResponseBody: copyBody,
+		},
+		{
+			name: "http-code 500: copy is taken back when the reservation can not record it",
+			body: `{"reservationUid":"` + reservationUid + `","barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://reservation/reservations/" + reservationUid:           {code: http.StatusOK, body: reservationBody(bookedStatus, today)},
+				"POST http://library/libraries/library/books/book/checkout":       {code: http.StatusOK, body: copyBody},
+				"PUT http://reservation/reservations/" + reservationUid + "/copy": {code: http.StatusInternalServerError, body: `{"message":"failed to process request"}`},
+			},
+			expectedHTTPCode: http.StatusInternalServerError,
+			expectedRequests: []string{
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+				"POST http://library/libraries/library/books/book/checkout Bearer librarian-token",
+				"PUT http://reservation/reservations/" + reservationUid + "/status?status=" + rentedStatus + " Bearer librarian-token",
+				"PUT http://reservation/reservations/" + reservationUid + "/copy Bearer librarian-token",
+				"POST http://library/copies/B-1/return Bearer librarian-token",
+			},
+		},
+		{
+			name: "http-code 500: copy is taken back when the booking can not be rented",
+			body: `{"reservationUid":"` + reservationUid + `","barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://reservation/reservations/" + reservationUid:             {code: http.StatusOK, body: reservationBody(bookedStatus, today)},
+				"POST http://library/libraries/library/books/book/checkout":         {code: http.StatusOK, body: copyBody},
+				"PUT http://reservation/reservations/" + reservationUid + "/status": {code: http.StatusInternalServerError, body: `{"message":"failed to process request"}`},
+			},
+			expectedHTTPCode: http.StatusInternalServerError,
+			expectedRequests: []string{
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+				"POST http://library/libraries/library/books/book/checkout Bearer librarian-token",
+				"PUT http://reservation/reservations/" + reservationUid + "/status?status=" + rentedStatus + " Bearer librarian-token",
+				"POST http://library/copies/B-1/return Bearer librarian-token",
+			},
+		},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make([]string, 0)
+			h := newHandler(deskClient(tt.responses, &requests), &config.Config{
+				ReservationSystemURL: "http://reservation", LibrarySystemURL: "http://library", ServiceAccount: serviceAccount})
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetRequest(c.Request().WithContext(deskContext(c)))
+
+			err := h.CheckoutCopyAtDesk(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedHTTPCode, rec.Code)
+			require.Equal(t, tt.expectedRequests, requests)
+			if tt.expectedResponseBody != "" {
+				require.Equal(t, tt.expectedResponseBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_ReturnCopyAtDesk(t *testing.T) {
+	const reservationUid = "0f2c7e2e-5c1f-4d43-9a0b-2f8a3c6c9d11"
+
+	reservationBody := func(tillDate string) string {
+		return `{"reservationUid":"` + reservationUid + `","username":"reader","status":"RENTED",` +
+			`"startDate":"2024-01-10","tillDate":"` + tillDate + `","bookUid":"book","libraryUid":"library","copyBarcode":"B-1"}`
+	}
+	checkedOut := `{"barcode":"B-1","status":"CHECKED_OUT","reservationUid":"` + reservationUid + `"}`
+
+	tests := []struct {
+		name             string
+		body             string
+		responses        map[string]stubResponse
+		expectedHTTPCode int
+		expectedRequests []string
+	}{
+		{
+			name:             "http-code 400: no barcode",
+			body:             `{"condition":"GOOD"}`,
+			expectedHTTPCode: http.StatusBadRequest,
+			expectedRequests: []string{},
+		},
+		{
+			name: "http-code 404: unknown copy",
+			body: `{"barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://library/copies/B-1": {code: http.StatusNotFound, body: `{"message":"copy not found"}`},
+			},
+			expectedHTTPCode: http.StatusNotFound,
+			expectedRequests: []string{
+				"GET http://library/copies/B-1 Bearer librarian-token",
+			},
+		},
+		{
+			name: "http-code 409: copy is not checked out",
+			body: `{"barcode":"B-1"}`,
+			responses: map[string]stubResponse{
+				"GET http://library/copies/B-1": {code: http.StatusOK, body: `{"barcode":"B-1","status":"AVAILABLE"}`},
+			},
+			expectedHTTPCode: http.StatusConflict,
+			expectedRequests: []string{
+				"GET http://library/copies/B-1 Bearer librarian-token",
+			},
+		},
+		{
+			name: "http-code 204: loan is closed for the reader",
+			body: `{"barcode":"B-1","condition":"GOOD"}`,
+			responses: map[string]stubResponse{
+				"GET http://library/copies/B-1":                         {code: http.StatusOK, body: checkedOut},
+				"GET http://reservation/reservations/" + reservationUid: {code: http.StatusOK, body: reservationBody("2999-01-20")},
+			},
+			expectedHTTPCode: http.StatusNoContent,
+			expectedRequests: []string{
+				"GET http://library/copies/B-1 Bearer librarian-token",
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+				"GET http://library/libraries/library/calendar?from=2999-01-20&to=3000-01-21 Bearer librarian-token",
+				"PUT http://reservation/reservations/" + reservationUid + "/status?status=" + returnedStatus + " Bearer librarian-token",
+				"POST http://library/copies/B-1/return Bearer librarian-token",
+				"POST http://rating/rating/reader/events Bearer service-token",
+			},
+		},
+		{
+			name: "http-code 204: late return is fined by the gateway itself",
+			body: `{"barcode":"B-1","condition":"GOOD"}`,
+			responses: map[string]stubResponse{
+				"GET http://library/copies/B-1":                         {code: http.StatusOK, body: checkedOut},
+				"GET http://reservation/reservations/" + reservationUid: {code: http.StatusOK, body: reservationBody("2024-01-20")},
+			},
+			expectedHTTPCode: http.StatusNoContent,
+			expectedRequests: []string{
+				"GET http://library/copies/B-1 Bearer librarian-token",
+				"GET http://reservation/reservations/" + reservationUid + " Bearer librarian-token",
+				"GET http://library/libraries/library/calendar?from=2024-01-20&to=2025-01-20 Bearer librarian-token",
+				"GET http://library/libraries/library/books/book/policy Bearer librarian-token",
+				"PUT http://reservation/reservations/" + reservationUid + "/status?status=" + expiredStatus + " Bearer librarian-token",
+				"POST http://reservation/fines/accrue Bearer service-token",
+				"POST http://library/copies/B-1/return Bearer librarian-token",
+				"POST http://rating/rating/reader/events Bearer service-token",
+			},
+		},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make([]string, 0)
+			h := newHandler(deskClient(tt.responses, &requests), &config.Config{ReservationSystemURL: "http://reservation",
+				LibrarySystemURL: "http://library", RatingSystemURL: "http://rating", ServiceAccount: serviceAccount})
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetRequest(c.Request().WithContext(deskContext(c)))
+
+			err := h.ReturnCopyAtDesk(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedHTTPCode, rec.Code)
+			require.Equal(t, tt.expectedRequests, requests)
+		})
+	}
+}
+
+func Test_StaffToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		roles         []string
+		expectedToken string
+	}{
+		{
+			name:          "librarian lends with own token",
+			roles:         []string{auth.LibrarianRole},
+			expectedToken: "Bearer reader-token",
+		},
+		{
+			name:          "gateway lends for the reader",
+			expectedToken: "Bearer service-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make([]string, 0)
+			h := newHandler(deskClient(nil, &requests), &config.Config{LibrarySystemURL: "http://library", ServiceAccount: serviceAccount})
+			ctx := auth.SetRoles(auth.SetToken(context.Background(), "reader-token"), tt.roles)
+
+			_, _, err := h.checkoutCopy(ctx, "library", "book", "reservation", "")
+			require.NoError(t, err)
+			_, _, err = h.returnCopy(ctx, "B-1", "")
+			require.NoError(t, err)
+
+			require.Equal(t, []string{
+				"POST http://library/libraries/library/books/book/checkout " + tt.expectedToken,
+				"POST http://library/copies/B-1/return " + tt.expectedToken,
+			}, requests)
+		})
+	}
+}
+
+func readerContext(c echo.Context) context.Context {
+	return auth.SetToken(auth.SetUser(c.Request().Context(), "reader"), "reader-token")
+}
+
+func Test_ReserveBookByUser(t *testing.T) {
+	const (
+		bookUid        = "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+		libraryUid     = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+		reservationUid = "0f2c7e2e-5c1f-4d43-9a0b-2f8a3c6c9d11"
+	)
+
+	today := my_time.Today(time.UTC)
+	tillDate := today.AddDays(7).String()
+	reservationBody := `{"reservationUid":"` + reservationUid + `","status":"RENTED","startDate":"` + today.String() +
+		`","tillDate":"` + tillDate + `","bookUid":"` + bookUid + `","libraryUid":"` + libraryUid + `"}`
+
+	responses := func() map[string]stubResponse {
+		return map[string]stubResponse{
+			"GET http://library/libraries/by-uids":                                            {code: http.StatusOK, body: `{"data":[{"libraryUid":"` + libraryUid + `"}]}`},
+			"GET http://library/books/":                                                       {code: http.StatusOK, body: `{"data":[{"bookUid":"` + bookUid + `"}]}`},
+			"GET http://reservation/reservations/by-user/reader":                              {code: http.StatusOK, body: `[]`},
+			"POST http://rating/rating/reader/events":                                         {code: http.StatusOK, body: `{"stars":75,"allowed":true}`},
+			"GET http://rating/rating/reader/tier":                                            {code: http.StatusOK, body: `{"name":"BRONZE","maxLoans":3,"maxLoanDays":30}`},
+			"POST http://reservation/reservations/":                                           {code: http.StatusOK, body: reservationBody},
+			"POST http://library/libraries/" + libraryUid + "/books/" + bookUid + "/checkout": {code: http.StatusOK, body: `{"barcode":"B-1","status":"CHECKED_OUT"}`},
+		}
+	}
+	checks := []string{
+		"GET http://library/libraries/by-uids?libraryUids=" + libraryUid + " Bearer reader-token",
+		"GET http://library/books/?bookUids=" + bookUid + " Bearer reader-token",
+		"GET http://reservation/reservations/by-user/reader?status=RENTED Bearer reader-token",
+		"GET http://reservation/reservations/by-user/reader?status=BOOKED Bearer reader-token",
+		"GET http://reservation/fines/reader Bearer reader-token",
+		"PUT http://rating/rating/reader Bearer reader-token",
+		"POST http://rating/rating/reader/events Bearer service-token",
+		"GET http://rating/rating/reader/tier Bearer reader-token",
+		"GET http://library/libraries/" + libraryUid + "/books/" + bookUid + "/policy Bearer reader-token",
+		"POST http://reservation/reservations/ Bearer reader-token",
+	}
+
+	tests := []struct {
+		name             string
+		responses        map[string]stubResponse
+		expectedHTTPCode int
+		expectedRequests []string
+	}{
+		{
+			name:             "http-code 200: gateway lends a copy for the reader",
+			responses:        responses(),
+			expectedHTTPCode: http.StatusOK,
+			expectedRequests: append(checks[:len(checks):len(checks)],
+				"POST http://library/libraries/"+libraryUid+"/books/"+bookUid+"/checkout Bearer service-token",
+				"PUT http://reservation/reservations/"+reservationUid+"/copy Bearer service-token",
+				"GET http://library/books/?bookUids="+bookUid+" Bearer reader-token",
+				"GET http://library/libraries/by-uids?libraryUids="+libraryUid+" Bearer reader-token",
+			),
+		},
+		{
+			name: "http-code 409: reservation is canceled when no copy can be lent",
+			responses: func() map[string]stubResponse {
+				r := responses()
+				r["POST http://library/libraries/"+libraryUid+"/books/"+bookUid+"/checkout"] = stubResponse{code: http.StatusConflict, body: `{"message":"no copy is available"}`}
+				return r
+			}(),
+			expectedHTTPCode: http.StatusConflict,
+			expectedRequests: append(checks[:len(checks):len(checks)],
+				"POST http://library/libraries/"+libraryUid+"/books/"+bookUid+"/checkout Bearer service-token",
+				"PUT http://reservation/reservations/"+reservationUid+"/status?status="+canceledStatus+" Bearer service-token",
+			),
+		},
+		{
+			name: "http-code 500: copy is taken back when the reservation can not record it",
+			responses: func() map[string]stubResponse {
+				r := responses()
+				r["PUT http://reservation/reservations/"+reservationUid+"/copy"] = stubResponse{code: http.StatusInternalServerError, body: `{"message":"failed to process request"}`}
+				return r
+			}(),
+			expectedHTTPCode: http.StatusInternalServerError,
+			expectedRequests: append(checks[:len(checks):len(checks)],
+				"POST http://library/libraries/"+libraryUid+"/books/"+bookUid+"/checkout Bearer service-token",
+				"PUT http://reservation/reservations/"+reservationUid+"/copy Bearer service-token",
+				"POST http://library/copies/B-1/return Bearer service-token",
+				"PUT http://reservation/reservations/"+reservationUid+"/status?status="+canceledStatus+" Bearer service-token",
+			),
+		},
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make([]string, 0)
+			h := newHandler(deskClient(tt.responses, &requests), &config.Config{ReservationSystemURL: "http://reservation",
+				LibrarySystemURL: "http://library", RatingSystemURL: "http://rating", ServiceAccount: serviceAccount})
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(
+				`{"bookUid":"`+bookUid+`","libraryUid":"`+libraryUid+`","tillDate":"`+tillDate+`"}`))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetRequest(c.Request().WithContext(readerContext(c)))
+
+			err := h.ReserveBookByUser(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedHTTPCode, rec.Code, rec.Body.String())
+			require.Equal(t, tt.expectedRequests, requests)
+		})
+	}
+}
+
+func Test_ReturnRentedBookByUser(t *testing.T) {
+	const reservationUid = "0f2c7e2e-5c1f-4d43-9a0b-2f8a3c6c9d11"
+
+	requests := make([]string, 0)
+	h := newHandler(deskClient(map[string]stubResponse{
+		"GET http://reservation/reservations/" + reservationUid: {code: http.StatusOK, body: `{"reservationUid":"` + reservationUid +
+			`","username":"reader","status":"RENTED","startDate":"2999-01-10","tillDate":"2999-01-20","bookUid":"book","libraryUid":"library","copyBarcode":"B-1"}`},
+	}, &requests), &config.Config{ReservationSystemURL: "http://reservation", LibrarySystemURL: "http://library",
+		RatingSystemURL: "http://rating", ServiceAccount: serviceAccount})
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(`{"condition":"GOOD","date":"2999-01-15"}`)), rec)
+	c.SetParamNames("reservationUid")
+	c.SetParamValues(reservationUid)
+	c.SetRequest(c.Request().WithContext(readerContext(c)))
+
+	err := h.ReturnBookByUser(c)
+
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, []string{
+		"GET http://reservation/reservations/" + reservationUid + " Bearer reader-token",
+		"GET http://library/libraries/library/calendar?from=2999-01-20&to=3000-01-21 Bearer reader-token",
+		"PUT http://reservation/reservations/" + reservationUid + "/status?status=" + returnedStatus + " Bearer service-token",
+		"POST http://library/copies/B-1/return Bearer service-token",
+		"POST http://rating/rating/reader/events Bearer service-token",
+	}, requests)
+}
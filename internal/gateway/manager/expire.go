@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Erlendum/rsoi-lab-02/internal/gateway/config"
+	"github.com/Erlendum/rsoi-lab-02/internal/gateway/expiry"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"os"
+)
+
+// Expire reports the rented reservations that are overdue according to the calendars of their libraries,
+// authorized as the gateway service account from SERVICE_CLIENT_ID and SERVICE_CLIENT_SECRET. The report is written to stdout.
+func Expire(ctx context.Context) error {
+	cfg, err := config.New()
+	if err != nil {
+		log.Error().Err(err).Msg("config load error")
+		return err
+	}
+
+	job := expiry.NewJob(&http.Client{Timeout: reconcileTimeout}, cfg)
+	report, err := job.Run(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("expiry error")
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
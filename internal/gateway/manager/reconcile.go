@@ -0,0 +1,35 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Erlendum/rsoi-lab-02/internal/gateway/config"
+	"github.com/Erlendum/rsoi-lab-02/internal/gateway/reconcile"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const reconcileTimeout = 30 * time.Second
+
+// Reconcile compares rented reservations with library stock through the services' APIs, authorized as the
+// gateway service account from SERVICE_CLIENT_ID and SERVICE_CLIENT_SECRET. The drift report is written to stdout.
+func Reconcile(ctx context.Context, apply bool) error {
+	cfg, err := config.New()
+	if err != nil {
+		log.Error().Err(err).Msg("config load error")
+		return err
+	}
+
+	reconciler := reconcile.NewReconciler(&http.Client{Timeout: reconcileTimeout}, cfg)
+	report, err := reconciler.Run(ctx, apply)
+	if err != nil {
+		log.Error().Err(err).Msg("reconciliation error")
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,54 @@
+package reconcile
+
+type reservation struct {
+	ReservationUid string `json:"reservationUid"`
+	BookUid        string `json:"bookUid"`
+	LibraryUid     string `json:"libraryUid"`
+	CopyBarcode    string `json:"copyBarcode"`
+}
+
+type bookCopy struct {
+	Barcode        string `json:"barcode"`
+	LibraryUid     string `json:"libraryUid"`
+	BookUid        string `json:"bookUid"`
+	ReservationUid string `json:"reservationUid"`
+}
+
+type inventory struct {
+	AvailableCount int `json:"availableCount"`
+	RecordedCount  int `json:"recordedCount"`
+}
+
+type pair struct {
+	LibraryUid string
+	BookUid    string
+}
+
+// UnlinkedLoan is a copy checked out for a rented reservation that does not know its copy.
+type UnlinkedLoan struct {
+	ReservationUid string `json:"reservationUid"`
+	Barcode        string `json:"barcode"`
+}
+
+// Drift describes a library and book pair whose stock does not agree with the loans. The expected count
+// is the initial stock, that is the available and checked out copies plus loans made before copies were
+// tracked, minus the active loans.
+type Drift struct {
+	LibraryUid       string         `json:"libraryUid"`
+	BookUid          string         `json:"bookUid"`
+	ActiveLoans      int            `json:"activeLoans"`
+	CheckedOutCopies int            `json:"checkedOutCopies"`
+	ExpectedCount    int            `json:"expectedCount"`
+	ActualCount      int            `json:"actualCount"`
+	LedgerCount      int            `json:"ledgerCount"`
+	OrphanCopies     []string       `json:"orphanCopies,omitempty"`
+	UnlinkedLoans    []UnlinkedLoan `json:"unlinkedLoans,omitempty"`
+	LoansWithoutCopy []string       `json:"loansWithoutCopy,omitempty"`
+}
+
+type Report struct {
+	Apply     bool     `json:"apply"`
+	Drifts    []Drift  `json:"drifts"`
+	Corrected int      `json:"corrected"`
+	Errors    []string `json:"errors,omitempty"`
+}
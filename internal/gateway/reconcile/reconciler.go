@@ -0,0 +1,203 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Erlendum/rsoi-lab-02/internal/gateway/config"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+const (
+	rentedStatus     = "RENTED"
+	checkedOutStatus = "CHECKED_OUT"
+)
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type tokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+type Reconciler struct {
+	httpClient    httpClient
+	serviceTokens tokenSource
+	config        *config.Config
+}
+
+func NewReconciler(httpClient httpClient, config *config.Config) *Reconciler {
+	return &Reconciler{httpClient: httpClient, serviceTokens: config.ServiceTokens(httpClient), config: config}
+}
+
+// Run matches the rented reservations against the checked out copies by reservation uid. With apply, copies
+// lent for reservations that are closed or unknown are returned to the shelf and reservations that miss the
+// barcode of their copy get it, everything else is only reported.
+//
+// Copies are read before loans: a reservation made in between then only lacks its copy in the report, while
+// the other way round its fresh copy would look orphaned and be taken back from the reader.
+func (r *Reconciler) Run(ctx context.Context, apply bool) (Report, error) {
+	copies := make([]bookCopy, 0)
+	err := r.do(ctx, http.MethodGet, r.config.LibrarySystemURL+"/copies?status="+checkedOutStatus, nil, &copies)
+	if err != nil {
+		return Report{}, fmt.Errorf("get checked out copies: %w", err)
+	}
+
+	loans := make([]reservation, 0)
+	err = r.do(ctx, http.MethodGet, r.config.ReservationSystemURL+"/reservations?status="+rentedStatus, nil, &loans)
+	if err != nil {
+		return Report{}, fmt.Errorf("get rented reservations: %w", err)
+	}
+
+	drifts := map[pair]*Drift{}
+	drift := func(p pair) *Drift {
+		if _, ok := drifts[p]; !ok {
+			drifts[p] = &Drift{LibraryUid: p.LibraryUid, BookUid: p.BookUid}
+		}
+		return drifts[p]
+	}
+
+	loansByUid := make(map[string]reservation, len(loans))
+	for _, l := range loans {
+		loansByUid[l.ReservationUid] = l
+		drift(pair{LibraryUid: l.LibraryUid, BookUid: l.BookUid}).ActiveLoans++
+	}
+
+	lent := make(map[string]struct{}, len(copies))
+	orphans := make(map[string]string)
+	for _, c := range copies {
+		d := drift(pair{LibraryUid: c.LibraryUid, BookUid: c.BookUid})
+		d.CheckedOutCopies++
+
+		l, ok := loansByUid[c.ReservationUid]
+		if !ok {
+			d.OrphanCopies = append(d.OrphanCopies, c.Barcode)
+			orphans[c.Barcode] = c.ReservationUid
+			continue
+		}
+		lent[c.ReservationUid] = struct{}{}
+		if l.CopyBarcode != c.Barcode {
+			d.UnlinkedLoans = append(d.UnlinkedLoans, UnlinkedLoan{ReservationUid: l.ReservationUid, Barcode: c.Barcode})
+		}
+	}
+
+	for _, l := range loans {
+		if _, ok := lent[l.ReservationUid]; !ok {
+			d := drift(pair{LibraryUid: l.LibraryUid, BookUid: l.BookUid})
+			d.LoansWithoutCopy = append(d.LoansWithoutCopy, l.ReservationUid)
+		}
+	}
+
+	report := Report{Apply: apply, Drifts: make([]Drift, 0)}
+	for p, d := range drifts {
+		if len(d.OrphanCopies) == 0 && len(d.UnlinkedLoans) == 0 && len(d.LoansWithoutCopy) == 0 {
+			continue
+		}
+
+		inv := inventory{}
+		err = r.do(ctx, http.MethodGet, r.config.LibrarySystemURL+"/libraries/"+url.PathEscape(p.LibraryUid)+
+			"/books/"+url.PathEscape(p.BookUid)+"/inventory", nil, &inv)
+		if err != nil {
+			return Report{}, fmt.Errorf("get inventory of book %s in library %s: %w", p.BookUid, p.LibraryUid, err)
+		}
+		d.ActualCount = inv.RecordedCount
+		d.LedgerCount = inv.AvailableCount
+		d.ExpectedCount = d.ActualCount + d.CheckedOutCopies + len(d.LoansWithoutCopy) - d.ActiveLoans
+
+		report.Drifts = append(report.Drifts, *d)
+	}
+
+	sort.Slice(report.Drifts, func(i, j int) bool {
+		if report.Drifts[i].LibraryUid != report.Drifts[j].LibraryUid {
+			return report.Drifts[i].LibraryUid < report.Drifts[j].LibraryUid
+		}
+		return report.Drifts[i].BookUid < report.Drifts[j].BookUid
+	})
+
+	if !apply {
+		return report, nil
+	}
+
+	for _, d := range report.Drifts {
+		for _, barcode := range d.OrphanCopies {
+			// the copy may have been lent again after the snapshot, then it is left alone
+			current := bookCopy{}
+			err = r.do(ctx, http.MethodGet, r.config.LibrarySystemURL+"/copies/"+url.PathEscape(barcode), nil, &current)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("get copy %s: %s", barcode, err))
+				continue
+			}
+			if current.ReservationUid != orphans[barcode] {
+				continue
+			}
+
+			err = r.do(ctx, http.MethodPost, r.config.LibrarySystemURL+"/copies/"+url.PathEscape(barcode)+"/return", struct{}{}, nil)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("return copy %s: %s", barcode, err))
+				continue
+			}
+			report.Corrected++
+		}
+
+		for _, l := range d.UnlinkedLoans {
+			err = r.do(ctx, http.MethodPut, r.config.ReservationSystemURL+"/reservations/"+url.PathEscape(l.ReservationUid)+"/copy",
+				struct {
+					CopyBarcode string `json:"copyBarcode"`
+				}{CopyBarcode: l.Barcode}, nil)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("link copy %s to reservation %s: %s", l.Barcode, l.ReservationUid, err))
+				continue
+			}
+			report.Corrected++
+		}
+	}
+
+	return report, nil
+}
+
+// do sends the request with the service token and decodes the response into result when it is set.
+func (r *Reconciler) do(ctx context.Context, method, reqURL string, reqBody, result interface{}) error {
+	var body io.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+	token, err := r.serviceTokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("get service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code = %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
@@ -0,0 +1,134 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"github.com/Erlendum/rsoi-lab-02/internal/gateway/config"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type httpClientStub struct {
+	responses map[string]string
+	calls     []string
+}
+
+const tokenCall = "POST http://keycloak/token"
+
+func (h *httpClientStub) Do(req *http.Request) (*http.Response, error) {
+	call := req.Method + " " + req.URL.String()
+	h.calls = append(h.calls, call)
+
+	body, ok := h.responses[call]
+	if call != tokenCall && req.Header.Get("Authorization") != "Bearer service-token" {
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(bytes.NewBufferString("{}"))}, nil
+	}
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(bytes.NewBufferString("{}"))}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+func Test_Run(t *testing.T) {
+	cfg := &config.Config{ReservationSystemURL: "http://reservation", LibrarySystemURL: "http://library",
+		ServiceAccount: config.ServiceAccount{TokenURL: "http://keycloak/token", ClientID: "gateway", ClientSecret: "secret"}}
+
+	newStub := func() *httpClientStub {
+		return &httpClientStub{responses: map[string]string{
+			"GET http://reservation/reservations?status=RENTED": `[
+				{"reservationUid": "r1", "libraryUid": "l1", "bookUid": "b1", "copyBarcode": "c1"},
+				{"reservationUid": "r2", "libraryUid": "l1", "bookUid": "b1"},
+				{"reservationUid": "r3", "libraryUid": "l1", "bookUid": "b2"}
+			]`,
+			"GET http://library/copies?status=CHECKED_OUT": `[
+				{"barcode": "c1", "libraryUid": "l1", "bookUid": "b1", "reservationUid": "r1"},
+				{"barcode": "c2", "libraryUid": "l1", "bookUid": "b1", "reservationUid": "r2"},
+				{"barcode": "c3", "libraryUid": "l1", "bookUid": "b1", "reservationUid": "closed"}
+			]`,
+			"GET http://library/libraries/l1/books/b1/inventory": `{"availableCount": 4, "recordedCount": 4}`,
+			"GET http://library/libraries/l1/books/b2/inventory": `{"availableCount": 1, "recordedCount": 1}`,
+			"GET http://library/copies/c3":                       `{"barcode": "c3", "libraryUid": "l1", "bookUid": "b1", "reservationUid": "closed"}`,
+			"POST http://library/copies/c3/return":               `{}`,
+			"PUT http://reservation/reservations/r2/copy":        ``,
+			tokenCall: `{"access_token": "service-token", "expires_in": 300}`,
+		}}
+	}
+
+	t.Run("report only", func(t *testing.T) {
+		stub := newStub()
+
+		report, err := NewReconciler(stub, cfg).Run(context.Background(), false)
+
+		require.NoError(t, err)
+		require.Equal(t, []Drift{
+			{
+				LibraryUid:       "l1",
+				BookUid:          "b1",
+				ActiveLoans:      2,
+				CheckedOutCopies: 3,
+				ExpectedCount:    5,
+				ActualCount:      4,
+				LedgerCount:      4,
+				OrphanCopies:     []string{"c3"},
+				UnlinkedLoans:    []UnlinkedLoan{{ReservationUid: "r2", Barcode: "c2"}},
+			},
+			{
+				LibraryUid:       "l1",
+				BookUid:          "b2",
+				ActiveLoans:      1,
+				ExpectedCount:    1,
+				ActualCount:      1,
+				LedgerCount:      1,
+				LoansWithoutCopy: []string{"r3"},
+			},
+		}, report.Drifts)
+		require.Zero(t, report.Corrected)
+		require.NotContains(t, stub.calls, "POST http://library/copies/c3/return")
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		stub := newStub()
+
+		report, err := NewReconciler(stub, cfg).Run(context.Background(), true)
+
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Corrected)
+		require.Empty(t, report.Errors)
+		require.Contains(t, stub.calls, "POST http://library/copies/c3/return")
+		require.Contains(t, stub.calls, "PUT http://reservation/reservations/r2/copy")
+	})
+
+	t.Run("copies are read before loans", func(t *testing.T) {
+		stub := newStub()
+
+		_, err := NewReconciler(stub, cfg).Run(context.Background(), false)
+
+		require.NoError(t, err)
+		require.Equal(t, tokenCall, stub.calls[0])
+		require.Equal(t, "GET http://library/copies?status=CHECKED_OUT", stub.calls[1])
+		require.Equal(t, "GET http://reservation/reservations?status=RENTED", stub.calls[2])
+	})
+
+	t.Run("apply skips copy lent again", func(t *testing.T) {
+		stub := newStub()
+		stub.responses["GET http://library/copies/c3"] = `{"barcode": "c3", "libraryUid": "l1", "bookUid": "b1", "reservationUid": "r4"}`
+
+		report, err := NewReconciler(stub, cfg).Run(context.Background(), true)
+
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Corrected)
+		require.Empty(t, report.Errors)
+		require.NotContains(t, stub.calls, "POST http://library/copies/c3/return")
+	})
+
+	t.Run("service unavailable", func(t *testing.T) {
+		stub := newStub()
+		delete(stub.responses, "GET http://library/copies?status=CHECKED_OUT")
+
+		_, err := NewReconciler(stub, cfg).Run(context.Background(), false)
+
+		require.Error(t, err)
+	})
+}
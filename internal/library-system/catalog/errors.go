@@ -0,0 +1,8 @@
+package catalog
+
+import "errors"
+
+var (
+	errUnknownFormat = errors.New("unknown format")
+	errWrongHeader   = errors.New("wrong header")
+)
@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/config"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+//go:generate mockgen -source=handler.go -destination=handler_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/library-system/catalog -package=catalog
+
+const (
+	maxImportSize = 32 << 20
+)
+
+type catalogImporter interface {
+	Import(ctx context.Context, format string, r io.Reader, dryRun bool) (Report, error)
+}
+
+type handler struct {
+	importer catalogImporter
+	config   *config.Config
+}
+
+func NewHandler(importer catalogImporter, config *config.Config) *handler {
+	return &handler{importer: importer, config: config}
+}
+
+func (h *handler) Register(echo *echo.Echo) {
+	api := echo.Group("/api/v1")
+
+	api.Use(auth.Middleware(h.config.JWKURI))
+
+	api.POST("/catalog/import", h.ImportCatalog, auth.RequireRole(auth.AdminRole))
+}
+
+// ImportCatalog takes the file as the request body, the format is csv or jsonl. Row errors do not fail
+// the request, they are returned in the report.
+func (h *handler) ImportCatalog(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format != CSVFormat && format != JSONLFormat {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "format is wrong",
+		})
+	}
+
+	dryRun := false
+	if dryRunParam := c.QueryParam("dryRun"); dryRunParam != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(dryRunParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "dryRun is wrong",
+			})
+		}
+	}
+
+	body := http.MaxBytesReader(c.Response(), c.Request().Body, maxImportSize)
+
+	report, err := h.importer.Import(c.Request().Context(), format, body, dryRun)
+	if err != nil {
+		log.Err(err).Msg("failed to import catalog")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return c.JSON(http.StatusRequestEntityTooLarge, echo.Map{
+				"message": "file is too large",
+			})
+		}
+		if errors.Is(err, errWrongHeader) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to import catalog",
+		})
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,51 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: handler.go
+
+// Package catalog is a generated GoMock package.
+package catalog
+
+import (
+	context "context"
+	io "io"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockcatalogImporter is a mock of catalogImporter interface.
+type MockcatalogImporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockcatalogImporterMockRecorder
+}
+
+// MockcatalogImporterMockRecorder is the mock recorder for MockcatalogImporter.
+type MockcatalogImporterMockRecorder struct {
+	mock *MockcatalogImporter
+}
+
+// NewMockcatalogImporter creates a new mock instance.
+func NewMockcatalogImporter(ctrl *gomock.Controller) *MockcatalogImporter {
+	mock := &MockcatalogImporter{ctrl: ctrl}
+	mock.recorder = &MockcatalogImporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockcatalogImporter) EXPECT() *MockcatalogImporterMockRecorder {
+	return m.recorder
+}
+
+// Import mocks base method.
+func (m *MockcatalogImporter) Import(ctx context.Context, format string, r io.Reader, dryRun bool) (Report, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Import", ctx, format, r, dryRun)
+	ret0, _ := ret[0].(Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Import indicates an expected call of Import.
+func (mr *MockcatalogImporterMockRecorder) Import(ctx, format, r, dryRun interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Import", reflect.TypeOf((*MockcatalogImporter)(nil).Import), ctx, format, r, dryRun)
+}
@@ -0,0 +1,101 @@
+package catalog
+
+import (
+	"bytes"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ImportCatalog(t *testing.T) {
+	type fields struct {
+		query                string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(importer *MockcatalogImporter)
+	}{
+		{
+			name: "http-code 400: wrong format",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				query:            "?format=xml",
+			},
+
+			Prepare: func(importer *MockcatalogImporter) {
+			},
+		},
+		{
+			name: "http-code 400: wrong header",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				query:            "?format=csv",
+			},
+
+			Prepare: func(importer *MockcatalogImporter) {
+				importer.EXPECT().Import(gomock.Any(), CSVFormat, gomock.Any(), false).Return(Report{}, errWrongHeader)
+			},
+		},
+		{
+			name: "http-code 500: import error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+				query:            "?format=jsonl",
+			},
+
+			Prepare: func(importer *MockcatalogImporter) {
+				importer.EXPECT().Import(gomock.Any(), JSONLFormat, gomock.Any(), false).Return(Report{}, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: dry run report",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				query:            "?format=csv&dryRun=true",
+				expectedResponseBody: `{"dryRun":true,"rows":2,"applied":1,"createdBooks":0,"errors":[{"line":3,"message":"book not found"}]}
+`,
+			},
+
+			Prepare: func(importer *MockcatalogImporter) {
+				importer.EXPECT().Import(gomock.Any(), CSVFormat, gomock.Any(), true).
+					Return(Report{DryRun: true, Rows: 2, Applied: 1, Errors: []RowError{{Line: 3, Message: "book not found"}}}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			importer := NewMockcatalogImporter(ctrl)
+			tt.Prepare(importer)
+
+			h := &handler{importer: importer}
+
+			req := httptest.NewRequest(http.MethodPost, "/test"+tt.fields.query, bytes.NewBufferString("test"))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.ImportCatalog(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package catalog
+
+import (
+	"context"
+	"github.com/Erlendum/rsoi-lab-02/pkg/isbn"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+//go:generate mockgen -source=importer.go -destination=importer_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/library-system/catalog -package=catalog
+
+const (
+	batchSize          = 500
+	excellentCondition = "EXCELLENT"
+)
+
+type storage interface {
+	// InTx runs fn in a single transaction, which is rolled back on error or when dryRun is set.
+	InTx(ctx context.Context, dryRun bool, fn func(tx txStorage) error) error
+}
+
+type txStorage interface {
+	GetOpenLibraryIDs(ctx context.Context, uids []string) (map[string]int, error)
+	GetBookIDs(ctx context.Context, uids []string) (map[string]int, error)
+	GetBookUidsByISBN(ctx context.Context, isbns []string) (map[string]string, error)
+	UpsertBook(ctx context.Context, b book) (int, bool, error)
+	SetLibraryBookCount(ctx context.Context, libraryID, bookID, count int) error
+}
+
+type importer struct {
+	storage  storage
+	validate *validator.Validate
+}
+
+func NewImporter(storage storage) *importer {
+	return &importer{storage: storage, validate: validator.New()}
+}
+
+// Import validates every row, then applies the valid ones batch by batch in one transaction. Rows that
+// fail are listed in the report and do not stop the rest. A dry run goes through the same steps, so it
+// reports the same errors, and rolls the transaction back.
+func (i *importer) Import(ctx context.Context, format string, r io.Reader, dryRun bool) (Report, error) {
+	rows, rowErrors, err := parse(format, r)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{DryRun: dryRun, Rows: len(rows) + len(rowErrors), Errors: rowErrors}
+
+	valid := make([]row, 0, len(rows))
+	for _, rw := range rows {
+		if err := i.validate.Struct(rw); err != nil {
+			report.Errors = append(report.Errors, RowError{Line: rw.Line, Message: validationMessage(err)})
+			continue
+		}
+		if rw.ISBN != "" {
+			normalized, err := isbn.Normalize(rw.ISBN)
+			if err != nil {
+				report.Errors = append(report.Errors, RowError{Line: rw.Line, Message: "isbn is wrong"})
+				continue
+			}
+			rw.ISBN = normalized
+		}
+		valid = append(valid, rw)
+	}
+
+	err = i.storage.InTx(ctx, dryRun, func(tx txStorage) error {
+		for start := 0; start < len(valid); start += batchSize {
+			end := min(start+batchSize, len(valid))
+			err := i.applyBatch(ctx, tx, valid[start:end], &report)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, errors.Wrap(err, "failed to apply import")
+	}
+
+	sortRowErrors(report.Errors)
+	return report, nil
+}
+
+func (i *importer) applyBatch(ctx context.Context, tx txStorage, rows []row, report *Report) error {
+	libraryUids := make([]string, 0, len(rows))
+	isbns := make([]string, 0, len(rows))
+	for _, rw := range rows {
+		libraryUids = append(libraryUids, rw.LibraryUid)
+		if rw.ISBN != "" {
+			isbns = append(isbns, rw.ISBN)
+		}
+	}
+
+	libraryIDs, err := tx.GetOpenLibraryIDs(ctx, libraryUids)
+	if err != nil {
+		return err
+	}
+	uidsByISBN, err := tx.GetBookUidsByISBN(ctx, isbns)
+	if err != nil {
+		return err
+	}
+
+	bookUids := make([]string, 0, len(rows))
+	for _, rw := range rows {
+		if rw.BookUid != "" {
+			bookUids = append(bookUids, rw.BookUid)
+		} else if uid, ok := uidsByISBN[rw.ISBN]; ok {
+			bookUids = append(bookUids, uid)
+		}
+	}
+	bookIDs, err := tx.GetBookIDs(ctx, bookUids)
+	if err != nil {
+		return err
+	}
+
+	for _, rw := range rows {
+		libraryID, ok := libraryIDs[rw.LibraryUid]
+		if !ok {
+			report.Errors = append(report.Errors, RowError{Line: rw.Line, Message: "library not found or closed"})
+			continue
+		}
+
+		// an isbn finds the book without uid, with uid it must not belong to another book
+		if uid, ok := uidsByISBN[rw.ISBN]; ok {
+			if rw.BookUid == "" {
+				rw.BookUid = uid
+			} else if rw.BookUid != uid {
+				report.Errors = append(report.Errors, RowError{Line: rw.Line, Message: "isbn belongs to another book"})
+				continue
+			}
+		}
+
+		bookID, ok := bookIDs[rw.BookUid]
+		if rw.Name != "" || (ok && rw.hasBookColumns()) {
+			b := book{BookUid: rw.BookUid, Name: rw.Name, Author: rw.Author, Genre: rw.Genre, Condition: rw.Condition, ISBN: rw.ISBN}
+			if b.BookUid == "" {
+				b.BookUid = uuid.New().String()
+			}
+
+			var created bool
+			bookID, created, err = tx.UpsertBook(ctx, b)
+			if err != nil {
+				return err
+			}
+			if created {
+				report.CreatedBooks++
+			}
+			bookIDs[b.BookUid] = bookID
+			if b.ISBN != "" {
+				uidsByISBN[b.ISBN] = b.BookUid
+			}
+		} else if !ok {
+			report.Errors = append(report.Errors, RowError{Line: rw.Line, Message: "book not found"})
+			continue
+		}
+
+		err = tx.SetLibraryBookCount(ctx, libraryID, bookID, *rw.AvailableCount)
+		if err != nil {
+			return err
+		}
+		report.Applied++
+	}
+
+	return nil
+}
+
+// validationMessage lists the failed fields with their rules, e.g. "LibraryUid: uuid".
+func validationMessage(err error) string {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err.Error()
+	}
+
+	fields := make([]string, 0, len(validationErrors))
+	for _, e := range validationErrors {
+		fields = append(fields, e.Field()+": "+e.Tag())
+	}
+	return strings.Join(fields, ", ")
+}
+
+func sortRowErrors(rowErrors []RowError) {
+	slices.SortStableFunc(rowErrors, func(a, b RowError) int {
+		return a.Line - b.Line
+	})
+}
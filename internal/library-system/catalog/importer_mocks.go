@@ -0,0 +1,147 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: importer.go
+
+// Package catalog is a generated GoMock package.
+package catalog
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// Mockstorage is a mock of storage interface.
+type Mockstorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockstorageMockRecorder
+}
+
+// MockstorageMockRecorder is the mock recorder for Mockstorage.
+type MockstorageMockRecorder struct {
+	mock *Mockstorage
+}
+
+// NewMockstorage creates a new mock instance.
+func NewMockstorage(ctrl *gomock.Controller) *Mockstorage {
+	mock := &Mockstorage{ctrl: ctrl}
+	mock.recorder = &MockstorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
+	return m.recorder
+}
+
+// InTx mocks base method.
+func (m *Mockstorage) InTx(ctx context.Context, dryRun bool, fn func(txStorage) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InTx", ctx, dryRun, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InTx indicates an expected call of InTx.
+func (mr *MockstorageMockRecorder) InTx(ctx, dryRun, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InTx", reflect.TypeOf((*Mockstorage)(nil).InTx), ctx, dryRun, fn)
+}
+
+// MocktxStorage is a mock of txStorage interface.
+type MocktxStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MocktxStorageMockRecorder
+}
+
+// MocktxStorageMockRecorder is the mock recorder for MocktxStorage.
+type MocktxStorageMockRecorder struct {
+	mock *MocktxStorage
+}
+
+// NewMocktxStorage creates a new mock instance.
+func NewMocktxStorage(ctrl *gomock.Controller) *MocktxStorage {
+	mock := &MocktxStorage{ctrl: ctrl}
+	mock.recorder = &MocktxStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MocktxStorage) EXPECT() *MocktxStorageMockRecorder {
+	return m.recorder
+}
+
+// GetBookIDs mocks base method.
+func (m *MocktxStorage) GetBookIDs(ctx context.Context, uids []string) (map[string]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookIDs", ctx, uids)
+	ret0, _ := ret[0].(map[string]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBookIDs indicates an expected call of GetBookIDs.
+func (mr *MocktxStorageMockRecorder) GetBookIDs(ctx, uids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookIDs", reflect.TypeOf((*MocktxStorage)(nil).GetBookIDs), ctx, uids)
+}
+
+// GetBookUidsByISBN mocks base method.
+func (m *MocktxStorage) GetBookUidsByISBN(ctx context.Context, isbns []string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookUidsByISBN", ctx, isbns)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBookUidsByISBN indicates an expected call of GetBookUidsByISBN.
+func (mr *MocktxStorageMockRecorder) GetBookUidsByISBN(ctx, isbns interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookUidsByISBN", reflect.TypeOf((*MocktxStorage)(nil).GetBookUidsByISBN), ctx, isbns)
+}
+
+// GetOpenLibraryIDs mocks base method.
+func (m *MocktxStorage) GetOpenLibraryIDs(ctx context.Context, uids []string) (map[string]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOpenLibraryIDs", ctx, uids)
+	ret0, _ := ret[0].(map[string]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOpenLibraryIDs indicates an expected call of GetOpenLibraryIDs.
+func (mr *MocktxStorageMockRecorder) GetOpenLibraryIDs(ctx, uids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOpenLibraryIDs", reflect.TypeOf((*MocktxStorage)(nil).GetOpenLibraryIDs), ctx, uids)
+}
+
+// SetLibraryBookCount mocks base method.
+func (m *MocktxStorage) SetLibraryBookCount(ctx context.Context, libraryID, bookID, count int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetLibraryBookCount", ctx, libraryID, bookID, count)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetLibraryBookCount indicates an expected call of SetLibraryBookCount.
+func (mr *MocktxStorageMockRecorder) SetLibraryBookCount(ctx, libraryID, bookID, count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLibraryBookCount", reflect.TypeOf((*MocktxStorage)(nil).SetLibraryBookCount), ctx, libraryID, bookID, count)
+}
+
+// UpsertBook mocks base method.
+func (m *MocktxStorage) UpsertBook(ctx context.Context, b book) (int, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertBook", ctx, b)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// UpsertBook indicates an expected call of UpsertBook.
+func (mr *MocktxStorageMockRecorder) UpsertBook(ctx, b interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertBook", reflect.TypeOf((*MocktxStorage)(nil).UpsertBook), ctx, b)
+}
@@ -0,0 +1,164 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+const (
+	testLibraryUid = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+	testBookUid    = "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+	unknownUid     = "00000000-0000-0000-0000-000000000000"
+)
+
+func Test_Import(t *testing.T) {
+	type fields struct {
+		format      string
+		file        string
+		dryRun      bool
+		expected    Report
+		expectedErr error
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(storage *Mockstorage, tx *MocktxStorage)
+	}{
+		{
+			name: "wrong header",
+			fields: fields{
+				format:      CSVFormat,
+				file:        "library_uid,count\n",
+				expectedErr: errWrongHeader,
+			},
+			Prepare: func(storage *Mockstorage, tx *MocktxStorage) {},
+		},
+		{
+			name: "storage error",
+			fields: fields{
+				format:      JSONLFormat,
+				file:        `{"libraryUid": "` + testLibraryUid + `", "bookUid": "` + testBookUid + `", "availableCount": 1}`,
+				expectedErr: errors.New(""),
+			},
+			Prepare: func(storage *Mockstorage, tx *MocktxStorage) {
+				storage.EXPECT().InTx(gomock.Any(), false, gomock.Any()).DoAndReturn(func(_ context.Context, _ bool, fn func(tx txStorage) error) error {
+					return fn(tx)
+				})
+				tx.EXPECT().GetOpenLibraryIDs(gomock.Any(), []string{testLibraryUid}).Return(nil, errors.New(""))
+			},
+		},
+		{
+			name: "rows are applied and errors are reported by line",
+			fields: fields{
+				format: CSVFormat,
+				dryRun: true,
+				file: "library_uid,book_uid,name,author,available_count\n" +
+					testLibraryUid + "," + testBookUid + ",,,3\n" +
+					testLibraryUid + ",,Новая книга,Автор,2\n" +
+					"test,,Книга,,1\n" +
+					testLibraryUid + ",,,,1\n" +
+					unknownUid + "," + testBookUid + ",,,1\n" +
+					testLibraryUid + "," + unknownUid + ",,,1\n" +
+					testLibraryUid + "," + testBookUid + ",,,many\n",
+				expected: Report{
+					DryRun:       true,
+					Rows:         7,
+					Applied:      2,
+					CreatedBooks: 1,
+					Errors: []RowError{
+						{Line: 4, Message: "LibraryUid: uuid"},
+						{Line: 5, Message: "Name: required_without_all"},
+						{Line: 6, Message: "library not found or closed"},
+						{Line: 7, Message: "book not found"},
+						{Line: 8, Message: "available_count is wrong"},
+					},
+				},
+			},
+			Prepare: func(storage *Mockstorage, tx *MocktxStorage) {
+				storage.EXPECT().InTx(gomock.Any(), true, gomock.Any()).DoAndReturn(func(_ context.Context, _ bool, fn func(tx txStorage) error) error {
+					return fn(tx)
+				})
+				tx.EXPECT().GetOpenLibraryIDs(gomock.Any(), gomock.Any()).Return(map[string]int{testLibraryUid: 1}, nil)
+				tx.EXPECT().GetBookUidsByISBN(gomock.Any(), []string{}).Return(map[string]string{}, nil)
+				tx.EXPECT().GetBookIDs(gomock.Any(), []string{testBookUid, testBookUid, unknownUid}).Return(map[string]int{testBookUid: 10}, nil)
+				tx.EXPECT().SetLibraryBookCount(gomock.Any(), 1, 10, 3).Return(nil)
+				tx.EXPECT().UpsertBook(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, b book) (int, bool, error) {
+					require.NotEmpty(t, b.BookUid)
+					require.Equal(t, "Новая книга", b.Name)
+					require.Empty(t, b.Condition)
+					return 11, true, nil
+				})
+				tx.EXPECT().SetLibraryBookCount(gomock.Any(), 1, 11, 2).Return(nil)
+			},
+		},
+		{
+			name: "books are found by isbn and keep the columns a row leaves out",
+			fields: fields{
+				format: CSVFormat,
+				file: "library_uid,book_uid,isbn,name,genre,available_count\n" +
+					testLibraryUid + ",,978-0-306-40615-7,,Научная литература,4\n" +
+					testLibraryUid + ",,0-306-40615-2,,,5\n" +
+					testLibraryUid + ",,9780306406158,,,1\n" +
+					testLibraryUid + "," + unknownUid + ",9780306406157,,,1\n" +
+					testLibraryUid + ",,9781861972712,,,1\n" +
+					testLibraryUid + ",,9780141439518,Новая книга,,2\n",
+				expected: Report{
+					Rows:         6,
+					Applied:      3,
+					CreatedBooks: 1,
+					Errors: []RowError{
+						{Line: 4, Message: "isbn is wrong"},
+						{Line: 5, Message: "isbn belongs to another book"},
+						{Line: 6, Message: "book not found"},
+					},
+				},
+			},
+			Prepare: func(storage *Mockstorage, tx *MocktxStorage) {
+				storage.EXPECT().InTx(gomock.Any(), false, gomock.Any()).DoAndReturn(func(_ context.Context, _ bool, fn func(tx txStorage) error) error {
+					return fn(tx)
+				})
+				tx.EXPECT().GetOpenLibraryIDs(gomock.Any(), gomock.Any()).Return(map[string]int{testLibraryUid: 1}, nil)
+				tx.EXPECT().GetBookUidsByISBN(gomock.Any(), []string{"9780306406157", "9780306406157", "9780306406157", "9781861972712", "9780141439518"}).
+					Return(map[string]string{"9780306406157": testBookUid}, nil)
+				tx.EXPECT().GetBookIDs(gomock.Any(), []string{testBookUid, testBookUid, unknownUid}).Return(map[string]int{testBookUid: 10}, nil)
+				tx.EXPECT().UpsertBook(gomock.Any(), book{BookUid: testBookUid, Genre: "Научная литература", ISBN: "9780306406157"}).Return(10, false, nil)
+				tx.EXPECT().SetLibraryBookCount(gomock.Any(), 1, 10, 4).Return(nil)
+				tx.EXPECT().UpsertBook(gomock.Any(), book{BookUid: testBookUid, ISBN: "9780306406157"}).Return(10, false, nil)
+				tx.EXPECT().SetLibraryBookCount(gomock.Any(), 1, 10, 5).Return(nil)
+				tx.EXPECT().UpsertBook(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, b book) (int, bool, error) {
+					require.NotEmpty(t, b.BookUid)
+					require.Equal(t, "9780141439518", b.ISBN)
+					return 11, true, nil
+				})
+				tx.EXPECT().SetLibraryBookCount(gomock.Any(), 1, 11, 2).Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			storage := NewMockstorage(ctrl)
+			tx := NewMocktxStorage(ctrl)
+			tt.Prepare(storage, tx)
+
+			report, err := NewImporter(storage).Import(context.Background(), tt.fields.format, strings.NewReader(tt.fields.file), tt.fields.dryRun)
+			if tt.fields.expectedErr != nil {
+				require.Error(t, err)
+				if errors.Is(tt.fields.expectedErr, errWrongHeader) {
+					require.ErrorIs(t, err, errWrongHeader)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expected, report)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package catalog
+
+// row is one line of an import file. The book is found by bookUid or, without it, by isbn. A row with a name
+// creates the book when none is found, a found book gets the columns the row gives and keeps the others,
+// and a row with no book columns only refers to an existing book.
+type row struct {
+	Line           int    `json:"-"`
+	LibraryUid     string `json:"libraryUid" validate:"required,uuid"`
+	BookUid        string `json:"bookUid" validate:"omitempty,uuid"`
+	ISBN           string `json:"isbn"`
+	Name           string `json:"name" validate:"required_without_all=BookUid ISBN,max=255"`
+	Author         string `json:"author" validate:"max=255"`
+	Genre          string `json:"genre" validate:"max=255"`
+	Condition      string `json:"condition" validate:"omitempty,oneof=EXCELLENT GOOD BAD"`
+	AvailableCount *int   `json:"availableCount" validate:"required,gte=0"`
+}
+
+// hasBookColumns tells whether the row gives anything to store on the book.
+func (r row) hasBookColumns() bool {
+	return r.Name != "" || r.Author != "" || r.Genre != "" || r.Condition != "" || r.ISBN != ""
+}
+
+// book holds the columns to store, an empty one keeps the stored value.
+type book struct {
+	BookUid   string `db:"book_uid"`
+	Name      string `db:"name"`
+	Author    string `db:"author"`
+	Genre     string `db:"genre"`
+	Condition string `db:"condition"`
+	ISBN      string `db:"isbn"`
+}
+
+type RowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type Report struct {
+	DryRun       bool       `json:"dryRun"`
+	Rows         int        `json:"rows"`
+	Applied      int        `json:"applied"`
+	CreatedBooks int        `json:"createdBooks"`
+	Errors       []RowError `json:"errors"`
+}
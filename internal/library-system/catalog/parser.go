@@ -0,0 +1,142 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	CSVFormat   = "csv"
+	JSONLFormat = "jsonl"
+)
+
+var (
+	csvColumns         = []string{"library_uid", "book_uid", "isbn", "name", "author", "genre", "condition", "available_count"}
+	requiredCSVColumns = []string{"library_uid", "available_count"}
+)
+
+// parse reads every row it can, rows that cannot be read are reported instead of stopping the import.
+// Only an unreadable file as a whole is an error.
+func parse(format string, r io.Reader) ([]row, []RowError, error) {
+	switch format {
+	case CSVFormat:
+		return parseCSV(r)
+	case JSONLFormat:
+		return parseJSONL(r)
+	default:
+		return nil, nil, errUnknownFormat
+	}
+}
+
+func parseCSV(r io.Reader) ([]row, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.Wrap(errWrongHeader, err.Error())
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(csvColumns, name) {
+			return nil, nil, errors.Wrapf(errWrongHeader, "unknown column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range requiredCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, errors.Wrapf(errWrongHeader, "column %q is required", name)
+		}
+	}
+
+	value := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rows := make([]row, 0)
+	rowErrors := make([]RowError, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+				rowErrors = append(rowErrors, RowError{Line: line, Message: "wrong number of fields"})
+				continue
+			}
+			return nil, nil, errors.Wrap(err, "failed to read csv")
+		}
+
+		rw := row{
+			Line:       line,
+			LibraryUid: value(record, "library_uid"),
+			BookUid:    value(record, "book_uid"),
+			ISBN:       value(record, "isbn"),
+			Name:       value(record, "name"),
+			Author:     value(record, "author"),
+			Genre:      value(record, "genre"),
+			Condition:  value(record, "condition"),
+		}
+		if count := value(record, "available_count"); count != "" {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				rowErrors = append(rowErrors, RowError{Line: line, Message: "available_count is wrong"})
+				continue
+			}
+			rw.AvailableCount = &n
+		}
+		rows = append(rows, rw)
+	}
+
+	return rows, rowErrors, nil
+}
+
+func parseJSONL(r io.Reader) ([]row, []RowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	rows := make([]row, 0)
+	rowErrors := make([]RowError, 0)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		rw := row{}
+		err := json.Unmarshal(data, &rw)
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, Message: fmt.Sprintf("wrong json: %s", err.Error())})
+			continue
+		}
+		rw.Line = line
+		rw.LibraryUid = strings.TrimSpace(rw.LibraryUid)
+		rw.BookUid = strings.TrimSpace(rw.BookUid)
+		rw.ISBN = strings.TrimSpace(rw.ISBN)
+		rw.Name = strings.TrimSpace(rw.Name)
+		rw.Author = strings.TrimSpace(rw.Author)
+		rw.Genre = strings.TrimSpace(rw.Genre)
+		rows = append(rows, rw)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read jsonl")
+	}
+
+	return rows, rowErrors, nil
+}
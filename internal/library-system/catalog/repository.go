@@ -0,0 +1,198 @@
+package catalog
+
+import (
+	"context"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+
+	importReason             = "IMPORT"
+	setInventoryContextQuery = `SELECT set_config('inventory.reason', $1, true), set_config('inventory.actor', $2, true);`
+)
+
+type repository struct {
+	conn *sqlx.DB
+}
+
+func NewRepository(conn *sqlx.DB) *repository {
+	return &repository{conn: conn}
+}
+
+func (r *repository) InTx(ctx context.Context, dryRun bool, fn func(tx txStorage) error) error {
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	// stock changes of the import are written to the inventory ledger under their own reason
+	_, err = tx.ExecContext(ctx, setInventoryContextQuery, importReason, auth.GetUser(ctx))
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "failed to set inventory context")
+	}
+
+	err = fn(&txRepository{tx: tx})
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if dryRun {
+		return errors.Wrap(tx.Rollback(), "failed to rollback transaction")
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
+
+type txRepository struct {
+	tx *sqlx.Tx
+}
+
+func (r *txRepository) GetOpenLibraryIDs(ctx context.Context, uids []string) (map[string]int, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Select("id", "library_uid").
+		From("library").
+		Where(sq.Eq{"library_uid": uids, "closed_at": nil})
+
+	return r.selectIDs(ctx, builder, "library_uid")
+}
+
+func (r *txRepository) GetBookIDs(ctx context.Context, uids []string) (map[string]int, error) {
+	if len(uids) == 0 {
+		return map[string]int{}, nil
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Select("id", "book_uid").
+		From("books").
+		Where(sq.Eq{"book_uid": uids})
+
+	return r.selectIDs(ctx, builder, "book_uid")
+}
+
+// GetBookUidsByISBN maps the isbns of known books to their uids.
+func (r *txRepository) GetBookUidsByISBN(ctx context.Context, isbns []string) (map[string]string, error) {
+	if len(isbns) == 0 {
+		return map[string]string{}, nil
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	query, args, err := psql.Select("isbn", "book_uid").
+		From("books").
+		Where(sq.Eq{"isbn": isbns}).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	rows, err := r.tx.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+	defer rows.Close()
+
+	uids := make(map[string]string)
+	for rows.Next() {
+		var isbn, uid string
+		err = rows.Scan(&isbn, &uid)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan book_uid")
+		}
+		uids[isbn] = uid
+	}
+
+	return uids, errors.Wrap(rows.Err(), "failed to read rows")
+}
+
+func (r *txRepository) selectIDs(ctx context.Context, builder sq.SelectBuilder, uidColumn string) (map[string]int, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	rows, err := r.tx.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int)
+	for rows.Next() {
+		var (
+			id  int
+			uid string
+		)
+		err = rows.Scan(&id, &uid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to scan %s", uidColumn)
+		}
+		ids[uid] = id
+	}
+
+	return ids, errors.Wrap(rows.Err(), "failed to read rows")
+}
+
+// UpsertBook creates the book or updates the metadata the import gives, empty columns keep the stored value.
+// A new book without condition is excellent. It reports whether the book was created.
+func (r *txRepository) UpsertBook(ctx context.Context, b book) (int, bool, error) {
+	query := `
+INSERT INTO books (book_uid, name, author, genre, condition, isbn)
+VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), $7), NULLIF($6, ''))
+ON CONFLICT (book_uid) DO UPDATE
+SET name      = COALESCE(NULLIF($2, ''), books.name),
+    author    = COALESCE(NULLIF($3, ''), books.author),
+    genre     = COALESCE(NULLIF($4, ''), books.genre),
+    condition = COALESCE(NULLIF($5, ''), books.condition),
+    isbn      = COALESCE(NULLIF($6, ''), books.isbn)
+RETURNING id, (xmax = 0) AS created;
+`
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var (
+		id      int
+		created bool
+	)
+	err := r.tx.QueryRowxContext(ctx, query, b.BookUid, b.Name, b.Author, b.Genre, b.Condition, b.ISBN, excellentCondition).Scan(&id, &created)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed to execute query")
+	}
+
+	return id, created, nil
+}
+
+func (r *txRepository) SetLibraryBookCount(ctx context.Context, libraryID, bookID, count int) error {
+	query := `
+INSERT INTO library_books (library_id, book_id, available_count)
+VALUES ($1, $2, 0)
+ON CONFLICT (library_id, book_id) DO NOTHING;
+`
+	setCountQuery := `SELECT set_available_copies($1, $2, $3);`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	_, err := r.tx.ExecContext(ctx, query, libraryID, bookID)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	_, err = r.tx.ExecContext(ctx, setCountQuery, libraryID, bookID, count)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	return nil
+}
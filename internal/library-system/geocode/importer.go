@@ -0,0 +1,96 @@
+package geocode
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//go:generate mockgen -source=importer.go -destination=importer_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/library-system/geocode -package=geocode
+
+type storage interface {
+	SetLibraryLocation(ctx context.Context, city, address string, lat, lon float64) (int, error)
+}
+
+var header = []string{"city", "address", "latitude", "longitude"}
+
+type location struct {
+	city     string
+	address  string
+	lat, lon float64
+}
+
+type Result struct {
+	Rows      int
+	Updated   int
+	Unmatched []string
+}
+
+type importer struct {
+	storage storage
+}
+
+func NewImporter(storage storage) *importer {
+	return &importer{storage: storage}
+}
+
+// Import reads a geocoder export in CSV with the city,address,latitude,longitude header. The whole file is
+// validated before anything is written, and re-running it is safe.
+func (i *importer) Import(ctx context.Context, r io.Reader) (Result, error) {
+	locations, err := parse(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{Rows: len(locations), Unmatched: make([]string, 0)}
+	for _, l := range locations {
+		updated, err := i.storage.SetLibraryLocation(ctx, l.city, l.address, l.lat, l.lon)
+		if err != nil {
+			return res, errors.Wrapf(err, "failed to set location of %s, %s", l.city, l.address)
+		}
+		if updated == 0 {
+			res.Unmatched = append(res.Unmatched, l.city+", "+l.address)
+		}
+		res.Updated += updated
+	}
+
+	return res, nil
+}
+
+func parse(r io.Reader) ([]location, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(header)
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read csv")
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(header, ",") {
+		return nil, fmt.Errorf("header must be %s", strings.Join(header, ","))
+	}
+
+	locations := make([]location, 0, len(records)-1)
+	for n, record := range records[1:] {
+		line := n + 2
+		l := location{city: strings.TrimSpace(record[0]), address: strings.TrimSpace(record[1])}
+		if l.city == "" || l.address == "" {
+			return nil, fmt.Errorf("line %d: city and address are required", line)
+		}
+		l.lat, err = strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil || l.lat < -90 || l.lat > 90 {
+			return nil, fmt.Errorf("line %d: latitude is wrong", line)
+		}
+		l.lon, err = strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		if err != nil || l.lon < -180 || l.lon > 180 {
+			return nil, fmt.Errorf("line %d: longitude is wrong", line)
+		}
+		locations = append(locations, l)
+	}
+
+	return locations, nil
+}
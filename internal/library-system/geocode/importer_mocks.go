@@ -0,0 +1,50 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: importer.go
+
+// Package geocode is a generated GoMock package.
+package geocode
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// Mockstorage is a mock of storage interface.
+type Mockstorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockstorageMockRecorder
+}
+
+// MockstorageMockRecorder is the mock recorder for Mockstorage.
+type MockstorageMockRecorder struct {
+	mock *Mockstorage
+}
+
+// NewMockstorage creates a new mock instance.
+func NewMockstorage(ctrl *gomock.Controller) *Mockstorage {
+	mock := &Mockstorage{ctrl: ctrl}
+	mock.recorder = &MockstorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
+	return m.recorder
+}
+
+// SetLibraryLocation mocks base method.
+func (m *Mockstorage) SetLibraryLocation(ctx context.Context, city, address string, lat, lon float64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetLibraryLocation", ctx, city, address, lat, lon)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetLibraryLocation indicates an expected call of SetLibraryLocation.
+func (mr *MockstorageMockRecorder) SetLibraryLocation(ctx, city, address, lat, lon interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLibraryLocation", reflect.TypeOf((*Mockstorage)(nil).SetLibraryLocation), ctx, city, address, lat, lon)
+}
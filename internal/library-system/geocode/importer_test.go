@@ -0,0 +1,72 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func Test_Import(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		expected    Result
+		expectedErr bool
+		Prepare     func(storage *Mockstorage)
+	}{
+		{
+			name:        "wrong header",
+			file:        "name,lat,lon\ntest,1,1\n",
+			expectedErr: true,
+			Prepare:     func(storage *Mockstorage) {},
+		},
+		{
+			name:        "wrong latitude, nothing is written",
+			file:        "city,address,latitude,longitude\nМосква,first,55.76,37.68\nМосква,second,95,37.68\n",
+			expectedErr: true,
+			Prepare:     func(storage *Mockstorage) {},
+		},
+		{
+			name:        "storage error",
+			file:        "city,address,latitude,longitude\nМосква,first,55.76,37.68\n",
+			expectedErr: true,
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().SetLibraryLocation(gomock.Any(), "Москва", "first", 55.76, 37.68).Return(0, errors.New(""))
+			},
+		},
+		{
+			name: "success",
+			file: "city,address,latitude,longitude\nМосква,\"2-я Бауманская ул., д.5, стр.1\",55.766,37.685\nМосква,unknown,55.7,37.6\n",
+			expected: Result{
+				Rows:      2,
+				Updated:   1,
+				Unmatched: []string{"Москва, unknown"},
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().SetLibraryLocation(gomock.Any(), "Москва", "2-я Бауманская ул., д.5, стр.1", 55.766, 37.685).Return(1, nil)
+				storage.EXPECT().SetLibraryLocation(gomock.Any(), "Москва", "unknown", 55.7, 37.6).Return(0, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			storage := NewMockstorage(ctrl)
+			tt.Prepare(storage)
+
+			res, err := NewImporter(storage).Import(context.Background(), strings.NewReader(tt.file))
+			if tt.expectedErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, res)
+		})
+	}
+}
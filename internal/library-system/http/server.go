@@ -16,21 +16,79 @@ type libraryHandler interface {
 	GetLibraries(c echo.Context) error
 	GetBooksByLibrary(c echo.Context) error
 	GetBooksByUids(c echo.Context) error
+	SearchBooks(c echo.Context) error
+	GetBookAvailability(c echo.Context) error
+	GetBookByISBN(c echo.Context) error
+	GetCopy(c echo.Context) error
+	GetCopies(c echo.Context) error
+	CheckoutCopy(c echo.Context) error
+	ReturnCopy(c echo.Context) error
+	GetInventory(c echo.Context) error
+	GetStock(c echo.Context) error
 	GetLibrariesByUids(c echo.Context) error
+	GetNearbyLibraries(c echo.Context) error
 	UpdateBooksAvailableCount(c echo.Context) error
+	CreateLibrary(c echo.Context) error
+	UpdateLibrary(c echo.Context) error
+	CloseLibrary(c echo.Context) error
+	CreateBook(c echo.Context) error
+	UpdateBook(c echo.Context) error
+	UpsertLibraryBook(c echo.Context) error
+	DeleteLibraryBook(c echo.Context) error
+}
+
+type catalogHandler interface {
+	Register(echo *echo.Echo)
+	ImportCatalog(c echo.Context) error
+}
+
+type scheduleHandler interface {
+	Register(echo *echo.Echo)
+	GetSchedule(c echo.Context) error
+	GetNextOpenDay(c echo.Context) error
+	GetCalendar(c echo.Context) error
+	SetOpeningHours(c echo.Context) error
+	SetClosure(c echo.Context) error
+	DeleteClosure(c echo.Context) error
+}
+
+type transferHandler interface {
+	Register(echo *echo.Echo)
+	GetTransfers(c echo.Context) error
+	GetTransfer(c echo.Context) error
+	CreateTransfer(c echo.Context) error
+	DispatchTransfer(c echo.Context) error
+	ReceiveTransfer(c echo.Context) error
+}
+
+type policyHandler interface {
+	Register(echo *echo.Echo)
+	GetPolicies(c echo.Context) error
+	GetBookPolicy(c echo.Context) error
+	SetPolicy(c echo.Context) error
+	DeletePolicy(c echo.Context) error
 }
 
 type server struct {
-	echo           *echo.Echo
-	cfg            *config.Server
-	libraryHandler libraryHandler
+	echo            *echo.Echo
+	cfg             *config.Server
+	libraryHandler  libraryHandler
+	catalogHandler  catalogHandler
+	transferHandler transferHandler
+	scheduleHandler scheduleHandler
+	policyHandler   policyHandler
 }
 
-func NewServer(cfg *config.Server, libraryHandler libraryHandler) *server {
+func NewServer(cfg *config.Server, libraryHandler libraryHandler, catalogHandler catalogHandler,
+	transferHandler transferHandler, scheduleHandler scheduleHandler, policyHandler policyHandler) *server {
 	return &server{
-		echo:           echo.New(),
-		libraryHandler: libraryHandler,
-		cfg:            cfg,
+		echo:            echo.New(),
+		libraryHandler:  libraryHandler,
+		catalogHandler:  catalogHandler,
+		transferHandler: transferHandler,
+		scheduleHandler: scheduleHandler,
+		policyHandler:   policyHandler,
+		cfg:             cfg,
 	}
 }
 
@@ -54,6 +112,10 @@ func (s *server) Init() error {
 	})
 
 	s.libraryHandler.Register(s.echo)
+	s.catalogHandler.Register(s.echo)
+	s.transferHandler.Register(s.echo)
+	s.scheduleHandler.Register(s.echo)
+	s.policyHandler.Register(s.echo)
 	return nil
 }
 
@@ -0,0 +1,55 @@
+package library
+
+import (
+	"encoding/base64"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"strconv"
+)
+
+// page is either offset based or, when AfterID is set, continues right after the row with that id.
+type page struct {
+	Offset  int
+	Limit   int
+	AfterID int
+}
+
+// encodeCursor hides the id behind an opaque token, so clients do not depend on its meaning.
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to decode cursor")
+	}
+	id, err := strconv.Atoi(string(raw))
+	if err != nil || id <= 0 {
+		return 0, errors.New("cursor is wrong")
+	}
+	return id, nil
+}
+
+// parsePage reads size and either after or page, the page number is 0 for cursor requests.
+func parsePage(c echo.Context) (page, int, error) {
+	size, err := strconv.Atoi(c.QueryParam("size"))
+	if err != nil || size <= 0 {
+		return page{}, 0, errors.New("size is wrong")
+	}
+
+	if after := c.QueryParam("after"); after != "" {
+		afterID, err := decodeCursor(after)
+		if err != nil {
+			return page{}, 0, errors.New("after is wrong")
+		}
+		return page{Limit: size, AfterID: afterID}, 0, nil
+	}
+
+	pageNum, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || pageNum <= 0 {
+		return page{}, 0, errors.New("page is wrong")
+	}
+
+	return page{Offset: pageNum*size - size, Limit: size}, pageNum, nil
+}
@@ -6,4 +6,7 @@ var (
 	errLibraryNotFound = errors.New("library not found")
 	errBookNotFound    = errors.New("book not found")
 	errRecordNotFound  = errors.New("record not found")
+	errISBNTaken       = errors.New("isbn is already taken")
+	errCopyNotFound    = errors.New("copy not found")
+	errCopyUnavailable = errors.New("copy is not available")
 )
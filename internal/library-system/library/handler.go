@@ -2,24 +2,67 @@ package library
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/Erlendum/rsoi-lab-02/internal/library-system/config"
 	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	"github.com/Erlendum/rsoi-lab-02/pkg/isbn"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	excellentCondition = "EXCELLENT"
+
+	availableStatus  = "AVAILABLE"
+	checkedOutStatus = "CHECKED_OUT"
+	inTransitStatus  = "IN_TRANSIT"
+	withdrawnStatus  = "WITHDRAWN"
+
+	checkoutReason   = "CHECKOUT"
+	returnReason     = "RETURN"
+	holdReason       = "HOLD"
+	adjustmentReason = "ADJUSTMENT"
+
+	defaultNearbyRadiusKm = 5.0
+	maxNearbyRadiusKm     = 100.0
+	defaultNearbySize     = 20
+	maxNearbySize         = 100
 )
 
 //go:generate mockgen -source=handler.go -destination=handler_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/library-system/library -package=library
 
 type storage interface {
-	GetLibraries(ctx context.Context, city string, offset, limit int) ([]library, error)
-	GetBooksByLibrary(ctx context.Context, libraryUid string, offset, limit int, showAll bool) ([]book, error)
+	GetLibraries(ctx context.Context, city string, p page) ([]library, int, error)
+	GetBooksByLibrary(ctx context.Context, libraryUid string, p page, showAll bool) ([]book, int, error)
 	GetBooksAvailableCount(ctx context.Context, libraryUid, bookUid string) (int, error)
 	GetBooksByUids(ctx context.Context, uids []string) ([]book, error)
+	GetBookByISBN(ctx context.Context, isbn string) (book, error)
 	GetLibrariesByUids(ctx context.Context, uids []string) ([]library, error)
-	UpdateBooksAvailableCount(ctx context.Context, libraryUid, bookUid string, count int) error
+	UpdateBooksAvailableCount(ctx context.Context, libraryUid, bookUid string, count int, reason string) error
+	CreateLibrary(ctx context.Context, l *library) (library, error)
+	UpdateLibrary(ctx context.Context, l *library) (library, error)
+	CloseLibrary(ctx context.Context, libraryUid string) error
+	CreateBook(ctx context.Context, b *book) (book, error)
+	UpdateBook(ctx context.Context, b *book) (book, error)
+	UpsertLibraryBook(ctx context.Context, libraryUid, bookUid string, count int) (bool, error)
+	DeleteLibraryBook(ctx context.Context, libraryUid, bookUid string) error
+	SearchBooks(ctx context.Context, filter searchFilter, offset, limit int) ([]foundBook, error)
+	GetBooksAvailability(ctx context.Context, bookIDs []int, city string) ([]bookAvailability, error)
+	GetNearbyLibraries(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]nearbyLibrary, error)
+	GetCopy(ctx context.Context, barcode string) (bookCopy, error)
+	GetCopies(ctx context.Context, status string) ([]bookCopy, error)
+	CheckoutCopy(ctx context.Context, libraryUid, bookUid, barcode, reservationUid string) (bookCopy, error)
+	ReturnCopy(ctx context.Context, barcode, condition string) (bookCopy, error)
+	GetInventoryCount(ctx context.Context, libraryUid, bookUid string, at time.Time) (int, error)
+	GetStockCount(ctx context.Context, libraryUid, bookUid string) (int, error)
 }
 
 type handler struct {
@@ -39,8 +82,25 @@ func (h *handler) Register(echo *echo.Echo) {
 	api.GET("/libraries", h.GetLibraries)
 	api.GET("/libraries/:uid/books", h.GetBooksByLibrary)
 	api.GET("/books/", h.GetBooksByUids)
+	api.GET("/books/search", h.SearchBooks)
+	api.GET("/books/isbn/:isbn", h.GetBookByISBN)
+	api.GET("/books/:uid/availability", h.GetBookAvailability)
 	api.GET("/libraries/by-uids", h.GetLibrariesByUids)
-	api.PUT("/libraries/:libraryuid/books/:bookuid", h.UpdateBooksAvailableCount)
+	api.GET("/libraries/nearby", h.GetNearbyLibraries)
+	api.PUT("/libraries/:libraryuid/books/:bookuid", h.UpdateBooksAvailableCount, auth.RequireRole(auth.AdminRole, auth.ServiceRole))
+	api.POST("/libraries/:libraryuid/books/:bookuid/checkout", h.CheckoutCopy, auth.RequireRole(auth.LibrarianRole, auth.ServiceRole))
+	api.GET("/libraries/:libraryuid/books/:bookuid/inventory", h.GetInventory, auth.RequireRole(auth.LibrarianRole, auth.AdminRole, auth.ServiceRole))
+	api.GET("/libraries/:libraryuid/books/:bookuid/stock", h.GetStock)
+	api.GET("/copies", h.GetCopies, auth.RequireRole(auth.LibrarianRole, auth.AdminRole, auth.ServiceRole))
+	api.GET("/copies/:barcode", h.GetCopy, auth.RequireRole(auth.LibrarianRole, auth.ServiceRole))
+	api.POST("/copies/:barcode/return", h.ReturnCopy, auth.RequireRole(auth.LibrarianRole, auth.ServiceRole))
+	api.POST("/libraries", h.CreateLibrary, auth.RequireRole(auth.AdminRole))
+	api.PUT("/libraries/:uid", h.UpdateLibrary, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:uid", h.CloseLibrary, auth.RequireRole(auth.AdminRole))
+	api.POST("/books", h.CreateBook, auth.RequireRole(auth.AdminRole))
+	api.PUT("/books/:uid", h.UpdateBook, auth.RequireRole(auth.AdminRole))
+	api.POST("/libraries/:libraryuid/books", h.UpsertLibraryBook, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryuid/books/:bookuid", h.DeleteLibraryBook, auth.RequireRole(auth.AdminRole))
 }
 
 func (h *handler) GetLibraries(c echo.Context) error {
@@ -51,29 +111,17 @@ func (h *handler) GetLibraries(c echo.Context) error {
 		})
 	}
 
-	pageParam := c.QueryParam("page")
-	page, err := strconv.Atoi(pageParam)
-	if err != nil || page <= 0 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"message": "page is wrong",
-		})
-	}
-
-	sizeParam := c.QueryParam("size")
-	size, err := strconv.Atoi(sizeParam)
-	if err != nil || size <= 0 {
+	p, pageNum, err := parsePage(c)
+	if err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{
-			"message": "size is wrong",
+			"message": err.Error(),
 		})
 	}
 
-	libraries, err := h.storage.GetLibraries(c.Request().Context(), city, page*size-size, size)
+	libraries, total, err := h.storage.GetLibraries(c.Request().Context(), city, p)
 
 	if err != nil {
 		log.Err(err).Msg("failed to get libraries")
-		if errors.Is(err, errLibraryNotFound) {
-			return c.NoContent(http.StatusNoContent)
-		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{
 			"message": "failed to get libraries",
 		})
@@ -89,6 +137,7 @@ func (h *handler) GetLibraries(c echo.Context) error {
 		Page          int    `json:"page"`
 		PageSize      int    `json:"pageSize"`
 		TotalElements int    `json:"totalElements"`
+		NextCursor    string `json:"nextCursor,omitempty"`
 		Items         []item `json:"items"`
 	}
 
@@ -102,11 +151,14 @@ func (h *handler) GetLibraries(c echo.Context) error {
 		})
 	}
 	res := response{
-		Page:          page,
-		PageSize:      size,
-		TotalElements: len(libraries),
+		Page:          pageNum,
+		PageSize:      p.Limit,
+		TotalElements: total,
 		Items:         items,
 	}
+	if len(libraries) == p.Limit {
+		res.NextCursor = encodeCursor(libraries[len(libraries)-1].ID)
+	}
 
 	return c.JSON(http.StatusOK, res)
 
@@ -120,19 +172,10 @@ func (h *handler) GetBooksByLibrary(c echo.Context) error {
 		})
 	}
 
-	pageParam := c.QueryParam("page")
-	page, err := strconv.Atoi(pageParam)
-	if err != nil || page <= 0 {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"message": "page is wrong",
-		})
-	}
-
-	sizeParam := c.QueryParam("size")
-	size, err := strconv.Atoi(sizeParam)
-	if err != nil || size <= 0 {
+	p, pageNum, err := parsePage(c)
+	if err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{
-			"message": "size is wrong",
+			"message": err.Error(),
 		})
 	}
 
@@ -144,13 +187,10 @@ func (h *handler) GetBooksByLibrary(c echo.Context) error {
 		})
 	}
 
-	books, err := h.storage.GetBooksByLibrary(c.Request().Context(), libraryUid, page*size-size, size, showAll)
+	books, total, err := h.storage.GetBooksByLibrary(c.Request().Context(), libraryUid, p, showAll)
 
 	if err != nil {
 		log.Err(err).Msg("failed to get books")
-		if errors.Is(err, errBookNotFound) {
-			return c.NoContent(http.StatusNoContent)
-		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{
 			"message": "failed to get books",
 		})
@@ -168,6 +208,7 @@ func (h *handler) GetBooksByLibrary(c echo.Context) error {
 		Page          int    `json:"page"`
 		PageSize      int    `json:"pageSize"`
 		TotalElements int    `json:"totalElements"`
+		NextCursor    string `json:"nextCursor,omitempty"`
 		Items         []item `json:"items"`
 	}
 
@@ -183,11 +224,14 @@ func (h *handler) GetBooksByLibrary(c echo.Context) error {
 		})
 	}
 	res := response{
-		Page:          page,
-		PageSize:      size,
-		TotalElements: len(books),
+		Page:          pageNum,
+		PageSize:      p.Limit,
+		TotalElements: total,
 		Items:         items,
 	}
+	if len(books) == p.Limit {
+		res.NextCursor = encodeCursor(books[len(books)-1].ID)
+	}
 
 	return c.JSON(http.StatusOK, res)
 }
@@ -212,26 +256,13 @@ func (h *handler) GetBooksByUids(c echo.Context) error {
 		})
 	}
 
-	type item struct {
-		BookUid   string `json:"bookUid"`
-		Name      string `json:"name"`
-		Author    string `json:"author"`
-		Genre     string `json:"genre"`
-		Condition string `json:"condition"`
-	}
 	type response struct {
-		Data []item `json:"data"`
+		Data []bookResponse `json:"data"`
 	}
 
-	items := make([]item, 0, len(books))
+	items := make([]bookResponse, 0, len(books))
 	for _, v := range books {
-		items = append(items, item{
-			BookUid:   v.BookUid,
-			Name:      v.Name,
-			Author:    v.Author,
-			Genre:     v.Genre,
-			Condition: v.Condition,
-		})
+		items = append(items, newBookResponse(v))
 	}
 
 	res := response{
@@ -324,7 +355,18 @@ func (h *handler) UpdateBooksAvailableCount(c echo.Context) error {
 		})
 	}
 
-	err = h.storage.UpdateBooksAvailableCount(c.Request().Context(), libraryUid, bookUid, actualCount+countDiff)
+	reason := c.QueryParam("reason")
+	switch reason {
+	case "":
+		reason = adjustmentReason
+	case checkoutReason, returnReason, holdReason, adjustmentReason:
+	default:
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "reason is wrong",
+		})
+	}
+
+	err = h.storage.UpdateBooksAvailableCount(c.Request().Context(), libraryUid, bookUid, actualCount+countDiff, reason)
 	if err != nil {
 		log.Err(err).Msg("failed to update books available count")
 		if errors.Is(err, errRecordNotFound) {
@@ -339,3 +381,1004 @@ func (h *handler) UpdateBooksAvailableCount(c echo.Context) error {
 
 	return c.NoContent(http.StatusOK)
 }
+
+type libraryRequest struct {
+	Name    string `json:"name" validate:"required,max=80"`
+	City    string `json:"city" validate:"required,max=255"`
+	Address string `json:"address" validate:"required,max=255"`
+}
+
+type libraryResponse struct {
+	LibraryUid string `json:"libraryUid"`
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	City       string `json:"city"`
+}
+
+func newLibraryResponse(l library) libraryResponse {
+	return libraryResponse{
+		LibraryUid: l.LibraryUid,
+		Name:       l.Name,
+		Address:    l.Address,
+		City:       l.City,
+	}
+}
+
+// parseLibraryRequest trims the fields before validation, so blank values are rejected.
+func parseLibraryRequest(c echo.Context) (libraryRequest, error) {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return libraryRequest{}, err
+	}
+
+	req := libraryRequest{}
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return libraryRequest{}, err
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.City = strings.TrimSpace(req.City)
+	req.Address = strings.TrimSpace(req.Address)
+
+	err = c.Validate(req)
+	if err != nil {
+		return libraryRequest{}, err
+	}
+
+	return req, nil
+}
+
+func (h *handler) CreateLibrary(c echo.Context) error {
+	req, err := parseLibraryRequest(c)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to parse request body",
+		})
+	}
+
+	created, err := h.storage.CreateLibrary(c.Request().Context(), &library{
+		LibraryUid: uuid.New().String(),
+		Name:       req.Name,
+		City:       req.City,
+		Address:    req.Address,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to create library")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to create library",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, newLibraryResponse(created))
+}
+
+func (h *handler) UpdateLibrary(c echo.Context) error {
+	libraryUid := c.Param("uid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	req, err := parseLibraryRequest(c)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to parse request body",
+		})
+	}
+
+	updated, err := h.storage.UpdateLibrary(c.Request().Context(), &library{
+		LibraryUid: libraryUid,
+		Name:       req.Name,
+		City:       req.City,
+		Address:    req.Address,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to update library")
+		if errors.Is(err, errLibraryNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to update library",
+		})
+	}
+
+	return c.JSON(http.StatusOK, newLibraryResponse(updated))
+}
+
+func (h *handler) CloseLibrary(c echo.Context) error {
+	libraryUid := c.Param("uid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	err := h.storage.CloseLibrary(c.Request().Context(), libraryUid)
+	if err != nil {
+		log.Err(err).Msg("failed to close library")
+		if errors.Is(err, errLibraryNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to close library",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+type bookRequest struct {
+	Name        string  `json:"name" validate:"required,max=255"`
+	Author      string  `json:"author" validate:"max=255"`
+	Genre       string  `json:"genre" validate:"max=255"`
+	Condition   string  `json:"condition" validate:"omitempty,oneof=EXCELLENT GOOD BAD"`
+	ISBN        *string `json:"isbn"`
+	Publisher   *string `json:"publisher" validate:"omitempty,max=255"`
+	Year        *int    `json:"year" validate:"omitempty,min=1450,max=2100"`
+	Language    *string `json:"language" validate:"omitempty,max=35"`
+	PageCount   *int    `json:"pageCount" validate:"omitempty,min=1"`
+	Description *string `json:"description" validate:"omitempty,max=10000"`
+}
+
+func (r bookRequest) book(bookUid string) *book {
+	return &book{
+		BookUid:     bookUid,
+		Name:        r.Name,
+		Author:      r.Author,
+		Genre:       r.Genre,
+		Condition:   r.Condition,
+		ISBN:        r.ISBN,
+		Publisher:   r.Publisher,
+		Year:        r.Year,
+		Language:    r.Language,
+		PageCount:   r.PageCount,
+		Description: r.Description,
+	}
+}
+
+type bookResponse struct {
+	BookUid     string  `json:"bookUid"`
+	Name        string  `json:"name"`
+	Author      string  `json:"author"`
+	Genre       string  `json:"genre"`
+	Condition   string  `json:"condition"`
+	ISBN        *string `json:"isbn,omitempty"`
+	Publisher   *string `json:"publisher,omitempty"`
+	Year        *int    `json:"year,omitempty"`
+	Language    *string `json:"language,omitempty"`
+	PageCount   *int    `json:"pageCount,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+func newBookResponse(b book) bookResponse {
+	return bookResponse{
+		BookUid:     b.BookUid,
+		Name:        b.Name,
+		Author:      b.Author,
+		Genre:       b.Genre,
+		Condition:   b.Condition,
+		ISBN:        b.ISBN,
+		Publisher:   b.Publisher,
+		Year:        b.Year,
+		Language:    b.Language,
+		PageCount:   b.PageCount,
+		Description: b.Description,
+	}
+}
+
+// trimOptional treats a blank optional field as a missing one.
+func trimOptional(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// parseBookRequest trims the fields before validation, a missing condition means a new book.
+// The isbn may come as ISBN-10 or ISBN-13 with hyphens, it is stored as ISBN-13.
+func parseBookRequest(c echo.Context) (bookRequest, error) {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return bookRequest{}, err
+	}
+
+	req := bookRequest{}
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return bookRequest{}, err
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Author = strings.TrimSpace(req.Author)
+	req.Genre = strings.TrimSpace(req.Genre)
+	if req.Condition == "" {
+		req.Condition = excellentCondition
+	}
+	req.Publisher = trimOptional(req.Publisher)
+	req.Language = trimOptional(req.Language)
+	req.Description = trimOptional(req.Description)
+
+	req.ISBN = trimOptional(req.ISBN)
+	if req.ISBN != nil {
+		normalized, err := isbn.Normalize(*req.ISBN)
+		if err != nil {
+			return bookRequest{}, err
+		}
+		req.ISBN = &normalized
+	}
+
+	err = c.Validate(req)
+	if err != nil {
+		return bookRequest{}, err
+	}
+
+	return req, nil
+}
+
+func (h *handler) CreateBook(c echo.Context) error {
+	req, err := parseBookRequest(c)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to parse request body",
+		})
+	}
+
+	created, err := h.storage.CreateBook(c.Request().Context(), req.book(uuid.New().String()))
+	if err != nil {
+		log.Err(err).Msg("failed to create book")
+		if errors.Is(err, errISBNTaken) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "book with this isbn already exists",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to create book",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, newBookResponse(created))
+}
+
+func (h *handler) UpdateBook(c echo.Context) error {
+	bookUid := c.Param("uid")
+	if bookUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	req, err := parseBookRequest(c)
+	if err != nil {
+		log.Err(err).Msg("failed to parse request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to parse request body",
+		})
+	}
+
+	updated, err := h.storage.UpdateBook(c.Request().Context(), req.book(bookUid))
+	if err != nil {
+		log.Err(err).Msg("failed to update book")
+		if errors.Is(err, errBookNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "book not found",
+			})
+		}
+		if errors.Is(err, errISBNTaken) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "book with this isbn already exists",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to update book",
+		})
+	}
+
+	return c.JSON(http.StatusOK, newBookResponse(updated))
+}
+
+// GetBookByISBN accepts both ISBN-10 and ISBN-13, so any printed form of the edition finds the book.
+func (h *handler) GetBookByISBN(c echo.Context) error {
+	normalized, err := isbn.Normalize(c.Param("isbn"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "isbn is wrong",
+		})
+	}
+
+	found, err := h.storage.GetBookByISBN(c.Request().Context(), normalized)
+	if err != nil {
+		log.Err(err).Msg("failed to get book by isbn")
+		if errors.Is(err, errBookNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "book not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get book",
+		})
+	}
+
+	return c.JSON(http.StatusOK, newBookResponse(found))
+}
+
+// UpsertLibraryBook attaches a book to a library with the given count, or overwrites the count when
+// the book is already there. Relative changes go through UpdateBooksAvailableCount.
+func (h *handler) UpsertLibraryBook(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read request body",
+		})
+	}
+
+	type request struct {
+		BookUid        string `json:"bookUid" validate:"required,uuid"`
+		AvailableCount *int   `json:"availableCount" validate:"required,gte=0"`
+	}
+	req := request{}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		log.Err(err).Msg("failed to unmarshal request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal request body",
+		})
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate request body",
+		})
+	}
+
+	created, err := h.storage.UpsertLibraryBook(c.Request().Context(), libraryUid, req.BookUid, *req.AvailableCount)
+	if err != nil {
+		log.Err(err).Msg("failed to upsert library book")
+		if errors.Is(err, errRecordNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library or book not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to upsert library book",
+		})
+	}
+
+	type response struct {
+		LibraryUid     string `json:"libraryUid"`
+		BookUid        string `json:"bookUid"`
+		AvailableCount int    `json:"availableCount"`
+	}
+
+	statusCode := http.StatusOK
+	if created {
+		statusCode = http.StatusCreated
+	}
+
+	return c.JSON(statusCode, response{LibraryUid: libraryUid, BookUid: req.BookUid, AvailableCount: *req.AvailableCount})
+}
+
+func (h *handler) DeleteLibraryBook(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	bookUid := c.Param("bookuid")
+	if libraryUid == "" || bookUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	err := h.storage.DeleteLibraryBook(c.Request().Context(), libraryUid, bookUid)
+	if err != nil {
+		log.Err(err).Msg("failed to delete library book")
+		if errors.Is(err, errRecordNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "record not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to delete library book",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *handler) SearchBooks(c echo.Context) error {
+	filter := searchFilter{
+		Query:  strings.TrimSpace(c.QueryParam("q")),
+		Genre:  strings.TrimSpace(c.QueryParam("genre")),
+		Author: strings.TrimSpace(c.QueryParam("author")),
+		City:   strings.TrimSpace(c.QueryParam("city")),
+	}
+	if filter.Query == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "q is wrong",
+		})
+	}
+
+	pageParam := c.QueryParam("page")
+	page, err := strconv.Atoi(pageParam)
+	if err != nil || page <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "page is wrong",
+		})
+	}
+
+	sizeParam := c.QueryParam("size")
+	size, err := strconv.Atoi(sizeParam)
+	if err != nil || size <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "size is wrong",
+		})
+	}
+
+	books, err := h.storage.SearchBooks(c.Request().Context(), filter, page*size-size, size)
+	if err != nil {
+		log.Err(err).Msg("failed to search books")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to search books",
+		})
+	}
+
+	type libraryItem struct {
+		LibraryUid     string `json:"libraryUid"`
+		Name           string `json:"name"`
+		Address        string `json:"address"`
+		City           string `json:"city"`
+		AvailableCount int    `json:"availableCount"`
+	}
+	type item struct {
+		BookUid   string        `json:"bookUid"`
+		Name      string        `json:"name"`
+		Author    string        `json:"author"`
+		Genre     string        `json:"genre"`
+		Condition string        `json:"condition"`
+		Rank      float64       `json:"rank"`
+		Highlight string        `json:"highlight"`
+		Libraries []libraryItem `json:"libraries"`
+	}
+	type response struct {
+		Page          int    `json:"page"`
+		PageSize      int    `json:"pageSize"`
+		TotalElements int    `json:"totalElements"`
+		Items         []item `json:"items"`
+	}
+
+	res := response{
+		Page:     page,
+		PageSize: size,
+		Items:    make([]item, 0, len(books)),
+	}
+	if len(books) == 0 {
+		return c.JSON(http.StatusOK, res)
+	}
+
+	ids := make([]int, 0, len(books))
+	for _, v := range books {
+		ids = append(ids, v.ID)
+	}
+
+	availability, err := h.storage.GetBooksAvailability(c.Request().Context(), ids, filter.City)
+	if err != nil {
+		log.Err(err).Msg("failed to get books availability")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to search books",
+		})
+	}
+
+	libraries := make(map[int][]libraryItem, len(books))
+	for _, v := range availability {
+		libraries[v.BookID] = append(libraries[v.BookID], libraryItem{
+			LibraryUid:     v.LibraryUid,
+			Name:           v.Name,
+			Address:        v.Address,
+			City:           v.City,
+			AvailableCount: v.AvailableCount,
+		})
+	}
+
+	res.TotalElements = books[0].Total
+	for _, v := range books {
+		bookLibraries := libraries[v.ID]
+		if bookLibraries == nil {
+			bookLibraries = make([]libraryItem, 0)
+		}
+		res.Items = append(res.Items, item{
+			BookUid:   v.BookUid,
+			Name:      v.Name,
+			Author:    v.Author,
+			Genre:     v.Genre,
+			Condition: v.Condition,
+			Rank:      v.Rank,
+			Highlight: v.Highlight,
+			Libraries: bookLibraries,
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetBookAvailability lists the open libraries holding the book, the most available first.
+// GetBookAvailability tells which libraries hold the book, it is addressed by its uid or by its ISBN.
+func (h *handler) GetBookAvailability(c echo.Context) error {
+	ref := c.Param("uid")
+	city := strings.TrimSpace(c.QueryParam("city"))
+
+	var found book
+	if _, err := uuid.Parse(ref); err == nil {
+		books, err := h.storage.GetBooksByUids(c.Request().Context(), []string{ref})
+		if err != nil {
+			return bookLookupError(c, err)
+		}
+		found = books[0]
+	} else if normalized, err := isbn.Normalize(ref); err == nil {
+		found, err = h.storage.GetBookByISBN(c.Request().Context(), normalized)
+		if err != nil {
+			return bookLookupError(c, err)
+		}
+	} else {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	availability, err := h.storage.GetBooksAvailability(c.Request().Context(), []int{found.ID}, city)
+	if err != nil {
+		log.Err(err).Msg("failed to get book availability")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get book availability",
+		})
+	}
+
+	type libraryItem struct {
+		LibraryUid     string `json:"libraryUid"`
+		Name           string `json:"name"`
+		Address        string `json:"address"`
+		City           string `json:"city"`
+		AvailableCount int    `json:"availableCount"`
+	}
+	type response struct {
+		Book      bookResponse  `json:"book"`
+		Libraries []libraryItem `json:"libraries"`
+	}
+
+	libraries := make([]libraryItem, 0, len(availability))
+	for _, v := range availability {
+		libraries = append(libraries, libraryItem{
+			LibraryUid:     v.LibraryUid,
+			Name:           v.Name,
+			Address:        v.Address,
+			City:           v.City,
+			AvailableCount: v.AvailableCount,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response{Book: newBookResponse(found), Libraries: libraries})
+}
+
+// bookLookupError answers 404 for a missing book and 500 otherwise.
+func bookLookupError(c echo.Context, err error) error {
+	log.Err(err).Msg("failed to get book")
+	if errors.Is(err, errBookNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "book not found",
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, echo.Map{
+		"message": "failed to get book",
+	})
+}
+
+func (h *handler) GetNearbyLibraries(c echo.Context) error {
+	lat, err := strconv.ParseFloat(c.QueryParam("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "lat is wrong",
+		})
+	}
+
+	lon, err := strconv.ParseFloat(c.QueryParam("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "lon is wrong",
+		})
+	}
+
+	radius := defaultNearbyRadiusKm
+	if radiusParam := c.QueryParam("radius"); radiusParam != "" {
+		radius, err = strconv.ParseFloat(radiusParam, 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadiusKm {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "radius is wrong",
+			})
+		}
+	}
+
+	size := defaultNearbySize
+	if sizeParam := c.QueryParam("size"); sizeParam != "" {
+		size, err = strconv.Atoi(sizeParam)
+		if err != nil || size <= 0 || size > maxNearbySize {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "size is wrong",
+			})
+		}
+	}
+
+	libraries, err := h.storage.GetNearbyLibraries(c.Request().Context(), lat, lon, radius, size)
+	if err != nil {
+		log.Err(err).Msg("failed to get nearby libraries")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get libraries",
+		})
+	}
+
+	type item struct {
+		LibraryUid string  `json:"libraryUid"`
+		Name       string  `json:"name"`
+		Address    string  `json:"address"`
+		City       string  `json:"city"`
+		Latitude   float64 `json:"latitude"`
+		Longitude  float64 `json:"longitude"`
+		DistanceKm float64 `json:"distanceKm"`
+	}
+	type response struct {
+		Items []item `json:"items"`
+	}
+
+	items := make([]item, 0, len(libraries))
+	for _, v := range libraries {
+		items = append(items, item{
+			LibraryUid: v.LibraryUid,
+			Name:       v.Name,
+			Address:    v.Address,
+			City:       v.City,
+			Latitude:   *v.Latitude,
+			Longitude:  *v.Longitude,
+			DistanceKm: math.Round(v.Distance*100) / 100,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response{Items: items})
+}
+
+type copyResponse struct {
+	Barcode        string  `json:"barcode"`
+	LibraryUid     string  `json:"libraryUid"`
+	BookUid        string  `json:"bookUid"`
+	Condition      string  `json:"condition"`
+	Status         string  `json:"status"`
+	ReservationUid *string `json:"reservationUid,omitempty"`
+}
+
+func newCopyResponse(c bookCopy) copyResponse {
+	return copyResponse{
+		Barcode:        c.Barcode,
+		LibraryUid:     c.LibraryUid,
+		BookUid:        c.BookUid,
+		Condition:      c.Condition,
+		Status:         c.Status,
+		ReservationUid: c.ReservationUid,
+	}
+}
+
+func (h *handler) GetCopy(c echo.Context) error {
+	barcode := c.Param("barcode")
+	if barcode == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "barcode is wrong",
+		})
+	}
+
+	found, err := h.storage.GetCopy(c.Request().Context(), barcode)
+	if err != nil {
+		log.Err(err).Msg("failed to get copy")
+		if errors.Is(err, errCopyNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "copy not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get copy",
+		})
+	}
+
+	return c.JSON(http.StatusOK, newCopyResponse(found))
+}
+
+func (h *handler) GetCopies(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status != availableStatus && status != checkedOutStatus && status != inTransitStatus &&
+		status != withdrawnStatus {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "status is wrong",
+		})
+	}
+
+	copies, err := h.storage.GetCopies(c.Request().Context(), status)
+	if err != nil {
+		log.Err(err).Msg("failed to get copies")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get copies",
+		})
+	}
+
+	items := make([]copyResponse, 0, len(copies))
+	for _, v := range copies {
+		items = append(items, newCopyResponse(v))
+	}
+
+	return c.JSON(http.StatusOK, items)
+}
+
+// CheckoutCopy lends a copy for the reservation, the barcode is set when the copy is scanned at the desk
+// and left out when any copy will do.
+func (h *handler) CheckoutCopy(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	bookUid := c.Param("bookuid")
+	if libraryUid == "" || bookUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read request body",
+		})
+	}
+
+	type request struct {
+		ReservationUid string `json:"reservationUid" validate:"required,uuid"`
+		Barcode        string `json:"barcode" validate:"max=32"`
+	}
+	req := request{}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		log.Err(err).Msg("failed to unmarshal request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal request body",
+		})
+	}
+	req.Barcode = strings.TrimSpace(req.Barcode)
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate request body",
+		})
+	}
+
+	if req.Barcode != "" {
+		scanned, err := h.storage.GetCopy(c.Request().Context(), req.Barcode)
+		if err != nil {
+			log.Err(err).Msg("failed to get copy")
+			if errors.Is(err, errCopyNotFound) {
+				return c.JSON(http.StatusNotFound, echo.Map{
+					"message": "copy not found",
+				})
+			}
+			return c.JSON(http.StatusInternalServerError, echo.Map{
+				"message": "failed to get copy",
+			})
+		}
+		if scanned.LibraryUid != libraryUid || scanned.BookUid != bookUid {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "copy belongs to another book or library",
+			})
+		}
+	}
+
+	lent, err := h.storage.CheckoutCopy(c.Request().Context(), libraryUid, bookUid, req.Barcode, req.ReservationUid)
+	if err != nil {
+		log.Err(err).Msg("failed to checkout copy")
+		if errors.Is(err, errCopyUnavailable) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "no available copy",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to checkout copy",
+		})
+	}
+
+	return c.JSON(http.StatusOK, newCopyResponse(lent))
+}
+
+// ReturnCopy puts the copy back on the shelf, a missing condition keeps the one it was lent in.
+func (h *handler) ReturnCopy(c echo.Context) error {
+	barcode := c.Param("barcode")
+	if barcode == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "barcode is wrong",
+		})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read request body",
+		})
+	}
+
+	type request struct {
+		Condition string `json:"condition" validate:"omitempty,oneof=EXCELLENT GOOD BAD"`
+	}
+	req := request{}
+
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			log.Err(err).Msg("failed to unmarshal request body")
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "failed to unmarshal request body",
+			})
+		}
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate request body",
+		})
+	}
+
+	lent, err := h.storage.GetCopy(c.Request().Context(), barcode)
+	if err != nil {
+		log.Err(err).Msg("failed to get copy")
+		if errors.Is(err, errCopyNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "copy not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get copy",
+		})
+	}
+
+	if req.Condition == "" {
+		req.Condition = lent.Condition
+	}
+
+	returned, err := h.storage.ReturnCopy(c.Request().Context(), barcode, req.Condition)
+	if err != nil {
+		log.Err(err).Msg("failed to return copy")
+		if errors.Is(err, errCopyUnavailable) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "copy is not checked out",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to return copy",
+		})
+	}
+
+	return c.JSON(http.StatusOK, newCopyResponse(returned))
+}
+
+// GetInventory rebuilds the available count from the inventory ledger at the given moment, now by default.
+// For the current moment the count kept in library_books is shown next to it, so a drift is visible.
+func (h *handler) GetInventory(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	bookUid := c.Param("bookuid")
+	if libraryUid == "" || bookUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	at := time.Now()
+	atParam := c.QueryParam("at")
+	if atParam != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, atParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "at is wrong",
+			})
+		}
+	}
+
+	count, err := h.storage.GetInventoryCount(c.Request().Context(), libraryUid, bookUid, at)
+	if err != nil {
+		log.Err(err).Msg("failed to get inventory count")
+		if errors.Is(err, errRecordNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library or book not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get inventory count",
+		})
+	}
+
+	type response struct {
+		LibraryUid     string    `json:"libraryUid"`
+		BookUid        string    `json:"bookUid"`
+		At             time.Time `json:"at"`
+		AvailableCount int       `json:"availableCount"`
+		RecordedCount  *int      `json:"recordedCount,omitempty"`
+	}
+
+	res := response{
+		LibraryUid:     libraryUid,
+		BookUid:        bookUid,
+		At:             at.UTC(),
+		AvailableCount: count,
+	}
+
+	if atParam == "" {
+		recorded, err := h.storage.GetBooksAvailableCount(c.Request().Context(), libraryUid, bookUid)
+		if err != nil && !errors.Is(err, errRecordNotFound) {
+			log.Err(err).Msg("failed to get available count")
+			return c.JSON(http.StatusInternalServerError, echo.Map{
+				"message": "failed to get available count",
+			})
+		}
+		res.RecordedCount = &recorded
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetStock returns how many copies of the book the library lends, checked out ones included and withdrawn ones not.
+// A library that does not hold the book has no stock of it.
+func (h *handler) GetStock(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	bookUid := c.Param("bookuid")
+	if libraryUid == "" || bookUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	count, err := h.storage.GetStockCount(c.Request().Context(), libraryUid, bookUid)
+	if err != nil {
+		log.Err(err).Msg("failed to get stock count")
+		if errors.Is(err, errRecordNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library or book not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get stock count",
+		})
+	}
+
+	type response struct {
+		LibraryUid string `json:"libraryUid"`
+		BookUid    string `json:"bookUid"`
+		StockCount int    `json:"stockCount"`
+	}
+
+	return c.JSON(http.StatusOK, response{
+		LibraryUid: libraryUid,
+		BookUid:    bookUid,
+		StockCount: count,
+	})
+}
@@ -7,6 +7,7 @@ package library
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,6 +35,109 @@ func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
 	return m.recorder
 }
 
+// CheckoutCopy mocks base method.
+func (m *Mockstorage) CheckoutCopy(ctx context.Context, libraryUid, bookUid, barcode, reservationUid string) (bookCopy, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckoutCopy", ctx, libraryUid, bookUid, barcode, reservationUid)
+	ret0, _ := ret[0].(bookCopy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckoutCopy indicates an expected call of CheckoutCopy.
+func (mr *MockstorageMockRecorder) CheckoutCopy(ctx, libraryUid, bookUid, barcode, reservationUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckoutCopy", reflect.TypeOf((*Mockstorage)(nil).CheckoutCopy), ctx, libraryUid, bookUid, barcode, reservationUid)
+}
+
+// CloseLibrary mocks base method.
+func (m *Mockstorage) CloseLibrary(ctx context.Context, libraryUid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CloseLibrary", ctx, libraryUid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CloseLibrary indicates an expected call of CloseLibrary.
+func (mr *MockstorageMockRecorder) CloseLibrary(ctx, libraryUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseLibrary", reflect.TypeOf((*Mockstorage)(nil).CloseLibrary), ctx, libraryUid)
+}
+
+// CreateBook mocks base method.
+func (m *Mockstorage) CreateBook(ctx context.Context, b *book) (book, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBook", ctx, b)
+	ret0, _ := ret[0].(book)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateBook indicates an expected call of CreateBook.
+func (mr *MockstorageMockRecorder) CreateBook(ctx, b interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBook", reflect.TypeOf((*Mockstorage)(nil).CreateBook), ctx, b)
+}
+
+// CreateLibrary mocks base method.
+func (m *Mockstorage) CreateLibrary(ctx context.Context, l *library) (library, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLibrary", ctx, l)
+	ret0, _ := ret[0].(library)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateLibrary indicates an expected call of CreateLibrary.
+func (mr *MockstorageMockRecorder) CreateLibrary(ctx, l interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLibrary", reflect.TypeOf((*Mockstorage)(nil).CreateLibrary), ctx, l)
+}
+
+// DeleteLibraryBook mocks base method.
+func (m *Mockstorage) DeleteLibraryBook(ctx context.Context, libraryUid, bookUid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLibraryBook", ctx, libraryUid, bookUid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteLibraryBook indicates an expected call of DeleteLibraryBook.
+func (mr *MockstorageMockRecorder) DeleteLibraryBook(ctx, libraryUid, bookUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLibraryBook", reflect.TypeOf((*Mockstorage)(nil).DeleteLibraryBook), ctx, libraryUid, bookUid)
+}
+
+// GetBookByISBN mocks base method.
+func (m *Mockstorage) GetBookByISBN(ctx context.Context, isbn string) (book, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookByISBN", ctx, isbn)
+	ret0, _ := ret[0].(book)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBookByISBN indicates an expected call of GetBookByISBN.
+func (mr *MockstorageMockRecorder) GetBookByISBN(ctx, isbn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookByISBN", reflect.TypeOf((*Mockstorage)(nil).GetBookByISBN), ctx, isbn)
+}
+
+// GetBooksAvailability mocks base method.
+func (m *Mockstorage) GetBooksAvailability(ctx context.Context, bookIDs []int, city string) ([]bookAvailability, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBooksAvailability", ctx, bookIDs, city)
+	ret0, _ := ret[0].([]bookAvailability)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBooksAvailability indicates an expected call of GetBooksAvailability.
+func (mr *MockstorageMockRecorder) GetBooksAvailability(ctx, bookIDs, city interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBooksAvailability", reflect.TypeOf((*Mockstorage)(nil).GetBooksAvailability), ctx, bookIDs, city)
+}
+
 // GetBooksAvailableCount mocks base method.
 func (m *Mockstorage) GetBooksAvailableCount(ctx context.Context, libraryUid, bookUid string) (int, error) {
 	m.ctrl.T.Helper()
@@ -50,18 +154,19 @@ func (mr *MockstorageMockRecorder) GetBooksAvailableCount(ctx, libraryUid, bookU
 }
 
 // GetBooksByLibrary mocks base method.
-func (m *Mockstorage) GetBooksByLibrary(ctx context.Context, libraryUid string, offset, limit int, showAll bool) ([]book, error) {
+func (m *Mockstorage) GetBooksByLibrary(ctx context.Context, libraryUid string, p page, showAll bool) ([]book, int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetBooksByLibrary", ctx, libraryUid, offset, limit, showAll)
+	ret := m.ctrl.Call(m, "GetBooksByLibrary", ctx, libraryUid, p, showAll)
 	ret0, _ := ret[0].([]book)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetBooksByLibrary indicates an expected call of GetBooksByLibrary.
-func (mr *MockstorageMockRecorder) GetBooksByLibrary(ctx, libraryUid, offset, limit, showAll interface{}) *gomock.Call {
+func (mr *MockstorageMockRecorder) GetBooksByLibrary(ctx, libraryUid, p, showAll interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBooksByLibrary", reflect.TypeOf((*Mockstorage)(nil).GetBooksByLibrary), ctx, libraryUid, offset, limit, showAll)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBooksByLibrary", reflect.TypeOf((*Mockstorage)(nil).GetBooksByLibrary), ctx, libraryUid, p, showAll)
 }
 
 // GetBooksByUids mocks base method.
@@ -79,19 +184,65 @@ func (mr *MockstorageMockRecorder) GetBooksByUids(ctx, uids interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBooksByUids", reflect.TypeOf((*Mockstorage)(nil).GetBooksByUids), ctx, uids)
 }
 
-// GetLibraries mocks base method.
-func (m *Mockstorage) GetLibraries(ctx context.Context, city string, offset, limit int) ([]library, error) {
+// GetCopies mocks base method.
+func (m *Mockstorage) GetCopies(ctx context.Context, status string) ([]bookCopy, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetLibraries", ctx, city, offset, limit)
-	ret0, _ := ret[0].([]library)
+	ret := m.ctrl.Call(m, "GetCopies", ctx, status)
+	ret0, _ := ret[0].([]bookCopy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCopies indicates an expected call of GetCopies.
+func (mr *MockstorageMockRecorder) GetCopies(ctx, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCopies", reflect.TypeOf((*Mockstorage)(nil).GetCopies), ctx, status)
+}
+
+// GetCopy mocks base method.
+func (m *Mockstorage) GetCopy(ctx context.Context, barcode string) (bookCopy, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCopy", ctx, barcode)
+	ret0, _ := ret[0].(bookCopy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCopy indicates an expected call of GetCopy.
+func (mr *MockstorageMockRecorder) GetCopy(ctx, barcode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCopy", reflect.TypeOf((*Mockstorage)(nil).GetCopy), ctx, barcode)
+}
+
+// GetInventoryCount mocks base method.
+func (m *Mockstorage) GetInventoryCount(ctx context.Context, libraryUid, bookUid string, at time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInventoryCount", ctx, libraryUid, bookUid, at)
+	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// GetInventoryCount indicates an expected call of GetInventoryCount.
+func (mr *MockstorageMockRecorder) GetInventoryCount(ctx, libraryUid, bookUid, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInventoryCount", reflect.TypeOf((*Mockstorage)(nil).GetInventoryCount), ctx, libraryUid, bookUid, at)
+}
+
+// GetLibraries mocks base method.
+func (m *Mockstorage) GetLibraries(ctx context.Context, city string, p page) ([]library, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLibraries", ctx, city, p)
+	ret0, _ := ret[0].([]library)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
 // GetLibraries indicates an expected call of GetLibraries.
-func (mr *MockstorageMockRecorder) GetLibraries(ctx, city, offset, limit interface{}) *gomock.Call {
+func (mr *MockstorageMockRecorder) GetLibraries(ctx, city, p interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLibraries", reflect.TypeOf((*Mockstorage)(nil).GetLibraries), ctx, city, offset, limit)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLibraries", reflect.TypeOf((*Mockstorage)(nil).GetLibraries), ctx, city, p)
 }
 
 // GetLibrariesByUids mocks base method.
@@ -109,16 +260,121 @@ func (mr *MockstorageMockRecorder) GetLibrariesByUids(ctx, uids interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLibrariesByUids", reflect.TypeOf((*Mockstorage)(nil).GetLibrariesByUids), ctx, uids)
 }
 
+// GetNearbyLibraries mocks base method.
+func (m *Mockstorage) GetNearbyLibraries(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]nearbyLibrary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNearbyLibraries", ctx, lat, lon, radiusKm, limit)
+	ret0, _ := ret[0].([]nearbyLibrary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNearbyLibraries indicates an expected call of GetNearbyLibraries.
+func (mr *MockstorageMockRecorder) GetNearbyLibraries(ctx, lat, lon, radiusKm, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNearbyLibraries", reflect.TypeOf((*Mockstorage)(nil).GetNearbyLibraries), ctx, lat, lon, radiusKm, limit)
+}
+
+// GetStockCount mocks base method.
+func (m *Mockstorage) GetStockCount(ctx context.Context, libraryUid, bookUid string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStockCount", ctx, libraryUid, bookUid)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStockCount indicates an expected call of GetStockCount.
+func (mr *MockstorageMockRecorder) GetStockCount(ctx, libraryUid, bookUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStockCount", reflect.TypeOf((*Mockstorage)(nil).GetStockCount), ctx, libraryUid, bookUid)
+}
+
+// ReturnCopy mocks base method.
+func (m *Mockstorage) ReturnCopy(ctx context.Context, barcode, condition string) (bookCopy, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReturnCopy", ctx, barcode, condition)
+	ret0, _ := ret[0].(bookCopy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReturnCopy indicates an expected call of ReturnCopy.
+func (mr *MockstorageMockRecorder) ReturnCopy(ctx, barcode, condition interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReturnCopy", reflect.TypeOf((*Mockstorage)(nil).ReturnCopy), ctx, barcode, condition)
+}
+
+// SearchBooks mocks base method.
+func (m *Mockstorage) SearchBooks(ctx context.Context, filter searchFilter, offset, limit int) ([]foundBook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchBooks", ctx, filter, offset, limit)
+	ret0, _ := ret[0].([]foundBook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchBooks indicates an expected call of SearchBooks.
+func (mr *MockstorageMockRecorder) SearchBooks(ctx, filter, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchBooks", reflect.TypeOf((*Mockstorage)(nil).SearchBooks), ctx, filter, offset, limit)
+}
+
+// UpdateBook mocks base method.
+func (m *Mockstorage) UpdateBook(ctx context.Context, b *book) (book, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBook", ctx, b)
+	ret0, _ := ret[0].(book)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateBook indicates an expected call of UpdateBook.
+func (mr *MockstorageMockRecorder) UpdateBook(ctx, b interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBook", reflect.TypeOf((*Mockstorage)(nil).UpdateBook), ctx, b)
+}
+
 // UpdateBooksAvailableCount mocks base method.
-func (m *Mockstorage) UpdateBooksAvailableCount(ctx context.Context, libraryUid, bookUid string, count int) error {
+func (m *Mockstorage) UpdateBooksAvailableCount(ctx context.Context, libraryUid, bookUid string, count int, reason string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateBooksAvailableCount", ctx, libraryUid, bookUid, count)
+	ret := m.ctrl.Call(m, "UpdateBooksAvailableCount", ctx, libraryUid, bookUid, count, reason)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateBooksAvailableCount indicates an expected call of UpdateBooksAvailableCount.
-func (mr *MockstorageMockRecorder) UpdateBooksAvailableCount(ctx, libraryUid, bookUid, count interface{}) *gomock.Call {
+func (mr *MockstorageMockRecorder) UpdateBooksAvailableCount(ctx, libraryUid, bookUid, count, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBooksAvailableCount", reflect.TypeOf((*Mockstorage)(nil).UpdateBooksAvailableCount), ctx, libraryUid, bookUid, count, reason)
+}
+
+// UpdateLibrary mocks base method.
+func (m *Mockstorage) UpdateLibrary(ctx context.Context, l *library) (library, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLibrary", ctx, l)
+	ret0, _ := ret[0].(library)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateLibrary indicates an expected call of UpdateLibrary.
+func (mr *MockstorageMockRecorder) UpdateLibrary(ctx, l interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLibrary", reflect.TypeOf((*Mockstorage)(nil).UpdateLibrary), ctx, l)
+}
+
+// UpsertLibraryBook mocks base method.
+func (m *Mockstorage) UpsertLibraryBook(ctx context.Context, libraryUid, bookUid string, count int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertLibraryBook", ctx, libraryUid, bookUid, count)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpsertLibraryBook indicates an expected call of UpsertLibraryBook.
+func (mr *MockstorageMockRecorder) UpsertLibraryBook(ctx, libraryUid, bookUid, count interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBooksAvailableCount", reflect.TypeOf((*Mockstorage)(nil).UpdateBooksAvailableCount), ctx, libraryUid, bookUid, count)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertLibraryBook", reflect.TypeOf((*Mockstorage)(nil).UpsertLibraryBook), ctx, libraryUid, bookUid, count)
 }
@@ -1,15 +1,19 @@
 package library
 
 import (
+	"bytes"
 	"errors"
 	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/require"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 )
 
 type handlerTestFields struct {
@@ -111,7 +115,7 @@ func Test_UpdateBooksAvailableCount(t *testing.T) {
 
 			Prepare: func(fields *handlerTestFields) {
 				fields.storage.EXPECT().GetBooksAvailableCount(gomock.Any(), "test", "test").Return(1, nil)
-				fields.storage.EXPECT().UpdateBooksAvailableCount(gomock.Any(), "test", "test", 0).Return(errors.New(""))
+				fields.storage.EXPECT().UpdateBooksAvailableCount(gomock.Any(), "test", "test", 0, adjustmentReason).Return(errors.New(""))
 			},
 		},
 		{
@@ -125,7 +129,7 @@ func Test_UpdateBooksAvailableCount(t *testing.T) {
 
 			Prepare: func(fields *handlerTestFields) {
 				fields.storage.EXPECT().GetBooksAvailableCount(gomock.Any(), "test", "test").Return(1, nil)
-				fields.storage.EXPECT().UpdateBooksAvailableCount(gomock.Any(), "test", "test", 0).Return(nil)
+				fields.storage.EXPECT().UpdateBooksAvailableCount(gomock.Any(), "test", "test", 0, adjustmentReason).Return(nil)
 			},
 		},
 	}
@@ -152,3 +156,1152 @@ func Test_UpdateBooksAvailableCount(t *testing.T) {
 		})
 	}
 }
+
+func Test_CreateLibrary(t *testing.T) {
+	type fields struct {
+		body                 string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: blank name",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				body:             `{"name": "  ", "city": "Москва", "address": "2-я Бауманская ул., д.5, стр.1"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 400: no address",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				body:             `{"name": "Библиотека имени 7 Непьющих", "city": "Москва"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+				body:             `{"name": "Библиотека имени 7 Непьющих", "city": "Москва", "address": "2-я Бауманская ул., д.5, стр.1"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().CreateLibrary(gomock.Any(), gomock.Any()).Return(library{}, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 201: success",
+			fields: fields{
+				expectedHTTPCode: http.StatusCreated,
+				body:             `{"name": " Библиотека имени 7 Непьющих ", "city": "Москва", "address": "2-я Бауманская ул., д.5, стр.1"}`,
+				expectedResponseBody: `{"libraryUid":"test","name":"Библиотека имени 7 Непьющих","address":"2-я Бауманская ул., д.5, стр.1","city":"Москва"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().CreateLibrary(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, l *library) (library, error) {
+					require.NotEmpty(t, l.LibraryUid)
+					require.Equal(t, "Библиотека имени 7 Непьющих", l.Name)
+					return library{LibraryUid: "test", Name: l.Name, City: l.City, Address: l.Address}, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.CreateLibrary(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusCreated {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_CloseLibrary(t *testing.T) {
+	type fields struct {
+		libraryUid       string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 404: library not found or already closed",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				libraryUid:       "test",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().CloseLibrary(gomock.Any(), "test").Return(errLibraryNotFound)
+			},
+		},
+		{
+			name: "http-code 204: success",
+			fields: fields{
+				expectedHTTPCode: http.StatusNoContent,
+				libraryUid:       "test",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().CloseLibrary(gomock.Any(), "test").Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodDelete, "/test", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("uid")
+			c.SetParamValues(tt.fields.libraryUid)
+
+			err := h.CloseLibrary(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_UpsertLibraryBook(t *testing.T) {
+	type fields struct {
+		libraryUid       string
+		body             string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: negative count",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				libraryUid:       "test",
+				body:             `{"bookUid": "f7cdc58f-2caf-4b15-9727-f89dcc629b27", "availableCount": -1}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 400: no count",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				libraryUid:       "test",
+				body:             `{"bookUid": "f7cdc58f-2caf-4b15-9727-f89dcc629b27"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: library or book not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				libraryUid:       "test",
+				body:             `{"bookUid": "f7cdc58f-2caf-4b15-9727-f89dcc629b27", "availableCount": 0}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().UpsertLibraryBook(gomock.Any(), "test", "f7cdc58f-2caf-4b15-9727-f89dcc629b27", 0).Return(false, errRecordNotFound)
+			},
+		},
+		{
+			name: "http-code 201: attached",
+			fields: fields{
+				expectedHTTPCode: http.StatusCreated,
+				libraryUid:       "test",
+				body:             `{"bookUid": "f7cdc58f-2caf-4b15-9727-f89dcc629b27", "availableCount": 3}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().UpsertLibraryBook(gomock.Any(), "test", "f7cdc58f-2caf-4b15-9727-f89dcc629b27", 3).Return(true, nil)
+			},
+		},
+		{
+			name: "http-code 200: count overwritten",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				libraryUid:       "test",
+				body:             `{"bookUid": "f7cdc58f-2caf-4b15-9727-f89dcc629b27", "availableCount": 5}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().UpsertLibraryBook(gomock.Any(), "test", "f7cdc58f-2caf-4b15-9727-f89dcc629b27", 5).Return(false, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("libraryuid")
+			c.SetParamValues(tt.fields.libraryUid)
+
+			err := h.UpsertLibraryBook(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_SearchBooks(t *testing.T) {
+	type fields struct {
+		query                string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: no query",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				query:            "?page=1&size=10",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 200: nothing found",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				query:            "?q=test&page=1&size=10",
+				expectedResponseBody: `{"page":1,"pageSize":10,"totalElements":0,"items":[]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().SearchBooks(gomock.Any(), searchFilter{Query: "test"}, 0, 10).Return([]foundBook{}, nil)
+			},
+		},
+		{
+			name: "http-code 200: grouped by library",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				query:            "?q=%D0%BA%D1%80%D0%B0%D1%82%D0%BA%D0%B8%D0%B9&city=%D0%9C%D0%BE%D1%81%D0%BA%D0%B2%D0%B0&page=1&size=10",
+				expectedResponseBody: `{"page":1,"pageSize":10,"totalElements":1,"items":[{"bookUid":"test","name":"Краткий курс C++ в 7 томах","author":"Бьерн Страуструп","genre":"Научная фантастика","condition":"EXCELLENT","rank":0.5,"highlight":"\u003cb\u003eКраткий\u003c/b\u003e курс","libraries":[{"libraryUid":"first","name":"Первая","address":"адрес","city":"Москва","availableCount":1},{"libraryUid":"second","name":"Вторая","address":"адрес","city":"Москва","availableCount":0}]}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().SearchBooks(gomock.Any(), searchFilter{Query: "краткий", City: "Москва"}, 0, 10).Return([]foundBook{
+					{
+						book: book{ID: 1, BookUid: "test", Name: "Краткий курс C++ в 7 томах", Author: "Бьерн Страуструп",
+							Genre: "Научная фантастика", Condition: "EXCELLENT"},
+						Rank:      0.5,
+						Highlight: "<b>Краткий</b> курс",
+						Total:     1,
+					},
+				}, nil)
+				fields.storage.EXPECT().GetBooksAvailability(gomock.Any(), []int{1}, "Москва").Return([]bookAvailability{
+					{BookID: 1, LibraryUid: "first", Name: "Первая", Address: "адрес", City: "Москва", AvailableCount: 1},
+					{BookID: 1, LibraryUid: "second", Name: "Вторая", Address: "адрес", City: "Москва", AvailableCount: 0},
+				}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test"+tt.fields.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.SearchBooks(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_GetLibraries(t *testing.T) {
+	type fields struct {
+		query                string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong cursor",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				query:            "?city=test&size=1&after=test",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 200: empty page",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				query:            "?city=test&page=3&size=1",
+				expectedResponseBody: `{"page":3,"pageSize":1,"totalElements":2,"items":[]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLibraries(gomock.Any(), "test", page{Offset: 2, Limit: 1}).Return([]library{}, 2, nil)
+			},
+		},
+		{
+			name: "http-code 200: full page has next cursor",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				query:            "?city=test&page=1&size=1",
+				expectedResponseBody: `{"page":1,"pageSize":1,"totalElements":2,"nextCursor":"Nw","items":[{"libraryUid":"test","name":"test","address":"test","city":"test"}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLibraries(gomock.Any(), "test", page{Limit: 1}).
+					Return([]library{{ID: 7, LibraryUid: "test", Name: "test", Address: "test", City: "test"}}, 2, nil)
+			},
+		},
+		{
+			name: "http-code 200: page after cursor",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				query:            "?city=test&size=2&after=Nw",
+				expectedResponseBody: `{"page":0,"pageSize":2,"totalElements":2,"items":[{"libraryUid":"last","name":"test","address":"test","city":"test"}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLibraries(gomock.Any(), "test", page{Limit: 2, AfterID: 7}).
+					Return([]library{{ID: 9, LibraryUid: "last", Name: "test", Address: "test", City: "test"}}, 2, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test"+tt.fields.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.GetLibraries(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_GetBookAvailability(t *testing.T) {
+	type fields struct {
+		bookUid              string
+		query                string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	bookUid := "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong uid",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				bookUid:          "test",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: book not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				bookUid:          bookUid,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetBooksByUids(gomock.Any(), []string{bookUid}).Return(nil, errBookNotFound)
+			},
+		},
+		{
+			name: "http-code 200: not held in the city",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				bookUid:          bookUid,
+				query:            "?city=test",
+				expectedResponseBody: `{"book":{"bookUid":"f7cdc58f-2caf-4b15-9727-f89dcc629b27","name":"test","author":"test","genre":"test","condition":"GOOD"},"libraries":[]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetBooksByUids(gomock.Any(), []string{bookUid}).
+					Return([]book{{ID: 1, BookUid: bookUid, Name: "test", Author: "test", Genre: "test", Condition: "GOOD"}}, nil)
+				fields.storage.EXPECT().GetBooksAvailability(gomock.Any(), []int{1}, "test").Return([]bookAvailability{}, nil)
+			},
+		},
+		{
+			name: "http-code 404: no book with the isbn",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				bookUid:          "978-0-306-40615-7",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetBookByISBN(gomock.Any(), "9780306406157").Return(book{}, errBookNotFound)
+			},
+		},
+		{
+			name: "http-code 200: book addressed by isbn",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				bookUid:          "0306406152",
+				expectedResponseBody: `{"book":{"bookUid":"f7cdc58f-2caf-4b15-9727-f89dcc629b27","name":"test","author":"test","genre":"test","condition":"GOOD"},"libraries":[{"libraryUid":"test","name":"test","address":"test","city":"test","availableCount":2}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetBookByISBN(gomock.Any(), "9780306406157").
+					Return(book{ID: 1, BookUid: bookUid, Name: "test", Author: "test", Genre: "test", Condition: "GOOD"}, nil)
+				fields.storage.EXPECT().GetBooksAvailability(gomock.Any(), []int{1}, "").
+					Return([]bookAvailability{{BookID: 1, LibraryUid: "test", Name: "test", Address: "test", City: "test", AvailableCount: 2}}, nil)
+			},
+		},
+		{
+			name: "http-code 200: success",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				bookUid:          bookUid,
+				expectedResponseBody: `{"book":{"bookUid":"f7cdc58f-2caf-4b15-9727-f89dcc629b27","name":"test","author":"test","genre":"test","condition":"GOOD"},"libraries":[{"libraryUid":"test","name":"test","address":"test","city":"test","availableCount":2}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetBooksByUids(gomock.Any(), []string{bookUid}).
+					Return([]book{{ID: 1, BookUid: bookUid, Name: "test", Author: "test", Genre: "test", Condition: "GOOD"}}, nil)
+				fields.storage.EXPECT().GetBooksAvailability(gomock.Any(), []int{1}, "").
+					Return([]bookAvailability{{BookID: 1, LibraryUid: "test", Name: "test", Address: "test", City: "test", AvailableCount: 2}}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test"+tt.fields.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("uid")
+			c.SetParamValues(tt.fields.bookUid)
+
+			err := h.GetBookAvailability(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_GetNearbyLibraries(t *testing.T) {
+	type fields struct {
+		query                string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	getPointerOnFloat := func(f float64) *float64 {
+		return &f
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong lat",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				query:            "?lat=91&lon=37.6",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 400: radius over limit",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				query:            "?lat=55.7&lon=37.6&radius=1000",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 200: default radius",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				query:            "?lat=55.7&lon=37.6",
+				expectedResponseBody: `{"items":[{"libraryUid":"test","name":"test","address":"test","city":"test","latitude":55.766,"longitude":37.685,"distanceKm":8.46}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetNearbyLibraries(gomock.Any(), 55.7, 37.6, defaultNearbyRadiusKm, defaultNearbySize).Return([]nearbyLibrary{
+					{
+						library: library{LibraryUid: "test", Name: "test", Address: "test", City: "test",
+							Latitude: getPointerOnFloat(55.766), Longitude: getPointerOnFloat(37.685)},
+						Distance: 8.4567,
+					},
+				}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test"+tt.fields.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.GetNearbyLibraries(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_CreateBook(t *testing.T) {
+	type fields struct {
+		body                 string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong isbn checksum",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				body:             `{"name": "Краткий курс C++ в 7 томах", "isbn": "0-306-40615-3"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 400: wrong year",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				body:             `{"name": "Краткий курс C++ в 7 томах", "year": 3000}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 409: isbn is taken",
+			fields: fields{
+				expectedHTTPCode: http.StatusConflict,
+				body:             `{"name": "Краткий курс C++ в 7 томах", "isbn": "9780306406157"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().CreateBook(gomock.Any(), gomock.Any()).Return(book{}, errISBNTaken)
+			},
+		},
+		{
+			name: "http-code 201: isbn-10 is stored as isbn-13",
+			fields: fields{
+				expectedHTTPCode: http.StatusCreated,
+				body:             `{"name": "Краткий курс C++ в 7 томах", "isbn": "0-306-40615-2", "year": 2011, "publisher": " "}`,
+				expectedResponseBody: `{"bookUid":"test","name":"Краткий курс C++ в 7 томах","author":"","genre":"","condition":"EXCELLENT","isbn":"9780306406157","year":2011}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().CreateBook(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, b *book) (book, error) {
+					require.Equal(t, "9780306406157", *b.ISBN)
+					require.Nil(t, b.Publisher)
+					res := *b
+					res.BookUid = "test"
+					return res, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.CreateBook(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusCreated {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_GetBookByISBN(t *testing.T) {
+	type fields struct {
+		isbn             string
+		expectedHTTPCode int
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong isbn",
+			fields: fields{
+				isbn:             "12345",
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: not found",
+			fields: fields{
+				isbn:             "978-0-306-40615-7",
+				expectedHTTPCode: http.StatusNotFound,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetBookByISBN(gomock.Any(), "9780306406157").Return(book{}, errBookNotFound)
+			},
+		},
+		{
+			name: "http-code 200: isbn-10",
+			fields: fields{
+				isbn:             "0306406152",
+				expectedHTTPCode: http.StatusOK,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetBookByISBN(gomock.Any(), "9780306406157").Return(book{BookUid: "test"}, nil)
+			},
+		},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("isbn")
+			c.SetParamValues(tt.fields.isbn)
+
+			err := h.GetBookByISBN(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_CheckoutCopy(t *testing.T) {
+	type fields struct {
+		body             string
+		expectedHTTPCode int
+	}
+
+	const (
+		libraryUid     = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+		bookUid        = "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+		reservationUid = "2d9c4e4f-0b8c-4bd6-9b84-5a1d8c6e0a7e"
+	)
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: no reservation",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				body:             `{"barcode": "000000000001"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: unknown barcode",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				body:             `{"reservationUid": "` + reservationUid + `", "barcode": "000000000001"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetCopy(gomock.Any(), "000000000001").Return(bookCopy{}, errCopyNotFound)
+			},
+		},
+		{
+			name: "http-code 409: copy of another library",
+			fields: fields{
+				expectedHTTPCode: http.StatusConflict,
+				body:             `{"reservationUid": "` + reservationUid + `", "barcode": "000000000001"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetCopy(gomock.Any(), "000000000001").Return(bookCopy{LibraryUid: "other", BookUid: bookUid}, nil)
+			},
+		},
+		{
+			name: "http-code 409: no available copy",
+			fields: fields{
+				expectedHTTPCode: http.StatusConflict,
+				body:             `{"reservationUid": "` + reservationUid + `"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().CheckoutCopy(gomock.Any(), libraryUid, bookUid, "", reservationUid).Return(bookCopy{}, errCopyUnavailable)
+			},
+		},
+		{
+			name: "http-code 200: scanned copy",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				body:             `{"reservationUid": "` + reservationUid + `", "barcode": " 000000000001 "}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetCopy(gomock.Any(), "000000000001").Return(bookCopy{LibraryUid: libraryUid, BookUid: bookUid}, nil)
+				fields.storage.EXPECT().CheckoutCopy(gomock.Any(), libraryUid, bookUid, "000000000001", reservationUid).Return(bookCopy{Barcode: "000000000001"}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("libraryuid", "bookuid")
+			c.SetParamValues(libraryUid, bookUid)
+
+			err := h.CheckoutCopy(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_ReturnCopy(t *testing.T) {
+	type fields struct {
+		body             string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong condition",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				body:             `{"condition": "TORN"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 409: copy is on the shelf",
+			fields: fields{
+				expectedHTTPCode: http.StatusConflict,
+				body:             `{"condition": "GOOD"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetCopy(gomock.Any(), "000000000001").Return(bookCopy{Condition: "EXCELLENT"}, nil)
+				fields.storage.EXPECT().ReturnCopy(gomock.Any(), "000000000001", "GOOD").Return(bookCopy{}, errCopyUnavailable)
+			},
+		},
+		{
+			name: "http-code 200: condition kept",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetCopy(gomock.Any(), "000000000001").Return(bookCopy{Condition: "GOOD"}, nil)
+				fields.storage.EXPECT().ReturnCopy(gomock.Any(), "000000000001", "GOOD").Return(bookCopy{Barcode: "000000000001"}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("barcode")
+			c.SetParamValues("000000000001")
+
+			err := h.ReturnCopy(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_GetInventory(t *testing.T) {
+	type fields struct {
+		at                   string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong moment",
+			fields: fields{
+				at:               "yesterday",
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: library or book not found",
+			fields: fields{
+				at:               "2024-11-30T12:00:00Z",
+				expectedHTTPCode: http.StatusNotFound,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetInventoryCount(gomock.Any(), "test", "test", gomock.Any()).Return(0, errRecordNotFound)
+			},
+		},
+		{
+			name: "http-code 200: past moment",
+			fields: fields{
+				at:               "2024-11-30T15:00:00+03:00",
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"test","bookUid":"test","at":"2024-11-30T12:00:00Z","availableCount":2}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetInventoryCount(gomock.Any(), "test", "test", gomock.Any()).DoAndReturn(
+					func(_ interface{}, _, _ string, at time.Time) (int, error) {
+						require.True(t, at.Equal(time.Date(2024, 11, 30, 12, 0, 0, 0, time.UTC)))
+						return 2, nil
+					})
+			},
+		},
+		{
+			name: "http-code 200: now with recorded count",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetInventoryCount(gomock.Any(), "test", "test", gomock.Any()).Return(3, nil)
+				fields.storage.EXPECT().GetBooksAvailableCount(gomock.Any(), "test", "test").Return(2, nil)
+			},
+		},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test?at="+url.QueryEscape(tt.fields.at), nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("libraryuid", "bookuid")
+			c.SetParamValues("test", "test")
+
+			err := h.GetInventory(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedResponseBody != "" {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_GetStock(t *testing.T) {
+	type fields struct {
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 404: library or book not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetStockCount(gomock.Any(), "test", "test").Return(0, errRecordNotFound)
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetStockCount(gomock.Any(), "test", "test").Return(0, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"test","bookUid":"test","stockCount":3}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetStockCount(gomock.Any(), "test", "test").Return(3, nil)
+			},
+		},
+	}
+
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("libraryuid", "bookuid")
+			c.SetParamValues("test", "test")
+
+			err := h.GetStock(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedResponseBody != "" {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
@@ -1,19 +1,68 @@
 package library
 
+import "time"
+
 type library struct {
-	ID         int    `db:"id"`
-	LibraryUid string `db:"library_uid"`
-	Name       string `db:"name"`
-	Address    string `db:"address"`
-	City       string `db:"city"`
+	ID         int        `db:"id"`
+	LibraryUid string     `db:"library_uid"`
+	Name       string     `db:"name"`
+	Address    string     `db:"address"`
+	City       string     `db:"city"`
+	ClosedAt   *time.Time `db:"closed_at"`
+	Latitude   *float64   `db:"latitude"`
+	Longitude  *float64   `db:"longitude"`
 }
 
 type book struct {
-	ID             int    `db:"id"`
-	BookUid        string `db:"book_uid"`
+	ID             int     `db:"id"`
+	BookUid        string  `db:"book_uid"`
+	Name           string  `db:"name"`
+	Author         string  `db:"author"`
+	Genre          string  `db:"genre"`
+	Condition      string  `db:"condition"`
+	ISBN           *string `db:"isbn"`
+	Publisher      *string `db:"publisher"`
+	Year           *int    `db:"year"`
+	Language       *string `db:"language"`
+	PageCount      *int    `db:"page_count"`
+	Description    *string `db:"description"`
+	AvailableCount int     `db:"available_count"`
+}
+
+type searchFilter struct {
+	Query  string
+	Genre  string
+	Author string
+	City   string
+}
+
+type foundBook struct {
+	book
+	Rank      float64 `db:"rank"`
+	Highlight string  `db:"highlight"`
+	Total     int     `db:"total"`
+}
+
+type bookAvailability struct {
+	BookID         int    `db:"book_id"`
+	LibraryUid     string `db:"library_uid"`
 	Name           string `db:"name"`
-	Author         string `db:"author"`
-	Genre          string `db:"genre"`
-	Condition      string `db:"condition"`
+	Address        string `db:"address"`
+	City           string `db:"city"`
 	AvailableCount int    `db:"available_count"`
 }
+
+type nearbyLibrary struct {
+	library
+	Distance float64 `db:"distance"`
+}
+
+type bookCopy struct {
+	ID             int     `db:"id"`
+	Barcode        string  `db:"barcode"`
+	LibraryUid     string  `db:"library_uid"`
+	BookUid        string  `db:"book_uid"`
+	Condition      string  `db:"condition"`
+	Status         string  `db:"status"`
+	ReservationUid *string `db:"reservation_uid"`
+}
@@ -2,16 +2,33 @@ package library
 
 import (
 	"context"
+	"database/sql"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"math"
+	"strings"
 	"time"
 )
 
 const (
 	defaultTimeout = 5 * time.Second
+
+	uniqueViolationCode = "23505"
+
+	earthRadiusKm = 6371.0
+	kmPerDegree   = 111.045
 )
 
+const setInventoryContextQuery = `SELECT set_config('inventory.reason', $1, true), set_config('inventory.actor', $2, true);`
+
+var bookColumns = []string{
+	"id", "book_uid", "name", "author", "genre", "condition",
+	"isbn", "publisher", "year", "language", "page_count", "description",
+}
+
 type repository struct {
 	conn *sqlx.DB
 }
@@ -20,65 +37,114 @@ func NewRepository(conn *sqlx.DB) *repository {
 	return &repository{conn: conn}
 }
 
-func (r *repository) GetLibraries(ctx context.Context, city string, offset, limit int) ([]library, error) {
+// beginInventoryTx starts a transaction whose copy changes go to the inventory ledger with the reason and
+// the caller as actor. An empty reason lets the ledger tell a checkout from a return by the copy status.
+func (r *repository) beginInventoryTx(ctx context.Context, reason string) (*sqlx.Tx, error) {
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+
+	_, err = tx.ExecContext(ctx, setInventoryContextQuery, reason, auth.GetUser(ctx))
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors.Wrap(err, "failed to set inventory context")
+	}
+
+	return tx, nil
+}
+
+// GetLibraries returns a page of open libraries ordered by id and the number of them in the city.
+func (r *repository) GetLibraries(ctx context.Context, city string, p page) ([]library, int, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	filter := sq.Eq{"city": city, "closed_at": nil}
+
 	builder := psql.Select("id", "library_uid", "name", "address", "city").
 		From("library").
-		Where(sq.Eq{"city": city}).Limit(uint64(limit)).Offset(uint64(offset))
+		Where(filter).
+		OrderBy("id").
+		Limit(uint64(p.Limit)).Offset(uint64(p.Offset))
+	if p.AfterID > 0 {
+		builder = builder.Where(sq.Gt{"id": p.AfterID})
+	}
 
 	query, args, err := builder.ToSql()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to build query")
+		return nil, 0, errors.Wrap(err, "failed to build query")
+	}
+
+	countQuery, countArgs, err := psql.Select("COUNT(*)").From("library").Where(filter).ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to build query")
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	libraries := make([]library, 0)
-	err = r.conn.SelectContext(ctx, &libraries, query, args...)
+	var total int
+	err = r.conn.GetContext(ctx, &total, countQuery, countArgs...)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute query")
+		return nil, 0, errors.Wrap(err, "failed to execute query")
 	}
 
-	if len(libraries) == 0 {
-		return nil, errors.Wrap(errLibraryNotFound, "library not found")
+	libraries := make([]library, 0)
+	err = r.conn.SelectContext(ctx, &libraries, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to execute query")
 	}
 
-	return libraries, nil
-
+	return libraries, total, nil
 }
 
-func (r *repository) GetBooksByLibrary(ctx context.Context, libraryUid string, offset, limit int, showAll bool) ([]book, error) {
+// GetBooksByLibrary returns a page of the library books ordered by book id and the number of them.
+func (r *repository) GetBooksByLibrary(ctx context.Context, libraryUid string, p page, showAll bool) ([]book, int, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	filter := sq.And{sq.Eq{"l.library_uid": libraryUid}}
+	if !showAll {
+		filter = append(filter, sq.Gt{"lb.available_count": 0})
+	}
+
 	builder := psql.Select("b.id", "b.book_uid", "b.name", "b.author", "b.genre", "b.condition", "lb.available_count").
 		From("books b").
 		Join("library_books lb ON lb.book_id = b.id").
 		Join("library l ON lb.library_id = l.id").
-		Where(sq.Eq{"l.library_uid": libraryUid}).Limit(uint64(limit)).Offset(uint64(offset))
-
-	if !showAll {
-		builder = builder.Where(sq.Gt{"lb.available_count": 0})
+		Where(filter).
+		OrderBy("b.id").
+		Limit(uint64(p.Limit)).Offset(uint64(p.Offset))
+	if p.AfterID > 0 {
+		builder = builder.Where(sq.Gt{"b.id": p.AfterID})
 	}
+
 	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to build query")
+	}
 
+	countQuery, countArgs, err := psql.Select("COUNT(*)").
+		From("library_books lb").
+		Join("library l ON lb.library_id = l.id").
+		Where(filter).
+		ToSql()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to build query")
+		return nil, 0, errors.Wrap(err, "failed to build query")
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	books := make([]book, 0)
-	err = r.conn.SelectContext(ctx, &books, query, args...)
+	var total int
+	err = r.conn.GetContext(ctx, &total, countQuery, countArgs...)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to execute query")
+		return nil, 0, errors.Wrap(err, "failed to execute query")
 	}
 
-	if len(books) == 0 {
-		return nil, errors.Wrap(errBookNotFound, "book not found")
+	books := make([]book, 0)
+	err = r.conn.SelectContext(ctx, &books, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to execute query")
 	}
 
-	return books, nil
+	return books, total, nil
 }
 
 func (r *repository) GetBooksAvailableCount(ctx context.Context, libraryUid, bookUid string) (int, error) {
@@ -100,6 +166,9 @@ func (r *repository) GetBooksAvailableCount(ctx context.Context, libraryUid, boo
 	var count int
 	err = r.conn.GetContext(ctx, &count, query, args...)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.Wrap(errRecordNotFound, "record not found")
+		}
 		return 0, errors.Wrap(err, "failed to execute query")
 	}
 
@@ -108,7 +177,7 @@ func (r *repository) GetBooksAvailableCount(ctx context.Context, libraryUid, boo
 
 func (r *repository) GetBooksByUids(ctx context.Context, uids []string) ([]book, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	builder := psql.Select("id", "book_uid", "name", "author", "genre", "condition").
+	builder := psql.Select(bookColumns...).
 		From("books").
 		Where(sq.Eq{"book_uid": uids})
 
@@ -160,18 +229,287 @@ func (r *repository) GetLibrariesByUids(ctx context.Context, uids []string) ([]l
 	return libraries, nil
 }
 
-func (r *repository) UpdateBooksAvailableCount(ctx context.Context, libraryUid, bookUid string, count int) error {
+// UpdateBooksAvailableCount labels new copies or withdraws available ones, the count itself follows the copies.
+func (r *repository) UpdateBooksAvailableCount(ctx context.Context, libraryUid, bookUid string, count int, reason string) error {
+	query := `
+SELECT set_available_copies(lb.library_id, lb.book_id, $1)
+FROM library_books lb
+JOIN books b ON b.id = lb.book_id
+JOIN library l ON l.id = lb.library_id
+WHERE b.book_uid = $2 AND l.library_uid = $3;
+`
+	args := []interface{}{count, bookUid, libraryUid}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.beginInventoryTx(ctx, reason)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+
+	if rowsAffected == 0 {
+		return errors.Wrap(errRecordNotFound, "no rows affected")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return nil
+}
+
+func (r *repository) CreateLibrary(ctx context.Context, l *library) (library, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Insert("library").Columns("library_uid", "name", "city", "address").
+		Values(l.LibraryUid, l.Name, l.City, l.Address).
+		Suffix("RETURNING id, library_uid, name, address, city, closed_at")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return library{}, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := library{}
+	err = r.conn.GetContext(ctx, &res, query, args...)
+	if err != nil {
+		return library{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+// UpdateLibrary changes an open library, closed libraries are treated as not found.
+func (r *repository) UpdateLibrary(ctx context.Context, l *library) (library, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Update("library").
+		Set("name", l.Name).
+		Set("city", l.City).
+		Set("address", l.Address).
+		Where(sq.Eq{"library_uid": l.LibraryUid, "closed_at": nil}).
+		Suffix("RETURNING id, library_uid, name, address, city, closed_at")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return library{}, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := library{}
+	err = r.conn.GetContext(ctx, &res, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return library{}, errors.Wrap(errLibraryNotFound, "library not found")
+		}
+		return library{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+// CloseLibrary soft deletes the library: it disappears from the city listing, but stays
+// resolvable by uid for existing reservations.
+func (r *repository) CloseLibrary(ctx context.Context, libraryUid string) error {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Update("library").
+		Set("closed_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"library_uid": libraryUid, "closed_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := r.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+
+	if rowsAffected == 0 {
+		return errors.Wrap(errLibraryNotFound, "no rows affected")
+	}
+
+	return nil
+}
+
+func (r *repository) CreateBook(ctx context.Context, b *book) (book, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Insert("books").
+		Columns("book_uid", "name", "author", "genre", "condition",
+			"isbn", "publisher", "year", "language", "page_count", "description").
+		Values(b.BookUid, b.Name, b.Author, b.Genre, b.Condition,
+			b.ISBN, b.Publisher, b.Year, b.Language, b.PageCount, b.Description).
+		Suffix("RETURNING " + strings.Join(bookColumns, ", "))
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return book{}, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := book{}
+	err = r.conn.GetContext(ctx, &res, query, args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return book{}, errors.Wrap(errISBNTaken, "isbn is already taken")
+		}
+		return book{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+func (r *repository) UpdateBook(ctx context.Context, b *book) (book, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Update("books").
+		Set("name", b.Name).
+		Set("author", b.Author).
+		Set("genre", b.Genre).
+		Set("condition", b.Condition).
+		Set("isbn", b.ISBN).
+		Set("publisher", b.Publisher).
+		Set("year", b.Year).
+		Set("language", b.Language).
+		Set("page_count", b.PageCount).
+		Set("description", b.Description).
+		Where(sq.Eq{"book_uid": b.BookUid}).
+		Suffix("RETURNING " + strings.Join(bookColumns, ", "))
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return book{}, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := book{}
+	err = r.conn.GetContext(ctx, &res, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return book{}, errors.Wrap(errBookNotFound, "book not found")
+		}
+		if isUniqueViolation(err) {
+			return book{}, errors.Wrap(errISBNTaken, "isbn is already taken")
+		}
+		return book{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+// GetBookByISBN expects the isbn already normalized to ISBN-13.
+func (r *repository) GetBookByISBN(ctx context.Context, isbn string) (book, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Select(bookColumns...).
+		From("books").
+		Where(sq.Eq{"isbn": isbn})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return book{}, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := book{}
+	err = r.conn.GetContext(ctx, &res, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return book{}, errors.Wrap(errBookNotFound, "book not found")
+		}
+		return book{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+// UpsertLibraryBook sets the stock of a book in an open library, it reports whether the book was attached
+// to the library by this call.
+func (r *repository) UpsertLibraryBook(ctx context.Context, libraryUid, bookUid string, count int) (bool, error) {
+	upsertQuery := `
+INSERT INTO library_books (library_id, book_id, available_count)
+SELECT l.id, b.id, 0
+FROM library l, books b
+WHERE l.library_uid = $1 AND l.closed_at IS NULL AND b.book_uid = $2
+ON CONFLICT (library_id, book_id) DO UPDATE SET available_count = library_books.available_count
+RETURNING library_id, book_id, (xmax = 0) AS created;
+`
+	setCountQuery := `SELECT set_available_copies($1, $2, $3);`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.beginInventoryTx(ctx, adjustmentReason)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var (
+		libraryID, bookID int
+		created           bool
+	)
+	err = tx.QueryRowxContext(ctx, upsertQuery, libraryUid, bookUid).Scan(&libraryID, &bookID, &created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, errors.Wrap(errRecordNotFound, "library or book not found")
+		}
+		return false, errors.Wrap(err, "failed to execute query")
+	}
+
+	_, err = tx.ExecContext(ctx, setCountQuery, libraryID, bookID, count)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to execute query")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return created, nil
+}
+
+func (r *repository) DeleteLibraryBook(ctx context.Context, libraryUid, bookUid string) error {
 	query := `
-UPDATE library_books
-SET available_count = $1
+DELETE FROM library_books
 WHERE book_id = (
-    SELECT id FROM books WHERE book_uid = $2
+    SELECT id FROM books WHERE book_uid = $1
 )
 AND library_id = (
-    SELECT id FROM library WHERE library_uid = $3
+    SELECT id FROM library WHERE library_uid = $2
 );
 `
-	args := []interface{}{count, bookUid, libraryUid}
+	args := []interface{}{bookUid, libraryUid}
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
@@ -192,3 +530,371 @@ AND library_id = (
 
 	return nil
 }
+
+func (r *repository) GetCopy(ctx context.Context, barcode string) (bookCopy, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Select("c.id", "c.barcode", "l.library_uid", "b.book_uid", "c.condition", "c.status", "c.reservation_uid").
+		From("book_copies c").
+		Join("library l ON l.id = c.library_id").
+		Join("books b ON b.id = c.book_id").
+		Where(sq.Eq{"c.barcode": barcode})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return bookCopy{}, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := bookCopy{}
+	err = r.conn.GetContext(ctx, &res, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return bookCopy{}, errors.Wrap(errCopyNotFound, "copy not found")
+		}
+		return bookCopy{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+func (r *repository) GetCopies(ctx context.Context, status string) ([]bookCopy, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Select("c.id", "c.barcode", "l.library_uid", "b.book_uid", "c.condition", "c.status", "c.reservation_uid").
+		From("book_copies c").
+		Join("library l ON l.id = c.library_id").
+		Join("books b ON b.id = c.book_id").
+		Where(sq.Eq{"c.status": status}).
+		OrderBy("c.id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	copies := make([]bookCopy, 0)
+	err = r.conn.SelectContext(ctx, &copies, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+
+	return copies, nil
+}
+
+// CheckoutCopy assigns an available copy of the book to the reservation. An empty barcode means any copy,
+// a scanned one must belong to the same library and book. A copy already held by the reservation is put
+// back on the shelf first, so the desk can hand out another copy than the one picked online.
+func (r *repository) CheckoutCopy(ctx context.Context, libraryUid, bookUid, barcode, reservationUid string) (bookCopy, error) {
+	releaseQuery := `
+UPDATE book_copies SET status = 'AVAILABLE', reservation_uid = NULL
+WHERE reservation_uid = $1;
+`
+	checkoutQuery := `
+WITH picked AS (
+    SELECT c.id FROM book_copies c
+    JOIN library l ON l.id = c.library_id
+    JOIN books b ON b.id = c.book_id
+    WHERE l.library_uid = $1 AND b.book_uid = $2 AND c.status = 'AVAILABLE' AND ($3 = '' OR c.barcode = $3)
+    ORDER BY c.id
+    LIMIT 1
+    FOR UPDATE OF c SKIP LOCKED
+)
+UPDATE book_copies c SET status = 'CHECKED_OUT', reservation_uid = $4
+FROM picked
+WHERE c.id = picked.id
+RETURNING c.id, c.barcode, $1 AS library_uid, $2 AS book_uid, c.condition, c.status, c.reservation_uid;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.beginInventoryTx(ctx, "")
+	if err != nil {
+		return bookCopy{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, releaseQuery, reservationUid)
+	if err != nil {
+		return bookCopy{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	res := bookCopy{}
+	err = tx.GetContext(ctx, &res, checkoutQuery, libraryUid, bookUid, barcode, reservationUid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return bookCopy{}, errors.Wrap(errCopyUnavailable, "no available copy")
+		}
+		return bookCopy{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return bookCopy{}, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return res, nil
+}
+
+// ReturnCopy puts a checked out copy back on the shelf, the result keeps the reservation it was lent by.
+func (r *repository) ReturnCopy(ctx context.Context, barcode, condition string) (bookCopy, error) {
+	query := `
+WITH returned AS (
+    SELECT c.id, c.reservation_uid, l.library_uid, b.book_uid FROM book_copies c
+    JOIN library l ON l.id = c.library_id
+    JOIN books b ON b.id = c.book_id
+    WHERE c.barcode = $1 AND c.status = 'CHECKED_OUT'
+    FOR UPDATE OF c
+)
+UPDATE book_copies c SET status = 'AVAILABLE', reservation_uid = NULL, condition = $2
+FROM returned
+WHERE c.id = returned.id
+RETURNING c.id, c.barcode, returned.library_uid, returned.book_uid, c.condition, c.status, returned.reservation_uid;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.beginInventoryTx(ctx, "")
+	if err != nil {
+		return bookCopy{}, err
+	}
+	defer tx.Rollback()
+
+	res := bookCopy{}
+	err = tx.GetContext(ctx, &res, query, barcode, condition)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return bookCopy{}, errors.Wrap(errCopyUnavailable, "copy is not checked out")
+		}
+		return bookCopy{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return bookCopy{}, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return res, nil
+}
+
+// GetInventoryCount rebuilds the available count of a book in a library from the ledger as it was at the moment.
+func (r *repository) GetInventoryCount(ctx context.Context, libraryUid, bookUid string, at time.Time) (int, error) {
+	query := `
+SELECT COALESCE(SUM(il.delta), 0)
+FROM library l
+CROSS JOIN books b
+LEFT JOIN inventory_ledger il ON il.library_id = l.id AND il.book_id = b.id AND il.created_at <= $3
+WHERE l.library_uid = $1 AND b.book_uid = $2
+GROUP BY l.id, b.id;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var count int
+	err := r.conn.GetContext(ctx, &count, query, libraryUid, bookUid, at)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.Wrap(errRecordNotFound, "library or book not found")
+		}
+		return 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	return count, nil
+}
+
+// GetStockCount counts the copies of a book in a library that are on the shelf or on loan, copies in transit
+// or withdrawn can not be lent.
+func (r *repository) GetStockCount(ctx context.Context, libraryUid, bookUid string) (int, error) {
+	query := `
+SELECT COUNT(c.id)
+FROM library l
+CROSS JOIN books b
+LEFT JOIN book_copies c ON c.library_id = l.id AND c.book_id = b.id AND c.status IN ('AVAILABLE', 'CHECKED_OUT')
+WHERE l.library_uid = $1 AND b.book_uid = $2 AND l.closed_at IS NULL
+GROUP BY l.id, b.id;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var count int
+	err := r.conn.GetContext(ctx, &count, query, libraryUid, bookUid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.Wrap(errRecordNotFound, "library or book not found")
+		}
+		return 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	return count, nil
+}
+
+// SearchBooks matches the query against both russian and english configurations and ranks by relevance.
+// Only books held by an open library, in the city when it is set, are found.
+func (r *repository) SearchBooks(ctx context.Context, filter searchFilter, offset, limit int) ([]foundBook, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	held := sq.Select("1").
+		From("library_books lb").
+		Join("library l ON l.id = lb.library_id").
+		Where("lb.book_id = b.id").
+		Where(sq.Eq{"l.closed_at": nil})
+	if filter.City != "" {
+		held = held.Where(sq.Eq{"l.city": filter.City})
+	}
+	heldSql, heldArgs, err := held.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	builder := psql.Select("b.id", "b.book_uid", "b.name", "COALESCE(b.author, '') AS author", "COALESCE(b.genre, '') AS genre", "b.condition",
+		"ts_rank(b.search_vector, q.query) AS rank",
+		"ts_headline('russian', b.name || ' ' || COALESCE(b.author, ''), q.query, 'StartSel=<b>, StopSel=</b>, MaxFragments=2') AS highlight",
+		"COUNT(*) OVER () AS total").
+		From("books b").
+		JoinClause(sq.Expr("CROSS JOIN (SELECT websearch_to_tsquery('russian', ?) || websearch_to_tsquery('english', ?) AS query) q", filter.Query, filter.Query)).
+		Where("b.search_vector @@ q.query").
+		Where(sq.Expr("EXISTS ("+heldSql+")", heldArgs...)).
+		OrderBy("rank DESC", "b.id").
+		Limit(uint64(limit)).Offset(uint64(offset))
+
+	if filter.Genre != "" {
+		builder = builder.Where(sq.Expr("LOWER(b.genre) = LOWER(?)", filter.Genre))
+	}
+	if filter.Author != "" {
+		builder = builder.Where(sq.ILike{"b.author": "%" + filter.Author + "%"})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	books := make([]foundBook, 0)
+	err = r.conn.SelectContext(ctx, &books, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+
+	return books, nil
+}
+
+func (r *repository) GetBooksAvailability(ctx context.Context, bookIDs []int, city string) ([]bookAvailability, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Select("lb.book_id", "l.library_uid", "l.name", "l.address", "l.city", "lb.available_count").
+		From("library_books lb").
+		Join("library l ON l.id = lb.library_id").
+		Where(sq.Eq{"lb.book_id": bookIDs, "l.closed_at": nil}).
+		OrderBy("lb.available_count DESC", "l.id")
+
+	if city != "" {
+		builder = builder.Where(sq.Eq{"l.city": city})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	availability := make([]bookAvailability, 0)
+	err = r.conn.SelectContext(ctx, &availability, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+
+	return availability, nil
+}
+
+// GetNearbyLibraries narrows open libraries down by a bounding box first, so the coordinates index is used,
+// and then keeps the ones within the haversine distance, the closest first.
+func (r *repository) GetNearbyLibraries(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]nearbyLibrary, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	latDelta := radiusKm / kmPerDegree
+	box := sq.And{
+		sq.Eq{"closed_at": nil},
+		sq.Expr("latitude BETWEEN ? AND ?", lat-latDelta, lat+latDelta),
+	}
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0.01 {
+		lonDelta := radiusKm / (kmPerDegree * cos)
+		box = append(box, sq.Expr("longitude BETWEEN ? AND ?", lon-lonDelta, lon+lonDelta))
+	}
+
+	distance := sq.Expr(`2 * ? * ASIN(SQRT(
+		POWER(SIN(RADIANS(latitude - ?) / 2), 2) +
+		COS(RADIANS(?)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - ?) / 2), 2)
+	)) AS distance`, earthRadiusKm, lat, lat, lon)
+
+	inner := psql.Select("id", "library_uid", "name", "address", "city", "latitude", "longitude").
+		Column(distance).
+		From("library").
+		Where(box)
+
+	builder := psql.Select("*").
+		FromSelect(inner, "t").
+		Where(sq.LtOrEq{"distance": radiusKm}).
+		OrderBy("distance", "id").
+		Limit(uint64(limit))
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	libraries := make([]nearbyLibrary, 0)
+	err = r.conn.SelectContext(ctx, &libraries, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+
+	return libraries, nil
+}
+
+// SetLibraryLocation stores coordinates for every library at the address, it returns how many were updated.
+func (r *repository) SetLibraryLocation(ctx context.Context, city, address string, lat, lon float64) (int, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	builder := psql.Update("library").
+		Set("latitude", lat).
+		Set("longitude", lon).
+		Where(sq.Eq{"city": city, "address": address})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := r.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get rows affected")
+	}
+
+	return int(rowsAffected), nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode
+}
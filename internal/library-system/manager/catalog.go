@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/catalog"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/config"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImportCatalog imports a local CSV or JSON lines file, the format is taken from the extension.
+// The report is written to stdout.
+func ImportCatalog(ctx context.Context, path string, dryRun bool) error {
+	format := catalog.CSVFormat
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".jsonl" || ext == ".ndjson" {
+		format = catalog.JSONLFormat
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		log.Error().Err(err).Msg("config load error")
+		return err
+	}
+
+	psqldb, err := sqlx.Connect("postgres", cfg.PostgreSQL.DSN)
+	if err != nil {
+		log.Error().Err(err).Msg("postgresql connection error")
+		return err
+	}
+	defer psqldb.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open catalog file")
+		return err
+	}
+	defer file.Close()
+
+	report, err := catalog.NewImporter(catalog.NewRepository(psqldb)).Import(ctx, format, file, dryRun)
+	if err != nil {
+		log.Error().Err(err).Msg("catalog import error")
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
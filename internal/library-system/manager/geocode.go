@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"context"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/config"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/geocode"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/library"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+	"os"
+)
+
+// Geocode imports library coordinates from a local CSV file, see geocode.Import for the format.
+func Geocode(ctx context.Context, path string) error {
+	cfg, err := config.New()
+	if err != nil {
+		log.Error().Err(err).Msg("config load error")
+		return err
+	}
+
+	psqldb, err := sqlx.Connect("postgres", cfg.PostgreSQL.DSN)
+	if err != nil {
+		log.Error().Err(err).Msg("postgresql connection error")
+		return err
+	}
+	defer psqldb.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open geocoding file")
+		return err
+	}
+	defer file.Close()
+
+	res, err := geocode.NewImporter(library.NewRepository(psqldb)).Import(ctx, file)
+	if err != nil {
+		log.Error().Err(err).Msg("geocoding import error")
+		return err
+	}
+
+	log.Info().Int("rows", res.Rows).Int("updated", res.Updated).Strs("unmatched", res.Unmatched).Msg("geocoding import completed")
+	return nil
+}
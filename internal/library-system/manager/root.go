@@ -2,9 +2,13 @@ package manager
 
 import (
 	"context"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/catalog"
 	"github.com/Erlendum/rsoi-lab-02/internal/library-system/config"
 	"github.com/Erlendum/rsoi-lab-02/internal/library-system/http"
 	"github.com/Erlendum/rsoi-lab-02/internal/library-system/library"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/policy"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/schedule"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/transfer"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/rs/zerolog"
@@ -49,7 +53,17 @@ func (r *root) Register(ctx context.Context) error {
 
 	libraryHandler := library.NewHandler(libraryRepo, r.cfg)
 
-	r.server = http.NewServer(&r.cfg.Server, libraryHandler)
+	catalogImporter := catalog.NewImporter(catalog.NewRepository(psqldb))
+
+	catalogHandler := catalog.NewHandler(catalogImporter, r.cfg)
+
+	transferHandler := transfer.NewHandler(transfer.NewRepository(psqldb), r.cfg)
+
+	scheduleHandler := schedule.NewHandler(schedule.NewRepository(psqldb), r.cfg)
+
+	policyHandler := policy.NewHandler(policy.NewRepository(psqldb), r.cfg)
+
+	r.server = http.NewServer(&r.cfg.Server, libraryHandler, catalogHandler, transferHandler, scheduleHandler, policyHandler)
 
 	err = r.server.Init()
 	if err != nil {
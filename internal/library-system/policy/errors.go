@@ -0,0 +1,9 @@
+package policy
+
+import "errors"
+
+var (
+	errLibraryNotFound = errors.New("library not found")
+	errBookNotFound    = errors.New("book not found")
+	errPolicyNotFound  = errors.New("policy not found")
+)
@@ -0,0 +1,228 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/config"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+)
+
+//go:generate mockgen -source=handler.go -destination=handler_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/library-system/policy -package=policy
+
+type storage interface {
+	GetPolicies(ctx context.Context, libraryUid string) ([]policy, error)
+	GetBookPolicies(ctx context.Context, libraryUid, bookUid string) ([]policy, error)
+	SetPolicy(ctx context.Context, libraryUid string, p policy) error
+	DeletePolicy(ctx context.Context, libraryUid string, p policy) error
+}
+
+type handler struct {
+	storage storage
+	config  *config.Config
+}
+
+func NewHandler(storage storage, config *config.Config) *handler {
+	return &handler{storage: storage, config: config}
+}
+
+func (h *handler) Register(echo *echo.Echo) {
+	api := echo.Group("/api/v1")
+
+	api.Use(auth.Middleware(h.config.JWKURI))
+
+	api.GET("/libraries/:libraryuid/policies", h.GetPolicies)
+	api.GET("/libraries/:libraryuid/books/:bookuid/policy", h.GetBookPolicy)
+	api.PUT("/libraries/:libraryuid/policy", h.SetPolicy, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryuid/policy", h.DeletePolicy, auth.RequireRole(auth.AdminRole))
+	api.PUT("/libraries/:libraryuid/policy/genres/:genre", h.SetPolicy, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryuid/policy/genres/:genre", h.DeletePolicy, auth.RequireRole(auth.AdminRole))
+	api.PUT("/libraries/:libraryuid/policy/books/:bookuid", h.SetPolicy, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryuid/policy/books/:bookuid", h.DeletePolicy, auth.RequireRole(auth.AdminRole))
+}
+
+type rulesItem struct {
+	MaxLoanDays        *int `json:"maxLoanDays" validate:"omitempty,min=1"`
+	MaxRenewals        *int `json:"maxRenewals" validate:"omitempty,min=0"`
+	MaxConcurrentLoans *int `json:"maxConcurrentLoans" validate:"omitempty,min=1"`
+	GraceDays          *int `json:"graceDays" validate:"omitempty,min=0"`
+}
+
+func newRulesItem(r rules) rulesItem {
+	return rulesItem{
+		MaxLoanDays:        r.MaxLoanDays,
+		MaxRenewals:        r.MaxRenewals,
+		MaxConcurrentLoans: r.MaxConcurrentLoans,
+		GraceDays:          r.GraceDays,
+	}
+}
+
+// scopeFromPath tells which policy the route addresses: a book, a genre or, without both, the library.
+func scopeFromPath(c echo.Context) policy {
+	p := policy{}
+	if genre := c.Param("genre"); genre != "" {
+		p.Genre = &genre
+	}
+	if bookUid := c.Param("bookuid"); bookUid != "" {
+		p.BookUid = &bookUid
+	}
+	return p
+}
+
+// storageError answers 404 for a missing library, book or policy and 500 otherwise.
+func storageError(c echo.Context, err error, message string) error {
+	log.Err(err).Msg(message)
+	switch {
+	case errors.Is(err, errLibraryNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "library not found",
+		})
+	case errors.Is(err, errBookNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "book not found",
+		})
+	case errors.Is(err, errPolicyNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "policy not found",
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, echo.Map{
+		"message": message,
+	})
+}
+
+// GetPolicies returns every policy of the library as it is stored, rules left out are inherited.
+func (h *handler) GetPolicies(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	policies, err := h.storage.GetPolicies(c.Request().Context(), libraryUid)
+	if err != nil {
+		return storageError(c, err, "failed to get policies")
+	}
+
+	type item struct {
+		Scope   string  `json:"scope"`
+		Genre   *string `json:"genre,omitempty"`
+		BookUid *string `json:"bookUid,omitempty"`
+		rulesItem
+	}
+	type response struct {
+		LibraryUid string `json:"libraryUid"`
+		Policies   []item `json:"policies"`
+	}
+
+	res := response{LibraryUid: libraryUid, Policies: make([]item, 0, len(policies))}
+	for _, v := range policies {
+		res.Policies = append(res.Policies, item{
+			Scope:     v.scope(),
+			Genre:     v.Genre,
+			BookUid:   v.BookUid,
+			rulesItem: newRulesItem(v.rules),
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetBookPolicy returns the rules a loan of the book from the library follows, a missing rule is not limited.
+func (h *handler) GetBookPolicy(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	bookUid := c.Param("bookuid")
+	if libraryUid == "" || bookUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	policies, err := h.storage.GetBookPolicies(c.Request().Context(), libraryUid, bookUid)
+	if err != nil {
+		return storageError(c, err, "failed to get policy")
+	}
+
+	type response struct {
+		LibraryUid string `json:"libraryUid"`
+		BookUid    string `json:"bookUid"`
+		rulesItem
+	}
+
+	return c.JSON(http.StatusOK, response{
+		LibraryUid: libraryUid,
+		BookUid:    bookUid,
+		rulesItem:  newRulesItem(effective(policies)),
+	})
+}
+
+// SetPolicy replaces the policy of the library, a genre or a book; rules left out are inherited.
+func (h *handler) SetPolicy(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read request body",
+		})
+	}
+
+	req := rulesItem{}
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		log.Err(err).Msg("failed to unmarshal request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal request body",
+		})
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate request body",
+		})
+	}
+
+	p := scopeFromPath(c)
+	p.rules = rules{
+		MaxLoanDays:        req.MaxLoanDays,
+		MaxRenewals:        req.MaxRenewals,
+		MaxConcurrentLoans: req.MaxConcurrentLoans,
+		GraceDays:          req.GraceDays,
+	}
+
+	err = h.storage.SetPolicy(c.Request().Context(), libraryUid, p)
+	if err != nil {
+		return storageError(c, err, "failed to set policy")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeletePolicy removes the policy of the library, a genre or a book.
+func (h *handler) DeletePolicy(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	err := h.storage.DeletePolicy(c.Request().Context(), libraryUid, scopeFromPath(c))
+	if err != nil {
+		return storageError(c, err, "failed to delete policy")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
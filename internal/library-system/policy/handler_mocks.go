@@ -0,0 +1,93 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: handler.go
+
+// Package policy is a generated GoMock package.
+package policy
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// Mockstorage is a mock of storage interface.
+type Mockstorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockstorageMockRecorder
+}
+
+// MockstorageMockRecorder is the mock recorder for Mockstorage.
+type MockstorageMockRecorder struct {
+	mock *Mockstorage
+}
+
+// NewMockstorage creates a new mock instance.
+func NewMockstorage(ctrl *gomock.Controller) *Mockstorage {
+	mock := &Mockstorage{ctrl: ctrl}
+	mock.recorder = &MockstorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
+	return m.recorder
+}
+
+// DeletePolicy mocks base method.
+func (m *Mockstorage) DeletePolicy(ctx context.Context, libraryUid string, p policy) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePolicy", ctx, libraryUid, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePolicy indicates an expected call of DeletePolicy.
+func (mr *MockstorageMockRecorder) DeletePolicy(ctx, libraryUid, p interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePolicy", reflect.TypeOf((*Mockstorage)(nil).DeletePolicy), ctx, libraryUid, p)
+}
+
+// GetBookPolicies mocks base method.
+func (m *Mockstorage) GetBookPolicies(ctx context.Context, libraryUid, bookUid string) ([]policy, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookPolicies", ctx, libraryUid, bookUid)
+	ret0, _ := ret[0].([]policy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBookPolicies indicates an expected call of GetBookPolicies.
+func (mr *MockstorageMockRecorder) GetBookPolicies(ctx, libraryUid, bookUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookPolicies", reflect.TypeOf((*Mockstorage)(nil).GetBookPolicies), ctx, libraryUid, bookUid)
+}
+
+// GetPolicies mocks base method.
+func (m *Mockstorage) GetPolicies(ctx context.Context, libraryUid string) ([]policy, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPolicies", ctx, libraryUid)
+	ret0, _ := ret[0].([]policy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPolicies indicates an expected call of GetPolicies.
+func (mr *MockstorageMockRecorder) GetPolicies(ctx, libraryUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPolicies", reflect.TypeOf((*Mockstorage)(nil).GetPolicies), ctx, libraryUid)
+}
+
+// SetPolicy mocks base method.
+func (m *Mockstorage) SetPolicy(ctx context.Context, libraryUid string, p policy) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPolicy", ctx, libraryUid, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPolicy indicates an expected call of SetPolicy.
+func (mr *MockstorageMockRecorder) SetPolicy(ctx, libraryUid, p interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPolicy", reflect.TypeOf((*Mockstorage)(nil).SetPolicy), ctx, libraryUid, p)
+}
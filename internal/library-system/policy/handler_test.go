@@ -0,0 +1,212 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testLibraryUid = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+	testBookUid    = "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func strPtr(v string) *string {
+	return &v
+}
+
+func Test_GetBookPolicy(t *testing.T) {
+	type fields struct {
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(storage *Mockstorage)
+	}{
+		{
+			name: "http-code 404: book not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetBookPolicies(gomock.Any(), testLibraryUid, testBookUid).Return(nil, errBookNotFound)
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetBookPolicies(gomock.Any(), testLibraryUid, testBookUid).Return(nil, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: no policy, no limits",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"` + testLibraryUid + `","bookUid":"` + testBookUid + `","maxLoanDays":null,"maxRenewals":null,"maxConcurrentLoans":null,"graceDays":null}
+`,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetBookPolicies(gomock.Any(), testLibraryUid, testBookUid).Return([]policy{}, nil)
+			},
+		},
+		{
+			name: "http-code 200: book overrides genre overrides library",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"` + testLibraryUid + `","bookUid":"` + testBookUid + `","maxLoanDays":3,"maxRenewals":0,"maxConcurrentLoans":5,"graceDays":2}
+`,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetBookPolicies(gomock.Any(), testLibraryUid, testBookUid).Return([]policy{
+					{BookUid: strPtr(testBookUid), rules: rules{MaxLoanDays: intPtr(3)}},
+					{Genre: strPtr("Reference"), rules: rules{MaxLoanDays: intPtr(7), MaxRenewals: intPtr(0)}},
+					{rules: rules{MaxLoanDays: intPtr(30), MaxRenewals: intPtr(2), MaxConcurrentLoans: intPtr(5), GraceDays: intPtr(2)}},
+				}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := NewMockstorage(ctrl)
+			tt.Prepare(storage)
+
+			h := &handler{storage: storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("libraryuid", "bookuid")
+			c.SetParamValues(testLibraryUid, testBookUid)
+
+			err := h.GetBookPolicy(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_SetPolicy(t *testing.T) {
+	type fields struct {
+		genre            string
+		requestBody      string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(storage *Mockstorage)
+	}{
+		{
+			name: "http-code 400: loan days below one",
+			fields: fields{
+				requestBody:      `{"maxLoanDays": 0}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 400: negative grace period",
+			fields: fields{
+				requestBody:      `{"graceDays": -1}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 404: library not found",
+			fields: fields{
+				requestBody:      `{"maxLoanDays": 14}`,
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().SetPolicy(gomock.Any(), testLibraryUid, gomock.Any()).Return(errLibraryNotFound)
+			},
+		},
+		{
+			name: "http-code 204: library policy",
+			fields: fields{
+				requestBody:      `{"maxLoanDays": 14, "maxRenewals": 2, "maxConcurrentLoans": 3, "graceDays": 1}`,
+				expectedHTTPCode: http.StatusNoContent,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().SetPolicy(gomock.Any(), testLibraryUid, policy{rules: rules{
+					MaxLoanDays:        intPtr(14),
+					MaxRenewals:        intPtr(2),
+					MaxConcurrentLoans: intPtr(3),
+					GraceDays:          intPtr(1),
+				}}).Return(nil)
+			},
+		},
+		{
+			name: "http-code 204: genre policy without renewals",
+			fields: fields{
+				genre:            "Reference",
+				requestBody:      `{"maxLoanDays": 3, "maxRenewals": 0}`,
+				expectedHTTPCode: http.StatusNoContent,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().SetPolicy(gomock.Any(), testLibraryUid, policy{
+					Genre: strPtr("Reference"),
+					rules: rules{MaxLoanDays: intPtr(3), MaxRenewals: intPtr(0)},
+				}).Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := NewMockstorage(ctrl)
+			tt.Prepare(storage)
+
+			h := &handler{storage: storage}
+
+			req := httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString(tt.fields.requestBody))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("libraryuid", "genre")
+			c.SetParamValues(testLibraryUid, tt.fields.genre)
+
+			err := h.SetPolicy(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package policy
+
+const (
+	libraryScope = "LIBRARY"
+	genreScope   = "GENRE"
+	bookScope    = "BOOK"
+)
+
+// rules are the limits of a policy, nil means the limit is inherited or, for the library policy, not set.
+type rules struct {
+	MaxLoanDays        *int `db:"max_loan_days"`
+	MaxRenewals        *int `db:"max_renewals"`
+	MaxConcurrentLoans *int `db:"max_concurrent_loans"`
+	GraceDays          *int `db:"grace_days"`
+}
+
+type policy struct {
+	Genre   *string `db:"genre"`
+	BookUid *string `db:"book_uid"`
+	rules
+}
+
+func (p policy) scope() string {
+	switch {
+	case p.BookUid != nil:
+		return bookScope
+	case p.Genre != nil:
+		return genreScope
+	default:
+		return libraryScope
+	}
+}
+
+// override returns the rules with the limits set in other replacing the own ones.
+func (r rules) override(other rules) rules {
+	if other.MaxLoanDays != nil {
+		r.MaxLoanDays = other.MaxLoanDays
+	}
+	if other.MaxRenewals != nil {
+		r.MaxRenewals = other.MaxRenewals
+	}
+	if other.MaxConcurrentLoans != nil {
+		r.MaxConcurrentLoans = other.MaxConcurrentLoans
+	}
+	if other.GraceDays != nil {
+		r.GraceDays = other.GraceDays
+	}
+	return r
+}
+
+// effective merges the policies that apply to a book, the book policy wins over the genre policy which
+// wins over the library policy.
+func effective(policies []policy) rules {
+	res := rules{}
+	for _, scope := range []string{libraryScope, genreScope, bookScope} {
+		for _, p := range policies {
+			if p.scope() == scope {
+				res = res.override(p.rules)
+			}
+		}
+	}
+	return res
+}
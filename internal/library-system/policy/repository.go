@@ -0,0 +1,209 @@
+package policy
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+)
+
+type repository struct {
+	conn *sqlx.DB
+}
+
+func NewRepository(conn *sqlx.DB) *repository {
+	return &repository{conn: conn}
+}
+
+func getLibraryID(ctx context.Context, q sqlx.QueryerContext, libraryUid string) (int, error) {
+	query := `SELECT id FROM library WHERE library_uid = $1 AND closed_at IS NULL;`
+
+	var id int
+	err := q.QueryRowxContext(ctx, query, libraryUid).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.Wrap(errLibraryNotFound, "library not found")
+		}
+		return 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	return id, nil
+}
+
+func getBook(ctx context.Context, q sqlx.QueryerContext, bookUid string) (int, *string, error) {
+	query := `SELECT id, genre FROM books WHERE book_uid = $1;`
+
+	var (
+		id    int
+		genre *string
+	)
+	err := q.QueryRowxContext(ctx, query, bookUid).Scan(&id, &genre)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil, errors.Wrap(errBookNotFound, "book not found")
+		}
+		return 0, nil, errors.Wrap(err, "failed to execute query")
+	}
+
+	return id, genre, nil
+}
+
+func selectPolicies() sq.SelectBuilder {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	return psql.Select("p.genre", "b.book_uid", "p.max_loan_days", "p.max_renewals", "p.max_concurrent_loans", "p.grace_days").
+		From("lending_policies p").
+		LeftJoin("books b ON b.id = p.book_id")
+}
+
+// GetPolicies returns the policy of the library followed by its genre and book overrides.
+func (r *repository) GetPolicies(ctx context.Context, libraryUid string) ([]policy, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	libraryID, err := getLibraryID(ctx, r.conn, libraryUid)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := selectPolicies().
+		Where(sq.Eq{"p.library_id": libraryID}).
+		OrderBy("p.book_id NULLS FIRST", "p.genre NULLS FIRST").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	res := make([]policy, 0)
+	err = r.conn.SelectContext(ctx, &res, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+// GetBookPolicies returns the policies of the library that apply to the book: its own, the one of
+// its genre and the one of the library.
+func (r *repository) GetBookPolicies(ctx context.Context, libraryUid, bookUid string) ([]policy, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	libraryID, err := getLibraryID(ctx, r.conn, libraryUid)
+	if err != nil {
+		return nil, err
+	}
+
+	bookID, genre, err := getBook(ctx, r.conn, bookUid)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := sq.Or{
+		sq.Eq{"p.genre": nil, "p.book_id": nil},
+		sq.Eq{"p.book_id": bookID},
+	}
+	if genre != nil {
+		scopes = append(scopes, sq.Eq{"p.genre": *genre})
+	}
+
+	query, args, err := selectPolicies().
+		Where(sq.And{sq.Eq{"p.library_id": libraryID}, scopes}).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	res := make([]policy, 0)
+	err = r.conn.SelectContext(ctx, &res, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+// SetPolicy creates or replaces the policy of the scope given by p: the library, a genre or a book.
+func (r *repository) SetPolicy(ctx context.Context, libraryUid string, p policy) error {
+	query := `
+INSERT INTO lending_policies (library_id, genre, book_id, max_loan_days, max_renewals, max_concurrent_loans, grace_days)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (library_id, COALESCE(genre, ''), COALESCE(book_id, 0)) DO UPDATE
+SET max_loan_days = EXCLUDED.max_loan_days, max_renewals = EXCLUDED.max_renewals,
+    max_concurrent_loans = EXCLUDED.max_concurrent_loans, grace_days = EXCLUDED.grace_days;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	libraryID, err := getLibraryID(ctx, r.conn, libraryUid)
+	if err != nil {
+		return err
+	}
+
+	var bookID *int
+	if p.BookUid != nil {
+		id, _, err := getBook(ctx, r.conn, *p.BookUid)
+		if err != nil {
+			return err
+		}
+		bookID = &id
+	}
+
+	_, err = r.conn.ExecContext(ctx, query, libraryID, p.Genre, bookID,
+		p.MaxLoanDays, p.MaxRenewals, p.MaxConcurrentLoans, p.GraceDays)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	return nil
+}
+
+// DeletePolicy removes the policy of the scope given by p, the broader policy applies again.
+func (r *repository) DeletePolicy(ctx context.Context, libraryUid string, p policy) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	libraryID, err := getLibraryID(ctx, r.conn, libraryUid)
+	if err != nil {
+		return err
+	}
+
+	scope := sq.Eq{"library_id": libraryID, "genre": nil, "book_id": nil}
+	if p.Genre != nil {
+		scope["genre"] = *p.Genre
+	}
+	if p.BookUid != nil {
+		id, _, err := getBook(ctx, r.conn, *p.BookUid)
+		if err != nil {
+			return err
+		}
+		scope["book_id"] = id
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	query, args, err := psql.Delete("lending_policies").Where(scope).ToSql()
+	if err != nil {
+		return errors.Wrap(err, "failed to build query")
+	}
+
+	result, err := r.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+	if affected == 0 {
+		return errors.Wrap(errPolicyNotFound, "policy not found")
+	}
+
+	return nil
+}
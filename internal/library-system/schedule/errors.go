@@ -0,0 +1,9 @@
+package schedule
+
+import "errors"
+
+var (
+	errLibraryNotFound = errors.New("library not found")
+	errClosureNotFound = errors.New("closure not found")
+	errNoOpenDay       = errors.New("library has no open day")
+)
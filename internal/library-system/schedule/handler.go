@@ -0,0 +1,425 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/config"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+)
+
+//go:generate mockgen -source=handler.go -destination=handler_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/library-system/schedule -package=schedule
+
+const (
+	timeFormat = "15:04"
+
+	defaultScheduleDays = 30
+	maxLookaheadDays    = 366
+)
+
+type storage interface {
+	GetSchedule(ctx context.Context, libraryUid string, from, to time.Time) (schedule, error)
+	SetOpeningHours(ctx context.Context, libraryUid, timezone string, hours []openingHours) error
+	SetClosure(ctx context.Context, libraryUid string, c closure) error
+	DeleteClosure(ctx context.Context, libraryUid string, date time.Time) error
+}
+
+type handler struct {
+	storage storage
+	config  *config.Config
+}
+
+func NewHandler(storage storage, config *config.Config) *handler {
+	return &handler{storage: storage, config: config}
+}
+
+func (h *handler) Register(echo *echo.Echo) {
+	api := echo.Group("/api/v1")
+
+	api.Use(auth.Middleware(h.config.JWKURI))
+
+	api.GET("/libraries/:libraryuid/schedule", h.GetSchedule)
+	api.GET("/libraries/:libraryuid/next-open-day", h.GetNextOpenDay)
+	api.GET("/libraries/:libraryuid/calendar", h.GetCalendar)
+	api.PUT("/libraries/:libraryuid/opening-hours", h.SetOpeningHours, auth.RequireRole(auth.AdminRole))
+	api.PUT("/libraries/:libraryuid/closures/:date", h.SetClosure, auth.RequireRole(auth.AdminRole))
+	api.DELETE("/libraries/:libraryuid/closures/:date", h.DeleteClosure, auth.RequireRole(auth.AdminRole))
+}
+
+type openingHoursItem struct {
+	Day      string `json:"day" validate:"required"`
+	OpensAt  string `json:"opensAt" validate:"required"`
+	ClosesAt string `json:"closesAt" validate:"required"`
+}
+
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func parseDateParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.Parse(dateFormat, value)
+}
+
+// GetSchedule returns the weekly hours and the closures between from and to, by default the next 30 days.
+func (h *handler) GetSchedule(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	from, err := parseDateParam(c.QueryParam("from"), today())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "from is wrong",
+		})
+	}
+
+	to, err := parseDateParam(c.QueryParam("to"), from.AddDate(0, 0, defaultScheduleDays))
+	if err != nil || to.Before(from) || to.After(from.AddDate(0, 0, maxLookaheadDays)) {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "to is wrong",
+		})
+	}
+
+	found, err := h.storage.GetSchedule(c.Request().Context(), libraryUid, from, to)
+	if err != nil {
+		log.Err(err).Msg("failed to get schedule")
+		if errors.Is(err, errLibraryNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get schedule",
+		})
+	}
+
+	type closureItem struct {
+		Date   string `json:"date"`
+		Reason string `json:"reason"`
+	}
+	type response struct {
+		LibraryUid   string             `json:"libraryUid"`
+		Timezone     string             `json:"timezone"`
+		OpeningHours []openingHoursItem `json:"openingHours"`
+		Closures     []closureItem      `json:"closures"`
+	}
+
+	res := response{
+		LibraryUid:   libraryUid,
+		Timezone:     found.Timezone,
+		OpeningHours: make([]openingHoursItem, 0, len(found.Hours)),
+		Closures:     make([]closureItem, 0, len(found.Closures)),
+	}
+	for _, v := range found.Hours {
+		res.OpeningHours = append(res.OpeningHours, openingHoursItem{
+			Day:      weekdays[v.Weekday-1],
+			OpensAt:  v.OpensAt,
+			ClosesAt: v.ClosesAt,
+		})
+	}
+	for _, v := range found.Closures {
+		res.Closures = append(res.Closures, closureItem{
+			Date:   v.Date.Format(dateFormat),
+			Reason: v.Reason,
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetCalendar returns the business days of the library between from and to, by default the next year,
+// as days off: weekdays it keeps no hours on and closures.
+func (h *handler) GetCalendar(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	from, err := parseDateParam(c.QueryParam("from"), today())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "from is wrong",
+		})
+	}
+
+	to, err := parseDateParam(c.QueryParam("to"), from.AddDate(0, 0, maxLookaheadDays))
+	if err != nil || to.Before(from) || to.After(from.AddDate(0, 0, maxLookaheadDays)) {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "to is wrong",
+		})
+	}
+
+	found, err := h.storage.GetSchedule(c.Request().Context(), libraryUid, from, to)
+	if err != nil {
+		log.Err(err).Msg("failed to get schedule")
+		if errors.Is(err, errLibraryNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get schedule",
+		})
+	}
+
+	calendar, err := found.calendar()
+	if err != nil {
+		log.Err(err).Msg("failed to build calendar")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to build calendar",
+		})
+	}
+
+	return c.JSON(http.StatusOK, calendar)
+}
+
+// GetNextOpenDay returns the first day from date on when the library is open and its hours, which is
+// where a due date falling on a closed day moves to.
+func (h *handler) GetNextOpenDay(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	date, err := parseDateParam(c.QueryParam("date"), today())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "date is wrong",
+		})
+	}
+
+	found, err := h.storage.GetSchedule(c.Request().Context(), libraryUid, date, date.AddDate(0, 0, maxLookaheadDays))
+	if err != nil {
+		log.Err(err).Msg("failed to get schedule")
+		if errors.Is(err, errLibraryNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get schedule",
+		})
+	}
+
+	openDate, hours, ok := found.nextOpenDay(date, maxLookaheadDays)
+	if !ok {
+		log.Err(errNoOpenDay).Str("libraryUid", libraryUid).Msg("failed to find open day")
+		return c.JSON(http.StatusConflict, echo.Map{
+			"message": errNoOpenDay.Error(),
+		})
+	}
+
+	type response struct {
+		LibraryUid string `json:"libraryUid"`
+		Date       string `json:"date"`
+		OpenDate   string `json:"openDate"`
+		OpensAt    string `json:"opensAt"`
+		ClosesAt   string `json:"closesAt"`
+	}
+
+	return c.JSON(http.StatusOK, response{
+		LibraryUid: libraryUid,
+		Date:       date.Format(dateFormat),
+		OpenDate:   openDate.Format(dateFormat),
+		OpensAt:    hours.OpensAt,
+		ClosesAt:   hours.ClosesAt,
+	})
+}
+
+// SetOpeningHours replaces the weekly hours, an empty list removes the schedule and the library is
+// treated as always open. The timezone is an IANA zone name and is kept when left out.
+func (h *handler) SetOpeningHours(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read request body",
+		})
+	}
+
+	type request struct {
+		Timezone     string             `json:"timezone" validate:"max=64"`
+		OpeningHours []openingHoursItem `json:"openingHours" validate:"max=7,dive"`
+	}
+	req := request{}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		log.Err(err).Msg("failed to unmarshal request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal request body",
+		})
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate request body",
+		})
+	}
+
+	if req.Timezone != "" {
+		if _, err = time.LoadLocation(req.Timezone); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "timezone is wrong",
+			})
+		}
+	}
+
+	hours := make([]openingHours, 0, len(req.OpeningHours))
+	for _, v := range req.OpeningHours {
+		weekday := slices.Index(weekdays, v.Day) + 1
+		if weekday == 0 || slices.ContainsFunc(hours, func(h openingHours) bool { return h.Weekday == weekday }) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "day is wrong: " + v.Day,
+			})
+		}
+
+		opensAt, err := time.Parse(timeFormat, v.OpensAt)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "opensAt is wrong: " + v.OpensAt,
+			})
+		}
+		closesAt, err := time.Parse(timeFormat, v.ClosesAt)
+		if err != nil || !closesAt.After(opensAt) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "closesAt is wrong: " + v.ClosesAt,
+			})
+		}
+
+		hours = append(hours, openingHours{Weekday: weekday, OpensAt: v.OpensAt, ClosesAt: v.ClosesAt})
+	}
+
+	err = h.storage.SetOpeningHours(c.Request().Context(), libraryUid, req.Timezone, hours)
+	if err != nil {
+		log.Err(err).Msg("failed to set opening hours")
+		if errors.Is(err, errLibraryNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to set opening hours",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetClosure marks the date as a holiday or closure of the library, setting it again replaces the reason.
+func (h *handler) SetClosure(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	date, err := time.Parse(dateFormat, c.Param("date"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "date is wrong",
+		})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read request body",
+		})
+	}
+
+	type request struct {
+		Reason string `json:"reason" validate:"max=255"`
+	}
+	req := request{}
+
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			log.Err(err).Msg("failed to unmarshal request body")
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "failed to unmarshal request body",
+			})
+		}
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate request body",
+		})
+	}
+
+	err = h.storage.SetClosure(c.Request().Context(), libraryUid, closure{Date: date, Reason: req.Reason})
+	if err != nil {
+		log.Err(err).Msg("failed to set closure")
+		if errors.Is(err, errLibraryNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to set closure",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *handler) DeleteClosure(c echo.Context) error {
+	libraryUid := c.Param("libraryuid")
+	if libraryUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	date, err := time.Parse(dateFormat, c.Param("date"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "date is wrong",
+		})
+	}
+
+	err = h.storage.DeleteClosure(c.Request().Context(), libraryUid, date)
+	if err != nil {
+		log.Err(err).Msg("failed to delete closure")
+		if errors.Is(err, errClosureNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "closure not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to delete closure",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: handler.go
+
+// Package schedule is a generated GoMock package.
+package schedule
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// Mockstorage is a mock of storage interface.
+type Mockstorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockstorageMockRecorder
+}
+
+// MockstorageMockRecorder is the mock recorder for Mockstorage.
+type MockstorageMockRecorder struct {
+	mock *Mockstorage
+}
+
+// NewMockstorage creates a new mock instance.
+func NewMockstorage(ctrl *gomock.Controller) *Mockstorage {
+	mock := &Mockstorage{ctrl: ctrl}
+	mock.recorder = &MockstorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
+	return m.recorder
+}
+
+// DeleteClosure mocks base method.
+func (m *Mockstorage) DeleteClosure(ctx context.Context, libraryUid string, date time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteClosure", ctx, libraryUid, date)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteClosure indicates an expected call of DeleteClosure.
+func (mr *MockstorageMockRecorder) DeleteClosure(ctx, libraryUid, date interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteClosure", reflect.TypeOf((*Mockstorage)(nil).DeleteClosure), ctx, libraryUid, date)
+}
+
+// GetSchedule mocks base method.
+func (m *Mockstorage) GetSchedule(ctx context.Context, libraryUid string, from, to time.Time) (schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSchedule", ctx, libraryUid, from, to)
+	ret0, _ := ret[0].(schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSchedule indicates an expected call of GetSchedule.
+func (mr *MockstorageMockRecorder) GetSchedule(ctx, libraryUid, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSchedule", reflect.TypeOf((*Mockstorage)(nil).GetSchedule), ctx, libraryUid, from, to)
+}
+
+// SetClosure mocks base method.
+func (m *Mockstorage) SetClosure(ctx context.Context, libraryUid string, c closure) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetClosure", ctx, libraryUid, c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetClosure indicates an expected call of SetClosure.
+func (mr *MockstorageMockRecorder) SetClosure(ctx, libraryUid, c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetClosure", reflect.TypeOf((*Mockstorage)(nil).SetClosure), ctx, libraryUid, c)
+}
+
+// SetOpeningHours mocks base method.
+func (m *Mockstorage) SetOpeningHours(ctx context.Context, libraryUid, timezone string, hours []openingHours) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetOpeningHours", ctx, libraryUid, timezone, hours)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetOpeningHours indicates an expected call of SetOpeningHours.
+func (mr *MockstorageMockRecorder) SetOpeningHours(ctx, libraryUid, timezone, hours interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOpeningHours", reflect.TypeOf((*Mockstorage)(nil).SetOpeningHours), ctx, libraryUid, timezone, hours)
+}
@@ -0,0 +1,287 @@
+package schedule
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testLibraryUid = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+
+func Test_GetNextOpenDay(t *testing.T) {
+	type fields struct {
+		date                 string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+
+	// 2024-12-30 is a Monday
+	weekdaysOnly := []openingHours{
+		{Weekday: 1, OpensAt: "09:00", ClosesAt: "18:00"},
+		{Weekday: 2, OpensAt: "09:00", ClosesAt: "18:00"},
+		{Weekday: 3, OpensAt: "09:00", ClosesAt: "18:00"},
+		{Weekday: 4, OpensAt: "09:00", ClosesAt: "18:00"},
+		{Weekday: 5, OpensAt: "10:00", ClosesAt: "16:00"},
+	}
+	newYear := []closure{
+		{Date: time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), Reason: "New Year's Eve"},
+		{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Reason: "New Year"},
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(storage *Mockstorage)
+	}{
+		{
+			name: "http-code 400: wrong date",
+			fields: fields{
+				date:             "31.12.2024",
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 404: library not found",
+			fields: fields{
+				date:             "2024-12-31",
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetSchedule(gomock.Any(), testLibraryUid, gomock.Any(), gomock.Any()).Return(schedule{}, errLibraryNotFound)
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				date:             "2024-12-31",
+				expectedHTTPCode: http.StatusInternalServerError,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetSchedule(gomock.Any(), testLibraryUid, gomock.Any(), gomock.Any()).Return(schedule{}, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: open day",
+			fields: fields{
+				date:             "2024-12-30",
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"` + testLibraryUid + `","date":"2024-12-30","openDate":"2024-12-30","opensAt":"09:00","closesAt":"18:00"}
+`,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetSchedule(gomock.Any(), testLibraryUid, gomock.Any(), gomock.Any()).
+					Return(schedule{Hours: weekdaysOnly, Closures: newYear}, nil)
+			},
+		},
+		{
+			name: "http-code 200: holidays move to the next open day",
+			fields: fields{
+				date:             "2024-12-31",
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"` + testLibraryUid + `","date":"2024-12-31","openDate":"2025-01-02","opensAt":"09:00","closesAt":"18:00"}
+`,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetSchedule(gomock.Any(), testLibraryUid, gomock.Any(), gomock.Any()).
+					Return(schedule{Hours: weekdaysOnly, Closures: newYear}, nil)
+			},
+		},
+		{
+			name: "http-code 200: weekend moves to monday",
+			fields: fields{
+				date:             "2025-01-04",
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"` + testLibraryUid + `","date":"2025-01-04","openDate":"2025-01-06","opensAt":"09:00","closesAt":"18:00"}
+`,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetSchedule(gomock.Any(), testLibraryUid, gomock.Any(), gomock.Any()).
+					Return(schedule{Hours: weekdaysOnly}, nil)
+			},
+		},
+		{
+			name: "http-code 200: library without hours is always open",
+			fields: fields{
+				date:             "2025-01-04",
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"` + testLibraryUid + `","date":"2025-01-04","openDate":"2025-01-04","opensAt":"00:00","closesAt":"23:59"}
+`,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().GetSchedule(gomock.Any(), testLibraryUid, gomock.Any(), gomock.Any()).
+					Return(schedule{}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := NewMockstorage(ctrl)
+			tt.Prepare(storage)
+
+			h := &handler{storage: storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test?date="+tt.fields.date, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("libraryuid")
+			c.SetParamValues(testLibraryUid)
+
+			err := h.GetNextOpenDay(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_SetOpeningHours(t *testing.T) {
+	type fields struct {
+		requestBody      string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(storage *Mockstorage)
+	}{
+		{
+			name: "http-code 400: unknown day",
+			fields: fields{
+				requestBody:      `{"openingHours":[{"day":"FUNDAY","opensAt":"09:00","closesAt":"18:00"}]}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 400: day twice",
+			fields: fields{
+				requestBody: `{"openingHours":[{"day":"MONDAY","opensAt":"09:00","closesAt":"13:00"},` +
+					`{"day":"MONDAY","opensAt":"14:00","closesAt":"18:00"}]}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 400: closes before it opens",
+			fields: fields{
+				requestBody:      `{"openingHours":[{"day":"MONDAY","opensAt":"18:00","closesAt":"09:00"}]}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 400: unknown timezone",
+			fields: fields{
+				requestBody:      `{"timezone":"Mars/Olympus","openingHours":[]}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 404: library not found",
+			fields: fields{
+				requestBody:      `{"openingHours":[]}`,
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().SetOpeningHours(gomock.Any(), testLibraryUid, "", []openingHours{}).Return(errLibraryNotFound)
+			},
+		},
+		{
+			name: "http-code 204: hours replaced",
+			fields: fields{
+				requestBody:      `{"timezone":"Europe/Moscow","openingHours":[{"day":"SUNDAY","opensAt":"10:00","closesAt":"15:30"}]}`,
+				expectedHTTPCode: http.StatusNoContent,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().SetOpeningHours(gomock.Any(), testLibraryUid, "Europe/Moscow", []openingHours{
+					{Weekday: 7, OpensAt: "10:00", ClosesAt: "15:30"},
+				}).Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := NewMockstorage(ctrl)
+			tt.Prepare(storage)
+
+			h := &handler{storage: storage}
+
+			req := httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString(tt.fields.requestBody))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("libraryuid")
+			c.SetParamValues(testLibraryUid)
+
+			err := h.SetOpeningHours(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_GetCalendar(t *testing.T) {
+	e := echo.New()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := NewMockstorage(ctrl)
+	storage.EXPECT().GetSchedule(gomock.Any(), testLibraryUid, gomock.Any(), gomock.Any()).Return(schedule{
+		Timezone: "Europe/Moscow",
+		Hours: []openingHours{
+			{Weekday: 1, OpensAt: "09:00", ClosesAt: "18:00"},
+			{Weekday: 2, OpensAt: "09:00", ClosesAt: "18:00"},
+			{Weekday: 3, OpensAt: "09:00", ClosesAt: "18:00"},
+			{Weekday: 4, OpensAt: "09:00", ClosesAt: "18:00"},
+			{Weekday: 5, OpensAt: "09:00", ClosesAt: "18:00"},
+			{Weekday: 6, OpensAt: "10:00", ClosesAt: "14:00"},
+		},
+		Closures: []closure{{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Reason: "New Year"}},
+	}, nil)
+
+	h := &handler{storage: storage}
+
+	req := httptest.NewRequest(http.MethodGet, "/test?from=2024-12-01&to=2025-01-31", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("libraryuid")
+	c.SetParamValues(testLibraryUid)
+
+	err := h.GetCalendar(c)
+
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, `{"timezone":"Europe/Moscow","closedWeekdays":["SUNDAY"],"holidays":["2025-01-01"]}
+`, rec.Body.String())
+}
@@ -0,0 +1,98 @@
+package schedule
+
+import (
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"time"
+)
+
+const dateFormat = "2006-01-02"
+
+// weekdays are the names the API uses for ISO weekdays, index 0 is Monday.
+var weekdays = []string{"MONDAY", "TUESDAY", "WEDNESDAY", "THURSDAY", "FRIDAY", "SATURDAY", "SUNDAY"}
+
+type openingHours struct {
+	Weekday  int    `db:"weekday"`
+	OpensAt  string `db:"opens_at"`
+	ClosesAt string `db:"closes_at"`
+}
+
+type closure struct {
+	Date   time.Time `db:"date"`
+	Reason string    `db:"reason"`
+}
+
+// schedule holds the weekly hours of a library and its closures within the requested range.
+type schedule struct {
+	Timezone string
+	Hours    []openingHours
+	Closures []closure
+}
+
+func isoWeekday(day time.Time) int {
+	if day.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(day.Weekday())
+}
+
+// hoursOn returns the hours of the day, a library without weekly hours is open all day every day.
+func (s schedule) hoursOn(day time.Time) (openingHours, bool) {
+	for _, c := range s.Closures {
+		if c.Date.Format(dateFormat) == day.Format(dateFormat) {
+			return openingHours{}, false
+		}
+	}
+
+	if len(s.Hours) == 0 {
+		return openingHours{Weekday: isoWeekday(day), OpensAt: "00:00", ClosesAt: "23:59"}, true
+	}
+
+	for _, h := range s.Hours {
+		if h.Weekday == isoWeekday(day) {
+			return h, true
+		}
+	}
+
+	return openingHours{}, false
+}
+
+// nextOpenDay looks for the first open day starting from the day itself, at most days ahead.
+func (s schedule) nextOpenDay(from time.Time, days int) (time.Time, openingHours, bool) {
+	for i := 0; i <= days; i++ {
+		day := from.AddDate(0, 0, i)
+		if h, ok := s.hoursOn(day); ok {
+			return day, h, true
+		}
+	}
+
+	return time.Time{}, openingHours{}, false
+}
+
+// calendar turns the schedule into business days, days without hours are days off unless the library
+// keeps no hours at all.
+func (s schedule) calendar() (*my_time.Calendar, error) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	closedWeekdays := make([]time.Weekday, 0)
+	if len(s.Hours) > 0 {
+		for weekday := 1; weekday <= len(weekdays); weekday++ {
+			open := false
+			for _, h := range s.Hours {
+				open = open || h.Weekday == weekday
+			}
+			if !open {
+				closedWeekdays = append(closedWeekdays, time.Weekday(weekday%7))
+			}
+		}
+	}
+
+	holidays := make([]my_time.Date, 0, len(s.Closures))
+	for _, c := range s.Closures {
+		holidays = append(holidays, my_time.DateIn(c.Date, time.UTC))
+	}
+
+	return my_time.NewCalendar(loc, closedWeekdays, holidays), nil
+}
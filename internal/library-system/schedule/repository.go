@@ -0,0 +1,193 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+)
+
+type repository struct {
+	conn *sqlx.DB
+}
+
+func NewRepository(conn *sqlx.DB) *repository {
+	return &repository{conn: conn}
+}
+
+func getLibraryID(ctx context.Context, q sqlx.QueryerContext, libraryUid string) (int, error) {
+	id, _, err := getLibrary(ctx, q, libraryUid)
+	return id, err
+}
+
+func getLibrary(ctx context.Context, q sqlx.QueryerContext, libraryUid string) (int, string, error) {
+	query := `SELECT id, timezone FROM library WHERE library_uid = $1 AND closed_at IS NULL;`
+
+	var (
+		id       int
+		timezone string
+	)
+	err := q.QueryRowxContext(ctx, query, libraryUid).Scan(&id, &timezone)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", errors.Wrap(errLibraryNotFound, "library not found")
+		}
+		return 0, "", errors.Wrap(err, "failed to execute query")
+	}
+
+	return id, timezone, nil
+}
+
+// GetSchedule returns the weekly hours of the library and its closures between from and to inclusive.
+func (r *repository) GetSchedule(ctx context.Context, libraryUid string, from, to time.Time) (schedule, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	libraryID, timezone, err := getLibrary(ctx, r.conn, libraryUid)
+	if err != nil {
+		return schedule{}, err
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	hoursQuery, hoursArgs, err := psql.Select("weekday", "to_char(opens_at, 'HH24:MI') AS opens_at", "to_char(closes_at, 'HH24:MI') AS closes_at").
+		From("library_opening_hours").
+		Where(sq.Eq{"library_id": libraryID}).
+		OrderBy("weekday").
+		ToSql()
+	if err != nil {
+		return schedule{}, errors.Wrap(err, "failed to build query")
+	}
+
+	closuresQuery, closuresArgs, err := psql.Select("date", "reason").
+		From("library_closures").
+		Where(sq.And{
+			sq.Eq{"library_id": libraryID},
+			sq.GtOrEq{"date": from.Format(dateFormat)},
+			sq.LtOrEq{"date": to.Format(dateFormat)},
+		}).
+		OrderBy("date").
+		ToSql()
+	if err != nil {
+		return schedule{}, errors.Wrap(err, "failed to build query")
+	}
+
+	res := schedule{
+		Timezone: timezone,
+		Hours:    make([]openingHours, 0),
+		Closures: make([]closure, 0),
+	}
+
+	err = r.conn.SelectContext(ctx, &res.Hours, hoursQuery, hoursArgs...)
+	if err != nil {
+		return schedule{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	err = r.conn.SelectContext(ctx, &res.Closures, closuresQuery, closuresArgs...)
+	if err != nil {
+		return schedule{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+// SetOpeningHours replaces the weekly hours of the library, days left out are closed. An empty timezone
+// keeps the one the library has.
+func (r *repository) SetOpeningHours(ctx context.Context, libraryUid, timezone string, hours []openingHours) error {
+	timezoneQuery := `UPDATE library SET timezone = $2 WHERE id = $1;`
+	deleteQuery := `DELETE FROM library_opening_hours WHERE library_id = $1;`
+	insertQuery := `
+INSERT INTO library_opening_hours (library_id, weekday, opens_at, closes_at)
+VALUES ($1, $2, $3, $4);
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	libraryID, err := getLibraryID(ctx, tx, libraryUid)
+	if err != nil {
+		return err
+	}
+
+	if timezone != "" {
+		_, err = tx.ExecContext(ctx, timezoneQuery, libraryID, timezone)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute query")
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, deleteQuery, libraryID)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	for _, h := range hours {
+		_, err = tx.ExecContext(ctx, insertQuery, libraryID, h.Weekday, h.OpensAt, h.ClosesAt)
+		if err != nil {
+			return errors.Wrap(err, "failed to execute query")
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
+
+func (r *repository) SetClosure(ctx context.Context, libraryUid string, c closure) error {
+	query := `
+INSERT INTO library_closures (library_id, date, reason)
+VALUES ($1, $2, $3)
+ON CONFLICT (library_id, date) DO UPDATE
+SET reason = EXCLUDED.reason;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	libraryID, err := getLibraryID(ctx, r.conn, libraryUid)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.conn.ExecContext(ctx, query, libraryID, c.Date.Format(dateFormat), c.Reason)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteClosure(ctx context.Context, libraryUid string, date time.Time) error {
+	query := `
+DELETE FROM library_closures c
+USING library l
+WHERE l.id = c.library_id AND l.library_uid = $1 AND c.date = $2;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	result, err := r.conn.ExecContext(ctx, query, libraryUid, date.Format(dateFormat))
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+	if affected == 0 {
+		return errors.Wrap(errClosureNotFound, "closure not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+package transfer
+
+import "errors"
+
+var (
+	errLibraryNotFound  = errors.New("library not found")
+	errBookNotFound     = errors.New("book not found")
+	errTransferNotFound = errors.New("transfer not found")
+	errNotEnoughStock   = errors.New("not enough stock")
+	errWrongStatus      = errors.New("transfer has wrong status")
+)
@@ -0,0 +1,275 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/internal/library-system/config"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//go:generate mockgen -source=handler.go -destination=handler_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/library-system/transfer -package=transfer
+
+const (
+	requestedStatus = "REQUESTED"
+	inTransitStatus = "IN_TRANSIT"
+	receivedStatus  = "RECEIVED"
+)
+
+type storage interface {
+	GetTransfer(ctx context.Context, transferUid string) (transfer, error)
+	GetTransfers(ctx context.Context, f filter, offset, limit int) ([]transfer, int, error)
+	CreateTransfer(ctx context.Context, t transfer) (transfer, error)
+	DispatchTransfer(ctx context.Context, transferUid string) (transfer, error)
+	ReceiveTransfer(ctx context.Context, transferUid string) (transfer, error)
+}
+
+type handler struct {
+	storage storage
+	config  *config.Config
+}
+
+func NewHandler(storage storage, config *config.Config) *handler {
+	return &handler{storage: storage, config: config}
+}
+
+func (h *handler) Register(echo *echo.Echo) {
+	api := echo.Group("/api/v1")
+
+	api.Use(auth.Middleware(h.config.JWKURI))
+
+	staff := auth.RequireRole(auth.LibrarianRole, auth.AdminRole)
+
+	api.GET("/transfers", h.GetTransfers, staff)
+	api.GET("/transfers/:uid", h.GetTransfer, staff)
+	api.POST("/transfers", h.CreateTransfer, staff)
+	api.POST("/transfers/:uid/dispatch", h.DispatchTransfer, staff)
+	api.POST("/transfers/:uid/receive", h.ReceiveTransfer, staff)
+}
+
+type transferResponse struct {
+	TransferUid           string     `json:"transferUid"`
+	BookUid               string     `json:"bookUid"`
+	SourceLibraryUid      string     `json:"sourceLibraryUid"`
+	DestinationLibraryUid string     `json:"destinationLibraryUid"`
+	Count                 int        `json:"count"`
+	Status                string     `json:"status"`
+	RequestedBy           string     `json:"requestedBy"`
+	RequestedAt           time.Time  `json:"requestedAt"`
+	DispatchedBy          *string    `json:"dispatchedBy,omitempty"`
+	DispatchedAt          *time.Time `json:"dispatchedAt,omitempty"`
+	ReceivedBy            *string    `json:"receivedBy,omitempty"`
+	ReceivedAt            *time.Time `json:"receivedAt,omitempty"`
+}
+
+func newTransferResponse(t transfer) transferResponse {
+	return transferResponse{
+		TransferUid:           t.TransferUid,
+		BookUid:               t.BookUid,
+		SourceLibraryUid:      t.SourceLibraryUid,
+		DestinationLibraryUid: t.DestinationLibraryUid,
+		Count:                 t.Count,
+		Status:                t.Status,
+		RequestedBy:           t.RequestedBy,
+		RequestedAt:           t.RequestedAt,
+		DispatchedBy:          t.DispatchedBy,
+		DispatchedAt:          t.DispatchedAt,
+		ReceivedBy:            t.ReceivedBy,
+		ReceivedAt:            t.ReceivedAt,
+	}
+}
+
+// GetTransfers returns the transfer history, libraryUid matches both the sending and the receiving library.
+func (h *handler) GetTransfers(c echo.Context) error {
+	f := filter{
+		LibraryUid: c.QueryParam("libraryUid"),
+		BookUid:    c.QueryParam("bookUid"),
+		Status:     c.QueryParam("status"),
+	}
+	if f.Status != "" && f.Status != requestedStatus && f.Status != inTransitStatus && f.Status != receivedStatus {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "status is wrong",
+		})
+	}
+
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "page is wrong",
+		})
+	}
+
+	size, err := strconv.Atoi(c.QueryParam("size"))
+	if err != nil || size <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "size is wrong",
+		})
+	}
+
+	transfers, total, err := h.storage.GetTransfers(c.Request().Context(), f, page*size-size, size)
+	if err != nil {
+		log.Err(err).Msg("failed to get transfers")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get transfers",
+		})
+	}
+
+	type response struct {
+		Page          int                `json:"page"`
+		PageSize      int                `json:"pageSize"`
+		TotalElements int                `json:"totalElements"`
+		Items         []transferResponse `json:"items"`
+	}
+
+	items := make([]transferResponse, 0, len(transfers))
+	for _, v := range transfers {
+		items = append(items, newTransferResponse(v))
+	}
+
+	return c.JSON(http.StatusOK, response{
+		Page:          page,
+		PageSize:      size,
+		TotalElements: total,
+		Items:         items,
+	})
+}
+
+func (h *handler) GetTransfer(c echo.Context) error {
+	transferUid := c.Param("uid")
+	if transferUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	found, err := h.storage.GetTransfer(c.Request().Context(), transferUid)
+	if err != nil {
+		log.Err(err).Msg("failed to get transfer")
+		if errors.Is(err, errTransferNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "transfer not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get transfer",
+		})
+	}
+
+	return c.JSON(http.StatusOK, newTransferResponse(found))
+}
+
+// CreateTransfer requests copies for another library, nothing leaves the shelf until the transfer is dispatched.
+func (h *handler) CreateTransfer(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read request body",
+		})
+	}
+
+	type request struct {
+		BookUid               string `json:"bookUid" validate:"required,uuid"`
+		SourceLibraryUid      string `json:"sourceLibraryUid" validate:"required,uuid"`
+		DestinationLibraryUid string `json:"destinationLibraryUid" validate:"required,uuid,nefield=SourceLibraryUid"`
+		Count                 int    `json:"count" validate:"required,min=1"`
+	}
+	req := request{}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		log.Err(err).Msg("failed to unmarshal request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal request body",
+		})
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate request body",
+		})
+	}
+
+	created, err := h.storage.CreateTransfer(c.Request().Context(), transfer{
+		TransferUid:           uuid.New().String(),
+		BookUid:               req.BookUid,
+		SourceLibraryUid:      req.SourceLibraryUid,
+		DestinationLibraryUid: req.DestinationLibraryUid,
+		Count:                 req.Count,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to create transfer")
+		if errors.Is(err, errLibraryNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "library not found",
+			})
+		}
+		if errors.Is(err, errBookNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "book not found",
+			})
+		}
+		if errors.Is(err, errNotEnoughStock) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "not enough copies at the source library",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to create transfer",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, newTransferResponse(created))
+}
+
+// DispatchTransfer sends the requested copies, they leave the stock of the source library.
+func (h *handler) DispatchTransfer(c echo.Context) error {
+	return h.changeTransfer(c, h.storage.DispatchTransfer, "dispatch")
+}
+
+// ReceiveTransfer takes the copies in transit into the stock of the destination library.
+func (h *handler) ReceiveTransfer(c echo.Context) error {
+	return h.changeTransfer(c, h.storage.ReceiveTransfer, "receive")
+}
+
+func (h *handler) changeTransfer(c echo.Context, change func(ctx context.Context, transferUid string) (transfer, error), action string) error {
+	transferUid := c.Param("uid")
+	if transferUid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	changed, err := change(c.Request().Context(), transferUid)
+	if err != nil {
+		log.Err(err).Msgf("failed to %s transfer", action)
+		if errors.Is(err, errTransferNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "transfer not found",
+			})
+		}
+		if errors.Is(err, errWrongStatus) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": err.Error(),
+			})
+		}
+		if errors.Is(err, errNotEnoughStock) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "not enough copies at the source library",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to " + action + " transfer",
+		})
+	}
+
+	return c.JSON(http.StatusOK, newTransferResponse(changed))
+}
@@ -0,0 +1,111 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: handler.go
+
+// Package transfer is a generated GoMock package.
+package transfer
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// Mockstorage is a mock of storage interface.
+type Mockstorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockstorageMockRecorder
+}
+
+// MockstorageMockRecorder is the mock recorder for Mockstorage.
+type MockstorageMockRecorder struct {
+	mock *Mockstorage
+}
+
+// NewMockstorage creates a new mock instance.
+func NewMockstorage(ctrl *gomock.Controller) *Mockstorage {
+	mock := &Mockstorage{ctrl: ctrl}
+	mock.recorder = &MockstorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
+	return m.recorder
+}
+
+// CreateTransfer mocks base method.
+func (m *Mockstorage) CreateTransfer(ctx context.Context, t transfer) (transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTransfer", ctx, t)
+	ret0, _ := ret[0].(transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTransfer indicates an expected call of CreateTransfer.
+func (mr *MockstorageMockRecorder) CreateTransfer(ctx, t interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransfer", reflect.TypeOf((*Mockstorage)(nil).CreateTransfer), ctx, t)
+}
+
+// DispatchTransfer mocks base method.
+func (m *Mockstorage) DispatchTransfer(ctx context.Context, transferUid string) (transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DispatchTransfer", ctx, transferUid)
+	ret0, _ := ret[0].(transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DispatchTransfer indicates an expected call of DispatchTransfer.
+func (mr *MockstorageMockRecorder) DispatchTransfer(ctx, transferUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DispatchTransfer", reflect.TypeOf((*Mockstorage)(nil).DispatchTransfer), ctx, transferUid)
+}
+
+// GetTransfer mocks base method.
+func (m *Mockstorage) GetTransfer(ctx context.Context, transferUid string) (transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfer", ctx, transferUid)
+	ret0, _ := ret[0].(transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransfer indicates an expected call of GetTransfer.
+func (mr *MockstorageMockRecorder) GetTransfer(ctx, transferUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfer", reflect.TypeOf((*Mockstorage)(nil).GetTransfer), ctx, transferUid)
+}
+
+// GetTransfers mocks base method.
+func (m *Mockstorage) GetTransfers(ctx context.Context, f filter, offset, limit int) ([]transfer, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfers", ctx, f, offset, limit)
+	ret0, _ := ret[0].([]transfer)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTransfers indicates an expected call of GetTransfers.
+func (mr *MockstorageMockRecorder) GetTransfers(ctx, f, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfers", reflect.TypeOf((*Mockstorage)(nil).GetTransfers), ctx, f, offset, limit)
+}
+
+// ReceiveTransfer mocks base method.
+func (m *Mockstorage) ReceiveTransfer(ctx context.Context, transferUid string) (transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReceiveTransfer", ctx, transferUid)
+	ret0, _ := ret[0].(transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceiveTransfer indicates an expected call of ReceiveTransfer.
+func (mr *MockstorageMockRecorder) ReceiveTransfer(ctx, transferUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveTransfer", reflect.TypeOf((*Mockstorage)(nil).ReceiveTransfer), ctx, transferUid)
+}
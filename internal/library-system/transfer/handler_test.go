@@ -0,0 +1,221 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testBookUid        = "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+	testSourceUid      = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+	testDestinationUid = "52e6b4d4-1a5c-4f3e-9b8a-6c2a1d7e4f90"
+	testTransferUid    = "1e3b1b2a-8f1c-4d5e-9a7b-0c6d2e3f4a5b"
+)
+
+func Test_CreateTransfer(t *testing.T) {
+	type fields struct {
+		requestBody          string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	requestedAt := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	validBody := `{"bookUid":"` + testBookUid + `","sourceLibraryUid":"` + testSourceUid +
+		`","destinationLibraryUid":"` + testDestinationUid + `","count":2}`
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(storage *Mockstorage)
+	}{
+		{
+			name: "http-code 400: same library",
+			fields: fields{
+				requestBody: `{"bookUid":"` + testBookUid + `","sourceLibraryUid":"` + testSourceUid +
+					`","destinationLibraryUid":"` + testSourceUid + `","count":2}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 400: zero count",
+			fields: fields{
+				requestBody: `{"bookUid":"` + testBookUid + `","sourceLibraryUid":"` + testSourceUid +
+					`","destinationLibraryUid":"` + testDestinationUid + `","count":0}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(storage *Mockstorage) {},
+		},
+		{
+			name: "http-code 404: library not found",
+			fields: fields{
+				requestBody:      validBody,
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().CreateTransfer(gomock.Any(), gomock.Any()).Return(transfer{}, errLibraryNotFound)
+			},
+		},
+		{
+			name: "http-code 409: not enough stock",
+			fields: fields{
+				requestBody:      validBody,
+				expectedHTTPCode: http.StatusConflict,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().CreateTransfer(gomock.Any(), gomock.Any()).Return(transfer{}, errNotEnoughStock)
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				requestBody:      validBody,
+				expectedHTTPCode: http.StatusInternalServerError,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().CreateTransfer(gomock.Any(), gomock.Any()).Return(transfer{}, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 201: transfer requested",
+			fields: fields{
+				requestBody:      validBody,
+				expectedHTTPCode: http.StatusCreated,
+				expectedResponseBody: `{"transferUid":"` + testTransferUid + `","bookUid":"` + testBookUid +
+					`","sourceLibraryUid":"` + testSourceUid + `","destinationLibraryUid":"` + testDestinationUid +
+					`","count":2,"status":"REQUESTED","requestedBy":"librarian","requestedAt":"2024-12-01T12:00:00Z"}
+`,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().CreateTransfer(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ any, tr transfer) (transfer, error) {
+						require.NotEmpty(t, tr.TransferUid)
+						tr.TransferUid = testTransferUid
+						tr.Status = requestedStatus
+						tr.RequestedBy = "librarian"
+						tr.RequestedAt = requestedAt
+						return tr, nil
+					})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := NewMockstorage(ctrl)
+			tt.Prepare(storage)
+
+			h := &handler{storage: storage}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.requestBody))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.CreateTransfer(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusCreated {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_DispatchTransfer(t *testing.T) {
+	type fields struct {
+		expectedHTTPCode int
+		expectedStatus   string
+	}
+
+	e := echo.New()
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(storage *Mockstorage)
+	}{
+		{
+			name: "http-code 404: transfer not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().DispatchTransfer(gomock.Any(), testTransferUid).Return(transfer{}, errTransferNotFound)
+			},
+		},
+		{
+			name: "http-code 409: already dispatched",
+			fields: fields{
+				expectedHTTPCode: http.StatusConflict,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().DispatchTransfer(gomock.Any(), testTransferUid).Return(transfer{}, errWrongStatus)
+			},
+		},
+		{
+			name: "http-code 409: copies were lent meanwhile",
+			fields: fields{
+				expectedHTTPCode: http.StatusConflict,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().DispatchTransfer(gomock.Any(), testTransferUid).Return(transfer{}, errNotEnoughStock)
+			},
+		},
+		{
+			name: "http-code 200: in transit",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				expectedStatus:   inTransitStatus,
+			},
+			Prepare: func(storage *Mockstorage) {
+				storage.EXPECT().DispatchTransfer(gomock.Any(), testTransferUid).
+					Return(transfer{TransferUid: testTransferUid, Status: inTransitStatus}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := NewMockstorage(ctrl)
+			tt.Prepare(storage)
+
+			h := &handler{storage: storage}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("uid")
+			c.SetParamValues(testTransferUid)
+
+			err := h.DispatchTransfer(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				require.Contains(t, rec.Body.String(), `"status":"`+tt.fields.expectedStatus+`"`)
+			}
+		})
+	}
+}
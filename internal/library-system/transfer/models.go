@@ -0,0 +1,26 @@
+package transfer
+
+import "time"
+
+type transfer struct {
+	ID                    int        `db:"id"`
+	TransferUid           string     `db:"transfer_uid"`
+	BookUid               string     `db:"book_uid"`
+	SourceLibraryUid      string     `db:"source_library_uid"`
+	DestinationLibraryUid string     `db:"destination_library_uid"`
+	Count                 int        `db:"count"`
+	Status                string     `db:"status"`
+	RequestedBy           string     `db:"requested_by"`
+	RequestedAt           time.Time  `db:"requested_at"`
+	DispatchedBy          *string    `db:"dispatched_by"`
+	DispatchedAt          *time.Time `db:"dispatched_at"`
+	ReceivedBy            *string    `db:"received_by"`
+	ReceivedAt            *time.Time `db:"received_at"`
+}
+
+// filter narrows the transfer history, a library matches transfers it sends or receives.
+type filter struct {
+	LibraryUid string
+	BookUid    string
+	Status     string
+}
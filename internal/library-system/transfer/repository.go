@@ -0,0 +1,363 @@
+package transfer
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+
+	transferReason           = "TRANSFER"
+	setInventoryContextQuery = `SELECT set_config('inventory.reason', $1, true), set_config('inventory.actor', $2, true);`
+)
+
+type repository struct {
+	conn *sqlx.DB
+}
+
+func NewRepository(conn *sqlx.DB) *repository {
+	return &repository{conn: conn}
+}
+
+// lockedTransfer is the part of a transfer the state changes need, read under a row lock.
+type lockedTransfer struct {
+	ID                   int    `db:"id"`
+	BookID               int    `db:"book_id"`
+	SourceLibraryID      int    `db:"source_library_id"`
+	DestinationLibraryID int    `db:"destination_library_id"`
+	Count                int    `db:"count"`
+	Status               string `db:"status"`
+}
+
+func selectTransfers() sq.SelectBuilder {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	return psql.Select(
+		"t.id", "t.transfer_uid", "b.book_uid", "s.library_uid AS source_library_uid",
+		"d.library_uid AS destination_library_uid", "t.count", "t.status", "t.requested_by", "t.requested_at",
+		"t.dispatched_by", "t.dispatched_at", "t.received_by", "t.received_at",
+	).
+		From("transfers t").
+		Join("books b ON b.id = t.book_id").
+		Join("library s ON s.id = t.source_library_id").
+		Join("library d ON d.id = t.destination_library_id")
+}
+
+func getTransfer(ctx context.Context, q sqlx.QueryerContext, transferUid string) (transfer, error) {
+	query, args, err := selectTransfers().Where(sq.Eq{"t.transfer_uid": transferUid}).ToSql()
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to build query")
+	}
+
+	res := transfer{}
+	err = sqlx.GetContext(ctx, q, &res, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return transfer{}, errors.Wrap(errTransferNotFound, "transfer not found")
+		}
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+// beginTransferTx starts a transaction whose copy changes go to the inventory ledger as a transfer by the caller.
+func (r *repository) beginTransferTx(ctx context.Context) (*sqlx.Tx, error) {
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+
+	_, err = tx.ExecContext(ctx, setInventoryContextQuery, transferReason, auth.GetUser(ctx))
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors.Wrap(err, "failed to set inventory context")
+	}
+
+	return tx, nil
+}
+
+func (r *repository) GetTransfer(ctx context.Context, transferUid string) (transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	return getTransfer(ctx, r.conn, transferUid)
+}
+
+// GetTransfers returns a page of the transfer history, the newest first, and the number of matching transfers.
+func (r *repository) GetTransfers(ctx context.Context, f filter, offset, limit int) ([]transfer, int, error) {
+	where := sq.And{}
+	if f.LibraryUid != "" {
+		where = append(where, sq.Or{sq.Eq{"s.library_uid": f.LibraryUid}, sq.Eq{"d.library_uid": f.LibraryUid}})
+	}
+	if f.BookUid != "" {
+		where = append(where, sq.Eq{"b.book_uid": f.BookUid})
+	}
+	if f.Status != "" {
+		where = append(where, sq.Eq{"t.status": f.Status})
+	}
+
+	query, args, err := selectTransfers().
+		Where(where).
+		OrderBy("t.id DESC").
+		Limit(uint64(limit)).Offset(uint64(offset)).
+		ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to build query")
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	countQuery, countArgs, err := psql.Select("COUNT(*)").
+		From("transfers t").
+		Join("books b ON b.id = t.book_id").
+		Join("library s ON s.id = t.source_library_id").
+		Join("library d ON d.id = t.destination_library_id").
+		Where(where).
+		ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var total int
+	err = r.conn.GetContext(ctx, &total, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	transfers := make([]transfer, 0)
+	err = r.conn.SelectContext(ctx, &transfers, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	return transfers, total, nil
+}
+
+// CreateTransfer requests moving count copies of the book between two open libraries. The source must
+// have that many available copies on top of the ones already promised to transfers not yet dispatched.
+func (r *repository) CreateTransfer(ctx context.Context, t transfer) (transfer, error) {
+	libraryQuery := `SELECT id FROM library WHERE library_uid = $1 AND closed_at IS NULL;`
+	bookQuery := `SELECT id FROM books WHERE book_uid = $1;`
+	stockQuery := `
+SELECT lb.available_count - COALESCE((
+    SELECT SUM(t.count) FROM transfers t
+    WHERE t.source_library_id = lb.library_id AND t.book_id = lb.book_id AND t.status = 'REQUESTED'
+), 0)
+FROM library_books lb
+WHERE lb.library_id = $1 AND lb.book_id = $2
+FOR UPDATE OF lb;
+`
+	insertQuery := `
+INSERT INTO transfers (transfer_uid, book_id, source_library_id, destination_library_id, count, requested_by)
+VALUES ($1, $2, $3, $4, $5, $6);
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	libraryIDs := make([]int, 0, 2)
+	for _, uid := range []string{t.SourceLibraryUid, t.DestinationLibraryUid} {
+		var id int
+		err = tx.GetContext(ctx, &id, libraryQuery, uid)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return transfer{}, errors.Wrap(errLibraryNotFound, "library not found")
+			}
+			return transfer{}, errors.Wrap(err, "failed to execute query")
+		}
+		libraryIDs = append(libraryIDs, id)
+	}
+
+	var bookID int
+	err = tx.GetContext(ctx, &bookID, bookQuery, t.BookUid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return transfer{}, errors.Wrap(errBookNotFound, "book not found")
+		}
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	var free int
+	err = tx.GetContext(ctx, &free, stockQuery, libraryIDs[0], bookID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+	if free < t.Count {
+		return transfer{}, errors.Wrapf(errNotEnoughStock, "%d copies can be transferred", free)
+	}
+
+	_, err = tx.ExecContext(ctx, insertQuery, t.TransferUid, bookID, libraryIDs[0], libraryIDs[1], t.Count, auth.GetUser(ctx))
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	res, err := getTransfer(ctx, tx, t.TransferUid)
+	if err != nil {
+		return transfer{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return res, nil
+}
+
+// DispatchTransfer takes the copies off the shelf of the source library, they stay in transit until received.
+func (r *repository) DispatchTransfer(ctx context.Context, transferUid string) (transfer, error) {
+	dispatchQuery := `
+WITH picked AS (
+    SELECT id FROM book_copies
+    WHERE library_id = $1 AND book_id = $2 AND status = 'AVAILABLE'
+    ORDER BY id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+UPDATE book_copies c SET status = 'IN_TRANSIT', transfer_id = $4
+FROM picked
+WHERE c.id = picked.id;
+`
+	updateQuery := `
+UPDATE transfers SET status = 'IN_TRANSIT', dispatched_by = $2, dispatched_at = NOW()
+WHERE id = $1;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.beginTransferTx(ctx)
+	if err != nil {
+		return transfer{}, err
+	}
+	defer tx.Rollback()
+
+	t, err := r.lockTransfer(ctx, tx, transferUid, requestedStatus)
+	if err != nil {
+		return transfer{}, err
+	}
+
+	result, err := tx.ExecContext(ctx, dispatchQuery, t.SourceLibraryID, t.BookID, t.Count, t.ID)
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+	dispatched, err := result.RowsAffected()
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to get rows affected")
+	}
+	if int(dispatched) < t.Count {
+		return transfer{}, errors.Wrapf(errNotEnoughStock, "%d copies can be dispatched", dispatched)
+	}
+
+	_, err = tx.ExecContext(ctx, updateQuery, t.ID, auth.GetUser(ctx))
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	res, err := getTransfer(ctx, tx, transferUid)
+	if err != nil {
+		return transfer{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return res, nil
+}
+
+// ReceiveTransfer puts the copies in transit on the shelf of the destination library.
+func (r *repository) ReceiveTransfer(ctx context.Context, transferUid string) (transfer, error) {
+	libraryBookQuery := `
+INSERT INTO library_books (library_id, book_id, available_count)
+VALUES ($1, $2, 0)
+ON CONFLICT (library_id, book_id) DO NOTHING;
+`
+	receiveQuery := `
+UPDATE book_copies SET library_id = $1, status = 'AVAILABLE'
+WHERE transfer_id = $2 AND status = 'IN_TRANSIT';
+`
+	updateQuery := `
+UPDATE transfers SET status = 'RECEIVED', received_by = $2, received_at = NOW()
+WHERE id = $1;
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.beginTransferTx(ctx)
+	if err != nil {
+		return transfer{}, err
+	}
+	defer tx.Rollback()
+
+	t, err := r.lockTransfer(ctx, tx, transferUid, inTransitStatus)
+	if err != nil {
+		return transfer{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, libraryBookQuery, t.DestinationLibraryID, t.BookID)
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	_, err = tx.ExecContext(ctx, receiveQuery, t.DestinationLibraryID, t.ID)
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	_, err = tx.ExecContext(ctx, updateQuery, t.ID, auth.GetUser(ctx))
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	res, err := getTransfer(ctx, tx, transferUid)
+	if err != nil {
+		return transfer{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return transfer{}, errors.Wrap(err, "failed to commit transaction")
+	}
+
+	return res, nil
+}
+
+func (r *repository) lockTransfer(ctx context.Context, tx *sqlx.Tx, transferUid, status string) (lockedTransfer, error) {
+	query := `
+SELECT id, book_id, source_library_id, destination_library_id, count, status
+FROM transfers
+WHERE transfer_uid = $1
+FOR UPDATE;
+`
+
+	res := lockedTransfer{}
+	err := tx.GetContext(ctx, &res, query, transferUid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return lockedTransfer{}, errors.Wrap(errTransferNotFound, "transfer not found")
+		}
+		return lockedTransfer{}, errors.Wrap(err, "failed to execute query")
+	}
+	if res.Status != status {
+		return lockedTransfer{}, errors.Wrapf(errWrongStatus, "transfer is %s", res.Status)
+	}
+
+	return res, nil
+}
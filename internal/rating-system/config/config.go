@@ -4,9 +4,16 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"os"
+	"sort"
 	"time"
 )
 
+// the star range of a rating, every value in it must fall into a tier
+const (
+	minStars = 0
+	maxStars = 100
+)
+
 type Server struct {
 	Address         string        `yaml:"address"`
 	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
@@ -16,10 +23,23 @@ type PostgreSQL struct {
 	DSN string `env:"POSTGRESQL_DSN"`
 }
 
+// Tier is a named star range with the benefits a reader in it gets.
+type Tier struct {
+	Name        string `yaml:"name"`
+	MinStars    int    `yaml:"min_stars"`
+	MaxStars    int    `yaml:"max_stars"`
+	MaxLoans    int    `yaml:"max_loans"`
+	MaxLoanDays int    `yaml:"max_loan_days"`
+}
+
 type Config struct {
 	Server     Server `yaml:"server"`
 	PostgreSQL PostgreSQL
 	JWKURI     string `yaml:"jwks_uri"`
+	PolicyPath string `yaml:"policy_path"`
+	// StartingStars is granted to a reader when the rating record is provisioned.
+	StartingStars int    `yaml:"starting_stars"`
+	Tiers         []Tier `yaml:"tiers"`
 }
 
 func New() (*Config, error) {
@@ -35,5 +55,35 @@ func New() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = validateTiers(cfg.Tiers)
+	if err != nil {
+		return nil, err
+	}
 	return cfg, err
 }
+
+// validateTiers sorts tiers by stars and checks that they cover every rating without overlaps or gaps,
+// so a reader always has a tier.
+func validateTiers(tiers []Tier) error {
+	if len(tiers) == 0 {
+		return fmt.Errorf("no tiers configured")
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].MinStars < tiers[j].MinStars
+	})
+	for i, t := range tiers {
+		if t.Name == "" || t.MinStars > t.MaxStars {
+			return fmt.Errorf("tier %d is wrong", i)
+		}
+		if i > 0 && t.MinStars <= tiers[i-1].MaxStars {
+			return fmt.Errorf("tier %s overlaps tier %s", t.Name, tiers[i-1].Name)
+		}
+		if i > 0 && t.MinStars > tiers[i-1].MaxStars+1 {
+			return fmt.Errorf("no tier between %s and %s", tiers[i-1].Name, t.Name)
+		}
+	}
+	if tiers[0].MinStars > minStars || tiers[len(tiers)-1].MaxStars < maxStars {
+		return fmt.Errorf("tiers must cover %d to %d stars", minStars, maxStars)
+	}
+	return nil
+}
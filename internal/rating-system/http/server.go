@@ -14,8 +14,14 @@ import (
 type ratingHandler interface {
 	Register(echo *echo.Echo)
 	GetRatingRecord(c echo.Context) error
-	CreateRatingRecord(c echo.Context) error
+	ProvisionRatingRecord(c echo.Context) error
 	UpdateRatingRecord(c echo.Context) error
+	ReportEvent(c echo.Context) error
+	GetRatingHistory(c echo.Context) error
+	DryRunPolicy(c echo.Context) error
+	GetTier(c echo.Context) error
+	SetLeaderboardOptIn(c echo.Context) error
+	GetLeaderboard(c echo.Context) error
 }
 
 type server struct {
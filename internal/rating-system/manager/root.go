@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/Erlendum/rsoi-lab-02/internal/rating-system/config"
 	"github.com/Erlendum/rsoi-lab-02/internal/rating-system/http"
+	"github.com/Erlendum/rsoi-lab-02/internal/rating-system/policy"
 	"github.com/Erlendum/rsoi-lab-02/internal/rating-system/rating"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
@@ -45,9 +46,15 @@ func (r *root) Register(ctx context.Context) error {
 		return err
 	}
 
+	ratingPolicy, err := policy.Load(r.cfg.PolicyPath)
+	if err != nil {
+		log.Error().Err(err).Msg("rating policy load error")
+		return err
+	}
+
 	ratingRepo := rating.NewRepository(psqldb)
 
-	personHandler := rating.NewHandler(ratingRepo, r.cfg)
+	personHandler := rating.NewHandler(ratingRepo, ratingPolicy, r.cfg)
 
 	r.server = http.NewServer(&r.cfg.Server, personHandler)
 
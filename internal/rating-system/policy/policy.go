@@ -0,0 +1,174 @@
+package policy
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	ReturnEvent  = "RETURN"
+	ReserveEvent = "RESERVE"
+)
+
+var (
+	knownEvents     = []string{ReturnEvent, ReserveEvent}
+	knownConditions = []string{"EXCELLENT", "GOOD", "BAD"}
+)
+
+// Range matches an integer fact, both bounds are inclusive and optional.
+type Range struct {
+	Min *int `yaml:"min" json:"min,omitempty"`
+	Max *int `yaml:"max" json:"max,omitempty"`
+}
+
+func (r *Range) matches(v int) bool {
+	if r == nil {
+		return true
+	}
+	if r.Min != nil && v < *r.Min {
+		return false
+	}
+	if r.Max != nil && v > *r.Max {
+		return false
+	}
+	return true
+}
+
+// When lists the facts a rule depends on, a rule matches only if every present fact matches.
+type When struct {
+	DaysLate     *Range   `yaml:"daysLate" json:"daysLate,omitempty"`
+	Condition    []string `yaml:"condition" json:"condition,omitempty"`
+	Reservations *Range   `yaml:"reservations" json:"reservations,omitempty"`
+	Stars        *Range   `yaml:"stars" json:"stars,omitempty"`
+	FreeSlots    *Range   `yaml:"freeSlots" json:"freeSlots,omitempty"`
+}
+
+type Rule struct {
+	Name   string `yaml:"name" json:"name"`
+	Event  string `yaml:"event" json:"event"`
+	When   When   `yaml:"when" json:"when"`
+	Delta  int    `yaml:"delta" json:"delta"`
+	Deny   bool   `yaml:"deny" json:"deny"`
+	Reason string `yaml:"reason" json:"reason"`
+}
+
+type Policy struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Event is what the gateway reports, Stars is filled by the rating service before evaluation.
+type Event struct {
+	Type           string `json:"type" validate:"required,oneof=RETURN RESERVE"`
+	ReservationUid string `json:"reservationUid"`
+	DaysLate       int    `json:"daysLate" validate:"gte=0"`
+	Condition      string `json:"condition" validate:"omitempty,oneof=EXCELLENT GOOD BAD"`
+	Reservations   int    `json:"reservations" validate:"gte=0"`
+	Stars          int    `json:"-"`
+}
+
+type Applied struct {
+	Rule   string `json:"rule"`
+	Delta  int    `json:"delta"`
+	Deny   bool   `json:"deny"`
+	Reason string `json:"reason"`
+}
+
+type Outcome struct {
+	Delta   int       `json:"delta"`
+	Allowed bool      `json:"allowed"`
+	Applied []Applied `json:"applied"`
+}
+
+// Reasons joins reasons of the applied rules, deny reasons only when the event is denied.
+func (o Outcome) Reasons() string {
+	reasons := make([]string, 0, len(o.Applied))
+	for _, a := range o.Applied {
+		if o.Allowed || a.Deny {
+			reasons = append(reasons, a.Reason)
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse accepts YAML, and therefore JSON, and validates the rules.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	names := map[string]struct{}{}
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d: name is empty", i)
+		}
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("rule %s: duplicate name", r.Name)
+		}
+		names[r.Name] = struct{}{}
+		if !slices.Contains(knownEvents, r.Event) {
+			return fmt.Errorf("rule %s: unknown event %q", r.Name, r.Event)
+		}
+		if r.Reason == "" {
+			return fmt.Errorf("rule %s: reason is empty", r.Name)
+		}
+		for _, c := range r.When.Condition {
+			if !slices.Contains(knownConditions, c) {
+				return fmt.Errorf("rule %s: unknown condition %q", r.Name, c)
+			}
+		}
+		for _, rng := range []*Range{r.When.DaysLate, r.When.Reservations, r.When.Stars, r.When.FreeSlots} {
+			if rng != nil && rng.Min != nil && rng.Max != nil && *rng.Min > *rng.Max {
+				return fmt.Errorf("rule %s: min is greater than max", r.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (w *When) matches(e Event) bool {
+	if len(w.Condition) > 0 && !slices.Contains(w.Condition, e.Condition) {
+		return false
+	}
+	return w.DaysLate.matches(e.DaysLate) &&
+		w.Reservations.matches(e.Reservations) &&
+		w.Stars.matches(e.Stars) &&
+		w.FreeSlots.matches(e.Stars-e.Reservations)
+}
+
+// Evaluate applies every matching rule in order: deltas are summed, a single deny rejects the event
+// and cancels the deltas.
+func (p *Policy) Evaluate(e Event) Outcome {
+	o := Outcome{Allowed: true, Applied: make([]Applied, 0)}
+	for _, r := range p.Rules {
+		if r.Event != e.Type || !r.When.matches(e) {
+			continue
+		}
+		o.Applied = append(o.Applied, Applied{Rule: r.Name, Delta: r.Delta, Deny: r.Deny, Reason: r.Reason})
+		if r.Deny {
+			o.Allowed = false
+		}
+		o.Delta += r.Delta
+	}
+	if !o.Allowed {
+		o.Delta = 0
+	}
+	return o
+}
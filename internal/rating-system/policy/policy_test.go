@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+  - name: returned-on-time
+    event: RETURN
+    when:
+      daysLate: { max: 0 }
+    delta: 1
+    reason: "book returned on time"
+  - name: returned-late
+    event: RETURN
+    when:
+      daysLate: { min: 1 }
+    delta: -10
+    reason: "book returned late"
+  - name: returned-damaged
+    event: RETURN
+    when:
+      condition: [BAD]
+    delta: -5
+    reason: "book returned damaged"
+  - name: reservations-over-limit
+    event: RESERVE
+    when:
+      freeSlots: { max: 0 }
+    deny: true
+    reason: "reservations over limit"
+`
+
+func Test_Evaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		event           Event
+		expectedDelta   int
+		expectedAllowed bool
+		expectedRules   []string
+	}{
+		{
+			name:            "return on time",
+			event:           Event{Type: ReturnEvent, Condition: "EXCELLENT", Stars: 50},
+			expectedDelta:   1,
+			expectedAllowed: true,
+			expectedRules:   []string{"returned-on-time"},
+		},
+		{
+			name:            "late return of damaged book",
+			event:           Event{Type: ReturnEvent, DaysLate: 3, Condition: "BAD", Stars: 50},
+			expectedDelta:   -15,
+			expectedAllowed: true,
+			expectedRules:   []string{"returned-late", "returned-damaged"},
+		},
+		{
+			name:            "reservation within limit",
+			event:           Event{Type: ReserveEvent, Reservations: 1, Stars: 2},
+			expectedDelta:   0,
+			expectedAllowed: true,
+			expectedRules:   []string{},
+		},
+		{
+			name:            "reservation over limit",
+			event:           Event{Type: ReserveEvent, Reservations: 2, Stars: 2},
+			expectedDelta:   0,
+			expectedAllowed: false,
+			expectedRules:   []string{"reservations-over-limit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := p.Evaluate(tt.event)
+
+			require.Equal(t, tt.expectedDelta, o.Delta)
+			require.Equal(t, tt.expectedAllowed, o.Allowed)
+			rules := make([]string, 0, len(o.Applied))
+			for _, a := range o.Applied {
+				rules = append(rules, a.Rule)
+			}
+			require.Equal(t, tt.expectedRules, rules)
+		})
+	}
+}
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{
+			name:   "valid policy",
+			policy: testPolicy,
+		},
+		{
+			name:    "unknown event",
+			policy:  `rules: [{name: a, event: LOST, delta: 1, reason: r}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown condition",
+			policy:  `rules: [{name: a, event: RETURN, when: {condition: [TORN]}, delta: 1, reason: r}]`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			policy:  `rules: [{name: a, event: RETURN, reason: r}, {name: a, event: RESERVE, reason: r}]`,
+			wantErr: true,
+		},
+		{
+			name:    "empty range",
+			policy:  `rules: [{name: a, event: RETURN, when: {daysLate: {min: 2, max: 1}}, reason: r}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.policy))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_LoadDefaultPolicy(t *testing.T) {
+	p, err := Load("../../../configs/rating-system/policy.yml")
+	require.NoError(t, err)
+
+	require.Equal(t, 1, p.Evaluate(Event{Type: ReturnEvent, Stars: 1}).Delta)
+	require.Equal(t, -10, p.Evaluate(Event{Type: ReturnEvent, DaysLate: 1, Stars: 1}).Delta)
+	require.False(t, p.Evaluate(Event{Type: ReserveEvent, Reservations: 1, Stars: 1}).Allowed)
+}
@@ -4,4 +4,5 @@ import "errors"
 
 var (
 	errRecordNotFound = errors.New("record not found")
+	errEventRecorded  = errors.New("event for the reservation is already recorded")
 )
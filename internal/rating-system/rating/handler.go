@@ -5,29 +5,67 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/Erlendum/rsoi-lab-02/internal/rating-system/config"
+	"github.com/Erlendum/rsoi-lab-02/internal/rating-system/policy"
 	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 //go:generate mockgen -source=handler.go -destination=handler_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/rating-system/rating -package=rating
 
 type storage interface {
-	CreateRatingRecord(ctx context.Context, record *ratingRecord) (int, error)
-	UpdateRatingRecord(ctx context.Context, userName string, record *ratingRecord) error
+	ProvisionRatingRecord(ctx context.Context, username string, stars int, event *ratingEvent) (ratingRecord, bool, error)
+	ChangeStars(ctx context.Context, username string, delta int, event *ratingEvent) (starsChange, error)
 	GetRatingRecord(ctx context.Context, username string) (ratingRecord, error)
+	GetRatingHistory(ctx context.Context, username string, offset, limit int) ([]ratingEvent, int, error)
+	SetLeaderboardOptIn(ctx context.Context, username string, optIn bool) error
+	GetLeaderboard(ctx context.Context, limit int) ([]leaderboardEntry, error)
+}
+
+const (
+	manualAdjustmentReason = "manual adjustment"
+	startingStarsReason    = "starting stars"
+
+	defaultLeaderboardSize = 10
+	maxLeaderboardSize     = 100
+)
+
+type policyEngine interface {
+	Evaluate(e policy.Event) policy.Outcome
 }
 
 type handler struct {
 	storage storage
+	policy  policyEngine
 	config  *config.Config
 }
 
-func NewHandler(storage storage, config *config.Config) *handler {
-	return &handler{storage: storage, config: config}
+func NewHandler(storage storage, policy policyEngine, config *config.Config) *handler {
+	return &handler{storage: storage, policy: policy, config: config}
+}
+
+// newRatingEvent describes why stars change, the applied delta and resulting stars are filled by the storage.
+func newRatingEvent(ctx context.Context, username, reason, reservationUid string) *ratingEvent {
+	actor := auth.GetUser(ctx)
+	event := &ratingEvent{
+		UserName: &username,
+		Reason:   &reason,
+		Actor:    &actor,
+	}
+	if reservationUid != "" {
+		event.ReservationUid = &reservationUid
+	}
+	return event
+}
+
+// mayAccess tells whether the caller may see the rating history of the reader or change whether it is published:
+// the reader, librarians and admins. Other readers are told it does not exist.
+func mayAccess(ctx context.Context, username string) bool {
+	return username == auth.GetUser(ctx) || auth.HasRole(ctx, auth.LibrarianRole) || auth.HasRole(ctx, auth.AdminRole)
 }
 
 func (h *handler) Register(echo *echo.Echo) {
@@ -35,8 +73,14 @@ func (h *handler) Register(echo *echo.Echo) {
 	api.Use(auth.Middleware(h.config.JWKURI))
 
 	api.GET("/rating/:username", h.GetRatingRecord)
-	api.POST("/rating", h.CreateRatingRecord)
-	api.PUT("/rating/:username", h.UpdateRatingRecord)
+	api.PUT("/rating/:username", h.ProvisionRatingRecord)
+	api.PATCH("/rating/:username", h.UpdateRatingRecord, auth.RequireRole(auth.AdminRole))
+	api.POST("/rating/:username/events", h.ReportEvent, auth.RequireRole(auth.ServiceRole, auth.LibrarianRole, auth.AdminRole))
+	api.GET("/rating/:username/history", h.GetRatingHistory)
+	api.GET("/rating/:username/tier", h.GetTier)
+	api.PUT("/rating/:username/leaderboard", h.SetLeaderboardOptIn)
+	api.GET("/leaderboard", h.GetLeaderboard)
+	api.POST("/policy/dry-run", h.DryRunPolicy)
 }
 
 func (h *handler) GetRatingRecord(c echo.Context) error {
@@ -61,7 +105,141 @@ func (h *handler) GetRatingRecord(c echo.Context) error {
 	return c.JSON(http.StatusOK, response{Stars: *record.Stars})
 }
 
-func (h *handler) CreateRatingRecord(c echo.Context) error {
+// ProvisionRatingRecord is idempotent: it creates the record with the starting stars once and
+// answers with the stored record on every call, 201 when it was created and 200 otherwise.
+func (h *handler) ProvisionRatingRecord(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "username is wrong"})
+	}
+
+	record, created, err := h.storage.ProvisionRatingRecord(c.Request().Context(), username, h.config.StartingStars,
+		newRatingEvent(c.Request().Context(), username, startingStarsReason, ""))
+	if err != nil {
+		log.Err(err).Msg("failed to provision rating record")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to provision rating record"})
+	}
+
+	type response struct {
+		ID       int    `json:"id"`
+		UserName string `json:"userName"`
+		Stars    int    `json:"stars"`
+	}
+
+	statusCode := http.StatusOK
+	if created {
+		statusCode = http.StatusCreated
+	}
+
+	return c.JSON(statusCode, response{ID: *record.ID, UserName: *record.UserName, Stars: *record.Stars})
+}
+
+func (h *handler) UpdateRatingRecord(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "username is wrong"})
+	}
+	starsDiffParam := c.QueryParam("starsDiff")
+	starsDiff, err := strconv.Atoi(starsDiffParam)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "starsDiff is wrong"})
+	}
+
+	reason := c.QueryParam("reason")
+	if reason == "" {
+		reason = manualAdjustmentReason
+	}
+
+	change, err := h.storage.ChangeStars(c.Request().Context(), username, starsDiff, newRatingEvent(c.Request().Context(), username, reason, ""))
+	if err != nil {
+		log.Err(err).Msg("failed to change stars")
+		if errors.Is(err, errRecordNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"message": "record not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to update rating record"})
+	}
+
+	type response struct {
+		Stars   int  `json:"stars"`
+		Delta   int  `json:"delta"`
+		Clamped bool `json:"clamped"`
+	}
+
+	return c.JSON(http.StatusOK, response{Stars: change.Stars, Delta: change.Delta, Clamped: change.Clamped})
+}
+
+func (h *handler) ReportEvent(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "username is wrong"})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to read request body"})
+	}
+
+	event := policy.Event{}
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		log.Err(err).Msg("failed to unmarshal request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to unmarshal request body"})
+	}
+
+	if err = c.Validate(event); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to validate request body"})
+	}
+
+	record, err := h.storage.GetRatingRecord(c.Request().Context(), username)
+	if err != nil {
+		log.Err(err).Msg("failed to get rating record")
+		if errors.Is(err, errRecordNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"message": "record not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "storage error"})
+	}
+
+	event.Stars = *record.Stars
+	outcome := h.policy.Evaluate(event)
+
+	change := starsChange{Stars: *record.Stars}
+	if outcome.Allowed && outcome.Delta != 0 {
+		change, err = h.storage.ChangeStars(c.Request().Context(), username, outcome.Delta,
+			newRatingEvent(c.Request().Context(), username, outcome.Reasons(), event.ReservationUid))
+		if err != nil {
+			log.Err(err).Msg("failed to change stars")
+			if errors.Is(err, errRecordNotFound) {
+				return c.JSON(http.StatusNotFound, echo.Map{"message": "record not found"})
+			}
+			if errors.Is(err, errEventRecorded) {
+				return c.JSON(http.StatusConflict, echo.Map{"message": "event is already recorded"})
+			}
+			return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to update rating record"})
+		}
+	}
+
+	type response struct {
+		Stars   int              `json:"stars"`
+		Delta   int              `json:"delta"`
+		Clamped bool             `json:"clamped"`
+		Allowed bool             `json:"allowed"`
+		Reason  string           `json:"reason"`
+		Applied []policy.Applied `json:"applied"`
+	}
+
+	return c.JSON(http.StatusOK, response{
+		Stars:   change.Stars,
+		Delta:   change.Delta,
+		Clamped: change.Clamped,
+		Allowed: outcome.Allowed,
+		Reason:  outcome.Reasons(),
+		Applied: outcome.Applied,
+	})
+}
+
+func (h *handler) DryRunPolicy(c echo.Context) error {
 	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
 		log.Err(err).Msg("failed to read request body")
@@ -69,7 +247,9 @@ func (h *handler) CreateRatingRecord(c echo.Context) error {
 	}
 
 	type request struct {
-		UserName string `json:"userName" validate:"required"`
+		Policy string       `json:"policy" validate:"required"`
+		Stars  int          `json:"stars" validate:"gte=0"`
+		Event  policy.Event `json:"event"`
 	}
 	req := request{}
 
@@ -84,24 +264,113 @@ func (h *handler) CreateRatingRecord(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to validate request body"})
 	}
 
-	id, err := h.storage.CreateRatingRecord(c.Request().Context(), &ratingRecord{UserName: &req.UserName})
+	proposed, err := policy.Parse([]byte(req.Policy))
 	if err != nil {
-		log.Err(err).Msg("failed to create rating record")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to create rating record"})
+		log.Err(err).Msg("failed to parse policy")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "policy is wrong: " + err.Error()})
+	}
+
+	req.Event.Stars = req.Stars
+
+	type response struct {
+		Current  policy.Outcome `json:"current"`
+		Proposed policy.Outcome `json:"proposed"`
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{"id": id})
+	return c.JSON(http.StatusOK, response{
+		Current:  h.policy.Evaluate(req.Event),
+		Proposed: proposed.Evaluate(req.Event),
+	})
 }
 
-func (h *handler) UpdateRatingRecord(c echo.Context) error {
+func (h *handler) GetRatingHistory(c echo.Context) error {
 	username := c.Param("username")
 	if username == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "username is wrong"})
 	}
-	starsDiffParam := c.QueryParam("starsDiff")
-	starsDiff, err := strconv.Atoi(starsDiffParam)
+
+	if !mayAccess(c.Request().Context(), username) {
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "history not found"})
+	}
+
+	pageParam := c.QueryParam("page")
+	page, err := strconv.Atoi(pageParam)
+	if err != nil || page <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "page is wrong"})
+	}
+
+	sizeParam := c.QueryParam("size")
+	size, err := strconv.Atoi(sizeParam)
+	if err != nil || size <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "size is wrong"})
+	}
+
+	events, total, err := h.storage.GetRatingHistory(c.Request().Context(), username, page*size-size, size)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "starsDiff is wrong"})
+		log.Err(err).Msg("failed to get rating history")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "storage error"})
+	}
+
+	type item struct {
+		Delta          int     `json:"delta"`
+		Stars          int     `json:"stars"`
+		Reason         string  `json:"reason"`
+		ReservationUid *string `json:"reservationUid,omitempty"`
+		Actor          string  `json:"actor"`
+		CreatedAt      string  `json:"createdAt"`
+	}
+	type response struct {
+		Page          int    `json:"page"`
+		PageSize      int    `json:"pageSize"`
+		TotalElements int    `json:"totalElements"`
+		Items         []item `json:"items"`
+	}
+
+	items := make([]item, 0, len(events))
+	for _, v := range events {
+		items = append(items, item{
+			Delta:          *v.Delta,
+			Stars:          *v.Stars,
+			Reason:         *v.Reason,
+			ReservationUid: v.ReservationUid,
+			Actor:          *v.Actor,
+			CreatedAt:      v.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response{
+		Page:          page,
+		PageSize:      size,
+		TotalElements: total,
+		Items:         items,
+	})
+}
+
+type tierResponse struct {
+	Name        string `json:"name"`
+	MinStars    int    `json:"minStars"`
+	MaxStars    int    `json:"maxStars"`
+	MaxLoans    int    `json:"maxLoans"`
+	MaxLoanDays int    `json:"maxLoanDays"`
+}
+
+func newTierResponse(t *config.Tier) *tierResponse {
+	if t == nil {
+		return nil
+	}
+	return &tierResponse{
+		Name:        t.Name,
+		MinStars:    t.MinStars,
+		MaxStars:    t.MaxStars,
+		MaxLoans:    t.MaxLoans,
+		MaxLoanDays: t.MaxLoanDays,
+	}
+}
+
+func (h *handler) GetTier(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "username is wrong"})
 	}
 
 	record, err := h.storage.GetRatingRecord(c.Request().Context(), username)
@@ -113,13 +382,107 @@ func (h *handler) UpdateRatingRecord(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "storage error"})
 	}
 
-	newStars := *record.Stars + starsDiff
+	current, next := findTier(h.config.Tiers, *record.Stars)
+	if current == nil {
+		log.Error().Int("stars", *record.Stars).Msg("no tier for stars")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "tier not configured"})
+	}
+
+	type response struct {
+		tierResponse
+		Stars int           `json:"stars"`
+		Next  *tierResponse `json:"next,omitempty"`
+	}
+
+	return c.JSON(http.StatusOK, response{
+		tierResponse: *newTierResponse(current),
+		Stars:        *record.Stars,
+		Next:         newTierResponse(next),
+	})
+}
+
+func (h *handler) SetLeaderboardOptIn(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "username is wrong"})
+	}
 
-	err = h.storage.UpdateRatingRecord(c.Request().Context(), username, &ratingRecord{Stars: &newStars})
+	if !mayAccess(c.Request().Context(), username) {
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "record not found"})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to read request body"})
+	}
+
+	type request struct {
+		OptIn *bool `json:"optIn" validate:"required"`
+	}
+	req := request{}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		log.Err(err).Msg("failed to unmarshal request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to unmarshal request body"})
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate request body")
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "failed to validate request body"})
+	}
+
+	err = h.storage.SetLeaderboardOptIn(c.Request().Context(), username, *req.OptIn)
+	if err != nil {
+		log.Err(err).Msg("failed to set leaderboard opt-in")
+		if errors.Is(err, errRecordNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"message": "record not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "storage error"})
+	}
+
+	type response struct {
+		OptIn bool `json:"optIn"`
+	}
+
+	return c.JSON(http.StatusOK, response{OptIn: *req.OptIn})
+}
+
+// GetLeaderboard never exposes usernames: readers see ranks, stars and tiers, and only their own
+// entry is marked.
+func (h *handler) GetLeaderboard(c echo.Context) error {
+	size := defaultLeaderboardSize
+	if sizeParam := c.QueryParam("size"); sizeParam != "" {
+		var err error
+		size, err = strconv.Atoi(sizeParam)
+		if err != nil || size <= 0 || size > maxLeaderboardSize {
+			return c.JSON(http.StatusBadRequest, echo.Map{"message": "size is wrong"})
+		}
+	}
+
+	entries, err := h.storage.GetLeaderboard(c.Request().Context(), size)
 	if err != nil {
-		log.Err(err).Msg("failed to create rating record")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "failed to create rating record"})
+		log.Err(err).Msg("failed to get leaderboard")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "storage error"})
+	}
+
+	type item struct {
+		Rank  int    `json:"rank"`
+		Stars int    `json:"stars"`
+		Tier  string `json:"tier"`
+		Me    bool   `json:"me"`
+	}
+
+	user := auth.GetUser(c.Request().Context())
+	items := make([]item, 0, len(entries))
+	for _, v := range entries {
+		i := item{Rank: *v.Rank, Stars: *v.Stars, Me: user != "" && *v.UserName == user}
+		if t, _ := findTier(h.config.Tiers, *v.Stars); t != nil {
+			i.Tier = t.Name
+		}
+		items = append(items, i)
 	}
 
-	return c.NoContent(http.StatusOK)
+	return c.JSON(http.StatusOK, items)
 }
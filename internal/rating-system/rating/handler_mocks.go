@@ -8,6 +8,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	policy "github.com/Erlendum/rsoi-lab-02/internal/rating-system/policy"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -34,19 +35,50 @@ func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
 	return m.recorder
 }
 
-// CreateRatingRecord mocks base method.
-func (m *Mockstorage) CreateRatingRecord(ctx context.Context, record *ratingRecord) (int, error) {
+// ChangeStars mocks base method.
+func (m *Mockstorage) ChangeStars(ctx context.Context, username string, delta int, event *ratingEvent) (starsChange, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateRatingRecord", ctx, record)
-	ret0, _ := ret[0].(int)
+	ret := m.ctrl.Call(m, "ChangeStars", ctx, username, delta, event)
+	ret0, _ := ret[0].(starsChange)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CreateRatingRecord indicates an expected call of CreateRatingRecord.
-func (mr *MockstorageMockRecorder) CreateRatingRecord(ctx, record interface{}) *gomock.Call {
+// ChangeStars indicates an expected call of ChangeStars.
+func (mr *MockstorageMockRecorder) ChangeStars(ctx, username, delta, event interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRatingRecord", reflect.TypeOf((*Mockstorage)(nil).CreateRatingRecord), ctx, record)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeStars", reflect.TypeOf((*Mockstorage)(nil).ChangeStars), ctx, username, delta, event)
+}
+
+// GetLeaderboard mocks base method.
+func (m *Mockstorage) GetLeaderboard(ctx context.Context, limit int) ([]leaderboardEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLeaderboard", ctx, limit)
+	ret0, _ := ret[0].([]leaderboardEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLeaderboard indicates an expected call of GetLeaderboard.
+func (mr *MockstorageMockRecorder) GetLeaderboard(ctx, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLeaderboard", reflect.TypeOf((*Mockstorage)(nil).GetLeaderboard), ctx, limit)
+}
+
+// GetRatingHistory mocks base method.
+func (m *Mockstorage) GetRatingHistory(ctx context.Context, username string, offset, limit int) ([]ratingEvent, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRatingHistory", ctx, username, offset, limit)
+	ret0, _ := ret[0].([]ratingEvent)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetRatingHistory indicates an expected call of GetRatingHistory.
+func (mr *MockstorageMockRecorder) GetRatingHistory(ctx, username, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRatingHistory", reflect.TypeOf((*Mockstorage)(nil).GetRatingHistory), ctx, username, offset, limit)
 }
 
 // GetRatingRecord mocks base method.
@@ -64,16 +96,69 @@ func (mr *MockstorageMockRecorder) GetRatingRecord(ctx, username interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRatingRecord", reflect.TypeOf((*Mockstorage)(nil).GetRatingRecord), ctx, username)
 }
 
-// UpdateRatingRecord mocks base method.
-func (m *Mockstorage) UpdateRatingRecord(ctx context.Context, userName string, record *ratingRecord) error {
+// ProvisionRatingRecord mocks base method.
+func (m *Mockstorage) ProvisionRatingRecord(ctx context.Context, username string, stars int, event *ratingEvent) (ratingRecord, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProvisionRatingRecord", ctx, username, stars, event)
+	ret0, _ := ret[0].(ratingRecord)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ProvisionRatingRecord indicates an expected call of ProvisionRatingRecord.
+func (mr *MockstorageMockRecorder) ProvisionRatingRecord(ctx, username, stars, event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProvisionRatingRecord", reflect.TypeOf((*Mockstorage)(nil).ProvisionRatingRecord), ctx, username, stars, event)
+}
+
+// SetLeaderboardOptIn mocks base method.
+func (m *Mockstorage) SetLeaderboardOptIn(ctx context.Context, username string, optIn bool) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateRatingRecord", ctx, userName, record)
+	ret := m.ctrl.Call(m, "SetLeaderboardOptIn", ctx, username, optIn)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// UpdateRatingRecord indicates an expected call of UpdateRatingRecord.
-func (mr *MockstorageMockRecorder) UpdateRatingRecord(ctx, userName, record interface{}) *gomock.Call {
+// SetLeaderboardOptIn indicates an expected call of SetLeaderboardOptIn.
+func (mr *MockstorageMockRecorder) SetLeaderboardOptIn(ctx, username, optIn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLeaderboardOptIn", reflect.TypeOf((*Mockstorage)(nil).SetLeaderboardOptIn), ctx, username, optIn)
+}
+
+// MockpolicyEngine is a mock of policyEngine interface.
+type MockpolicyEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockpolicyEngineMockRecorder
+}
+
+// MockpolicyEngineMockRecorder is the mock recorder for MockpolicyEngine.
+type MockpolicyEngineMockRecorder struct {
+	mock *MockpolicyEngine
+}
+
+// NewMockpolicyEngine creates a new mock instance.
+func NewMockpolicyEngine(ctrl *gomock.Controller) *MockpolicyEngine {
+	mock := &MockpolicyEngine{ctrl: ctrl}
+	mock.recorder = &MockpolicyEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockpolicyEngine) EXPECT() *MockpolicyEngineMockRecorder {
+	return m.recorder
+}
+
+// Evaluate mocks base method.
+func (m *MockpolicyEngine) Evaluate(e policy.Event) policy.Outcome {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Evaluate", e)
+	ret0, _ := ret[0].(policy.Outcome)
+	return ret0
+}
+
+// Evaluate indicates an expected call of Evaluate.
+func (mr *MockpolicyEngineMockRecorder) Evaluate(e interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRatingRecord", reflect.TypeOf((*Mockstorage)(nil).UpdateRatingRecord), ctx, userName, record)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Evaluate", reflect.TypeOf((*MockpolicyEngine)(nil).Evaluate), e)
 }
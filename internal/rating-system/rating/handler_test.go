@@ -1,7 +1,11 @@
 package rating
 
 import (
+	"bytes"
 	"errors"
+	"github.com/Erlendum/rsoi-lab-02/internal/rating-system/config"
+	"github.com/Erlendum/rsoi-lab-02/internal/rating-system/policy"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
 	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang/mock/gomock"
@@ -11,15 +15,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type handlerTestFields struct {
 	storage *Mockstorage
+	policy  *MockpolicyEngine
 }
 
 func createHandlerTestFields(ctrl *gomock.Controller) *handlerTestFields {
 	return &handlerTestFields{
 		storage: NewMockstorage(ctrl),
+		policy:  NewMockpolicyEngine(ctrl),
 	}
 }
 
@@ -27,6 +34,10 @@ func getPointerOnInt(i int) *int {
 	return &i
 }
 
+func getPointerOnString(s string) *string {
+	return &s
+}
+
 func Test_GetRatingRecord(t *testing.T) {
 	type fields struct {
 		username             string
@@ -119,3 +130,684 @@ func Test_GetRatingRecord(t *testing.T) {
 		})
 	}
 }
+
+func Test_ReportEvent(t *testing.T) {
+	type fields struct {
+		username             string
+		body                 string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong event type",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				username:         "test",
+				body:             `{"type": "LOST"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: record not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				username:         "test",
+				body:             `{"type": "RETURN"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingRecord(gomock.Any(), "test").Return(ratingRecord{}, errRecordNotFound)
+			},
+		},
+		{
+			name: "http-code 200: denied event does not change stars",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				body:             `{"type": "RESERVE", "reservations": 1}`,
+				expectedResponseBody: `{"stars":1,"delta":0,"clamped":false,"allowed":false,"reason":"reservations over limit","applied":[{"rule":"over-limit","delta":0,"deny":true,"reason":"reservations over limit"}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingRecord(gomock.Any(), "test").Return(ratingRecord{Stars: getPointerOnInt(1)}, nil)
+				fields.policy.EXPECT().Evaluate(policy.Event{Type: policy.ReserveEvent, Reservations: 1, Stars: 1}).Return(policy.Outcome{
+					Allowed: false,
+					Applied: []policy.Applied{{Rule: "over-limit", Deny: true, Reason: "reservations over limit"}},
+				})
+			},
+		},
+		{
+			name: "http-code 409: event for the reservation is already recorded",
+			fields: fields{
+				expectedHTTPCode: http.StatusConflict,
+				username:         "test",
+				body:             `{"type": "RETURN", "reservationUid": "r1"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingRecord(gomock.Any(), "test").Return(ratingRecord{Stars: getPointerOnInt(50)}, nil)
+				fields.policy.EXPECT().Evaluate(policy.Event{Type: policy.ReturnEvent, ReservationUid: "r1", Stars: 50}).Return(policy.Outcome{
+					Delta:   1,
+					Allowed: true,
+					Applied: []policy.Applied{{Rule: "on-time", Delta: 1, Reason: "book returned on time"}},
+				})
+				fields.storage.EXPECT().ChangeStars(gomock.Any(), "test", 1, gomock.Any()).Return(starsChange{}, errEventRecorded)
+			},
+		},
+		{
+			name: "http-code 200: delta applied",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				body:             `{"type": "RETURN", "daysLate": 2}`,
+				expectedResponseBody: `{"stars":40,"delta":-10,"clamped":false,"allowed":true,"reason":"book returned late","applied":[{"rule":"late","delta":-10,"deny":false,"reason":"book returned late"}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingRecord(gomock.Any(), "test").Return(ratingRecord{Stars: getPointerOnInt(50)}, nil)
+				fields.policy.EXPECT().Evaluate(policy.Event{Type: policy.ReturnEvent, DaysLate: 2, Stars: 50}).Return(policy.Outcome{
+					Delta:   -10,
+					Allowed: true,
+					Applied: []policy.Applied{{Rule: "late", Delta: -10, Reason: "book returned late"}},
+				})
+				fields.storage.EXPECT().ChangeStars(gomock.Any(), "test", -10, gomock.Any()).
+					DoAndReturn(func(_ interface{}, _ string, _ int, event *ratingEvent) (starsChange, error) {
+						require.Equal(t, "book returned late", *event.Reason)
+						return starsChange{Stars: 40, Delta: -10}, nil
+					})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, policy: testFields.policy}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues(tt.fields.username)
+
+			err := h.ReportEvent(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_GetRatingHistory(t *testing.T) {
+	type fields struct {
+		username             string
+		caller               string
+		roles                []string
+		query                string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	createdAt := time.Date(2024, 11, 21, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong page",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				username:         "test",
+				query:            "page=0&size=10",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: history of another reader",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				username:         "test",
+				caller:           "other",
+				query:            "page=1&size=10",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 200: librarian sees the history of the reader",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				caller:           "librarian",
+				roles:            []string{auth.LibrarianRole},
+				query:            "page=1&size=10",
+				expectedResponseBody: `{"page":1,"pageSize":10,"totalElements":0,"items":[]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingHistory(gomock.Any(), "test", 0, 10).Return([]ratingEvent{}, 0, nil)
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+				username:         "test",
+				query:            "page=1&size=10",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingHistory(gomock.Any(), "test", 0, 10).Return(nil, 0, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: success",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				query:            "page=2&size=1",
+				expectedResponseBody: `{"page":2,"pageSize":1,"totalElements":2,"items":[{"delta":1,"stars":51,"reason":"book returned on time","actor":"test","createdAt":"2024-11-21T10:00:00Z"}]}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingHistory(gomock.Any(), "test", 1, 1).Return([]ratingEvent{{
+					Delta:     getPointerOnInt(1),
+					Stars:     getPointerOnInt(51),
+					Reason:    getPointerOnString("book returned on time"),
+					Actor:     getPointerOnString("test"),
+					CreatedAt: &createdAt,
+				}}, 2, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test?"+tt.fields.query, nil)
+			caller := tt.fields.caller
+			if caller == "" {
+				caller = tt.fields.username
+			}
+			req = req.WithContext(auth.SetRoles(auth.SetUser(req.Context(), caller), tt.fields.roles))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues(tt.fields.username)
+
+			err := h.GetRatingHistory(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_UpdateRatingRecord(t *testing.T) {
+	type fields struct {
+		username             string
+		starsDiff            string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong starsDiff",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				username:         "test",
+				starsDiff:        "test",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: record not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				username:         "test",
+				starsDiff:        "1",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().ChangeStars(gomock.Any(), "test", 1, gomock.Any()).Return(starsChange{}, errRecordNotFound)
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+				username:         "test",
+				starsDiff:        "1",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().ChangeStars(gomock.Any(), "test", 1, gomock.Any()).Return(starsChange{}, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: clamped",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				starsDiff:        "-10",
+				expectedResponseBody: `{"stars":0,"delta":-3,"clamped":true}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().ChangeStars(gomock.Any(), "test", -10, gomock.Any()).Return(starsChange{Stars: 0, Delta: -3, Clamped: true}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodPut, "/test?starsDiff="+tt.fields.starsDiff, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues(tt.fields.username)
+
+			err := h.UpdateRatingRecord(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_ProvisionRatingRecord(t *testing.T) {
+	type fields struct {
+		username             string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong username",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				username:         "",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+				username:         "test",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().ProvisionRatingRecord(gomock.Any(), "test", 1, gomock.Any()).Return(ratingRecord{}, false, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 201: created",
+			fields: fields{
+				expectedHTTPCode: http.StatusCreated,
+				username:         "test",
+				expectedResponseBody: `{"id":1,"userName":"test","stars":1}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().ProvisionRatingRecord(gomock.Any(), "test", 1, gomock.Any()).
+					Return(ratingRecord{ID: getPointerOnInt(1), UserName: getPointerOnString("test"), Stars: getPointerOnInt(1)}, true, nil)
+			},
+		},
+		{
+			name: "http-code 200: already exists",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				expectedResponseBody: `{"id":1,"userName":"test","stars":37}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().ProvisionRatingRecord(gomock.Any(), "test", 1, gomock.Any()).
+					Return(ratingRecord{ID: getPointerOnInt(1), UserName: getPointerOnString("test"), Stars: getPointerOnInt(37)}, false, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, config: &config.Config{StartingStars: 1}}
+
+			req := httptest.NewRequest(http.MethodPut, "/test", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues(tt.fields.username)
+
+			err := h.ProvisionRatingRecord(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedResponseBody != "" {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func getTestTiers() []config.Tier {
+	return []config.Tier{
+		{Name: "Bronze", MinStars: 0, MaxStars: 39, MaxLoans: 3, MaxLoanDays: 14},
+		{Name: "Silver", MinStars: 40, MaxStars: 74, MaxLoans: 5, MaxLoanDays: 30},
+		{Name: "Gold", MinStars: 75, MaxStars: 100, MaxLoans: 10, MaxLoanDays: 60},
+	}
+}
+
+func Test_GetTier(t *testing.T) {
+	type fields struct {
+		username             string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 404: record not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				username:         "test",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingRecord(gomock.Any(), "test").Return(ratingRecord{}, errRecordNotFound)
+			},
+		},
+		{
+			name: "http-code 200: next tier",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				expectedResponseBody: `{"name":"Silver","minStars":40,"maxStars":74,"maxLoans":5,"maxLoanDays":30,"stars":50,"next":{"name":"Gold","minStars":75,"maxStars":100,"maxLoans":10,"maxLoanDays":60}}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingRecord(gomock.Any(), "test").Return(ratingRecord{Stars: getPointerOnInt(50)}, nil)
+			},
+		},
+		{
+			name: "http-code 200: top tier",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				expectedResponseBody: `{"name":"Gold","minStars":75,"maxStars":100,"maxLoans":10,"maxLoanDays":60,"stars":100}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetRatingRecord(gomock.Any(), "test").Return(ratingRecord{Stars: getPointerOnInt(100)}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, config: &config.Config{Tiers: getTestTiers()}}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues(tt.fields.username)
+
+			err := h.GetTier(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_SetLeaderboardOptIn(t *testing.T) {
+	type fields struct {
+		username         string
+		caller           string
+		roles            []string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 404: rating of another reader",
+			fields: fields{
+				username:         "test",
+				caller:           "other",
+				expectedHTTPCode: http.StatusNotFound,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 200: reader opts in",
+			fields: fields{
+				username:         "test",
+				caller:           "test",
+				expectedHTTPCode: http.StatusOK,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().SetLeaderboardOptIn(gomock.Any(), "test", true).Return(nil)
+			},
+		},
+		{
+			name: "http-code 200: librarian opts the reader in",
+			fields: fields{
+				username:         "test",
+				caller:           "librarian",
+				roles:            []string{auth.LibrarianRole},
+				expectedHTTPCode: http.StatusOK,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().SetLeaderboardOptIn(gomock.Any(), "test", true).Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString(`{"optIn": true}`))
+			req = req.WithContext(auth.SetRoles(auth.SetUser(req.Context(), tt.fields.caller), tt.fields.roles))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues(tt.fields.username)
+
+			err := h.SetLeaderboardOptIn(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_GetLeaderboard(t *testing.T) {
+	type fields struct {
+		size                 string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong size",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				size:             "1000",
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 200: usernames are hidden",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `[{"rank":1,"stars":80,"tier":"Gold","me":false},{"rank":2,"stars":50,"tier":"Silver","me":true}]
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLeaderboard(gomock.Any(), defaultLeaderboardSize).Return([]leaderboardEntry{
+					{Rank: getPointerOnInt(1), UserName: getPointerOnString("other"), Stars: getPointerOnInt(80)},
+					{Rank: getPointerOnInt(2), UserName: getPointerOnString("test"), Stars: getPointerOnInt(50)},
+				}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, config: &config.Config{Tiers: getTestTiers()}}
+
+			req := httptest.NewRequest(http.MethodGet, "/test?size="+tt.fields.size, nil)
+			req = req.WithContext(auth.SetUser(req.Context(), "test"))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.GetLeaderboard(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
@@ -1,7 +1,32 @@
 package rating
 
+import "time"
+
 type ratingRecord struct {
 	ID       *int    `db:"id"`
 	UserName *string `db:"username"`
 	Stars    *int    `db:"stars"`
 }
+
+type ratingEvent struct {
+	ID             *int       `db:"id"`
+	UserName       *string    `db:"username"`
+	Delta          *int       `db:"delta"`
+	Stars          *int       `db:"stars"`
+	Reason         *string    `db:"reason"`
+	ReservationUid *string    `db:"reservation_uid"`
+	Actor          *string    `db:"actor"`
+	CreatedAt      *time.Time `db:"created_at"`
+}
+
+type starsChange struct {
+	Stars   int  `db:"stars"`
+	Delta   int  `db:"delta"`
+	Clamped bool `db:"clamped"`
+}
+
+type leaderboardEntry struct {
+	Rank     *int    `db:"rank"`
+	UserName *string `db:"username"`
+	Stars    *int    `db:"stars"`
+}
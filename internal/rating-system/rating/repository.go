@@ -11,6 +11,8 @@ import (
 
 const (
 	defaultTimeout = 5 * time.Second
+	minStars       = 0
+	maxStars       = 100
 )
 
 type repository struct {
@@ -21,51 +23,168 @@ func NewRepository(conn *sqlx.DB) *repository {
 	return &repository{conn: conn}
 }
 
-func (r *repository) CreateRatingRecord(ctx context.Context, record *ratingRecord) (int, error) {
-	insertRatingRecordQuery := `
-	WITH inserted AS (
+// ProvisionRatingRecord returns the existing record or creates it with the given stars, granting them in the ledger.
+func (r *repository) ProvisionRatingRecord(ctx context.Context, username string, stars int, event *ratingEvent) (ratingRecord, bool, error) {
+	provisionRatingRecordQuery := `
+	WITH upserted AS (
 		INSERT INTO rating
-			(username)
-				VALUES ($1)
-			ON CONFLICT (username) DO NOTHING
-			RETURNING id
+			(username, stars)
+				VALUES ($1, $2)
+			ON CONFLICT (username) DO UPDATE SET username = EXCLUDED.username
+			RETURNING id, username, stars, xmax = 0 AS created
+	), logged AS (
+		INSERT INTO rating_events
+			(username, delta, stars, reason, actor)
+			SELECT username, stars, stars, $3, $4 FROM upserted WHERE created
 	)
-	SELECT id FROM inserted;`
+	SELECT id, username, stars, created FROM upserted;`
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	var id int
-	err := r.conn.QueryRowContext(ctx, insertRatingRecordQuery, *record.UserName).Scan(&id)
+	res := ratingRecord{}
+	var created bool
+	err := r.conn.QueryRowContext(ctx, provisionRatingRecordQuery, username, stars, *event.Reason, *event.Actor).
+		Scan(&res.ID, &res.UserName, &res.Stars, &created)
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to execute query")
+		return ratingRecord{}, false, errors.Wrap(err, "failed to execute query")
 	}
 
-	return id, nil
+	return res, created, nil
 }
 
-func (r *repository) createUpdateBuilderForRecord(username string, record ratingRecord) (sq.UpdateBuilder, bool) {
+// ChangeStars adds delta to the stars in one statement: the row is locked, the result is clamped into
+// [minStars, maxStars] and the applied delta is appended to the ledger, so concurrent changes are never lost.
+// An event for a reservation is applied once, a repeated one gives errEventRecorded and changes nothing.
+func (r *repository) ChangeStars(ctx context.Context, username string, delta int, event *ratingEvent) (starsChange, error) {
+	lockQuery := `SELECT id FROM rating WHERE username = $1 FOR UPDATE;`
+	recordedQuery := `SELECT EXISTS (SELECT 1 FROM rating_events WHERE reservation_uid = $1);`
+	changeStarsQuery := `
+	WITH old AS (
+		SELECT id, stars FROM rating WHERE username = $1 FOR UPDATE
+	), updated AS (
+		UPDATE rating r
+			SET stars = LEAST($4::int, GREATEST($3::int, old.stars + $2))
+			FROM old
+			WHERE r.id = old.id
+			RETURNING r.stars, old.stars AS old_stars
+	), logged AS (
+		INSERT INTO rating_events
+			(username, delta, stars, reason, reservation_uid, actor)
+			SELECT $1, stars - old_stars, stars, $5, $6, $7 FROM updated
+	)
+	SELECT stars, stars - old_stars AS delta, old_stars + $2 <> stars AS clamped FROM updated;`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return starsChange{}, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if event.ReservationUid != nil {
+		// the row lock orders the events of the reader, the check after it sees an event recorded by a concurrent call
+		var id int
+		err = tx.GetContext(ctx, &id, lockQuery, username)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return starsChange{}, errRecordNotFound
+			}
+			return starsChange{}, errors.Wrap(err, "failed to lock rating record")
+		}
+
+		var recorded bool
+		err = tx.GetContext(ctx, &recorded, recordedQuery, *event.ReservationUid)
+		if err != nil {
+			return starsChange{}, errors.Wrap(err, "failed to execute query")
+		}
+		if recorded {
+			return starsChange{}, errEventRecorded
+		}
+	}
+
+	res := starsChange{}
+	err = tx.GetContext(ctx, &res, changeStarsQuery, username, delta, minStars, maxStars, *event.Reason, event.ReservationUid, *event.Actor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return starsChange{}, errRecordNotFound
+		}
+		return starsChange{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, errors.Wrap(tx.Commit(), "failed to commit stars change")
+}
+
+func (r *repository) GetRatingRecord(ctx context.Context, username string) (ratingRecord, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	isEmpty := true
-	updateBuilder := psql.Update("rating").Where(sq.Eq{"username": username})
-	if record.UserName != nil {
-		updateBuilder = updateBuilder.Set("username", record.UserName)
-		isEmpty = false
+
+	builder := psql.Select("id", "username", "stars").From("rating").Where(sq.Eq{"username": username})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return ratingRecord{}, errors.Wrap(err, "failed to build query")
 	}
-	if record.Stars != nil {
-		updateBuilder = updateBuilder.Set("stars", record.Stars)
-		isEmpty = false
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := ratingRecord{}
+
+	err = r.conn.GetContext(ctx, &res, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ratingRecord{}, errRecordNotFound
+		}
+		return ratingRecord{}, errors.Wrap(err, "failed to execute query")
 	}
 
-	return updateBuilder, isEmpty
+	return res, nil
 }
 
-func (r *repository) UpdateRatingRecord(ctx context.Context, userName string, record *ratingRecord) error {
-	builder, isEmpty := r.createUpdateBuilderForRecord(userName, *record)
-	if isEmpty {
-		return nil
+func (r *repository) GetRatingHistory(ctx context.Context, username string, offset, limit int) ([]ratingEvent, int, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	builder := psql.Select("id", "username", "delta", "stars", "reason", "reservation_uid", "actor", "created_at").
+		From("rating_events").
+		Where(sq.Eq{"username": username}).
+		OrderBy("created_at DESC", "id DESC").
+		Limit(uint64(limit)).Offset(uint64(offset))
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to build query")
+	}
+
+	countQuery, countArgs, err := psql.Select("COUNT(*)").From("rating_events").Where(sq.Eq{"username": username}).ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var total int
+	err = r.conn.GetContext(ctx, &total, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to execute query")
 	}
 
+	events := make([]ratingEvent, 0)
+	err = r.conn.SelectContext(ctx, &events, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	return events, total, nil
+}
+
+func (r *repository) SetLeaderboardOptIn(ctx context.Context, username string, optIn bool) error {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	builder := psql.Update("rating").Set("leaderboard_opt_in", optIn).Where(sq.Eq{"username": username})
+
 	query, args, err := builder.ToSql()
 	if err != nil {
 		return errors.Wrap(err, "failed to build query")
@@ -74,36 +193,45 @@ func (r *repository) UpdateRatingRecord(ctx context.Context, userName string, re
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	_, err = r.conn.ExecContext(ctx, query, args...)
+	res, err := r.conn.ExecContext(ctx, query, args...)
 	if err != nil {
 		return errors.Wrap(err, "failed to execute query")
 	}
 
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get affected rows")
+	}
+	if affected == 0 {
+		return errRecordNotFound
+	}
+
 	return nil
 }
 
-func (r *repository) GetRatingRecord(ctx context.Context, username string) (ratingRecord, error) {
+// GetLeaderboard ranks only the readers who opted in, equal stars share a rank.
+func (r *repository) GetLeaderboard(ctx context.Context, limit int) ([]leaderboardEntry, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
-	builder := psql.Select("id", "username", "stars").From("rating").Where(sq.Eq{"username": username})
+	builder := psql.Select("RANK() OVER (ORDER BY stars DESC) AS rank", "username", "stars").
+		From("rating").
+		Where(sq.Eq{"leaderboard_opt_in": true}).
+		OrderBy("stars DESC", "id").
+		Limit(uint64(limit))
 
 	query, args, err := builder.ToSql()
 	if err != nil {
-		return ratingRecord{}, errors.Wrap(err, "failed to build query")
+		return nil, errors.Wrap(err, "failed to build query")
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	res := ratingRecord{}
-
-	err = r.conn.GetContext(ctx, &res, query, args...)
+	entries := make([]leaderboardEntry, 0)
+	err = r.conn.SelectContext(ctx, &entries, query, args...)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ratingRecord{}, errRecordNotFound
-		}
-		return ratingRecord{}, errors.Wrap(err, "failed to execute query")
+		return nil, errors.Wrap(err, "failed to execute query")
 	}
 
-	return res, nil
+	return entries, nil
 }
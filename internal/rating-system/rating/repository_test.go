@@ -0,0 +1,136 @@
+package rating
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"testing"
+)
+
+// Test_ChangeStarsConcurrently needs a database with migrations applied, set RATING_SYSTEM_POSTGRESQL_DSN to run it.
+// The test workflow runs it against its Postgres service.
+func Test_ChangeStarsConcurrently(t *testing.T) {
+	dsn := os.Getenv("RATING_SYSTEM_POSTGRESQL_DSN")
+	if dsn == "" {
+		t.Skip("RATING_SYSTEM_POSTGRESQL_DSN is not set")
+	}
+
+	conn, err := sqlx.Connect("postgres", dsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	repo := NewRepository(conn)
+	username := "concurrency-" + uuid.New().String()[:8]
+
+	_, err = conn.ExecContext(ctx, "INSERT INTO rating (username, stars) VALUES ($1, 50)", username)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = conn.ExecContext(ctx, "DELETE FROM rating WHERE username = $1", username)
+	})
+
+	changeConcurrently := func(deltas []int) []starsChange {
+		var wg sync.WaitGroup
+		results := make([]starsChange, len(deltas))
+		errs := make([]error, len(deltas))
+		for i, delta := range deltas {
+			wg.Add(1)
+			go func(i, delta int) {
+				defer wg.Done()
+				results[i], errs[i] = repo.ChangeStars(ctx, username, delta, newRatingEvent(ctx, username, "concurrency test", ""))
+			}(i, delta)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		return results
+	}
+
+	deltas := make([]int, 0, 80)
+	for i := 0; i < 50; i++ {
+		deltas = append(deltas, 1)
+	}
+	for i := 0; i < 30; i++ {
+		deltas = append(deltas, -1)
+	}
+	changeConcurrently(deltas)
+
+	record, err := repo.GetRatingRecord(ctx, username)
+	require.NoError(t, err)
+	require.Equal(t, 70, *record.Stars)
+
+	deltas = make([]int, 0, 40)
+	for i := 0; i < 40; i++ {
+		deltas = append(deltas, 1)
+	}
+	clamped := 0
+	for _, res := range changeConcurrently(deltas) {
+		if res.Clamped {
+			clamped++
+		}
+	}
+
+	record, err = repo.GetRatingRecord(ctx, username)
+	require.NoError(t, err)
+	require.Equal(t, 100, *record.Stars)
+	require.Equal(t, 10, clamped)
+
+	var ledgerSum, ledgerCount int
+	err = conn.QueryRowContext(ctx, "SELECT COALESCE(SUM(delta), 0), COUNT(*) FROM rating_events WHERE username = $1", username).Scan(&ledgerSum, &ledgerCount)
+	require.NoError(t, err)
+	require.Equal(t, 50, ledgerSum)
+	require.Equal(t, 120, ledgerCount)
+}
+
+// Test_ChangeStarsOncePerReservation needs a database with migrations applied, set RATING_SYSTEM_POSTGRESQL_DSN to run it.
+func Test_ChangeStarsOncePerReservation(t *testing.T) {
+	dsn := os.Getenv("RATING_SYSTEM_POSTGRESQL_DSN")
+	if dsn == "" {
+		t.Skip("RATING_SYSTEM_POSTGRESQL_DSN is not set")
+	}
+
+	conn, err := sqlx.Connect("postgres", dsn)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	repo := NewRepository(conn)
+	username := "once-" + uuid.New().String()[:8]
+	reservationUid := uuid.New().String()
+
+	_, err = conn.ExecContext(ctx, "INSERT INTO rating (username, stars) VALUES ($1, 50)", username)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = conn.ExecContext(ctx, "DELETE FROM rating WHERE username = $1", username)
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = repo.ChangeStars(ctx, username, 1, newRatingEvent(ctx, username, "book returned on time", reservationUid))
+		}(i)
+	}
+	wg.Wait()
+
+	applied := 0
+	for _, err := range errs {
+		if err == nil {
+			applied++
+			continue
+		}
+		require.ErrorIs(t, err, errEventRecorded)
+	}
+	require.Equal(t, 1, applied)
+
+	record, err := repo.GetRatingRecord(ctx, username)
+	require.NoError(t, err)
+	require.Equal(t, 51, *record.Stars)
+}
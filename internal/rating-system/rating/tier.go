@@ -0,0 +1,16 @@
+package rating
+
+import "github.com/Erlendum/rsoi-lab-02/internal/rating-system/config"
+
+// findTier returns the tier the stars fall into and the tier above it, tiers are sorted by config.
+func findTier(tiers []config.Tier, stars int) (*config.Tier, *config.Tier) {
+	for i := range tiers {
+		if stars >= tiers[i].MinStars && stars <= tiers[i].MaxStars {
+			if i+1 < len(tiers) {
+				return &tiers[i], &tiers[i+1]
+			}
+			return &tiers[i], nil
+		}
+	}
+	return nil, nil
+}
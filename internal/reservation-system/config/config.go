@@ -16,10 +16,17 @@ type PostgreSQL struct {
 	DSN string `env:"POSTGRESQL_DSN"`
 }
 
+type Fines struct {
+	DailyRate int    `yaml:"daily_rate"`
+	Currency  string `yaml:"currency"`
+}
+
 type Config struct {
-	Server     Server `yaml:"server"`
-	PostgreSQL PostgreSQL
-	JWKURI     string `yaml:"jwks_uri"`
+	Server           Server `yaml:"server"`
+	PostgreSQL       PostgreSQL
+	JWKURI           string `yaml:"jwks_uri"`
+	LibrarySystemURL string `yaml:"library_system_url"`
+	Fines            Fines  `yaml:"fines"`
 }
 
 func New() (*Config, error) {
@@ -0,0 +1,11 @@
+package fine
+
+import "errors"
+
+var (
+	errLoanNotFound      = errors.New("loan not found")
+	errPaymentDeclined   = errors.New("payment declined")
+	errNotPositiveAmount = errors.New("amount must be positive")
+	errAmountExceeded    = errors.New("amount exceeds unpaid fines")
+	errEntryConflict     = errors.New("entry uid is taken by another entry")
+)
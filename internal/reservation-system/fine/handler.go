@@ -0,0 +1,434 @@
+package fine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/internal/reservation-system/config"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	fineType    = "FINE"
+	paymentType = "PAYMENT"
+	waiverType  = "WAIVER"
+
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// library-system serves at most a year of the calendar at once
+	maxCalendarDays = 366
+)
+
+//go:generate mockgen -source=handler.go -destination=handler_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/reservation-system/fine -package=fine
+
+type storage interface {
+	GetLoan(ctx context.Context, reservationUid string) (loan, error)
+	AccrueFine(ctx context.Context, e *entry) (entry, error)
+	PayFine(ctx context.Context, e *entry, charge func(ctx context.Context) (string, error)) (entry, int, error)
+	WaiveFine(ctx context.Context, e *entry) (int, error)
+	GetEntries(ctx context.Context, username string) ([]entry, error)
+	GetBalance(ctx context.Context, username string) (int, error)
+}
+
+type libraryCalendar interface {
+	Calendar(ctx context.Context, libraryUid string, from, to my_time.Date) (*my_time.Calendar, error)
+}
+
+type lendingPolicy interface {
+	GraceDays(ctx context.Context, libraryUid, bookUid string) (int, error)
+}
+
+type paymentProvider interface {
+	Charge(ctx context.Context, username string, amount int, currency string) (string, error)
+}
+
+type handler struct {
+	storage  storage
+	payments paymentProvider
+	calendar libraryCalendar
+	policy   lendingPolicy
+	config   *config.Config
+}
+
+func NewHandler(storage storage, payments paymentProvider, calendar libraryCalendar, policy lendingPolicy, config *config.Config) *handler {
+	return &handler{storage: storage, payments: payments, calendar: calendar, policy: policy, config: config}
+}
+
+func (h *handler) Register(echo *echo.Echo) {
+	api := echo.Group("/api/v1")
+
+	api.Use(auth.Middleware(h.config.JWKURI))
+	api.POST("/fines/accrue", h.AccrueFine, auth.RequireRole(auth.LibrarianRole, auth.AdminRole, auth.ServiceRole))
+	api.GET("/fines/:username", h.GetFines)
+	api.POST("/fines/:username/payments", h.PayFine)
+	api.POST("/fines/:username/waivers", h.WaiveFine, auth.RequireRole(auth.LibrarianRole))
+}
+
+// mayAccess tells whether the caller may see and pay the fines of the reader: the reader, librarians and admins.
+// Other readers are told the fines do not exist.
+func mayAccess(ctx context.Context, username string) bool {
+	return username == auth.GetUser(ctx) || auth.HasRole(ctx, auth.LibrarianRole) || auth.HasRole(ctx, auth.AdminRole)
+}
+
+// daysOverdue counts the business days of the library between the due date and the return date, zero if
+// the book came back in time. Every day counts when library-system cannot tell its calendar.
+func (h *handler) daysOverdue(ctx context.Context, l loan, returnDate my_time.Date) int {
+	if !returnDate.After(*l.TillDate) {
+		return 0
+	}
+
+	to := returnDate
+	if to.Sub(*l.TillDate) > maxCalendarDays {
+		to = l.TillDate.AddDays(maxCalendarDays)
+	}
+
+	calendar, err := h.calendar.Calendar(ctx, *l.LibraryUid, *l.TillDate, to)
+	if err != nil {
+		log.Err(err).Str("libraryUid", *l.LibraryUid).Msg("failed to get library calendar")
+		calendar = my_time.NewCalendar(time.UTC, nil, nil)
+	}
+
+	return calendar.DaysOverdue(*l.TillDate, returnDate)
+}
+
+func (h *handler) AccrueFine(c echo.Context) error {
+	type request struct {
+		ReservationUid string       `json:"reservationUid" validate:"required"`
+		Date           my_time.Date `json:"date" validate:"required"`
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read body",
+		})
+	}
+	req := request{}
+
+	if err = json.Unmarshal(body, &req); err != nil {
+		log.Err(err).Msg("failed to unmarshal body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal body",
+		})
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate body",
+		})
+	}
+
+	l, err := h.storage.GetLoan(c.Request().Context(), req.ReservationUid)
+	if err != nil {
+		log.Err(err).Msg("failed to get loan")
+		if errors.Is(err, errLoanNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "reservation not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get reservation",
+		})
+	}
+
+	type response struct {
+		ReservationUid string `json:"reservationUid"`
+		DaysOverdue    int    `json:"daysOverdue"`
+		Amount         int    `json:"amount"`
+		Currency       string `json:"currency"`
+	}
+
+	days := h.daysOverdue(c.Request().Context(), l, req.Date)
+	if days > 0 {
+		// the grace period of the library is not fined, a policy that cannot be loaded gives none
+		graceDays, err := h.policy.GraceDays(c.Request().Context(), *l.LibraryUid, *l.BookUid)
+		if err != nil {
+			log.Err(err).Str("libraryUid", *l.LibraryUid).Msg("failed to get grace days")
+		}
+		days -= graceDays
+	}
+	if days <= 0 || h.config.Fines.DailyRate <= 0 {
+		return c.JSON(http.StatusOK, response{
+			ReservationUid: req.ReservationUid,
+			Currency:       h.config.Fines.Currency,
+		})
+	}
+
+	entryUid := uuid.New().String()
+	amount := days * h.config.Fines.DailyRate
+	entryType := fineType
+	accrued, err := h.storage.AccrueFine(c.Request().Context(), &entry{
+		EntryUid:       &entryUid,
+		UserName:       l.UserName,
+		ReservationUid: l.ReservationUid,
+		Type:           &entryType,
+		Amount:         &amount,
+		DaysOverdue:    &days,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to accrue fine")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to accrue fine",
+		})
+	}
+
+	return c.JSON(http.StatusOK, response{
+		ReservationUid: req.ReservationUid,
+		DaysOverdue:    *accrued.DaysOverdue,
+		Amount:         *accrued.Amount,
+		Currency:       h.config.Fines.Currency,
+	})
+}
+
+func (h *handler) GetFines(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "username is wrong",
+		})
+	}
+
+	if !mayAccess(c.Request().Context(), username) {
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "fines not found",
+		})
+	}
+
+	balance, err := h.storage.GetBalance(c.Request().Context(), username)
+	if err != nil {
+		log.Err(err).Msg("failed to get fines balance")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get fines",
+		})
+	}
+
+	entries, err := h.storage.GetEntries(c.Request().Context(), username)
+	if err != nil {
+		log.Err(err).Msg("failed to get fines ledger")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get fines",
+		})
+	}
+
+	type item struct {
+		EntryUid       string  `json:"entryUid"`
+		Type           string  `json:"type"`
+		Amount         int     `json:"amount"`
+		ReservationUid *string `json:"reservationUid,omitempty"`
+		DaysOverdue    *int    `json:"daysOverdue,omitempty"`
+		Reason         *string `json:"reason,omitempty"`
+		PaymentID      *string `json:"paymentId,omitempty"`
+		CreatedAt      string  `json:"createdAt"`
+	}
+	type response struct {
+		Balance  int    `json:"balance"`
+		Currency string `json:"currency"`
+		Items    []item `json:"items"`
+	}
+
+	items := make([]item, 0, len(entries))
+	for _, v := range entries {
+		items = append(items, item{
+			EntryUid:       *v.EntryUid,
+			Type:           *v.Type,
+			Amount:         *v.Amount,
+			ReservationUid: v.ReservationUid,
+			DaysOverdue:    v.DaysOverdue,
+			Reason:         v.Reason,
+			PaymentID:      v.PaymentID,
+			CreatedAt:      v.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return c.JSON(http.StatusOK, response{
+		Balance:  balance,
+		Currency: h.config.Fines.Currency,
+		Items:    items,
+	})
+}
+
+// PayFine charges the reader and records the payment. The Idempotency-Key header, a UUID, becomes the uid of the
+// payment entry: a retry with the same key answers with the recorded payment and is not charged again.
+func (h *handler) PayFine(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "username is wrong",
+		})
+	}
+
+	if !mayAccess(c.Request().Context(), username) {
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "fines not found",
+		})
+	}
+
+	entryUid := c.Request().Header.Get(idempotencyKeyHeader)
+	if entryUid == "" {
+		entryUid = uuid.New().String()
+	} else if _, err := uuid.Parse(entryUid); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "idempotency key is wrong",
+		})
+	}
+
+	type request struct {
+		Amount int `json:"amount" validate:"required,gt=0"`
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read body",
+		})
+	}
+	req := request{}
+
+	if err = json.Unmarshal(body, &req); err != nil {
+		log.Err(err).Msg("failed to unmarshal body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal body",
+		})
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate body",
+		})
+	}
+
+	charge := func(ctx context.Context) (string, error) {
+		paymentID, err := h.payments.Charge(ctx, username, req.Amount, h.config.Fines.Currency)
+		if err != nil {
+			return "", errors.Join(errPaymentDeclined, err)
+		}
+		return paymentID, nil
+	}
+
+	entryType := paymentType
+	payment, balance, err := h.storage.PayFine(c.Request().Context(), &entry{
+		EntryUid: &entryUid,
+		UserName: &username,
+		Type:     &entryType,
+		Amount:   &req.Amount,
+	}, charge)
+	if err != nil {
+		log.Err(err).Msg("failed to pay fine")
+		switch {
+		case errors.Is(err, errAmountExceeded):
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "amount exceeds unpaid fines",
+			})
+		case errors.Is(err, errEntryConflict):
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "idempotency key is used by another request",
+			})
+		case errors.Is(err, errPaymentDeclined):
+			return c.JSON(http.StatusPaymentRequired, echo.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to record payment",
+		})
+	}
+
+	type response struct {
+		EntryUid  string `json:"entryUid"`
+		PaymentID string `json:"paymentId"`
+		Amount    int    `json:"amount"`
+		Balance   int    `json:"balance"`
+		Currency  string `json:"currency"`
+	}
+
+	return c.JSON(http.StatusOK, response{
+		EntryUid:  *payment.EntryUid,
+		PaymentID: *payment.PaymentID,
+		Amount:    *payment.Amount,
+		Balance:   balance,
+		Currency:  h.config.Fines.Currency,
+	})
+}
+
+func (h *handler) WaiveFine(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "username is wrong",
+		})
+	}
+
+	type request struct {
+		Amount int    `json:"amount" validate:"required,gt=0"`
+		Reason string `json:"reason" validate:"required,max=255"`
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read body",
+		})
+	}
+	req := request{}
+
+	if err = json.Unmarshal(body, &req); err != nil {
+		log.Err(err).Msg("failed to unmarshal body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal body",
+		})
+	}
+
+	if err = c.Validate(req); err != nil {
+		log.Err(err).Msg("failed to validate body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to validate body",
+		})
+	}
+
+	entryUid := uuid.New().String()
+	entryType := waiverType
+	balance, err := h.storage.WaiveFine(c.Request().Context(), &entry{
+		EntryUid: &entryUid,
+		UserName: &username,
+		Type:     &entryType,
+		Amount:   &req.Amount,
+		Reason:   &req.Reason,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to record waiver")
+		if errors.Is(err, errAmountExceeded) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"message": "amount exceeds unpaid fines",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to record waiver",
+		})
+	}
+
+	type response struct {
+		EntryUid string `json:"entryUid"`
+		Amount   int    `json:"amount"`
+		Balance  int    `json:"balance"`
+		Currency string `json:"currency"`
+	}
+
+	return c.JSON(http.StatusOK, response{
+		EntryUid: entryUid,
+		Amount:   req.Amount,
+		Balance:  balance,
+		Currency: h.config.Fines.Currency,
+	})
+}
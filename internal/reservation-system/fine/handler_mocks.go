@@ -0,0 +1,241 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: handler.go
+
+// Package fine is a generated GoMock package.
+package fine
+
+import (
+	context "context"
+	reflect "reflect"
+
+	time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// Mockstorage is a mock of storage interface.
+type Mockstorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockstorageMockRecorder
+}
+
+// MockstorageMockRecorder is the mock recorder for Mockstorage.
+type MockstorageMockRecorder struct {
+	mock *Mockstorage
+}
+
+// NewMockstorage creates a new mock instance.
+func NewMockstorage(ctrl *gomock.Controller) *Mockstorage {
+	mock := &Mockstorage{ctrl: ctrl}
+	mock.recorder = &MockstorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
+	return m.recorder
+}
+
+// AccrueFine mocks base method.
+func (m *Mockstorage) AccrueFine(ctx context.Context, e *entry) (entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccrueFine", ctx, e)
+	ret0, _ := ret[0].(entry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AccrueFine indicates an expected call of AccrueFine.
+func (mr *MockstorageMockRecorder) AccrueFine(ctx, e interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccrueFine", reflect.TypeOf((*Mockstorage)(nil).AccrueFine), ctx, e)
+}
+
+// GetBalance mocks base method.
+func (m *Mockstorage) GetBalance(ctx context.Context, username string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalance", ctx, username)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalance indicates an expected call of GetBalance.
+func (mr *MockstorageMockRecorder) GetBalance(ctx, username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*Mockstorage)(nil).GetBalance), ctx, username)
+}
+
+// GetEntries mocks base method.
+func (m *Mockstorage) GetEntries(ctx context.Context, username string) ([]entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEntries", ctx, username)
+	ret0, _ := ret[0].([]entry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEntries indicates an expected call of GetEntries.
+func (mr *MockstorageMockRecorder) GetEntries(ctx, username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEntries", reflect.TypeOf((*Mockstorage)(nil).GetEntries), ctx, username)
+}
+
+// GetLoan mocks base method.
+func (m *Mockstorage) GetLoan(ctx context.Context, reservationUid string) (loan, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoan", ctx, reservationUid)
+	ret0, _ := ret[0].(loan)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoan indicates an expected call of GetLoan.
+func (mr *MockstorageMockRecorder) GetLoan(ctx, reservationUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoan", reflect.TypeOf((*Mockstorage)(nil).GetLoan), ctx, reservationUid)
+}
+
+// PayFine mocks base method.
+func (m *Mockstorage) PayFine(ctx context.Context, e *entry, charge func(context.Context) (string, error)) (entry, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PayFine", ctx, e, charge)
+	ret0, _ := ret[0].(entry)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// PayFine indicates an expected call of PayFine.
+func (mr *MockstorageMockRecorder) PayFine(ctx, e, charge interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PayFine", reflect.TypeOf((*Mockstorage)(nil).PayFine), ctx, e, charge)
+}
+
+// WaiveFine mocks base method.
+func (m *Mockstorage) WaiveFine(ctx context.Context, e *entry) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaiveFine", ctx, e)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WaiveFine indicates an expected call of WaiveFine.
+func (mr *MockstorageMockRecorder) WaiveFine(ctx, e interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaiveFine", reflect.TypeOf((*Mockstorage)(nil).WaiveFine), ctx, e)
+}
+
+// MocklibraryCalendar is a mock of libraryCalendar interface.
+type MocklibraryCalendar struct {
+	ctrl     *gomock.Controller
+	recorder *MocklibraryCalendarMockRecorder
+}
+
+// MocklibraryCalendarMockRecorder is the mock recorder for MocklibraryCalendar.
+type MocklibraryCalendarMockRecorder struct {
+	mock *MocklibraryCalendar
+}
+
+// NewMocklibraryCalendar creates a new mock instance.
+func NewMocklibraryCalendar(ctrl *gomock.Controller) *MocklibraryCalendar {
+	mock := &MocklibraryCalendar{ctrl: ctrl}
+	mock.recorder = &MocklibraryCalendarMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MocklibraryCalendar) EXPECT() *MocklibraryCalendarMockRecorder {
+	return m.recorder
+}
+
+// Calendar mocks base method.
+func (m *MocklibraryCalendar) Calendar(ctx context.Context, libraryUid string, from, to time.Date) (*time.Calendar, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Calendar", ctx, libraryUid, from, to)
+	ret0, _ := ret[0].(*time.Calendar)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Calendar indicates an expected call of Calendar.
+func (mr *MocklibraryCalendarMockRecorder) Calendar(ctx, libraryUid, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Calendar", reflect.TypeOf((*MocklibraryCalendar)(nil).Calendar), ctx, libraryUid, from, to)
+}
+
+// MocklendingPolicy is a mock of lendingPolicy interface.
+type MocklendingPolicy struct {
+	ctrl     *gomock.Controller
+	recorder *MocklendingPolicyMockRecorder
+}
+
+// MocklendingPolicyMockRecorder is the mock recorder for MocklendingPolicy.
+type MocklendingPolicyMockRecorder struct {
+	mock *MocklendingPolicy
+}
+
+// NewMocklendingPolicy creates a new mock instance.
+func NewMocklendingPolicy(ctrl *gomock.Controller) *MocklendingPolicy {
+	mock := &MocklendingPolicy{ctrl: ctrl}
+	mock.recorder = &MocklendingPolicyMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MocklendingPolicy) EXPECT() *MocklendingPolicyMockRecorder {
+	return m.recorder
+}
+
+// GraceDays mocks base method.
+func (m *MocklendingPolicy) GraceDays(ctx context.Context, libraryUid, bookUid string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GraceDays", ctx, libraryUid, bookUid)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GraceDays indicates an expected call of GraceDays.
+func (mr *MocklendingPolicyMockRecorder) GraceDays(ctx, libraryUid, bookUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GraceDays", reflect.TypeOf((*MocklendingPolicy)(nil).GraceDays), ctx, libraryUid, bookUid)
+}
+
+// MockpaymentProvider is a mock of paymentProvider interface.
+type MockpaymentProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockpaymentProviderMockRecorder
+}
+
+// MockpaymentProviderMockRecorder is the mock recorder for MockpaymentProvider.
+type MockpaymentProviderMockRecorder struct {
+	mock *MockpaymentProvider
+}
+
+// NewMockpaymentProvider creates a new mock instance.
+func NewMockpaymentProvider(ctrl *gomock.Controller) *MockpaymentProvider {
+	mock := &MockpaymentProvider{ctrl: ctrl}
+	mock.recorder = &MockpaymentProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockpaymentProvider) EXPECT() *MockpaymentProviderMockRecorder {
+	return m.recorder
+}
+
+// Charge mocks base method.
+func (m *MockpaymentProvider) Charge(ctx context.Context, username string, amount int, currency string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Charge", ctx, username, amount, currency)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Charge indicates an expected call of Charge.
+func (mr *MockpaymentProviderMockRecorder) Charge(ctx, username, amount, currency interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Charge", reflect.TypeOf((*MockpaymentProvider)(nil).Charge), ctx, username, amount, currency)
+}
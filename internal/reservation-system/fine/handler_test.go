@@ -0,0 +1,540 @@
+package fine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Erlendum/rsoi-lab-02/internal/reservation-system/config"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type handlerTestFields struct {
+	storage  *Mockstorage
+	payments *MockpaymentProvider
+	calendar *MocklibraryCalendar
+	policy   *MocklendingPolicy
+}
+
+func createHandlerTestFields(ctrl *gomock.Controller) *handlerTestFields {
+	return &handlerTestFields{
+		storage:  NewMockstorage(ctrl),
+		payments: NewMockpaymentProvider(ctrl),
+		calendar: NewMocklibraryCalendar(ctrl),
+		policy:   NewMocklendingPolicy(ctrl),
+	}
+}
+
+func getPointerOnString(s string) *string {
+	return &s
+}
+
+func getPointerOnInt(i int) *int {
+	return &i
+}
+
+func getPointerOnDate(s string) *my_time.Date {
+	d, _ := my_time.NewDate(s)
+	return d
+}
+
+func Test_AccrueFine(t *testing.T) {
+	type fields struct {
+		body                 string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	testLoan := loan{
+		ReservationUid: getPointerOnString("test"),
+		UserName:       getPointerOnString("user"),
+		BookUid:        getPointerOnString("book"),
+		LibraryUid:     getPointerOnString("library"),
+		TillDate:       getPointerOnDate("2024-11-10"),
+	}
+	everyDay := my_time.NewCalendar(time.UTC, nil, nil)
+	weekdaysOnly := my_time.NewCalendar(time.UTC, []time.Weekday{time.Saturday, time.Sunday}, nil)
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong body",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				body:             `{"reservationUid": "test"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: reservation not found",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				body:             `{"reservationUid": "test", "date": "2024-11-15"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(loan{}, errLoanNotFound)
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+				body:             `{"reservationUid": "test", "date": "2024-11-15"}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(testLoan, nil)
+				fields.calendar.EXPECT().Calendar(gomock.Any(), "library", *testLoan.TillDate, gomock.Any()).Return(everyDay, nil)
+				fields.policy.EXPECT().GraceDays(gomock.Any(), "library", "book").Return(0, nil)
+				fields.storage.EXPECT().AccrueFine(gomock.Any(), gomock.Any()).Return(entry{}, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: returned in time",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				body:             `{"reservationUid": "test", "date": "2024-11-10"}`,
+				expectedResponseBody: `{"reservationUid":"test","daysOverdue":0,"amount":0,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(testLoan, nil)
+			},
+		},
+		{
+			name: "http-code 200: fine accrued",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				body:             `{"reservationUid": "test", "date": "2024-11-15"}`,
+				expectedResponseBody: `{"reservationUid":"test","daysOverdue":5,"amount":50,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(testLoan, nil)
+				fields.calendar.EXPECT().Calendar(gomock.Any(), "library", *testLoan.TillDate, gomock.Any()).Return(everyDay, nil)
+				fields.policy.EXPECT().GraceDays(gomock.Any(), "library", "book").Return(0, nil)
+				fields.storage.EXPECT().AccrueFine(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, e *entry) (entry, error) {
+					require.Equal(t, "user", *e.UserName)
+					require.Equal(t, fineType, *e.Type)
+					return entry{Amount: e.Amount, DaysOverdue: e.DaysOverdue}, nil
+				})
+			},
+		},
+		{
+			name: "http-code 200: fine already accrued",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				body:             `{"reservationUid": "test", "date": "2024-11-20"}`,
+				expectedResponseBody: `{"reservationUid":"test","daysOverdue":5,"amount":50,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(testLoan, nil)
+				fields.calendar.EXPECT().Calendar(gomock.Any(), "library", *testLoan.TillDate, gomock.Any()).Return(everyDay, nil)
+				fields.policy.EXPECT().GraceDays(gomock.Any(), "library", "book").Return(0, nil)
+				fields.storage.EXPECT().AccrueFine(gomock.Any(), gomock.Any()).Return(entry{Amount: getPointerOnInt(50), DaysOverdue: getPointerOnInt(5)}, nil)
+			},
+		},
+		{
+			name: "http-code 200: days off are not fined",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				body:             `{"reservationUid": "test", "date": "2024-11-18"}`,
+				expectedResponseBody: `{"reservationUid":"test","daysOverdue":5,"amount":50,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(testLoan, nil)
+				fields.calendar.EXPECT().Calendar(gomock.Any(), "library", *testLoan.TillDate, gomock.Any()).Return(weekdaysOnly, nil)
+				fields.policy.EXPECT().GraceDays(gomock.Any(), "library", "book").Return(0, nil)
+				fields.storage.EXPECT().AccrueFine(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, e *entry) (entry, error) {
+					return entry{Amount: e.Amount, DaysOverdue: e.DaysOverdue}, nil
+				})
+			},
+		},
+		{
+			name: "http-code 200: grace period is not fined",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				body:             `{"reservationUid": "test", "date": "2024-11-15"}`,
+				expectedResponseBody: `{"reservationUid":"test","daysOverdue":3,"amount":30,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(testLoan, nil)
+				fields.calendar.EXPECT().Calendar(gomock.Any(), "library", *testLoan.TillDate, gomock.Any()).Return(everyDay, nil)
+				fields.policy.EXPECT().GraceDays(gomock.Any(), "library", "book").Return(2, nil)
+				fields.storage.EXPECT().AccrueFine(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, e *entry) (entry, error) {
+					return entry{Amount: e.Amount, DaysOverdue: e.DaysOverdue}, nil
+				})
+			},
+		},
+		{
+			name: "http-code 200: returned within grace period",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				body:             `{"reservationUid": "test", "date": "2024-11-12"}`,
+				expectedResponseBody: `{"reservationUid":"test","daysOverdue":0,"amount":0,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(testLoan, nil)
+				fields.calendar.EXPECT().Calendar(gomock.Any(), "library", *testLoan.TillDate, gomock.Any()).Return(everyDay, nil)
+				fields.policy.EXPECT().GraceDays(gomock.Any(), "library", "book").Return(2, nil)
+			},
+		},
+		{
+			name: "http-code 200: every day counts without calendar",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				body:             `{"reservationUid": "test", "date": "2024-11-12"}`,
+				expectedResponseBody: `{"reservationUid":"test","daysOverdue":2,"amount":20,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetLoan(gomock.Any(), "test").Return(testLoan, nil)
+				fields.calendar.EXPECT().Calendar(gomock.Any(), "library", *testLoan.TillDate, gomock.Any()).Return(nil, errors.New(""))
+				fields.policy.EXPECT().GraceDays(gomock.Any(), "library", "book").Return(0, nil)
+				fields.storage.EXPECT().AccrueFine(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, e *entry) (entry, error) {
+					return entry{Amount: e.Amount, DaysOverdue: e.DaysOverdue}, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, payments: testFields.payments, calendar: testFields.calendar, policy: testFields.policy, config: &config.Config{Fines: config.Fines{DailyRate: 10, Currency: "RUB"}}}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.AccrueFine(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_PayFine(t *testing.T) {
+	type fields struct {
+		username             string
+		caller               string
+		roles                []string
+		idempotencyKey       string
+		body                 string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	// charged runs the charge the handler passes like the storage does and answers with the recorded payment
+	charged := func(balance int) func(ctx context.Context, e *entry, charge func(ctx context.Context) (string, error)) (entry, int, error) {
+		return func(ctx context.Context, e *entry, charge func(ctx context.Context) (string, error)) (entry, int, error) {
+			paymentID, err := charge(ctx)
+			if err != nil {
+				return entry{}, 0, err
+			}
+			return entry{EntryUid: e.EntryUid, Amount: e.Amount, PaymentID: &paymentID}, balance - *e.Amount, nil
+		}
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong amount",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				username:         "test",
+				body:             `{"amount": -5}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 400: wrong idempotency key",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				username:         "test",
+				idempotencyKey:   "retry",
+				body:             `{"amount": 50}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 404: fines of another reader",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+				username:         "test",
+				caller:           "other",
+				body:             `{"amount": 50}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 400: amount exceeds balance",
+			fields: fields{
+				expectedHTTPCode: http.StatusBadRequest,
+				username:         "test",
+				body:             `{"amount": 100}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().PayFine(gomock.Any(), gomock.Any(), gomock.Any()).Return(entry{}, 0, errAmountExceeded)
+			},
+		},
+		{
+			name: "http-code 409: idempotency key of another payment",
+			fields: fields{
+				expectedHTTPCode: http.StatusConflict,
+				username:         "test",
+				idempotencyKey:   "5f0fa5ab-07d4-4f5c-9c43-6c1d2e9a0b11",
+				body:             `{"amount": 50}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().PayFine(gomock.Any(), gomock.Any(), gomock.Any()).Return(entry{}, 0, errEntryConflict)
+			},
+		},
+		{
+			name: "http-code 402: payment declined",
+			fields: fields{
+				expectedHTTPCode: http.StatusPaymentRequired,
+				username:         "test",
+				body:             `{"amount": 50}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().PayFine(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(charged(50))
+				fields.payments.EXPECT().Charge(gomock.Any(), "test", 50, "RUB").Return("", errors.New(""))
+			},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				expectedHTTPCode: http.StatusInternalServerError,
+				username:         "test",
+				body:             `{"amount": 50}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().PayFine(gomock.Any(), gomock.Any(), gomock.Any()).Return(entry{}, 0, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: success",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				idempotencyKey:   "5f0fa5ab-07d4-4f5c-9c43-6c1d2e9a0b11",
+				body:             `{"amount": 30}`,
+				expectedResponseBody: `{"entryUid":"5f0fa5ab-07d4-4f5c-9c43-6c1d2e9a0b11","paymentId":"payment","amount":30,"balance":20,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().PayFine(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(charged(50))
+				fields.payments.EXPECT().Charge(gomock.Any(), "test", 30, "RUB").Return("payment", nil)
+			},
+		},
+		{
+			name: "http-code 200: retried payment is not charged again",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				idempotencyKey:   "5f0fa5ab-07d4-4f5c-9c43-6c1d2e9a0b11",
+				body:             `{"amount": 30}`,
+				expectedResponseBody: `{"entryUid":"5f0fa5ab-07d4-4f5c-9c43-6c1d2e9a0b11","paymentId":"payment","amount":30,"balance":20,"currency":"RUB"}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().PayFine(gomock.Any(), gomock.Any(), gomock.Any()).Return(entry{
+					EntryUid:  getPointerOnString("5f0fa5ab-07d4-4f5c-9c43-6c1d2e9a0b11"),
+					Amount:    getPointerOnInt(30),
+					PaymentID: getPointerOnString("payment"),
+				}, 20, nil)
+			},
+		},
+		{
+			name: "http-code 200: librarian pays for the reader",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				username:         "test",
+				caller:           "librarian",
+				roles:            []string{auth.LibrarianRole},
+				body:             `{"amount": 50}`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().PayFine(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(charged(50))
+				fields.payments.EXPECT().Charge(gomock.Any(), "test", 50, "RUB").Return("payment", nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, payments: testFields.payments, config: &config.Config{Fines: config.Fines{DailyRate: 10, Currency: "RUB"}}}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			if tt.fields.idempotencyKey != "" {
+				req.Header.Set(idempotencyKeyHeader, tt.fields.idempotencyKey)
+			}
+			caller := tt.fields.caller
+			if caller == "" {
+				caller = tt.fields.username
+			}
+			req = req.WithContext(auth.SetRoles(auth.SetUser(req.Context(), caller), tt.fields.roles))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues(tt.fields.username)
+
+			err := h.PayFine(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedResponseBody != "" {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.fields.expectedResponseBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_WaiveFine(t *testing.T) {
+	type fields struct {
+		body             string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: no reason",
+			fields: fields{
+				body:             `{"amount": 10}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+			},
+		},
+		{
+			name: "http-code 400: amount exceeds unpaid fines",
+			fields: fields{
+				body:             `{"amount": 60, "reason": "library was closed"}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().WaiveFine(gomock.Any(), gomock.Any()).Return(0, errAmountExceeded)
+			},
+		},
+		{
+			name: "http-code 200: waived",
+			fields: fields{
+				body:             `{"amount": 30, "reason": "library was closed"}`,
+				expectedHTTPCode: http.StatusOK,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().WaiveFine(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, e *entry) (int, error) {
+					require.Equal(t, "test", *e.UserName)
+					require.Equal(t, waiverType, *e.Type)
+					require.Equal(t, 30, *e.Amount)
+					require.Equal(t, "library was closed", *e.Reason)
+					return 20, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, config: &config.Config{Fines: config.Fines{DailyRate: 10, Currency: "RUB"}}}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.body))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues("test")
+
+			err := h.WaiveFine(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				body, err := io.ReadAll(rec.Result().Body)
+				require.NoError(t, err)
+				require.Contains(t, string(body), `"amount":30,"balance":20,"currency":"RUB"`)
+			}
+		})
+	}
+}
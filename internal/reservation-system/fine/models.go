@@ -0,0 +1,27 @@
+package fine
+
+import (
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"time"
+)
+
+type entry struct {
+	ID             *int       `db:"id"`
+	EntryUid       *string    `db:"entry_uid"`
+	UserName       *string    `db:"username"`
+	ReservationUid *string    `db:"reservation_uid"`
+	Type           *string    `db:"entry_type"`
+	Amount         *int       `db:"amount"`
+	DaysOverdue    *int       `db:"days_overdue"`
+	Reason         *string    `db:"reason"`
+	PaymentID      *string    `db:"payment_id"`
+	CreatedAt      *time.Time `db:"created_at"`
+}
+
+type loan struct {
+	ReservationUid *string
+	UserName       *string
+	BookUid        *string
+	LibraryUid     *string
+	TillDate       *my_time.Date
+}
@@ -0,0 +1,260 @@
+package fine
+
+import (
+	"context"
+	"database/sql"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+)
+
+type repository struct {
+	conn *sqlx.DB
+}
+
+func NewRepository(conn *sqlx.DB) *repository {
+	return &repository{conn: conn}
+}
+
+func (r *repository) GetLoan(ctx context.Context, reservationUid string) (loan, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	builder := psql.Select("reservation_uid", "username", "book_uid", "library_uid", "till_date").From("reservation").Where(sq.Eq{"reservation_uid": reservationUid})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return loan{}, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := loan{}
+
+	var tillDate string
+	err = r.conn.QueryRowContext(ctx, query, args...).Scan(&res.ReservationUid, &res.UserName, &res.BookUid, &res.LibraryUid, &tillDate)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return loan{}, errLoanNotFound
+		}
+		return loan{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	res.TillDate, err = my_time.NewDate(tillDate)
+	if err != nil {
+		return loan{}, errors.Wrap(err, "failed to parse till date")
+	}
+
+	return res, nil
+}
+
+// AccrueFine records a fine once per reservation, repeated calls return the fine stored first.
+func (r *repository) AccrueFine(ctx context.Context, e *entry) (entry, error) {
+	accrueFineQuery := `
+	WITH inserted AS (
+		INSERT INTO fine_ledger
+			(entry_uid, username, reservation_uid, entry_type, amount, days_overdue)
+				VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (reservation_uid) WHERE entry_type = 'FINE' DO NOTHING
+			RETURNING amount, days_overdue
+	)
+	SELECT amount, days_overdue FROM inserted
+	UNION ALL
+	SELECT amount, days_overdue FROM fine_ledger WHERE reservation_uid = $3 AND entry_type = 'FINE'
+	LIMIT 1;`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := entry{}
+	err := r.conn.QueryRowContext(ctx, accrueFineQuery, *e.EntryUid, *e.UserName, *e.ReservationUid, *e.Type, *e.Amount, *e.DaysOverdue).
+		Scan(&res.Amount, &res.DaysOverdue)
+	if err != nil {
+		return entry{}, errors.Wrap(err, "failed to execute query")
+	}
+
+	return res, nil
+}
+
+const (
+	// lockLedgerQuery serializes the payments and waivers of one reader until the transaction ends.
+	lockLedgerQuery    = `SELECT pg_advisory_xact_lock(hashtext('fine_ledger'), hashtext($1));`
+	ledgerBalanceQuery = `
+SELECT COALESCE(SUM(CASE WHEN entry_type = 'FINE' THEN amount ELSE -amount END), 0)
+FROM fine_ledger
+WHERE username = $1;
+`
+)
+
+// PayFine records the payment under a lock on the ledger of the reader, so concurrent payments cannot pay more
+// than the unpaid fines. The entry is written before the charge and gets its payment id in the same transaction,
+// a declined charge leaves nothing behind. A retry with the uid of a recorded payment returns it without charging
+// again. The returned balance is what stays unpaid.
+func (r *repository) PayFine(ctx context.Context, e *entry, charge func(ctx context.Context) (string, error)) (entry, int, error) {
+	recordedQuery := `
+SELECT id, entry_uid, username, reservation_uid, entry_type, amount, days_overdue, reason, payment_id, created_at
+FROM fine_ledger
+WHERE entry_uid = $1;
+`
+	insertQuery := `
+INSERT INTO fine_ledger (entry_uid, username, entry_type, amount)
+VALUES ($1, $2, $3, $4)
+RETURNING id, entry_uid, username, reservation_uid, entry_type, amount, days_overdue, reason, payment_id, created_at;
+`
+	paymentQuery := `UPDATE fine_ledger SET payment_id = $2 WHERE id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return entry{}, 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, lockLedgerQuery, *e.UserName)
+	if err != nil {
+		return entry{}, 0, errors.Wrap(err, "failed to lock ledger")
+	}
+
+	var balance int
+	err = tx.GetContext(ctx, &balance, ledgerBalanceQuery, *e.UserName)
+	if err != nil {
+		return entry{}, 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	res := entry{}
+	err = tx.GetContext(ctx, &res, recordedQuery, *e.EntryUid)
+	if err == nil {
+		if *res.UserName != *e.UserName || *res.Type != *e.Type || *res.Amount != *e.Amount {
+			return entry{}, 0, errEntryConflict
+		}
+		return res, balance, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return entry{}, 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	if *e.Amount > balance {
+		return entry{}, 0, errAmountExceeded
+	}
+
+	err = tx.GetContext(ctx, &res, insertQuery, *e.EntryUid, *e.UserName, *e.Type, *e.Amount)
+	if err != nil {
+		return entry{}, 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	paymentID, err := charge(ctx)
+	if err != nil {
+		return entry{}, 0, err
+	}
+	res.PaymentID = &paymentID
+
+	_, err = tx.ExecContext(ctx, paymentQuery, *res.ID, paymentID)
+	if err != nil {
+		return entry{}, 0, errors.Wrapf(err, "failed to record payment %s", paymentID)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return entry{}, 0, errors.Wrapf(err, "failed to commit payment %s", paymentID)
+	}
+
+	return res, balance - *e.Amount, nil
+}
+
+// WaiveFine records the waiver under the lock PayFine takes, so concurrent waivers and payments cannot take
+// off more than the unpaid fines. The returned balance is what stays unpaid.
+func (r *repository) WaiveFine(ctx context.Context, e *entry) (int, error) {
+	insertQuery := `
+INSERT INTO fine_ledger (entry_uid, username, entry_type, amount, reason)
+VALUES ($1, $2, $3, $4, $5);
+`
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, lockLedgerQuery, *e.UserName)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to lock ledger")
+	}
+
+	var balance int
+	err = tx.GetContext(ctx, &balance, ledgerBalanceQuery, *e.UserName)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	if *e.Amount > balance {
+		return 0, errAmountExceeded
+	}
+
+	_, err = tx.ExecContext(ctx, insertQuery, *e.EntryUid, *e.UserName, *e.Type, *e.Amount, e.Reason)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	return balance - *e.Amount, errors.Wrap(tx.Commit(), "failed to commit waiver")
+}
+
+func (r *repository) GetEntries(ctx context.Context, username string) ([]entry, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	builder := psql.Select("id", "entry_uid", "username", "reservation_uid", "entry_type", "amount", "days_overdue", "reason", "payment_id", "created_at").
+		From("fine_ledger").
+		Where(sq.Eq{"username": username}).
+		OrderBy("created_at", "id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	entries := make([]entry, 0)
+	err = r.conn.SelectContext(ctx, &entries, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute query")
+	}
+
+	return entries, nil
+}
+
+// GetBalance returns the unpaid amount: fines minus payments and waivers.
+func (r *repository) GetBalance(ctx context.Context, username string) (int, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	builder := psql.Select("COALESCE(SUM(CASE WHEN entry_type = 'FINE' THEN amount ELSE -amount END), 0)").
+		From("fine_ledger").
+		Where(sq.Eq{"username": username})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var balance int
+	err = r.conn.GetContext(ctx, &balance, query, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	return balance, nil
+}
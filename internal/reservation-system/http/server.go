@@ -17,18 +17,33 @@ type reservationHandler interface {
 	GetReservationByUid(c echo.Context) error
 	CreateReservation(c echo.Context) error
 	UpdateReservationStatus(c echo.Context) error
+	SetReservationCopy(c echo.Context) error
+	RenewReservation(c echo.Context) error
+	GetReservationsByStatus(c echo.Context) error
+	GetAvailability(c echo.Context) error
+	GetReservationHistory(c echo.Context) error
+}
+
+type fineHandler interface {
+	Register(echo *echo.Echo)
+	AccrueFine(c echo.Context) error
+	GetFines(c echo.Context) error
+	PayFine(c echo.Context) error
+	WaiveFine(c echo.Context) error
 }
 
 type server struct {
 	echo               *echo.Echo
 	cfg                *config.Server
 	reservationHandler reservationHandler
+	fineHandler        fineHandler
 }
 
-func NewServer(cfg *config.Server, reservationHandler reservationHandler) *server {
+func NewServer(cfg *config.Server, reservationHandler reservationHandler, fineHandler fineHandler) *server {
 	return &server{
 		echo:               echo.New(),
 		reservationHandler: reservationHandler,
+		fineHandler:        fineHandler,
 		cfg:                cfg,
 	}
 }
@@ -53,6 +68,7 @@ func (s *server) Init() error {
 	})
 
 	s.reservationHandler.Register(s.echo)
+	s.fineHandler.Register(s.echo)
 	return nil
 }
 
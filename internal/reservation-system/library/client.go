@@ -0,0 +1,154 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+)
+
+var errNotFound = errors.New("not found in library service")
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client asks library-system about libraries, their books and opening days on behalf of the caller.
+type Client struct {
+	httpClient       httpClient
+	librarySystemURL string
+}
+
+func NewClient(librarySystemURL string) *Client {
+	return &Client{
+		httpClient:       &http.Client{Timeout: defaultTimeout},
+		librarySystemURL: librarySystemURL,
+	}
+}
+
+// Calendar returns the business days of the library between from and to.
+func (c *Client) Calendar(ctx context.Context, libraryUid string, from, to my_time.Date) (*my_time.Calendar, error) {
+	reqURL := c.librarySystemURL + "/libraries/" + url.PathEscape(libraryUid) + "/calendar?from=" + from.String() + "&to=" + to.String()
+
+	res := &my_time.Calendar{}
+	err := c.get(ctx, reqURL, res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// NextOpenDay returns the date itself when the library is open that day and the next open day otherwise.
+func (c *Client) NextOpenDay(ctx context.Context, libraryUid string, date my_time.Date) (my_time.Date, error) {
+	reqURL := c.librarySystemURL + "/libraries/" + url.PathEscape(libraryUid) + "/next-open-day?date=" + date.String()
+
+	res := struct {
+		OpenDate my_time.Date `json:"openDate"`
+	}{}
+	err := c.get(ctx, reqURL, &res)
+	if err != nil {
+		return my_time.Date{}, err
+	}
+
+	return res.OpenDate, nil
+}
+
+// LibraryExists tells whether library-system knows the library.
+func (c *Client) LibraryExists(ctx context.Context, libraryUid string) (bool, error) {
+	return c.exists(ctx, c.librarySystemURL+"/libraries/by-uids?"+url.Values{"libraryUids": {libraryUid}}.Encode())
+}
+
+// BookExists tells whether library-system knows the book.
+func (c *Client) BookExists(ctx context.Context, bookUid string) (bool, error) {
+	return c.exists(ctx, c.librarySystemURL+"/books/?"+url.Values{"bookUids": {bookUid}}.Encode())
+}
+
+// Stock returns how many copies of the book the library lends, a library that does not hold the book has none.
+func (c *Client) Stock(ctx context.Context, libraryUid, bookUid string) (int, error) {
+	reqURL := c.librarySystemURL + "/libraries/" + url.PathEscape(libraryUid) + "/books/" + url.PathEscape(bookUid) + "/stock"
+
+	res := struct {
+		StockCount int `json:"stockCount"`
+	}{}
+	err := c.get(ctx, reqURL, &res)
+	if errors.Is(err, errNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return res.StockCount, nil
+}
+
+// GraceDays returns the grace period the lending policy of the library gives for the book, none without a policy.
+func (c *Client) GraceDays(ctx context.Context, libraryUid, bookUid string) (int, error) {
+	reqURL := c.librarySystemURL + "/libraries/" + url.PathEscape(libraryUid) + "/books/" + url.PathEscape(bookUid) + "/policy"
+
+	res := struct {
+		GraceDays *int `json:"graceDays"`
+	}{}
+	err := c.get(ctx, reqURL, &res)
+	if errors.Is(err, errNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if res.GraceDays == nil {
+		return 0, nil
+	}
+	return *res.GraceDays, nil
+}
+
+// exists treats 404 as a missing entity, any other failure is an error.
+func (c *Client) exists(ctx context.Context, reqURL string) (bool, error) {
+	err := c.get(ctx, reqURL, &struct{}{})
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *Client) get(ctx context.Context, reqURL string, res any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+auth.GetToken(ctx))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", errNotFound, body)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("library service responded %d: %s", resp.StatusCode, body)
+	}
+
+	return json.Unmarshal(body, res)
+}
@@ -3,7 +3,9 @@ package manager
 import (
 	"context"
 	"github.com/Erlendum/rsoi-lab-02/internal/reservation-system/config"
+	"github.com/Erlendum/rsoi-lab-02/internal/reservation-system/fine"
 	"github.com/Erlendum/rsoi-lab-02/internal/reservation-system/http"
+	"github.com/Erlendum/rsoi-lab-02/internal/reservation-system/library"
 	"github.com/Erlendum/rsoi-lab-02/internal/reservation-system/reservation"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
@@ -47,9 +49,15 @@ func (r *root) Register(ctx context.Context) error {
 
 	reservationRepo := reservation.NewRepository(psqldb)
 
-	reservationHandler := reservation.NewHandler(reservationRepo, r.cfg)
+	libraryClient := library.NewClient(r.cfg.LibrarySystemURL)
 
-	r.server = http.NewServer(&r.cfg.Server, reservationHandler)
+	reservationHandler := reservation.NewHandler(reservationRepo, libraryClient, libraryClient, r.cfg)
+
+	fineRepo := fine.NewRepository(psqldb)
+
+	fineHandler := fine.NewHandler(fineRepo, fine.NewLocalPaymentProvider(), libraryClient, libraryClient, r.cfg)
+
+	r.server = http.NewServer(&r.cfg.Server, reservationHandler, fineHandler)
 
 	err = r.server.Init()
 	if err != nil {
@@ -3,5 +3,7 @@ package reservation
 import "errors"
 
 var (
-	errNotFound = errors.New("reservation not found")
+	errNotFound           = errors.New("reservation not found")
+	errLibraryUnavailable = errors.New("library service unavailable")
+	errNoCopyFree         = errors.New("no copy is free")
 )
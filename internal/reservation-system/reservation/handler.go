@@ -4,47 +4,118 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/Erlendum/rsoi-lab-02/internal/reservation-system/config"
 	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
 	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
+	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var (
-	rentedStatus = "RENTED"
+	rentedStatus   = "RENTED"
+	bookedStatus   = "BOOKED"
+	returnedStatus = "RETURNED"
+	expiredStatus  = "EXPIRED"
+	canceledStatus = "CANCELED"
 )
 
+// statuses are all the states a reservation goes through.
+var statuses = map[string]bool{
+	"BOOKED":   true,
+	"RENTED":   true,
+	"RETURNED": true,
+	"EXPIRED":  true,
+	"CANCELED": true,
+}
+
+// transitions lists the statuses a reservation may move to from each status, closed reservations stay closed.
+// A rented reservation is canceled when its copy could not be lent.
+var transitions = map[string]map[string]bool{
+	bookedStatus: {rentedStatus: true, canceledStatus: true},
+	rentedStatus: {returnedStatus: true, expiredStatus: true, canceledStatus: true},
+}
+
+// closingStatuses are set by staff and services only: closing a loan returns the copy, counts the stock and
+// fines a late return, which a reader must not skip.
+var closingStatuses = map[string]bool{
+	returnedStatus: true,
+	expiredStatus:  true,
+	canceledStatus: true,
+}
+
+// maxReservationDays is how far after today a due date may be.
+const maxReservationDays = 366
+
+// availabilityDays is how many days the availability calendar shows when no end is asked for.
+const availabilityDays = 30
+
 //go:generate mockgen -source=handler.go -destination=handler_mocks.go -self_package=github.com/Erlendum/rsoi-lab-02/internal/reservation-system/reservation -package=reservation
 
 type storage interface {
-	CreateReservation(ctx context.Context, r *reservation) (int, error)
-	UpdateReservationStatus(ctx context.Context, uid string, username string, status string) error
+	CreateReservation(ctx context.Context, r *reservation, check func(ctx context.Context) error) (int, error)
+	UpdateReservationStatus(ctx context.Context, uid string, from string, to string) error
 	GetReservation(ctx context.Context, uid string) (reservation, error)
 	GetReservations(ctx context.Context, username string, status string) ([]reservation, error)
+	SetReservationCopy(ctx context.Context, uid string, barcode string) error
+	RenewReservation(ctx context.Context, uid string, tillDate my_time.Date) error
+	GetHoldingReservations(ctx context.Context, libraryUid, bookUid string, from, to my_time.Date) ([]reservation, error)
+	GetReservationHistory(ctx context.Context, username string, f historyFilter, offset, limit int) ([]reservation, int, error)
+}
+
+type libraryCalendar interface {
+	NextOpenDay(ctx context.Context, libraryUid string, date my_time.Date) (my_time.Date, error)
+}
+
+type libraryCatalog interface {
+	LibraryExists(ctx context.Context, libraryUid string) (bool, error)
+	BookExists(ctx context.Context, bookUid string) (bool, error)
+	Stock(ctx context.Context, libraryUid, bookUid string) (int, error)
 }
 
 type handler struct {
-	storage storage
-	config  *config.Config
+	storage  storage
+	calendar libraryCalendar
+	catalog  libraryCatalog
+	config   *config.Config
 }
 
-func NewHandler(storage storage, config *config.Config) *handler {
-	return &handler{storage: storage, config: config}
+func NewHandler(storage storage, calendar libraryCalendar, catalog libraryCatalog, config *config.Config) *handler {
+	return &handler{storage: storage, calendar: calendar, catalog: catalog, config: config}
 }
 
 func (h *handler) Register(echo *echo.Echo) {
 	api := echo.Group("/api/v1")
 
 	api.Use(auth.Middleware(h.config.JWKURI))
+	api.GET("/reservations", h.GetReservationsByStatus, auth.RequireRole(auth.LibrarianRole, auth.AdminRole, auth.ServiceRole))
 	api.GET("/reservations/by-user/:username", h.GetReservations)
+	api.GET("/reservations/by-user/:username/history", h.GetReservationHistory)
+	api.GET("/reservations/availability", h.GetAvailability)
 	api.GET("/reservations/:uid", h.GetReservationByUid)
 	api.POST("/reservations/", h.CreateReservation)
 	api.PUT("/reservations/:uid/status", h.UpdateReservationStatus)
+	api.PUT("/reservations/:uid/copy", h.SetReservationCopy, auth.RequireRole(auth.LibrarianRole, auth.AdminRole, auth.ServiceRole))
+	api.POST("/reservations/:uid/renew", h.RenewReservation, auth.RequireRole(auth.LibrarianRole, auth.AdminRole, auth.ServiceRole))
+}
+
+// isStaff tells whether the caller works with the reservations of every reader: librarians, admins and
+// other services acting on their own behalf.
+func isStaff(ctx context.Context) bool {
+	return auth.HasRole(ctx, auth.LibrarianRole) || auth.HasRole(ctx, auth.AdminRole) || auth.HasRole(ctx, auth.ServiceRole)
+}
+
+// mayAccess tells whether the caller may see the reservations of the reader. Other readers are told they
+// do not exist, so reservation uids and usernames cannot be probed.
+func mayAccess(ctx context.Context, username string) bool {
+	return username == auth.GetUser(ctx) || isStaff(ctx)
 }
 
 func (h *handler) GetReservations(c echo.Context) error {
@@ -55,6 +126,12 @@ func (h *handler) GetReservations(c echo.Context) error {
 		})
 	}
 
+	if !mayAccess(c.Request().Context(), username) {
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "reservations not found",
+		})
+	}
+
 	status := c.QueryParam("status")
 	if status == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{
@@ -73,12 +150,14 @@ func (h *handler) GetReservations(c echo.Context) error {
 	}
 
 	type response struct {
-		ReservationUid string `json:"reservationUid"`
-		Status         string `json:"status"`
-		StartDate      string `json:"startDate"`
-		TillDate       string `json:"tillDate"`
-		BookUid        string `json:"bookUid"`
-		LibraryUid     string `json:"libraryUid"`
+		ReservationUid string  `json:"reservationUid"`
+		Status         string  `json:"status"`
+		StartDate      string  `json:"startDate"`
+		TillDate       string  `json:"tillDate"`
+		BookUid        string  `json:"bookUid"`
+		LibraryUid     string  `json:"libraryUid"`
+		CopyBarcode    *string `json:"copyBarcode,omitempty"`
+		Renewals       int     `json:"renewals"`
 	}
 
 	res := make([]response, 0, len(r))
@@ -90,6 +169,194 @@ func (h *handler) GetReservations(c echo.Context) error {
 			TillDate:       v.TillDate.String(),
 			BookUid:        *v.BookUid,
 			LibraryUid:     *v.LibraryUid,
+			CopyBarcode:    v.CopyBarcode,
+			Renewals:       *v.Renewals,
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// parseHistoryFilter reads the filter of the history: statuses as a comma separated list or repeated, the start
+// date range, the library and the sort key, descending when prefixed with a minus and the newest first by default.
+func parseHistoryFilter(c echo.Context) (historyFilter, []validation.FieldError) {
+	f := historyFilter{Sort: "startDate", Desc: true}
+	fieldErrors := make([]validation.FieldError, 0)
+
+	wrongStatus := false
+	for _, param := range c.QueryParams()["status"] {
+		for _, status := range strings.Split(param, ",") {
+			if status = strings.TrimSpace(status); status == "" {
+				continue
+			}
+			wrongStatus = wrongStatus || !statuses[status]
+			f.Statuses = append(f.Statuses, status)
+		}
+	}
+	if wrongStatus {
+		fieldErrors = append(fieldErrors, validation.FieldError{Field: "status", Message: "must be one of BOOKED RENTED RETURNED EXPIRED CANCELED"})
+	}
+
+	parseDate := func(field string) *my_time.Date {
+		value := c.QueryParam(field)
+		if value == "" {
+			return nil
+		}
+		date, err := my_time.NewDate(value)
+		if err != nil {
+			fieldErrors = append(fieldErrors, validation.FieldError{Field: field, Message: "must be a date in YYYY-MM-DD format"})
+			return nil
+		}
+		return date
+	}
+	f.From = parseDate("from")
+	f.To = parseDate("to")
+	if f.From != nil && f.To != nil && f.To.Before(*f.From) {
+		fieldErrors = append(fieldErrors, validation.FieldError{Field: "to", Message: "must not be before " + f.From.String()})
+	}
+
+	if f.LibraryUid = c.QueryParam("libraryUid"); f.LibraryUid != "" {
+		if _, err := uuid.Parse(f.LibraryUid); err != nil {
+			fieldErrors = append(fieldErrors, validation.FieldError{Field: "libraryUid", Message: "must be a UUID"})
+		}
+	}
+
+	if sort := c.QueryParam("sort"); sort != "" {
+		f.Desc = strings.HasPrefix(sort, "-")
+		f.Sort = strings.TrimPrefix(sort, "-")
+		if _, ok := historySortColumns[f.Sort]; !ok {
+			fieldErrors = append(fieldErrors, validation.FieldError{Field: "sort", Message: "must be one of startDate tillDate status, prefixed with - to sort descending"})
+		}
+	}
+
+	return f, fieldErrors
+}
+
+// GetReservationHistory returns a page of all reservations of the reader, closed ones included.
+func (h *handler) GetReservationHistory(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "username is wrong",
+		})
+	}
+
+	if !mayAccess(c.Request().Context(), username) {
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "reservations not found",
+		})
+	}
+
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "page is wrong",
+		})
+	}
+
+	size, err := strconv.Atoi(c.QueryParam("size"))
+	if err != nil || size <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "size is wrong",
+		})
+	}
+
+	f, fieldErrors := parseHistoryFilter(c)
+	if len(fieldErrors) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "request is invalid",
+			"errors":  fieldErrors,
+		})
+	}
+
+	r, total, err := h.storage.GetReservationHistory(c.Request().Context(), username, f, page*size-size, size)
+	if err != nil {
+		log.Err(err).Msg("failed to get reservation history")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get reservation history",
+		})
+	}
+
+	type item struct {
+		ReservationUid string  `json:"reservationUid"`
+		Status         string  `json:"status"`
+		StartDate      string  `json:"startDate"`
+		TillDate       string  `json:"tillDate"`
+		BookUid        string  `json:"bookUid"`
+		LibraryUid     string  `json:"libraryUid"`
+		CopyBarcode    *string `json:"copyBarcode,omitempty"`
+		Renewals       int     `json:"renewals"`
+	}
+	type response struct {
+		Page          int    `json:"page"`
+		PageSize      int    `json:"pageSize"`
+		TotalElements int    `json:"totalElements"`
+		Items         []item `json:"items"`
+	}
+
+	items := make([]item, 0, len(r))
+	for _, v := range r {
+		items = append(items, item{
+			ReservationUid: *v.ReservationUid,
+			Status:         *v.Status,
+			StartDate:      v.StartDate.String(),
+			TillDate:       v.TillDate.String(),
+			BookUid:        *v.BookUid,
+			LibraryUid:     *v.LibraryUid,
+			CopyBarcode:    v.CopyBarcode,
+			Renewals:       *v.Renewals,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response{
+		Page:          page,
+		PageSize:      size,
+		TotalElements: total,
+		Items:         items,
+	})
+}
+
+// GetReservationsByStatus lists the reservations of all readers, it is meant for staff and service jobs.
+func (h *handler) GetReservationsByStatus(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "status is wrong",
+		})
+	}
+
+	r, err := h.storage.GetReservations(c.Request().Context(), "", status)
+	if err != nil {
+		log.Err(err).Msg("failed to get reservations")
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get reservations",
+		})
+	}
+
+	type response struct {
+		ReservationUid string  `json:"reservationUid"`
+		UserName       string  `json:"username"`
+		Status         string  `json:"status"`
+		StartDate      string  `json:"startDate"`
+		TillDate       string  `json:"tillDate"`
+		BookUid        string  `json:"bookUid"`
+		LibraryUid     string  `json:"libraryUid"`
+		CopyBarcode    *string `json:"copyBarcode,omitempty"`
+		Renewals       int     `json:"renewals"`
+	}
+
+	res := make([]response, 0, len(r))
+	for _, v := range r {
+		res = append(res, response{
+			ReservationUid: *v.ReservationUid,
+			UserName:       *v.UserName,
+			Status:         *v.Status,
+			StartDate:      v.StartDate.String(),
+			TillDate:       v.TillDate.String(),
+			BookUid:        *v.BookUid,
+			LibraryUid:     *v.LibraryUid,
+			CopyBarcode:    v.CopyBarcode,
+			Renewals:       *v.Renewals,
 		})
 	}
 
@@ -118,25 +385,154 @@ func (h *handler) GetReservationByUid(c echo.Context) error {
 		})
 	}
 
+	if !mayAccess(c.Request().Context(), *r.UserName) {
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "reservation not found",
+		})
+	}
+
 	type response struct {
-		ReservationUid string `json:"reservationUid"`
-		Status         string `json:"status"`
-		StartDate      string `json:"startDate"`
-		TillDate       string `json:"tillDate"`
-		BookUid        string `json:"bookUid"`
-		LibraryUid     string `json:"libraryUid"`
+		ReservationUid string  `json:"reservationUid"`
+		UserName       string  `json:"username"`
+		Status         string  `json:"status"`
+		StartDate      string  `json:"startDate"`
+		TillDate       string  `json:"tillDate"`
+		BookUid        string  `json:"bookUid"`
+		LibraryUid     string  `json:"libraryUid"`
+		CopyBarcode    *string `json:"copyBarcode,omitempty"`
+		Renewals       int     `json:"renewals"`
 	}
 
 	return c.JSON(http.StatusOK, response{
 		ReservationUid: *r.ReservationUid,
+		UserName:       *r.UserName,
 		Status:         *r.Status,
 		StartDate:      r.StartDate.String(),
 		TillDate:       r.TillDate.String(),
 		BookUid:        *r.BookUid,
 		LibraryUid:     *r.LibraryUid,
+		CopyBarcode:    r.CopyBarcode,
+		Renewals:       *r.Renewals,
 	})
 }
 
+// dueDate moves the date to the next day the library is open. The reservation keeps the requested date
+// when library-system cannot tell, a closed day is a smaller problem than a failed checkout.
+func (h *handler) dueDate(ctx context.Context, libraryUid string, date my_time.Date) my_time.Date {
+	openDate, err := h.calendar.NextOpenDay(ctx, libraryUid, date)
+	if err != nil {
+		log.Err(err).Str("libraryUid", libraryUid).Msg("failed to get next open day")
+		return date
+	}
+
+	return openDate
+}
+
+// checkExists asks library-system for the library and the book of a new reservation, each missing one is a field error.
+func (h *handler) checkExists(ctx context.Context, libraryUid, bookUid string) ([]validation.FieldError, error) {
+	fieldErrors := make([]validation.FieldError, 0)
+
+	ok, err := h.catalog.LibraryExists(ctx, libraryUid)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		fieldErrors = append(fieldErrors, validation.FieldError{Field: "libraryUid", Message: "library not found"})
+	}
+
+	ok, err = h.catalog.BookExists(ctx, bookUid)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		fieldErrors = append(fieldErrors, validation.FieldError{Field: "bookUid", Message: "book not found"})
+	}
+
+	return fieldErrors, nil
+}
+
+// getAvailability counts the copies of the book the library has free on every day between from and to.
+func (h *handler) getAvailability(ctx context.Context, libraryUid, bookUid string, from, to my_time.Date) (int, []dayAvailability, error) {
+	stock, err := h.catalog.Stock(ctx, libraryUid, bookUid)
+	if err != nil {
+		return 0, nil, errors.Join(errLibraryUnavailable, err)
+	}
+
+	holding, err := h.storage.GetHoldingReservations(ctx, libraryUid, bookUid, from, to)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return stock, availability(stock, holding, from, to, my_time.Today(time.UTC)), nil
+}
+
+// GetAvailability shows on which days the library has a copy of the book free: its stock less the loans and
+// bookings holding one that day. The calendar starts today and spans a month unless asked otherwise.
+func (h *handler) GetAvailability(c echo.Context) error {
+	libraryUid := c.QueryParam("libraryUid")
+	bookUid := c.QueryParam("bookUid")
+
+	fieldErrors := make([]validation.FieldError, 0)
+	if _, err := uuid.Parse(libraryUid); err != nil {
+		fieldErrors = append(fieldErrors, validation.FieldError{Field: "libraryUid", Message: "must be a UUID"})
+	}
+	if _, err := uuid.Parse(bookUid); err != nil {
+		fieldErrors = append(fieldErrors, validation.FieldError{Field: "bookUid", Message: "must be a UUID"})
+	}
+
+	today := my_time.Today(time.UTC)
+	from, dateErr := validation.DateFrom("from", c.QueryParam("from"), today, maxReservationDays)
+	if dateErr != nil {
+		fieldErrors = append(fieldErrors, *dateErr)
+	}
+	to := from.AddDays(availabilityDays)
+	if dateErr == nil && c.QueryParam("to") != "" {
+		to, dateErr = validation.DateFrom("to", c.QueryParam("to"), from, maxReservationDays)
+		if dateErr != nil {
+			fieldErrors = append(fieldErrors, *dateErr)
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "request is invalid",
+			"errors":  fieldErrors,
+		})
+	}
+
+	stock, days, err := h.getAvailability(c.Request().Context(), libraryUid, bookUid, from, to)
+	if err != nil {
+		log.Err(err).Msg("failed to get availability")
+		if errors.Is(err, errLibraryUnavailable) {
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{
+				"message": "library service unavailable",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get availability",
+		})
+	}
+
+	type response struct {
+		LibraryUid    string            `json:"libraryUid"`
+		BookUid       string            `json:"bookUid"`
+		StockCount    int               `json:"stockCount"`
+		AvailableFrom *my_time.Date     `json:"availableFrom"`
+		Days          []dayAvailability `json:"days"`
+	}
+
+	return c.JSON(http.StatusOK, response{
+		LibraryUid:    libraryUid,
+		BookUid:       bookUid,
+		StockCount:    stock,
+		AvailableFrom: firstAvailable(days),
+		Days:          days,
+	})
+}
+
+// CreateReservation validates the request field by field: uids must be UUIDs of a library and a book known to
+// library-system, the start date must fall within a year from today, today when it is left out, and the due date
+// within a year after the start. A reservation starting later is a booking, it holds a copy from its start date.
+// Either is made only when a copy is free on every day from the start to the due date.
 func (h *handler) CreateReservation(c echo.Context) error {
 	username := auth.GetUser(c.Request().Context())
 	if username == "" {
@@ -146,9 +542,10 @@ func (h *handler) CreateReservation(c echo.Context) error {
 	}
 
 	type request struct {
-		BookUid    string       `json:"bookUid" validate:"required"`
-		LibraryUid string       `json:"libraryUid" validate:"required"`
-		TillDate   my_time.Date `json:"tillDate" validate:"required"`
+		BookUid    string `json:"bookUid" validate:"required,uuid"`
+		LibraryUid string `json:"libraryUid" validate:"required,uuid"`
+		StartDate  string `json:"startDate"`
+		TillDate   string `json:"tillDate"`
 	}
 
 	body, err := io.ReadAll(c.Request().Body)
@@ -167,20 +564,81 @@ func (h *handler) CreateReservation(c echo.Context) error {
 		})
 	}
 
-	now := my_time.Date(time.Now())
+	now := my_time.Today(time.UTC)
+	fieldErrors := validation.FieldErrors(c.Validate(req))
+	var requestedDate my_time.Date
+	startDate, dateErr := validation.DateFrom("startDate", req.StartDate, now, maxReservationDays)
+	if dateErr == nil {
+		requestedDate, dateErr = validation.DateWindow("tillDate", req.TillDate, startDate, maxReservationDays)
+	}
+	if dateErr != nil {
+		fieldErrors = append(fieldErrors, *dateErr)
+	}
+	if len(fieldErrors) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "request is invalid",
+			"errors":  fieldErrors,
+		})
+	}
+
+	fieldErrors, err = h.checkExists(c.Request().Context(), req.LibraryUid, req.BookUid)
+	if err != nil {
+		log.Err(err).Msg("failed to check library and book")
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{
+			"message": "library service unavailable",
+		})
+	}
+	if len(fieldErrors) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "request is invalid",
+			"errors":  fieldErrors,
+		})
+	}
+
+	tillDate := h.dueDate(c.Request().Context(), req.LibraryUid, requestedDate)
+
+	// the available copy is looked up under the same lock as the reservation is inserted
+	check := func(ctx context.Context) error {
+		_, days, err := h.getAvailability(ctx, req.LibraryUid, req.BookUid, startDate, tillDate)
+		if err != nil {
+			return err
+		}
+		for _, d := range days {
+			if d.Available == 0 {
+				return fmt.Errorf("%w on %s", errNoCopyFree, d.Date)
+			}
+		}
+		return nil
+	}
+
+	status := rentedStatus
+	if startDate.After(now) {
+		status = bookedStatus
+	}
+
 	reservationUid := uuid.New().String()
 	_, err = h.storage.CreateReservation(c.Request().Context(), &reservation{
 		BookUid:        &req.BookUid,
 		ReservationUid: &reservationUid,
 		LibraryUid:     &req.LibraryUid,
-		TillDate:       &req.TillDate,
-		StartDate:      &now,
+		TillDate:       &tillDate,
+		StartDate:      &startDate,
 		UserName:       &username,
-		Status:         &rentedStatus,
-	})
+		Status:         &status,
+	}, check)
 
 	if err != nil {
 		log.Err(err).Msg("failed to create reservation")
+		switch {
+		case errors.Is(err, errNoCopyFree):
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": err.Error(),
+			})
+		case errors.Is(err, errLibraryUnavailable):
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{
+				"message": "library service unavailable",
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{
 			"message": "failed to create reservation",
 		})
@@ -197,29 +655,82 @@ func (h *handler) CreateReservation(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, response{
 		ReservationUid: reservationUid,
-		Status:         rentedStatus,
-		StartDate:      now.String(),
-		TillDate:       req.TillDate.String(),
+		Status:         status,
+		StartDate:      startDate.String(),
+		TillDate:       tillDate.String(),
 		BookUid:        req.BookUid,
 		LibraryUid:     req.LibraryUid,
 	})
 }
 
+// UpdateReservationStatus moves the reservation to the status when the transition is allowed. Readers may only
+// pick up their own bookings, closing statuses are set by staff and services.
 func (h *handler) UpdateReservationStatus(c echo.Context) error {
-	username := auth.GetUser(c.Request().Context())
-	if username == "" {
+	status := c.QueryParam("status")
+	if !statuses[status] {
 		return c.JSON(http.StatusBadRequest, echo.Map{
-			"message": "username is wrong",
+			"message": "status is wrong",
 		})
 	}
 
-	status := c.QueryParam("status")
-	if status == "" {
+	uid := c.Param("uid")
+	if uid == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{
-			"message": "status is wrong",
+			"message": "uid is wrong",
+		})
+	}
+
+	r, err := h.storage.GetReservation(c.Request().Context(), uid)
+	if err != nil {
+		log.Err(err).Msg("failed to get reservation")
+		if errors.Is(err, errNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "reservation not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to update reservation status",
+		})
+	}
+
+	if !mayAccess(c.Request().Context(), *r.UserName) {
+		return c.JSON(http.StatusNotFound, echo.Map{
+			"message": "reservation not found",
 		})
 	}
 
+	if closingStatuses[status] && !isStaff(c.Request().Context()) {
+		return c.JSON(http.StatusForbidden, echo.Map{
+			"message": "only staff can close reservations",
+		})
+	}
+
+	if !transitions[*r.Status][status] {
+		return c.JSON(http.StatusConflict, echo.Map{
+			"message": "reservation can not move from " + *r.Status + " to " + status,
+		})
+	}
+
+	err = h.storage.UpdateReservationStatus(c.Request().Context(), uid, *r.Status, status)
+	if err != nil {
+		log.Err(err).Msg("failed to update reservation status")
+		// the status changed after it was read, the transition was checked against the old one
+		if errors.Is(err, errNotFound) {
+			return c.JSON(http.StatusConflict, echo.Map{
+				"message": "reservation status has changed",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to update reservation status",
+		})
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// SetReservationCopy records the copy lent for a reservation. Only staff and services set it, after the copy
+// is checked out in library-system.
+func (h *handler) SetReservationCopy(c echo.Context) error {
 	uid := c.Param("uid")
 	if uid == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{
@@ -227,18 +738,136 @@ func (h *handler) UpdateReservationStatus(c echo.Context) error {
 		})
 	}
 
-	err := h.storage.UpdateReservationStatus(c.Request().Context(), uid, username, status)
+	type request struct {
+		CopyBarcode string `json:"copyBarcode"`
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		log.Err(err).Msg("failed to update reservation status")
+		log.Err(err).Msg("failed to read body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read body",
+		})
+	}
+	req := &request{}
+
+	if err = json.Unmarshal(body, &req); err != nil {
+		log.Err(err).Msg("failed to unmarshal body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal body",
+		})
+	}
+
+	if req.CopyBarcode == "" || len(req.CopyBarcode) > 32 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "copyBarcode is wrong",
+		})
+	}
+
+	err = h.storage.SetReservationCopy(c.Request().Context(), uid, req.CopyBarcode)
+	if err != nil {
+		log.Err(err).Msg("failed to set reservation copy")
 		if errors.Is(err, errNotFound) {
 			return c.JSON(http.StatusNotFound, echo.Map{
 				"message": "reservation not found",
 			})
 		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"message": "failed to update reservation status",
+			"message": "failed to set reservation copy",
 		})
 	}
 
 	return c.NoContent(http.StatusOK)
 }
+
+// RenewReservation moves the due date of a rented reservation further, to the next open day of the library
+// when the requested one is closed. Only staff and services renew: the tier and lending policy limits of a
+// reader are checked by the gateway, which renews for the reader with its own token.
+func (h *handler) RenewReservation(c echo.Context) error {
+	uid := c.Param("uid")
+	if uid == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "uid is wrong",
+		})
+	}
+
+	type request struct {
+		TillDate my_time.Date `json:"tillDate"`
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Err(err).Msg("failed to read body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to read body",
+		})
+	}
+	req := &request{}
+
+	if err = json.Unmarshal(body, &req); err != nil {
+		log.Err(err).Msg("failed to unmarshal body")
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "failed to unmarshal body",
+		})
+	}
+
+	r, err := h.storage.GetReservation(c.Request().Context(), uid)
+	if err != nil {
+		log.Err(err).Msg("failed to get reservation")
+		if errors.Is(err, errNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "reservation not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to get reservation",
+		})
+	}
+
+	if *r.Status != rentedStatus {
+		return c.JSON(http.StatusConflict, echo.Map{
+			"message": "only rented reservations can be renewed",
+		})
+	}
+
+	if !time.Time(req.TillDate).After(time.Time(*r.TillDate)) {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"message": "tillDate must be after " + r.TillDate.String(),
+		})
+	}
+
+	tillDate := h.dueDate(c.Request().Context(), *r.LibraryUid, req.TillDate)
+
+	err = h.storage.RenewReservation(c.Request().Context(), uid, tillDate)
+	if err != nil {
+		log.Err(err).Msg("failed to renew reservation")
+		if errors.Is(err, errNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{
+				"message": "reservation not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"message": "failed to renew reservation",
+		})
+	}
+
+	type response struct {
+		ReservationUid string `json:"reservationUid"`
+		Status         string `json:"status"`
+		StartDate      string `json:"startDate"`
+		TillDate       string `json:"tillDate"`
+		BookUid        string `json:"bookUid"`
+		LibraryUid     string `json:"libraryUid"`
+		Renewals       int    `json:"renewals"`
+	}
+
+	return c.JSON(http.StatusOK, response{
+		ReservationUid: uid,
+		Status:         *r.Status,
+		StartDate:      r.StartDate.String(),
+		TillDate:       tillDate.String(),
+		BookUid:        *r.BookUid,
+		LibraryUid:     *r.LibraryUid,
+		Renewals:       *r.Renewals + 1,
+	})
+}
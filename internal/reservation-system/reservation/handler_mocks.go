@@ -8,6 +8,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	time "github.com/Erlendum/rsoi-lab-02/pkg/time"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -35,18 +36,33 @@ func (m *Mockstorage) EXPECT() *MockstorageMockRecorder {
 }
 
 // CreateReservation mocks base method.
-func (m *Mockstorage) CreateReservation(ctx context.Context, r *reservation) (int, error) {
+func (m *Mockstorage) CreateReservation(ctx context.Context, r *reservation, check func(context.Context) error) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateReservation", ctx, r)
+	ret := m.ctrl.Call(m, "CreateReservation", ctx, r, check)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateReservation indicates an expected call of CreateReservation.
-func (mr *MockstorageMockRecorder) CreateReservation(ctx, r interface{}) *gomock.Call {
+func (mr *MockstorageMockRecorder) CreateReservation(ctx, r, check interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReservation", reflect.TypeOf((*Mockstorage)(nil).CreateReservation), ctx, r)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReservation", reflect.TypeOf((*Mockstorage)(nil).CreateReservation), ctx, r, check)
+}
+
+// GetHoldingReservations mocks base method.
+func (m *Mockstorage) GetHoldingReservations(ctx context.Context, libraryUid, bookUid string, from, to time.Date) ([]reservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHoldingReservations", ctx, libraryUid, bookUid, from, to)
+	ret0, _ := ret[0].([]reservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHoldingReservations indicates an expected call of GetHoldingReservations.
+func (mr *MockstorageMockRecorder) GetHoldingReservations(ctx, libraryUid, bookUid, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHoldingReservations", reflect.TypeOf((*Mockstorage)(nil).GetHoldingReservations), ctx, libraryUid, bookUid, from, to)
 }
 
 // GetReservation mocks base method.
@@ -64,6 +80,22 @@ func (mr *MockstorageMockRecorder) GetReservation(ctx, uid interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReservation", reflect.TypeOf((*Mockstorage)(nil).GetReservation), ctx, uid)
 }
 
+// GetReservationHistory mocks base method.
+func (m *Mockstorage) GetReservationHistory(ctx context.Context, username string, f historyFilter, offset, limit int) ([]reservation, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReservationHistory", ctx, username, f, offset, limit)
+	ret0, _ := ret[0].([]reservation)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetReservationHistory indicates an expected call of GetReservationHistory.
+func (mr *MockstorageMockRecorder) GetReservationHistory(ctx, username, f, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReservationHistory", reflect.TypeOf((*Mockstorage)(nil).GetReservationHistory), ctx, username, f, offset, limit)
+}
+
 // GetReservations mocks base method.
 func (m *Mockstorage) GetReservations(ctx context.Context, username, status string) ([]reservation, error) {
 	m.ctrl.T.Helper()
@@ -79,16 +111,150 @@ func (mr *MockstorageMockRecorder) GetReservations(ctx, username, status interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReservations", reflect.TypeOf((*Mockstorage)(nil).GetReservations), ctx, username, status)
 }
 
+// RenewReservation mocks base method.
+func (m *Mockstorage) RenewReservation(ctx context.Context, uid string, tillDate time.Date) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewReservation", ctx, uid, tillDate)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenewReservation indicates an expected call of RenewReservation.
+func (mr *MockstorageMockRecorder) RenewReservation(ctx, uid, tillDate interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewReservation", reflect.TypeOf((*Mockstorage)(nil).RenewReservation), ctx, uid, tillDate)
+}
+
+// SetReservationCopy mocks base method.
+func (m *Mockstorage) SetReservationCopy(ctx context.Context, uid, barcode string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetReservationCopy", ctx, uid, barcode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetReservationCopy indicates an expected call of SetReservationCopy.
+func (mr *MockstorageMockRecorder) SetReservationCopy(ctx, uid, barcode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReservationCopy", reflect.TypeOf((*Mockstorage)(nil).SetReservationCopy), ctx, uid, barcode)
+}
+
 // UpdateReservationStatus mocks base method.
-func (m *Mockstorage) UpdateReservationStatus(ctx context.Context, uid, username, status string) error {
+func (m *Mockstorage) UpdateReservationStatus(ctx context.Context, uid, from, to string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateReservationStatus", ctx, uid, username, status)
+	ret := m.ctrl.Call(m, "UpdateReservationStatus", ctx, uid, from, to)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateReservationStatus indicates an expected call of UpdateReservationStatus.
-func (mr *MockstorageMockRecorder) UpdateReservationStatus(ctx, uid, username, status interface{}) *gomock.Call {
+func (mr *MockstorageMockRecorder) UpdateReservationStatus(ctx, uid, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateReservationStatus", reflect.TypeOf((*Mockstorage)(nil).UpdateReservationStatus), ctx, uid, from, to)
+}
+
+// MocklibraryCalendar is a mock of libraryCalendar interface.
+type MocklibraryCalendar struct {
+	ctrl     *gomock.Controller
+	recorder *MocklibraryCalendarMockRecorder
+}
+
+// MocklibraryCalendarMockRecorder is the mock recorder for MocklibraryCalendar.
+type MocklibraryCalendarMockRecorder struct {
+	mock *MocklibraryCalendar
+}
+
+// NewMocklibraryCalendar creates a new mock instance.
+func NewMocklibraryCalendar(ctrl *gomock.Controller) *MocklibraryCalendar {
+	mock := &MocklibraryCalendar{ctrl: ctrl}
+	mock.recorder = &MocklibraryCalendarMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MocklibraryCalendar) EXPECT() *MocklibraryCalendarMockRecorder {
+	return m.recorder
+}
+
+// NextOpenDay mocks base method.
+func (m *MocklibraryCalendar) NextOpenDay(ctx context.Context, libraryUid string, date time.Date) (time.Date, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NextOpenDay", ctx, libraryUid, date)
+	ret0, _ := ret[0].(time.Date)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextOpenDay indicates an expected call of NextOpenDay.
+func (mr *MocklibraryCalendarMockRecorder) NextOpenDay(ctx, libraryUid, date interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NextOpenDay", reflect.TypeOf((*MocklibraryCalendar)(nil).NextOpenDay), ctx, libraryUid, date)
+}
+
+// MocklibraryCatalog is a mock of libraryCatalog interface.
+type MocklibraryCatalog struct {
+	ctrl     *gomock.Controller
+	recorder *MocklibraryCatalogMockRecorder
+}
+
+// MocklibraryCatalogMockRecorder is the mock recorder for MocklibraryCatalog.
+type MocklibraryCatalogMockRecorder struct {
+	mock *MocklibraryCatalog
+}
+
+// NewMocklibraryCatalog creates a new mock instance.
+func NewMocklibraryCatalog(ctrl *gomock.Controller) *MocklibraryCatalog {
+	mock := &MocklibraryCatalog{ctrl: ctrl}
+	mock.recorder = &MocklibraryCatalogMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MocklibraryCatalog) EXPECT() *MocklibraryCatalogMockRecorder {
+	return m.recorder
+}
+
+// BookExists mocks base method.
+func (m *MocklibraryCatalog) BookExists(ctx context.Context, bookUid string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BookExists", ctx, bookUid)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BookExists indicates an expected call of BookExists.
+func (mr *MocklibraryCatalogMockRecorder) BookExists(ctx, bookUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BookExists", reflect.TypeOf((*MocklibraryCatalog)(nil).BookExists), ctx, bookUid)
+}
+
+// LibraryExists mocks base method.
+func (m *MocklibraryCatalog) LibraryExists(ctx context.Context, libraryUid string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LibraryExists", ctx, libraryUid)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LibraryExists indicates an expected call of LibraryExists.
+func (mr *MocklibraryCatalogMockRecorder) LibraryExists(ctx, libraryUid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LibraryExists", reflect.TypeOf((*MocklibraryCatalog)(nil).LibraryExists), ctx, libraryUid)
+}
+
+// Stock mocks base method.
+func (m *MocklibraryCatalog) Stock(ctx context.Context, libraryUid, bookUid string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stock", ctx, libraryUid, bookUid)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stock indicates an expected call of Stock.
+func (mr *MocklibraryCatalogMockRecorder) Stock(ctx, libraryUid, bookUid interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateReservationStatus", reflect.TypeOf((*Mockstorage)(nil).UpdateReservationStatus), ctx, uid, username, status)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stock", reflect.TypeOf((*MocklibraryCatalog)(nil).Stock), ctx, libraryUid, bookUid)
 }
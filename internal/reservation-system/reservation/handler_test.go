@@ -1,8 +1,11 @@
 package reservation
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"github.com/Erlendum/rsoi-lab-02/pkg/auth"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
 	"github.com/Erlendum/rsoi-lab-02/pkg/validation"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang/mock/gomock"
@@ -11,107 +14,167 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type handlerTestFields struct {
-	storage *Mockstorage
+	storage  *Mockstorage
+	calendar *MocklibraryCalendar
+	catalog  *MocklibraryCatalog
 }
 
 func createHandlerTestFields(ctrl *gomock.Controller) *handlerTestFields {
 	return &handlerTestFields{
-		storage: NewMockstorage(ctrl),
+		storage:  NewMockstorage(ctrl),
+		calendar: NewMocklibraryCalendar(ctrl),
+		catalog:  NewMocklibraryCatalog(ctrl),
 	}
 }
 
 func Test_UpdateReservationStatus(t *testing.T) {
 	type fields struct {
 		status           string
-		username         string
-		reservationUid   string
+		caller           string
+		roles            []string
+		current          string
 		expectedHTTPCode int
 	}
 
 	e := echo.New()
 	e.Validator = validation.MustRegisterCustomValidator(validator.New())
 
+	withStatus := func(status string) reservation {
+		r := ownedReservation("uid", "test")
+		r.Status = &status
+		return r
+	}
+
 	tests := []struct {
 		name    string
 		fields  fields
 		Prepare func(fields *handlerTestFields)
 	}{
 		{
-			name: "http-code 400: wrong status",
+			name: "http-code 400: unknown status",
 			fields: fields{
+				status:           "LOST",
 				expectedHTTPCode: http.StatusBadRequest,
-				username:         "test",
-				status:           "",
-				reservationUid:   "test",
 			},
 
 			Prepare: func(fields *handlerTestFields) {
 			},
 		},
 		{
-			name: "http-code 400: wrong username",
+			name: "http-code 404: not found error",
 			fields: fields{
-				expectedHTTPCode: http.StatusBadRequest,
-				username:         "",
-				status:           "test",
-				reservationUid:   "test",
+				status:           rentedStatus,
+				expectedHTTPCode: http.StatusNotFound,
 			},
 
 			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(reservation{}, errNotFound)
 			},
 		},
 		{
-			name: "http-code 400: wrong reservationUid",
+			name: "http-code 404: reservation of another reader",
 			fields: fields{
-				expectedHTTPCode: http.StatusBadRequest,
-				username:         "",
-				status:           "test",
-				reservationUid:   "",
+				status:           rentedStatus,
+				caller:           "other",
+				expectedHTTPCode: http.StatusNotFound,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(withStatus(bookedStatus), nil)
+			},
+		},
+		{
+			name: "http-code 403: reader returns their own loan",
+			fields: fields{
+				status:           returnedStatus,
+				expectedHTTPCode: http.StatusForbidden,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(withStatus(rentedStatus), nil)
+			},
+		},
+		{
+			name: "http-code 409: returned reservation is rented again",
+			fields: fields{
+				status:           rentedStatus,
+				caller:           "librarian",
+				roles:            []string{auth.LibrarianRole},
+				expectedHTTPCode: http.StatusConflict,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(withStatus(returnedStatus), nil)
+			},
+		},
+		{
+			name: "http-code 409: status changed concurrently",
+			fields: fields{
+				status:           expiredStatus,
+				caller:           "gateway",
+				roles:            []string{auth.ServiceRole},
+				expectedHTTPCode: http.StatusConflict,
 			},
 
 			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(withStatus(rentedStatus), nil)
+				fields.storage.EXPECT().UpdateReservationStatus(gomock.Any(), "uid", rentedStatus, expiredStatus).Return(errNotFound)
 			},
 		},
 		{
 			name: "http-code 500: storage error",
 			fields: fields{
+				status:           rentedStatus,
 				expectedHTTPCode: http.StatusInternalServerError,
-				username:         "test",
-				status:           "test",
-				reservationUid:   "test",
 			},
 
 			Prepare: func(fields *handlerTestFields) {
-				fields.storage.EXPECT().UpdateReservationStatus(gomock.Any(), "test", "test", "test").Return(errors.New(""))
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(withStatus(bookedStatus), nil)
+				fields.storage.EXPECT().UpdateReservationStatus(gomock.Any(), "uid", bookedStatus, rentedStatus).Return(errors.New(""))
 			},
 		},
 		{
-			name: "http-code 404: not found error",
+			name: "http-code 200: reader picks up their booking",
 			fields: fields{
-				expectedHTTPCode: http.StatusNotFound,
-				username:         "test",
-				status:           "test",
-				reservationUid:   "test",
+				status:           rentedStatus,
+				expectedHTTPCode: http.StatusOK,
 			},
 
 			Prepare: func(fields *handlerTestFields) {
-				fields.storage.EXPECT().UpdateReservationStatus(gomock.Any(), "test", "test", "test").Return(errNotFound)
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(withStatus(bookedStatus), nil)
+				fields.storage.EXPECT().UpdateReservationStatus(gomock.Any(), "uid", bookedStatus, rentedStatus).Return(nil)
 			},
 		},
 		{
-			name: "http-code 200: success",
+			name: "http-code 200: service cancels a booking",
 			fields: fields{
+				status:           canceledStatus,
+				caller:           "gateway",
+				roles:            []string{auth.ServiceRole},
 				expectedHTTPCode: http.StatusOK,
-				username:         "test",
-				status:           "test",
-				reservationUid:   "test",
 			},
 
 			Prepare: func(fields *handlerTestFields) {
-				fields.storage.EXPECT().UpdateReservationStatus(gomock.Any(), "test", "test", "test").Return(nil)
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(withStatus(bookedStatus), nil)
+				fields.storage.EXPECT().UpdateReservationStatus(gomock.Any(), "uid", bookedStatus, canceledStatus).Return(nil)
+			},
+		},
+		{
+			name: "http-code 200: service cancels a loan whose copy was not lent",
+			fields: fields{
+				status:           canceledStatus,
+				caller:           "gateway",
+				roles:            []string{auth.ServiceRole},
+				expectedHTTPCode: http.StatusOK,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(withStatus(rentedStatus), nil)
+				fields.storage.EXPECT().UpdateReservationStatus(gomock.Any(), "uid", rentedStatus, canceledStatus).Return(nil)
 			},
 		},
 	}
@@ -129,11 +192,863 @@ func Test_UpdateReservationStatus(t *testing.T) {
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 			c.SetParamNames("uid")
-			c.SetParamValues(tt.fields.reservationUid)
+			c.SetParamValues("uid")
+			c.SetRequest(c.Request().WithContext(callerContext(c, tt.fields.caller, tt.fields.roles)))
+
+			err := h.UpdateReservationStatus(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_RenewReservation(t *testing.T) {
+	type fields struct {
+		username             string
+		roles                []string
+		requestBody          string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+
+	date := func(year int, month time.Month, day int) *my_time.Date {
+		d := my_time.Date(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+		return &d
+	}
+	rented := func() reservation {
+		uid, username, bookUid, libraryUid, renewals := "test", "owner", "book", "library", 1
+		return reservation{
+			ReservationUid: &uid,
+			UserName:       &username,
+			BookUid:        &bookUid,
+			LibraryUid:     &libraryUid,
+			Status:         &rentedStatus,
+			StartDate:      date(2024, 12, 1),
+			TillDate:       date(2024, 12, 20),
+			Renewals:       &renewals,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 409: returned reservation",
+			fields: fields{
+				username:         "gateway",
+				roles:            []string{auth.ServiceRole},
+				requestBody:      `{"tillDate":"2024-12-31"}`,
+				expectedHTTPCode: http.StatusConflict,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				returned := rented()
+				status := "RETURNED"
+				returned.Status = &status
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "test").Return(returned, nil)
+			},
+		},
+		{
+			name: "http-code 400: till date is not later",
+			fields: fields{
+				username:         "gateway",
+				roles:            []string{auth.ServiceRole},
+				requestBody:      `{"tillDate":"2024-12-20"}`,
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "test").Return(rented(), nil)
+			},
+		},
+		{
+			name: "http-code 200: holiday moves to the next open day",
+			fields: fields{
+				username:         "gateway",
+				roles:            []string{auth.ServiceRole},
+				requestBody:      `{"tillDate":"2024-12-31"}`,
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"reservationUid":"test","status":"RENTED","startDate":"2024-12-01","tillDate":"2025-01-02","bookUid":"book","libraryUid":"library","renewals":2}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "test").Return(rented(), nil)
+				fields.calendar.EXPECT().NextOpenDay(gomock.Any(), "library", *date(2024, 12, 31)).Return(*date(2025, 1, 2), nil)
+				fields.storage.EXPECT().RenewReservation(gomock.Any(), "test", *date(2025, 1, 2)).Return(nil)
+			},
+		},
+		{
+			name: "http-code 200: librarian renews, calendar unavailable",
+			fields: fields{
+				username:         "librarian",
+				roles:            []string{auth.LibrarianRole},
+				requestBody:      `{"tillDate":"2024-12-31"}`,
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"reservationUid":"test","status":"RENTED","startDate":"2024-12-01","tillDate":"2024-12-31","bookUid":"book","libraryUid":"library","renewals":2}
+`,
+			},
+
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "test").Return(rented(), nil)
+				fields.calendar.EXPECT().NextOpenDay(gomock.Any(), "library", *date(2024, 12, 31)).Return(my_time.Date{}, errors.New(""))
+				fields.storage.EXPECT().RenewReservation(gomock.Any(), "test", *date(2024, 12, 31)).Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, calendar: testFields.calendar}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.requestBody))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("uid")
+			c.SetParamValues("test")
 			ctx := auth.SetUser(c.Request().Context(), tt.fields.username)
+			ctx = auth.SetRoles(ctx, tt.fields.roles)
 			c.SetRequest(c.Request().WithContext(ctx))
 
-			err := h.UpdateReservationStatus(c)
+			err := h.RenewReservation(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedHTTPCode == http.StatusOK {
+				require.Equal(t, tt.fields.expectedResponseBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_CreateReservation(t *testing.T) {
+	const (
+		bookUid    = "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+		libraryUid = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+	)
+
+	type fields struct {
+		requestBody          string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+	e.Validator = validation.MustRegisterCustomValidator(validator.New())
+
+	today := my_time.Today(time.UTC)
+	tillDate := today.AddDays(14)
+	body := func(bookUid, libraryUid, tillDate string) string {
+		return `{"bookUid":"` + bookUid + `","libraryUid":"` + libraryUid + `","tillDate":"` + tillDate + `"}`
+	}
+	bookingBody := func(startDate, tillDate string) string {
+		return `{"bookUid":"` + bookUid + `","libraryUid":"` + libraryUid + `","startDate":"` + startDate + `","tillDate":"` + tillDate + `"}`
+	}
+	startDate := today.AddDays(7)
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: every field is wrong",
+			fields: fields{
+				requestBody:      body("book", "", today.String()),
+				expectedHTTPCode: http.StatusBadRequest,
+				expectedResponseBody: `{"errors":[` +
+					`{"field":"bookUid","message":"must be a UUID"},` +
+					`{"field":"libraryUid","message":"is required"},` +
+					`{"field":"tillDate","message":"must be after ` + today.String() + `"}` +
+					`],"message":"request is invalid"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 400: till date too far",
+			fields: fields{
+				requestBody:      body(bookUid, libraryUid, today.AddDays(maxReservationDays+1).String()),
+				expectedHTTPCode: http.StatusBadRequest,
+				expectedResponseBody: `{"errors":[{"field":"tillDate","message":"must be at most 366 days after ` + today.String() + `"}],"message":"request is invalid"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 400: till date is not a date",
+			fields: fields{
+				requestBody:      body(bookUid, libraryUid, "31.12.2024"),
+				expectedHTTPCode: http.StatusBadRequest,
+				expectedResponseBody: `{"errors":[{"field":"tillDate","message":"must be a date in YYYY-MM-DD format"}],"message":"request is invalid"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 400: start date in the past",
+			fields: fields{
+				requestBody:      bookingBody(today.AddDays(-1).String(), tillDate.String()),
+				expectedHTTPCode: http.StatusBadRequest,
+				expectedResponseBody: `{"errors":[{"field":"startDate","message":"must not be before ` + today.String() + `"}],"message":"request is invalid"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 400: till date not after start date",
+			fields: fields{
+				requestBody:      bookingBody(startDate.String(), startDate.String()),
+				expectedHTTPCode: http.StatusBadRequest,
+				expectedResponseBody: `{"errors":[{"field":"tillDate","message":"must be after ` + startDate.String() + `"}],"message":"request is invalid"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 400: unknown library and book",
+			fields: fields{
+				requestBody:      body(bookUid, libraryUid, tillDate.String()),
+				expectedHTTPCode: http.StatusBadRequest,
+				expectedResponseBody: `{"errors":[{"field":"libraryUid","message":"library not found"},{"field":"bookUid","message":"book not found"}],"message":"request is invalid"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.catalog.EXPECT().LibraryExists(gomock.Any(), libraryUid).Return(false, nil)
+				fields.catalog.EXPECT().BookExists(gomock.Any(), bookUid).Return(false, nil)
+			},
+		},
+		{
+			name: "http-code 503: library service unavailable",
+			fields: fields{
+				requestBody:      body(bookUid, libraryUid, tillDate.String()),
+				expectedHTTPCode: http.StatusServiceUnavailable,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.catalog.EXPECT().LibraryExists(gomock.Any(), libraryUid).Return(false, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 409: the only copy is booked within the period",
+			fields: fields{
+				requestBody:      body(bookUid, libraryUid, tillDate.String()),
+				expectedHTTPCode: http.StatusConflict,
+				expectedResponseBody: `{"message":"no copy is free on ` + startDate.String() + `"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.catalog.EXPECT().LibraryExists(gomock.Any(), libraryUid).Return(true, nil)
+				fields.catalog.EXPECT().BookExists(gomock.Any(), bookUid).Return(true, nil)
+				fields.calendar.EXPECT().NextOpenDay(gomock.Any(), libraryUid, tillDate).Return(tillDate, nil)
+				fields.catalog.EXPECT().Stock(gomock.Any(), libraryUid, bookUid).Return(1, nil)
+				fields.storage.EXPECT().GetHoldingReservations(gomock.Any(), libraryUid, bookUid, today, tillDate).Return([]reservation{
+					holding(bookedStatus, startDate, startDate.AddDays(3)),
+				}, nil)
+				fields.storage.EXPECT().CreateReservation(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ *reservation, check func(context.Context) error) (int, error) {
+					return 0, check(ctx)
+				})
+			},
+		},
+		{
+			name: "http-code 200: success",
+			fields: fields{
+				requestBody:      body(bookUid, libraryUid, tillDate.String()),
+				expectedHTTPCode: http.StatusOK,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.catalog.EXPECT().LibraryExists(gomock.Any(), libraryUid).Return(true, nil)
+				fields.catalog.EXPECT().BookExists(gomock.Any(), bookUid).Return(true, nil)
+				fields.calendar.EXPECT().NextOpenDay(gomock.Any(), libraryUid, tillDate).Return(tillDate, nil)
+				fields.catalog.EXPECT().Stock(gomock.Any(), libraryUid, bookUid).Return(2, nil)
+				fields.storage.EXPECT().GetHoldingReservations(gomock.Any(), libraryUid, bookUid, today, tillDate).Return([]reservation{
+					holding(bookedStatus, startDate, startDate.AddDays(3)),
+				}, nil)
+				fields.storage.EXPECT().CreateReservation(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, r *reservation, check func(context.Context) error) (int, error) {
+					require.NoError(t, check(ctx))
+					require.Equal(t, "test", *r.UserName)
+					require.Equal(t, rentedStatus, *r.Status)
+					require.Equal(t, today, *r.StartDate)
+					require.Equal(t, tillDate, *r.TillDate)
+					return 1, nil
+				})
+			},
+		},
+		{
+			name: "http-code 200: future start date is a booking",
+			fields: fields{
+				requestBody:      bookingBody(startDate.String(), startDate.AddDays(14).String()),
+				expectedHTTPCode: http.StatusOK,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.catalog.EXPECT().LibraryExists(gomock.Any(), libraryUid).Return(true, nil)
+				fields.catalog.EXPECT().BookExists(gomock.Any(), bookUid).Return(true, nil)
+				fields.calendar.EXPECT().NextOpenDay(gomock.Any(), libraryUid, startDate.AddDays(14)).Return(startDate.AddDays(14), nil)
+				fields.catalog.EXPECT().Stock(gomock.Any(), libraryUid, bookUid).Return(1, nil)
+				fields.storage.EXPECT().GetHoldingReservations(gomock.Any(), libraryUid, bookUid, startDate, startDate.AddDays(14)).Return([]reservation{
+					holding(rentedStatus, today.AddDays(-10), startDate.AddDays(-1)),
+				}, nil)
+				fields.storage.EXPECT().CreateReservation(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, r *reservation, check func(context.Context) error) (int, error) {
+					require.NoError(t, check(ctx))
+					require.Equal(t, bookedStatus, *r.Status)
+					require.Equal(t, startDate, *r.StartDate)
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, calendar: testFields.calendar, catalog: testFields.catalog}
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.fields.requestBody))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetRequest(c.Request().WithContext(auth.SetUser(c.Request().Context(), "test")))
+
+			err := h.CreateReservation(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedResponseBody != "" {
+				require.Equal(t, tt.fields.expectedResponseBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+// holding makes a reservation that holds a copy from start to till.
+func holding(status string, start, till my_time.Date) reservation {
+	return reservation{Status: &status, StartDate: &start, TillDate: &till}
+}
+
+func Test_GetAvailability(t *testing.T) {
+	const (
+		bookUid    = "f7cdc58f-2caf-4b15-9727-f89dcc629b27"
+		libraryUid = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+	)
+
+	type fields struct {
+		query                string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+
+	today := my_time.Today(time.UTC)
+	day := func(days int) string {
+		return today.AddDays(days).String()
+	}
+	query := func(from, to string) string {
+		return "?libraryUid=" + libraryUid + "&bookUid=" + bookUid + "&from=" + from + "&to=" + to
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 400: wrong uids and range",
+			fields: fields{
+				query:            "?libraryUid=test&from=" + day(2) + "&to=" + day(1),
+				expectedHTTPCode: http.StatusBadRequest,
+				expectedResponseBody: `{"errors":[` +
+					`{"field":"libraryUid","message":"must be a UUID"},` +
+					`{"field":"bookUid","message":"must be a UUID"},` +
+					`{"field":"to","message":"must not be before ` + day(2) + `"}` +
+					`],"message":"request is invalid"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 503: library service unavailable",
+			fields: fields{
+				query:            query(day(0), day(2)),
+				expectedHTTPCode: http.StatusServiceUnavailable,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.catalog.EXPECT().Stock(gomock.Any(), libraryUid, bookUid).Return(0, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: overdue loan and booking hold the copies",
+			fields: fields{
+				query:            query(day(0), day(3)),
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"` + libraryUid + `","bookUid":"` + bookUid + `","stockCount":2,"availableFrom":"` + day(1) + `","days":[` +
+					`{"date":"` + day(0) + `","available":0},` +
+					`{"date":"` + day(1) + `","available":1},` +
+					`{"date":"` + day(2) + `","available":0},` +
+					`{"date":"` + day(3) + `","available":1}]}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.catalog.EXPECT().Stock(gomock.Any(), libraryUid, bookUid).Return(2, nil)
+				fields.storage.EXPECT().GetHoldingReservations(gomock.Any(), libraryUid, bookUid, today, today.AddDays(3)).Return([]reservation{
+					holding(rentedStatus, today.AddDays(-20), today.AddDays(-2)),
+					holding(bookedStatus, today, today),
+					holding(bookedStatus, today.AddDays(2), today.AddDays(5)),
+					holding(rentedStatus, today.AddDays(-1), today.AddDays(2)),
+				}, nil)
+			},
+		},
+		{
+			name: "http-code 200: never available",
+			fields: fields{
+				query:            query(day(0), day(0)),
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"libraryUid":"` + libraryUid + `","bookUid":"` + bookUid + `","stockCount":0,"availableFrom":null,"days":[{"date":"` + day(0) + `","available":0}]}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.catalog.EXPECT().Stock(gomock.Any(), libraryUid, bookUid).Return(0, nil)
+				fields.storage.EXPECT().GetHoldingReservations(gomock.Any(), libraryUid, bookUid, today, today).Return([]reservation{}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage, catalog: testFields.catalog}
+
+			req := httptest.NewRequest(http.MethodGet, "/test"+tt.fields.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := h.GetAvailability(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedResponseBody != "" {
+				require.Equal(t, tt.fields.expectedResponseBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_GetReservationHistory(t *testing.T) {
+	const libraryUid = "83575e12-7ce0-48ee-9931-51919ff3c9ee"
+
+	type fields struct {
+		caller               string
+		roles                []string
+		query                string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+
+	from, _ := my_time.NewDate("2024-01-01")
+	to, _ := my_time.NewDate("2024-12-31")
+	returned := func(uid string) reservation {
+		status, username, bookUid, lib := "RETURNED", "test", "book", libraryUid
+		renewals := 1
+		startDate, tillDate := *from, from.AddDays(14)
+		return reservation{
+			ReservationUid: &uid,
+			UserName:       &username,
+			Status:         &status,
+			BookUid:        &bookUid,
+			LibraryUid:     &lib,
+			StartDate:      &startDate,
+			TillDate:       &tillDate,
+			Renewals:       &renewals,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 404: history of another reader",
+			fields: fields{
+				caller:           "other",
+				query:            "?page=1&size=10",
+				expectedHTTPCode: http.StatusNotFound,
+				expectedResponseBody: `{"message":"reservations not found"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 200: librarian sees the history of any reader",
+			fields: fields{
+				caller:           "librarian",
+				roles:            []string{auth.LibrarianRole},
+				query:            "?page=1&size=10",
+				expectedHTTPCode: http.StatusOK,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservationHistory(gomock.Any(), "test", gomock.Any(), 0, 10).Return([]reservation{}, 0, nil)
+			},
+		},
+		{
+			name: "http-code 400: wrong page",
+			fields: fields{
+				query:            "?page=0&size=10",
+				expectedHTTPCode: http.StatusBadRequest,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 400: every filter is wrong",
+			fields: fields{
+				query:            "?page=1&size=10&status=RETURNED,LOST&from=2024-12-31&to=2024-01-01&libraryUid=test&sort=-copy",
+				expectedHTTPCode: http.StatusBadRequest,
+				expectedResponseBody: `{"errors":[` +
+					`{"field":"status","message":"must be one of BOOKED RENTED RETURNED EXPIRED CANCELED"},` +
+					`{"field":"to","message":"must not be before 2024-12-31"},` +
+					`{"field":"libraryUid","message":"must be a UUID"},` +
+					`{"field":"sort","message":"must be one of startDate tillDate status, prefixed with - to sort descending"}` +
+					`],"message":"request is invalid"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 500: storage error",
+			fields: fields{
+				query:            "?page=1&size=10",
+				expectedHTTPCode: http.StatusInternalServerError,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservationHistory(gomock.Any(), "test", gomock.Any(), 0, 10).Return(nil, 0, errors.New(""))
+			},
+		},
+		{
+			name: "http-code 200: newest first by default",
+			fields: fields{
+				query:            "?page=1&size=10",
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"page":1,"pageSize":10,"totalElements":0,"items":[]}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservationHistory(gomock.Any(), "test", historyFilter{Sort: "startDate", Desc: true}, 0, 10).Return([]reservation{}, 0, nil)
+			},
+		},
+		{
+			name: "http-code 200: filtered and sorted",
+			fields: fields{
+				query:            "?page=2&size=1&status=RETURNED,EXPIRED&status=CANCELED&from=2024-01-01&to=2024-12-31&libraryUid=" + libraryUid + "&sort=tillDate",
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"page":2,"pageSize":1,"totalElements":2,"items":[` +
+					`{"reservationUid":"second","status":"RETURNED","startDate":"2024-01-01","tillDate":"2024-01-15","bookUid":"book","libraryUid":"` + libraryUid + `","renewals":1}` +
+					`]}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservationHistory(gomock.Any(), "test", historyFilter{
+					Statuses:   []string{"RETURNED", "EXPIRED", "CANCELED"},
+					From:       from,
+					To:         to,
+					LibraryUid: libraryUid,
+					Sort:       "tillDate",
+				}, 1, 1).Return([]reservation{returned("second")}, 2, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test"+tt.fields.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues("test")
+			c.SetRequest(c.Request().WithContext(callerContext(c, tt.fields.caller, tt.fields.roles)))
+
+			err := h.GetReservationHistory(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedResponseBody != "" {
+				require.Equal(t, tt.fields.expectedResponseBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+// callerContext authenticates the request as the caller with the roles, "test" when the caller is empty.
+func callerContext(c echo.Context, caller string, roles []string) context.Context {
+	if caller == "" {
+		caller = "test"
+	}
+	return auth.SetRoles(auth.SetUser(c.Request().Context(), caller), roles)
+}
+
+// ownedReservation makes a rented reservation of the reader.
+func ownedReservation(uid, username string) reservation {
+	status, bookUid, libraryUid := rentedStatus, "book", "library"
+	renewals := 0
+	startDate, _ := my_time.NewDate("2024-01-01")
+	tillDate, _ := my_time.NewDate("2024-01-15")
+	return reservation{
+		ReservationUid: &uid,
+		UserName:       &username,
+		Status:         &status,
+		BookUid:        &bookUid,
+		LibraryUid:     &libraryUid,
+		StartDate:      startDate,
+		TillDate:       tillDate,
+		Renewals:       &renewals,
+	}
+}
+
+func Test_GetReservationByUid(t *testing.T) {
+	type fields struct {
+		caller               string
+		roles                []string
+		expectedHTTPCode     int
+		expectedResponseBody string
+	}
+
+	e := echo.New()
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 404: unknown reservation",
+			fields: fields{
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(reservation{}, errNotFound)
+			},
+		},
+		{
+			name: "http-code 404: reservation of another reader looks unknown",
+			fields: fields{
+				caller:           "other",
+				expectedHTTPCode: http.StatusNotFound,
+				expectedResponseBody: `{"message":"reservation not found"}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(ownedReservation("uid", "test"), nil)
+			},
+		},
+		{
+			name: "http-code 200: own reservation",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+				expectedResponseBody: `{"reservationUid":"uid","username":"test","status":"RENTED","startDate":"2024-01-01","tillDate":"2024-01-15","bookUid":"book","libraryUid":"library","renewals":0}
+`,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(ownedReservation("uid", "test"), nil)
+			},
+		},
+		{
+			name: "http-code 200: admin sees any reservation",
+			fields: fields{
+				caller:           "other",
+				roles:            []string{auth.AdminRole},
+				expectedHTTPCode: http.StatusOK,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservation(gomock.Any(), "uid").Return(ownedReservation("uid", "test"), nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("uid")
+			c.SetParamValues("uid")
+			c.SetRequest(c.Request().WithContext(callerContext(c, tt.fields.caller, tt.fields.roles)))
+
+			err := h.GetReservationByUid(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+			if tt.fields.expectedResponseBody != "" {
+				require.Equal(t, tt.fields.expectedResponseBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_GetReservations(t *testing.T) {
+	type fields struct {
+		caller           string
+		roles            []string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 404: reservations of another reader",
+			fields: fields{
+				caller:           "other",
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(fields *handlerTestFields) {},
+		},
+		{
+			name: "http-code 200: own reservations",
+			fields: fields{
+				expectedHTTPCode: http.StatusOK,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservations(gomock.Any(), "test", rentedStatus).Return([]reservation{ownedReservation("uid", "test")}, nil)
+			},
+		},
+		{
+			name: "http-code 200: librarian sees reservations of any reader",
+			fields: fields{
+				caller:           "librarian",
+				roles:            []string{auth.LibrarianRole},
+				expectedHTTPCode: http.StatusOK,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().GetReservations(gomock.Any(), "test", rentedStatus).Return([]reservation{}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodGet, "/test?status="+rentedStatus, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("username")
+			c.SetParamValues("test")
+			c.SetRequest(c.Request().WithContext(callerContext(c, tt.fields.caller, tt.fields.roles)))
+
+			err := h.GetReservations(c)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
+		})
+	}
+}
+
+func Test_SetReservationCopy(t *testing.T) {
+	type fields struct {
+		caller           string
+		roles            []string
+		expectedHTTPCode int
+	}
+
+	e := echo.New()
+
+	tests := []struct {
+		name    string
+		fields  fields
+		Prepare func(fields *handlerTestFields)
+	}{
+		{
+			name: "http-code 404: reservation is not rented",
+			fields: fields{
+				caller:           "librarian",
+				roles:            []string{auth.LibrarianRole},
+				expectedHTTPCode: http.StatusNotFound,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().SetReservationCopy(gomock.Any(), "uid", "000000000001").Return(errNotFound)
+			},
+		},
+		{
+			name: "http-code 200: librarian sets the copy of any reservation",
+			fields: fields{
+				caller:           "librarian",
+				roles:            []string{auth.LibrarianRole},
+				expectedHTTPCode: http.StatusOK,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().SetReservationCopy(gomock.Any(), "uid", "000000000001").Return(nil)
+			},
+		},
+		{
+			name: "http-code 200: reconcile job sets the copy of any reservation",
+			fields: fields{
+				caller:           "gateway",
+				roles:            []string{auth.ServiceRole},
+				expectedHTTPCode: http.StatusOK,
+			},
+			Prepare: func(fields *handlerTestFields) {
+				fields.storage.EXPECT().SetReservationCopy(gomock.Any(), "uid", "000000000001").Return(nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			testFields := createHandlerTestFields(ctrl)
+			tt.Prepare(testFields)
+
+			h := &handler{storage: testFields.storage}
+
+			req := httptest.NewRequest(http.MethodPut, "/test", bytes.NewBufferString(`{"copyBarcode":"000000000001"}`))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("uid")
+			c.SetParamValues("uid")
+			c.SetRequest(c.Request().WithContext(callerContext(c, tt.fields.caller, tt.fields.roles)))
+
+			err := h.SetReservationCopy(c)
 
 			require.NoError(t, err)
 			require.Equal(t, tt.fields.expectedHTTPCode, rec.Code)
@@ -13,4 +13,65 @@ type reservation struct {
 	Status         *string       `db:"status"`
 	StartDate      *my_time.Date `db:"start_date"`
 	TillDate       *my_time.Date `db:"till_date"`
+	CopyBarcode    *string       `db:"copy_barcode"`
+	Renewals       *int          `db:"renewals"`
+}
+
+// historyFilter narrows the reservations of a reader down, zero fields do not filter. Sort is a column of
+// historySortColumns.
+type historyFilter struct {
+	Statuses   []string
+	From       *my_time.Date
+	To         *my_time.Date
+	LibraryUid string
+	Sort       string
+	Desc       bool
+}
+
+// historySortColumns maps the sort keys of the history to their columns.
+var historySortColumns = map[string]string{
+	"startDate": "start_date",
+	"tillDate":  "till_date",
+	"status":    "status",
+}
+
+type dayAvailability struct {
+	Date      my_time.Date `json:"date"`
+	Available int          `json:"available"`
+}
+
+// holds tells whether the reservation keeps a copy on the day. A rented copy is held until it is returned,
+// so an overdue loan keeps holding it through today.
+func (r reservation) holds(day, today my_time.Date) bool {
+	end := *r.TillDate
+	if *r.Status == rentedStatus && end.Before(today) {
+		end = today
+	}
+	return !day.Before(*r.StartDate) && !day.After(end)
+}
+
+// availability counts the copies free on every day between from and to: the stock less the reservations
+// holding a copy that day. More holding reservations than copies leave none free rather than a debt.
+func availability(stock int, holding []reservation, from, to, today my_time.Date) []dayAvailability {
+	res := make([]dayAvailability, 0, to.Sub(from)+1)
+	for day := from; !day.After(to); day = day.AddDays(1) {
+		available := stock
+		for _, r := range holding {
+			if r.holds(day, today) {
+				available--
+			}
+		}
+		res = append(res, dayAvailability{Date: day, Available: max(available, 0)})
+	}
+	return res
+}
+
+// firstAvailable returns the first day with a free copy, nil when there is none.
+func firstAvailable(days []dayAvailability) *my_time.Date {
+	for _, d := range days {
+		if d.Available > 0 {
+			return &d.Date
+		}
+	}
+	return nil
 }
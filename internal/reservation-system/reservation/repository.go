@@ -22,7 +22,12 @@ func NewRepository(conn *sqlx.DB) *repository {
 	return &repository{conn: conn}
 }
 
-func (r *repository) CreateReservation(ctx context.Context, res *reservation) (int, error) {
+// CreateReservation runs check and inserts the reservation under a lock on the copies of the book in the
+// library, so two readers cannot both take the last free copy. check sees the reservations committed before
+// the lock was taken, its error is returned as is and nothing is inserted.
+func (r *repository) CreateReservation(ctx context.Context, res *reservation, check func(ctx context.Context) error) (int, error) {
+	lockQuery := `SELECT pg_advisory_xact_lock(hashtext('reservation'), hashtext($1 || '/' || $2));`
+
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 	builder := psql.Insert("reservation").Columns("reservation_uid", "username", "book_uid", "library_uid", "status", "start_date", "till_date").
 		Values(*res.ReservationUid, *res.UserName, *res.BookUid, *res.LibraryUid, *res.Status, res.StartDate.String(), res.TillDate.String())
@@ -34,19 +39,68 @@ func (r *repository) CreateReservation(ctx context.Context, res *reservation) (i
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
+	tx, err := r.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, lockQuery, *res.LibraryUid, *res.BookUid)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to lock copies")
+	}
+
+	err = check(ctx)
+	if err != nil {
+		return 0, err
+	}
+
 	var id int
-	err = r.conn.QueryRowContext(ctx, query, args...).Scan(&id)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&id)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to execute query")
 	}
 
-	return id, nil
+	return id, errors.Wrap(tx.Commit(), "failed to commit reservation")
+}
+
+// UpdateReservationStatus moves the reservation from one status to another, a reservation no longer in the
+// from status is not found.
+func (r *repository) UpdateReservationStatus(ctx context.Context, uid string, from string, to string) error {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	builder := psql.Update("reservation").Set("status", to).Where(sq.Eq{"reservation_uid": uid, "status": from})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := r.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+
+	if rowsAffected == 0 {
+		return errNotFound
+	}
+
+	return nil
 }
 
-func (r *repository) UpdateReservationStatus(ctx context.Context, uid string, username string, status string) error {
+// SetReservationCopy records the copy lent for a rented reservation.
+func (r *repository) SetReservationCopy(ctx context.Context, uid string, barcode string) error {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
-	builder := psql.Update("reservation").Set("status", status).Where(sq.And{sq.Eq{"reservation_uid": uid}, sq.Eq{"username": username}})
+	builder := psql.Update("reservation").Set("copy_barcode", barcode).Where(sq.Eq{"reservation_uid": uid, "status": rentedStatus})
 
 	query, args, err := builder.ToSql()
 	if err != nil {
@@ -67,7 +121,41 @@ func (r *repository) UpdateReservationStatus(ctx context.Context, uid string, us
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("no rows affected")
+		return errNotFound
+	}
+
+	return nil
+}
+
+// RenewReservation sets a new due date for a rented reservation and counts the renewal.
+func (r *repository) RenewReservation(ctx context.Context, uid string, tillDate my_time.Date) error {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	builder := psql.Update("reservation").
+		Set("till_date", tillDate.String()).
+		Set("renewals", sq.Expr("renewals + 1")).
+		Where(sq.Eq{"reservation_uid": uid, "status": rentedStatus})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := r.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to execute query")
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to get rows affected")
+	}
+
+	if rowsAffected == 0 {
+		return errNotFound
 	}
 
 	return nil
@@ -76,7 +164,7 @@ func (r *repository) UpdateReservationStatus(ctx context.Context, uid string, us
 func (r *repository) GetReservation(ctx context.Context, uid string) (reservation, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
-	builder := psql.Select("reservation_uid", "username", "book_uid", "library_uid", "status", "start_date", "till_date").From("reservation").Where(sq.Eq{"reservation_uid": uid})
+	builder := psql.Select("reservation_uid", "username", "book_uid", "library_uid", "status", "start_date", "till_date", "copy_barcode", "renewals").From("reservation").Where(sq.Eq{"reservation_uid": uid})
 
 	query, args, err := builder.ToSql()
 	if err != nil {
@@ -89,7 +177,7 @@ func (r *repository) GetReservation(ctx context.Context, uid string) (reservatio
 	res := reservation{}
 
 	var startDate, tillDate string
-	err = r.conn.QueryRowContext(ctx, query, args...).Scan(&res.ReservationUid, &res.UserName, &res.BookUid, &res.LibraryUid, &res.Status, &startDate, &tillDate)
+	err = r.conn.QueryRowContext(ctx, query, args...).Scan(&res.ReservationUid, &res.UserName, &res.BookUid, &res.LibraryUid, &res.Status, &startDate, &tillDate, &res.CopyBarcode, &res.Renewals)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return reservation{}, errNotFound
@@ -112,7 +200,58 @@ func (r *repository) GetReservation(ctx context.Context, uid string) (reservatio
 func (r *repository) GetReservations(ctx context.Context, username string, status string) ([]reservation, error) {
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
-	builder := psql.Select("reservation_uid", "username", "book_uid", "library_uid", "status", "start_date", "till_date").From("reservation").Where(sq.And{sq.Eq{"username": username}, sq.Eq{"status": status}})
+	builder := psql.Select("reservation_uid", "username", "book_uid", "library_uid", "status", "start_date", "till_date", "copy_barcode", "renewals").From("reservation").Where(sq.Eq{"status": status})
+	if username != "" {
+		builder = builder.Where(sq.Eq{"username": username})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res := make([]reservation, 0)
+
+	rows, err := r.conn.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to perform query %s", query)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var model reservation
+		var startDate, tillDate string
+		if err = rows.Scan(&model.ReservationUid, &model.UserName, &model.BookUid, &model.LibraryUid, &model.Status, &startDate, &tillDate, &model.CopyBarcode, &model.Renewals); err != nil {
+			return nil, errors.Wrap(err, "failed to row scan")
+		}
+		model.StartDate, err = my_time.NewDate(startDate)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse start date")
+		}
+		model.TillDate, err = my_time.NewDate(tillDate)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse till date")
+		}
+		res = append(res, model)
+	}
+
+	return res, nil
+}
+
+// GetHoldingReservations returns the rented and booked reservations of a book in a library that may hold a copy
+// between from and to. Rented ones hold it until they are returned, so an overdue loan is never left out.
+func (r *repository) GetHoldingReservations(ctx context.Context, libraryUid, bookUid string, from, to my_time.Date) ([]reservation, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	builder := psql.Select("reservation_uid", "status", "start_date", "till_date").
+		From("reservation").
+		Where(sq.Eq{"library_uid": libraryUid, "book_uid": bookUid, "status": []string{rentedStatus, bookedStatus}}).
+		Where(sq.LtOrEq{"start_date": to.String()}).
+		Where(sq.Or{sq.GtOrEq{"till_date": from.String()}, sq.Eq{"status": rentedStatus}}).
+		OrderBy("start_date")
 
 	query, args, err := builder.ToSql()
 	if err != nil {
@@ -133,7 +272,7 @@ func (r *repository) GetReservations(ctx context.Context, username string, statu
 	for rows.Next() {
 		var model reservation
 		var startDate, tillDate string
-		if err = rows.Scan(&model.ReservationUid, &model.UserName, &model.BookUid, &model.LibraryUid, &model.Status, &startDate, &tillDate); err != nil {
+		if err = rows.Scan(&model.ReservationUid, &model.Status, &startDate, &tillDate); err != nil {
 			return nil, errors.Wrap(err, "failed to row scan")
 		}
 		model.StartDate, err = my_time.NewDate(startDate)
@@ -149,3 +288,79 @@ func (r *repository) GetReservations(ctx context.Context, username string, statu
 
 	return res, nil
 }
+
+// GetReservationHistory returns a page of the reservations of the reader that match the filter and the number
+// of all matching ones. The date range applies to the start date, equal rows keep the newest first.
+func (r *repository) GetReservationHistory(ctx context.Context, username string, f historyFilter, offset, limit int) ([]reservation, int, error) {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	where := sq.And{sq.Eq{"username": username}}
+	if len(f.Statuses) > 0 {
+		where = append(where, sq.Eq{"status": f.Statuses})
+	}
+	if f.From != nil {
+		where = append(where, sq.GtOrEq{"start_date": f.From.String()})
+	}
+	if f.To != nil {
+		where = append(where, sq.LtOrEq{"start_date": f.To.String()})
+	}
+	if f.LibraryUid != "" {
+		where = append(where, sq.Eq{"library_uid": f.LibraryUid})
+	}
+
+	order := historySortColumns[f.Sort]
+	if f.Desc {
+		order += " DESC"
+	}
+
+	query, args, err := psql.Select("reservation_uid", "username", "book_uid", "library_uid", "status", "start_date", "till_date", "copy_barcode", "renewals").
+		From("reservation").
+		Where(where).
+		OrderBy(order, "id DESC").
+		Limit(uint64(limit)).Offset(uint64(offset)).
+		ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to build query")
+	}
+
+	countQuery, countArgs, err := psql.Select("COUNT(*)").From("reservation").Where(where).ToSql()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to build query")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var total int
+	err = r.conn.GetContext(ctx, &total, countQuery, countArgs...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to execute query")
+	}
+
+	res := make([]reservation, 0)
+
+	rows, err := r.conn.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to perform query %s", query)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var model reservation
+		var startDate, tillDate string
+		if err = rows.Scan(&model.ReservationUid, &model.UserName, &model.BookUid, &model.LibraryUid, &model.Status, &startDate, &tillDate, &model.CopyBarcode, &model.Renewals); err != nil {
+			return nil, 0, errors.Wrap(err, "failed to row scan")
+		}
+		model.StartDate, err = my_time.NewDate(startDate)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to parse start date")
+		}
+		model.TillDate, err = my_time.NewDate(tillDate)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to parse till date")
+		}
+		res = append(res, model)
+	}
+
+	return res, total, nil
+}
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+DELETE FROM library_books WHERE book_id IS NULL OR library_id IS NULL;
+
+CREATE TEMPORARY TABLE library_books_merged AS
+SELECT book_id, library_id, SUM(available_count) AS available_count
+FROM library_books
+GROUP BY book_id, library_id;
+
+DELETE FROM library_books;
+
+INSERT INTO library_books (book_id, library_id, available_count)
+SELECT book_id, library_id, available_count FROM library_books_merged;
+
+DROP TABLE library_books_merged;
+
+ALTER TABLE library_books ALTER COLUMN book_id SET NOT NULL;
+ALTER TABLE library_books ALTER COLUMN library_id SET NOT NULL;
+ALTER TABLE library_books ADD CONSTRAINT library_books_pkey PRIMARY KEY (library_id, book_id);
+ALTER TABLE library_books ADD CONSTRAINT library_books_available_count_check CHECK (available_count >= 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE library_books DROP CONSTRAINT IF EXISTS library_books_available_count_check;
+ALTER TABLE library_books DROP CONSTRAINT IF EXISTS library_books_pkey;
+ALTER TABLE library_books ALTER COLUMN library_id DROP NOT NULL;
+ALTER TABLE library_books ALTER COLUMN book_id DROP NOT NULL;
+-- +goose StatementEnd
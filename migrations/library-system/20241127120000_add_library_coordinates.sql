@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE library ADD COLUMN latitude DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90);
+ALTER TABLE library ADD COLUMN longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180);
+
+CREATE INDEX library_coordinates_idx ON library (latitude, longitude) WHERE closed_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS library_coordinates_idx;
+ALTER TABLE library DROP COLUMN IF EXISTS longitude;
+ALTER TABLE library DROP COLUMN IF EXISTS latitude;
+-- +goose StatementEnd
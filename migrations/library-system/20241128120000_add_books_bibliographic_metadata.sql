@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE books ADD COLUMN isbn VARCHAR(13) CHECK (isbn ~ '^[0-9]{13}$');
+ALTER TABLE books ADD COLUMN publisher VARCHAR(255);
+ALTER TABLE books ADD COLUMN year SMALLINT CHECK (year BETWEEN 1450 AND 2100);
+ALTER TABLE books ADD COLUMN language VARCHAR(35);
+ALTER TABLE books ADD COLUMN page_count INT CHECK (page_count > 0);
+ALTER TABLE books ADD COLUMN description TEXT;
+
+CREATE UNIQUE INDEX books_isbn_idx ON books (isbn) WHERE isbn IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS books_isbn_idx;
+ALTER TABLE books DROP COLUMN IF EXISTS description;
+ALTER TABLE books DROP COLUMN IF EXISTS page_count;
+ALTER TABLE books DROP COLUMN IF EXISTS language;
+ALTER TABLE books DROP COLUMN IF EXISTS year;
+ALTER TABLE books DROP COLUMN IF EXISTS publisher;
+ALTER TABLE books DROP COLUMN IF EXISTS isbn;
+-- +goose StatementEnd
@@ -0,0 +1,76 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE SEQUENCE book_copies_barcode_seq;
+
+CREATE TABLE book_copies
+(
+    id              SERIAL PRIMARY KEY,
+    barcode         VARCHAR(32) UNIQUE NOT NULL,
+    library_id      INT         NOT NULL,
+    book_id         INT         NOT NULL,
+    condition       VARCHAR(20) NOT NULL DEFAULT 'EXCELLENT'
+    CHECK (condition IN ('EXCELLENT', 'GOOD', 'BAD')),
+    status          VARCHAR(20) NOT NULL DEFAULT 'AVAILABLE'
+    CHECK (status IN ('AVAILABLE', 'CHECKED_OUT', 'WITHDRAWN')),
+    reservation_uid uuid,
+    FOREIGN KEY (library_id, book_id) REFERENCES library_books (library_id, book_id) ON DELETE CASCADE,
+    CHECK ((status = 'CHECKED_OUT') = (reservation_uid IS NOT NULL))
+);
+
+CREATE INDEX book_copies_library_book_idx ON book_copies (library_id, book_id, status);
+CREATE UNIQUE INDEX book_copies_reservation_idx ON book_copies (reservation_uid) WHERE reservation_uid IS NOT NULL;
+
+-- available_count is derived from copies and kept only so that readers of library_books stay cheap
+CREATE FUNCTION sync_library_books_available_count() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE library_books lb
+    SET available_count = (
+        SELECT COUNT(*) FROM book_copies c
+        WHERE c.library_id = lb.library_id AND c.book_id = lb.book_id AND c.status = 'AVAILABLE'
+    )
+    WHERE (lb.library_id = NEW.library_id AND lb.book_id = NEW.book_id)
+       OR (lb.library_id = OLD.library_id AND lb.book_id = OLD.book_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER book_copies_available_count
+AFTER INSERT OR UPDATE OR DELETE ON book_copies
+FOR EACH ROW EXECUTE FUNCTION sync_library_books_available_count();
+
+-- set_available_copies labels new copies or withdraws the newest available ones until the count matches
+CREATE FUNCTION set_available_copies(p_library_id INT, p_book_id INT, p_count INT) RETURNS VOID AS $$
+DECLARE
+    current_count INT;
+BEGIN
+    SELECT COUNT(*) INTO current_count FROM book_copies
+    WHERE library_id = p_library_id AND book_id = p_book_id AND status = 'AVAILABLE';
+
+    IF p_count > current_count THEN
+        INSERT INTO book_copies (barcode, library_id, book_id, condition)
+        SELECT LPAD(nextval('book_copies_barcode_seq')::TEXT, 12, '0'), p_library_id, p_book_id, COALESCE(b.condition, 'EXCELLENT')
+        FROM books b, generate_series(1, p_count - current_count)
+        WHERE b.id = p_book_id;
+    ELSIF p_count < current_count THEN
+        UPDATE book_copies SET status = 'WITHDRAWN'
+        WHERE id IN (
+            SELECT id FROM book_copies
+            WHERE library_id = p_library_id AND book_id = p_book_id AND status = 'AVAILABLE'
+            ORDER BY id DESC
+            LIMIT current_count - p_count
+        );
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT set_available_copies(library_id, book_id, available_count) FROM library_books;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS set_available_copies(INT, INT, INT);
+DROP TRIGGER IF EXISTS book_copies_available_count ON book_copies;
+DROP FUNCTION IF EXISTS sync_library_books_available_count();
+DROP TABLE IF EXISTS book_copies;
+DROP SEQUENCE IF EXISTS book_copies_barcode_seq;
+-- +goose StatementEnd
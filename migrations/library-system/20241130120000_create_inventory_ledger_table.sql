@@ -0,0 +1,97 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE inventory_ledger
+(
+    id              BIGSERIAL PRIMARY KEY,
+    library_id      INT         NOT NULL REFERENCES library (id),
+    book_id         INT         NOT NULL REFERENCES books (id),
+    delta           INT         NOT NULL CHECK (delta <> 0),
+    reason          VARCHAR(20) NOT NULL
+    CHECK (reason IN ('CHECKOUT', 'RETURN', 'HOLD', 'ADJUSTMENT', 'IMPORT')),
+    actor           VARCHAR(80) NOT NULL,
+    reservation_uid uuid,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX inventory_ledger_library_book_idx ON inventory_ledger (library_id, book_id, created_at);
+
+CREATE FUNCTION forbid_inventory_ledger_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'inventory_ledger is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER inventory_ledger_append_only
+BEFORE UPDATE OR DELETE ON inventory_ledger
+FOR EACH ROW EXECUTE FUNCTION forbid_inventory_ledger_change();
+
+CREATE TRIGGER inventory_ledger_no_truncate
+BEFORE TRUNCATE ON inventory_ledger
+FOR EACH STATEMENT EXECUTE FUNCTION forbid_inventory_ledger_change();
+
+-- the reason and the actor come from transaction settings set by the service, a change made without them
+-- is a checkout or a return when the copy status says so and an adjustment by the database user otherwise
+CREATE FUNCTION record_inventory_change() RETURNS TRIGGER AS $$
+DECLARE
+    old_available INT := 0;
+    new_available INT := 0;
+    change_reason VARCHAR(20) := NULLIF(current_setting('inventory.reason', true), '');
+    change_actor  VARCHAR(80) := COALESCE(NULLIF(current_setting('inventory.actor', true), ''), current_user);
+BEGIN
+    IF TG_OP <> 'INSERT' AND OLD.status = 'AVAILABLE' THEN
+        old_available := 1;
+    END IF;
+    IF TG_OP <> 'DELETE' AND NEW.status = 'AVAILABLE' THEN
+        new_available := 1;
+    END IF;
+
+    IF change_reason IS NULL THEN
+        IF TG_OP = 'UPDATE' AND OLD.status = 'AVAILABLE' AND NEW.status = 'CHECKED_OUT' THEN
+            change_reason := 'CHECKOUT';
+        ELSIF TG_OP = 'UPDATE' AND OLD.status = 'CHECKED_OUT' AND NEW.status = 'AVAILABLE' THEN
+            change_reason := 'RETURN';
+        ELSE
+            change_reason := 'ADJUSTMENT';
+        END IF;
+    END IF;
+
+    IF TG_OP = 'UPDATE' AND OLD.library_id = NEW.library_id AND OLD.book_id = NEW.book_id THEN
+        IF new_available <> old_available THEN
+            INSERT INTO inventory_ledger (library_id, book_id, delta, reason, actor, reservation_uid)
+            VALUES (NEW.library_id, NEW.book_id, new_available - old_available, change_reason, change_actor,
+                    COALESCE(NEW.reservation_uid, OLD.reservation_uid));
+        END IF;
+        RETURN NULL;
+    END IF;
+
+    IF old_available = 1 THEN
+        INSERT INTO inventory_ledger (library_id, book_id, delta, reason, actor, reservation_uid)
+        VALUES (OLD.library_id, OLD.book_id, -1, change_reason, change_actor, OLD.reservation_uid);
+    END IF;
+    IF new_available = 1 THEN
+        INSERT INTO inventory_ledger (library_id, book_id, delta, reason, actor, reservation_uid)
+        VALUES (NEW.library_id, NEW.book_id, 1, change_reason, change_actor, NEW.reservation_uid);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER book_copies_inventory_ledger
+AFTER INSERT OR UPDATE OR DELETE ON book_copies
+FOR EACH ROW EXECUTE FUNCTION record_inventory_change();
+
+-- the stock on hand before the ledger existed is its opening balance
+INSERT INTO inventory_ledger (library_id, book_id, delta, reason, actor)
+SELECT library_id, book_id, COUNT(*), 'ADJUSTMENT', 'migration'
+FROM book_copies
+WHERE status = 'AVAILABLE'
+GROUP BY library_id, book_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS book_copies_inventory_ledger ON book_copies;
+DROP FUNCTION IF EXISTS record_inventory_change();
+DROP TABLE IF EXISTS inventory_ledger;
+DROP FUNCTION IF EXISTS forbid_inventory_ledger_change();
+-- +goose StatementEnd
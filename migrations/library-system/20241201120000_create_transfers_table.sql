@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE transfers
+(
+    id                     SERIAL PRIMARY KEY,
+    transfer_uid           uuid UNIQUE NOT NULL,
+    book_id                INT         NOT NULL REFERENCES books (id),
+    source_library_id      INT         NOT NULL REFERENCES library (id),
+    destination_library_id INT         NOT NULL REFERENCES library (id),
+    count                  INT         NOT NULL CHECK (count > 0),
+    status                 VARCHAR(20) NOT NULL DEFAULT 'REQUESTED'
+    CHECK (status IN ('REQUESTED', 'IN_TRANSIT', 'RECEIVED')),
+    requested_by           VARCHAR(80) NOT NULL,
+    requested_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    dispatched_by          VARCHAR(80),
+    dispatched_at          TIMESTAMPTZ,
+    received_by            VARCHAR(80),
+    received_at            TIMESTAMPTZ,
+    CHECK (source_library_id <> destination_library_id)
+);
+
+CREATE INDEX transfers_source_library_idx ON transfers (source_library_id, id);
+CREATE INDEX transfers_destination_library_idx ON transfers (destination_library_id, id);
+
+ALTER TABLE book_copies ADD COLUMN transfer_id INT REFERENCES transfers (id);
+
+ALTER TABLE book_copies DROP CONSTRAINT book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check
+    CHECK (status IN ('AVAILABLE', 'CHECKED_OUT', 'IN_TRANSIT', 'WITHDRAWN'));
+
+ALTER TABLE inventory_ledger DROP CONSTRAINT inventory_ledger_reason_check;
+ALTER TABLE inventory_ledger ADD CONSTRAINT inventory_ledger_reason_check
+    CHECK (reason IN ('CHECKOUT', 'RETURN', 'HOLD', 'ADJUSTMENT', 'IMPORT', 'TRANSFER'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE book_copies SET status = 'WITHDRAWN' WHERE status = 'IN_TRANSIT';
+
+ALTER TABLE book_copies DROP CONSTRAINT book_copies_status_check;
+ALTER TABLE book_copies ADD CONSTRAINT book_copies_status_check
+    CHECK (status IN ('AVAILABLE', 'CHECKED_OUT', 'WITHDRAWN'));
+
+ALTER TABLE book_copies DROP COLUMN IF EXISTS transfer_id;
+DROP TABLE IF EXISTS transfers;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- weekday is ISO, 1 is Monday and 7 is Sunday; a library without any rows keeps no schedule and is always open
+CREATE TABLE library_opening_hours
+(
+    library_id INT  NOT NULL REFERENCES library (id),
+    weekday    INT  NOT NULL CHECK (weekday BETWEEN 1 AND 7),
+    opens_at   TIME NOT NULL,
+    closes_at  TIME NOT NULL,
+    PRIMARY KEY (library_id, weekday),
+    CHECK (opens_at < closes_at)
+);
+
+CREATE TABLE library_closures
+(
+    library_id INT          NOT NULL REFERENCES library (id),
+    date       DATE         NOT NULL,
+    reason     VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (library_id, date)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS library_closures;
+DROP TABLE IF EXISTS library_opening_hours;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- an IANA zone name, days of the library schedule and due dates are in this zone
+ALTER TABLE library ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE library DROP COLUMN IF EXISTS timezone;
+-- +goose StatementEnd
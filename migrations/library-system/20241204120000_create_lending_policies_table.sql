@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a row without genre and book is the policy of the library, a genre or a book row overrides it; a NULL rule
+-- is inherited from the broader policy and means no limit when nothing sets it
+CREATE TABLE lending_policies
+(
+    id                   SERIAL PRIMARY KEY,
+    library_id           INT NOT NULL REFERENCES library (id),
+    genre                VARCHAR(255),
+    book_id              INT REFERENCES books (id),
+    max_loan_days        INT CHECK (max_loan_days > 0),
+    max_renewals         INT CHECK (max_renewals >= 0),
+    max_concurrent_loans INT CHECK (max_concurrent_loans > 0),
+    grace_days           INT CHECK (grace_days >= 0),
+    CHECK (genre IS NULL OR book_id IS NULL)
+);
+
+CREATE UNIQUE INDEX lending_policies_scope_idx ON lending_policies (library_id, COALESCE(genre, ''), COALESCE(book_id, 0));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS lending_policies;
+-- +goose StatementEnd
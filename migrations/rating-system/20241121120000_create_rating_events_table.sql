@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE rating_events
+(
+    id              SERIAL PRIMARY KEY,
+    username        VARCHAR(80)  NOT NULL,
+    delta           INT          NOT NULL,
+    stars           INT          NOT NULL,
+    reason          VARCHAR(255) NOT NULL,
+    reservation_uid uuid,
+    actor           VARCHAR(80)  NOT NULL,
+    created_at      TIMESTAMP    NOT NULL DEFAULT now()
+);
+
+CREATE INDEX rating_events_username_created_at_idx ON rating_events (username, created_at DESC, id DESC);
+
+CREATE RULE rating_events_no_update AS ON UPDATE TO rating_events DO INSTEAD NOTHING;
+CREATE RULE rating_events_no_delete AS ON DELETE TO rating_events DO INSTEAD NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS rating_events;
+-- +goose StatementEnd
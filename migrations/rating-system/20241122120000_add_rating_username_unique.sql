@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- duplicates are merged into the oldest record keeping the highest stars, the history stays keyed by username
+CREATE TEMPORARY TABLE rating_merge ON COMMIT DROP AS
+SELECT username, MIN(id) AS id, MAX(stars) AS stars
+FROM rating
+GROUP BY username
+HAVING COUNT(*) > 1;
+
+INSERT INTO rating_events (username, delta, stars, reason, actor)
+SELECT r.username, m.stars - r.stars, m.stars, 'merged duplicate rating records', 'migration'
+FROM rating r
+         JOIN rating_merge m ON m.id = r.id
+WHERE r.stars <> m.stars;
+
+UPDATE rating r
+SET stars = m.stars
+FROM rating_merge m
+WHERE r.id = m.id;
+
+DELETE FROM rating a USING rating_merge m WHERE a.username = m.username AND a.id <> m.id;
+
+ALTER TABLE rating ADD CONSTRAINT rating_username_key UNIQUE (username);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE rating DROP CONSTRAINT IF EXISTS rating_username_key;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE rating ADD COLUMN leaderboard_opt_in BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX rating_leaderboard_idx ON rating (stars DESC, id) WHERE leaderboard_opt_in;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS rating_leaderboard_idx;
+ALTER TABLE rating DROP COLUMN IF EXISTS leaderboard_opt_in;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX rating_events_reservation_uid_idx ON rating_events (reservation_uid) WHERE reservation_uid IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS rating_events_reservation_uid_idx;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE fine_ledger
+(
+    id              SERIAL PRIMARY KEY,
+    entry_uid       uuid UNIQUE  NOT NULL,
+    username        VARCHAR(80)  NOT NULL,
+    reservation_uid uuid,
+    entry_type      VARCHAR(20)  NOT NULL
+    CHECK (entry_type IN ('FINE', 'PAYMENT', 'WAIVER')),
+    amount          INT          NOT NULL
+    CHECK (amount > 0),
+    days_overdue    INT,
+    reason          VARCHAR(255),
+    payment_id      VARCHAR(80),
+    created_at      TIMESTAMP    NOT NULL DEFAULT now()
+);
+
+CREATE INDEX fine_ledger_username_idx ON fine_ledger (username);
+CREATE UNIQUE INDEX fine_ledger_reservation_fine_idx ON fine_ledger (reservation_uid) WHERE entry_type = 'FINE';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS fine_ledger;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE reservation ADD COLUMN copy_barcode VARCHAR(32);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE reservation DROP COLUMN IF EXISTS copy_barcode;
+-- +goose StatementEnd
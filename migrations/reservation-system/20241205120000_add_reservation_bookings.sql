@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- BOOKED reservations start in the future and hold a copy only from their start date, CANCELED ones were never picked up
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_status_check;
+ALTER TABLE reservation ADD CONSTRAINT reservation_status_check
+    CHECK (status IN ('BOOKED', 'RENTED', 'RETURNED', 'EXPIRED', 'CANCELED'));
+
+CREATE INDEX reservation_library_book_idx ON reservation (library_uid, book_uid, status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS reservation_library_book_idx;
+
+DELETE FROM reservation WHERE status IN ('BOOKED', 'CANCELED');
+ALTER TABLE reservation DROP CONSTRAINT IF EXISTS reservation_status_check;
+ALTER TABLE reservation ADD CONSTRAINT reservation_status_check
+    CHECK (status IN ('RENTED', 'RETURNED', 'EXPIRED'));
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the history of a reader is read page by page, the newest first
+CREATE INDEX reservation_username_start_date_idx ON reservation (username, start_date DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS reservation_username_start_date_idx;
+-- +goose StatementEnd
@@ -9,6 +9,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 )
 
@@ -16,11 +17,21 @@ const (
 	authorizationHeader = "Authorization"
 	bearerPrefix        = "Bearer "
 	userClaim           = "preferred_username"
+	realmAccessClaim    = "realm_access"
+	rolesClaim          = "roles"
 )
 
 const (
 	tokenCtxKey = "token"
 	userCtxKey  = "user"
+	rolesCtxKey = "roles"
+)
+
+const (
+	LibrarianRole = "librarian"
+	AdminRole     = "admin"
+	// ServiceRole is held by the token a service calls another one with on its own behalf, not for a reader.
+	ServiceRole = "service"
 )
 
 func GetToken(ctx context.Context) string {
@@ -37,6 +48,16 @@ func GetUser(ctx context.Context) string {
 func SetUser(ctx context.Context, user string) context.Context {
 	return context.WithValue(ctx, userCtxKey, user)
 }
+func GetRoles(ctx context.Context) []string {
+	value, _ := ctx.Value(rolesCtxKey).([]string)
+	return value
+}
+func SetRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, rolesCtxKey, roles)
+}
+func HasRole(ctx context.Context, role string) bool {
+	return slices.Contains(GetRoles(ctx), role)
+}
 
 func Middleware(jwksURI string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -46,7 +67,12 @@ func Middleware(jwksURI string) echo.MiddlewareFunc {
 				slog.Warn("no bearer token in request header")
 				return c.NoContent(http.StatusUnauthorized)
 			}
-			user, err := getUserFromToken(token, jwksURI)
+			claims, err := getClaimsFromToken(token, jwksURI)
+			if err != nil {
+				slog.Warn("unable to parse token", "error", err)
+				return c.NoContent(http.StatusUnauthorized)
+			}
+			user, err := getUserFromClaims(claims)
 			if err != nil {
 				slog.Warn("unable to get user from token", "error", err)
 				return c.NoContent(http.StatusUnauthorized)
@@ -54,12 +80,27 @@ func Middleware(jwksURI string) echo.MiddlewareFunc {
 			ctx := c.Request().Context()
 			ctx = SetToken(ctx, token)
 			ctx = SetUser(ctx, user)
+			ctx = SetRoles(ctx, getRolesFromClaims(claims))
 			c.SetRequest(c.Request().WithContext(ctx))
 			return next(c)
 		}
 	}
 }
 
+// RequireRole must be used after Middleware, it answers 403 when the caller has none of the roles.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			for _, role := range roles {
+				if HasRole(c.Request().Context(), role) {
+					return next(c)
+				}
+			}
+			return c.NoContent(http.StatusForbidden)
+		}
+	}
+}
+
 func getBearerToken(c echo.Context) (string, bool) {
 	header := c.Request().Header.Get(authorizationHeader)
 	if header == "" {
@@ -71,22 +112,45 @@ func getBearerToken(c echo.Context) (string, bool) {
 	return strings.TrimPrefix(header, bearerPrefix), true
 }
 
-func getUserFromToken(rawToken, jwksURI string) (string, error) {
+func getClaimsFromToken(rawToken, jwksURI string) (jwt.MapClaims, error) {
 	jwks, err := keyfunc.Get(jwksURI, keyfunc.Options{})
 	if err != nil {
-		return "", fmt.Errorf("get keyfunc: %w", err)
+		return nil, fmt.Errorf("get keyfunc: %w", err)
 	}
 	token, err := jwt.Parse(rawToken, jwks.Keyfunc)
 	if err != nil {
-		return "", fmt.Errorf("parse jwt: %w", err)
+		return nil, fmt.Errorf("parse jwt: %w", err)
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", errors.New("invalid token type")
+		return nil, errors.New("invalid token type")
 	}
+	return claims, nil
+}
+
+func getUserFromClaims(claims jwt.MapClaims) (string, error) {
 	user, ok := claims[userClaim].(string)
 	if !ok {
 		return "", errors.New("invalid user claim")
 	}
 	return user, nil
 }
+
+// getRolesFromClaims reads realm roles in the keycloak format: {"realm_access": {"roles": [...]}}.
+func getRolesFromClaims(claims jwt.MapClaims) []string {
+	realmAccess, ok := claims[realmAccessClaim].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	rawRoles, ok := realmAccess[rolesClaim].([]interface{})
+	if !ok {
+		return nil
+	}
+	roles := make([]string, 0, len(rawRoles))
+	for _, v := range rawRoles {
+		if role, ok := v.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryLeeway renews a token this long before it expires, so a request never leaves with an expired one.
+const tokenExpiryLeeway = 30 * time.Second
+
+var errNoServiceAccount = errors.New("service account is not configured")
+
+// HTTPClient sends the token requests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// TokenSource gets access tokens of a service account with the OAuth2 client credentials grant. A token is kept
+// until shortly before it expires, so the identity provider is asked once per token lifetime.
+type TokenSource struct {
+	httpClient   HTTPClient
+	tokenURL     string
+	clientID     string
+	clientSecret string
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewTokenSource(httpClient HTTPClient, tokenURL, clientID, clientSecret string) *TokenSource {
+	return &TokenSource{
+		httpClient:   httpClient,
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+}
+
+// Token returns the kept token while it is valid and fetches a new one otherwise.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiresAt) {
+		return s.token, nil
+	}
+	if s.clientID == "" || s.clientSecret == "" {
+		return "", errNoServiceAccount
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint responded %d: %s", resp.StatusCode, body)
+	}
+
+	res := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err = json.Unmarshal(body, &res); err != nil {
+		return "", err
+	}
+	if res.AccessToken == "" {
+		return "", errors.New("token endpoint responded without an access token")
+	}
+
+	s.token = res.AccessToken
+	s.expiresAt = time.Now().Add(time.Duration(res.ExpiresIn)*time.Second - tokenExpiryLeeway)
+	return s.token, nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type tokenEndpointStub struct {
+	expiresIn string
+	calls     int
+}
+
+func (s *tokenEndpointStub) Do(req *http.Request) (*http.Response, error) {
+	s.calls++
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+	if req.PostForm.Get("grant_type") != "client_credentials" || req.PostForm.Get("client_secret") != "secret" {
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(bytes.NewBufferString(`{"error":"invalid_client"}`))}, nil
+	}
+	body := `{"access_token":"token-` + req.PostForm.Get("client_id") + `","expires_in":` + s.expiresIn + `}`
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+func Test_TokenSource(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("token is kept until it expires", func(t *testing.T) {
+		stub := &tokenEndpointStub{expiresIn: "300"}
+		source := NewTokenSource(stub, "http://keycloak/token", "gateway", "secret")
+
+		for i := 0; i < 3; i++ {
+			token, err := source.Token(ctx)
+			require.NoError(t, err)
+			require.Equal(t, "token-gateway", token)
+		}
+		require.Equal(t, 1, stub.calls)
+	})
+
+	t.Run("short lived token is fetched again", func(t *testing.T) {
+		stub := &tokenEndpointStub{expiresIn: "10"}
+		source := NewTokenSource(stub, "http://keycloak/token", "gateway", "secret")
+
+		_, err := source.Token(ctx)
+		require.NoError(t, err)
+		_, err = source.Token(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 2, stub.calls)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		_, err := NewTokenSource(&tokenEndpointStub{}, "http://keycloak/token", "gateway", "wrong").Token(ctx)
+		require.ErrorContains(t, err, "401")
+	})
+
+	t.Run("no service account", func(t *testing.T) {
+		stub := &tokenEndpointStub{}
+		_, err := NewTokenSource(stub, "http://keycloak/token", "", "").Token(ctx)
+		require.ErrorIs(t, err, errNoServiceAccount)
+		require.Zero(t, stub.calls)
+	})
+}
@@ -0,0 +1,73 @@
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrWrongLength   = errors.New("isbn must have 10 or 13 digits")
+	ErrWrongChecksum = errors.New("isbn checksum is wrong")
+)
+
+// Normalize validates an ISBN-10 or ISBN-13, hyphens and spaces are ignored, and returns it as ISBN-13,
+// so both forms of the same edition are stored the same way.
+func Normalize(s string) (string, error) {
+	s = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+
+	switch len(s) {
+	case 10:
+		if !valid10(s) {
+			return "", ErrWrongChecksum
+		}
+		isbn := "978" + s[:9]
+		return isbn + string(checkDigit13(isbn)), nil
+	case 13:
+		if !digits(s) || checkDigit13(s[:12]) != s[12] {
+			return "", ErrWrongChecksum
+		}
+		return s, nil
+	default:
+		return "", ErrWrongLength
+	}
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func valid10(s string) bool {
+	if !digits(s[:9]) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(s[i]-'0') * (10 - i)
+	}
+	switch {
+	case s[9] == 'X':
+		sum += 10
+	case s[9] >= '0' && s[9] <= '9':
+		sum += int(s[9] - '0')
+	default:
+		return false
+	}
+	return sum%11 == 0
+}
+
+func checkDigit13(s string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(s[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
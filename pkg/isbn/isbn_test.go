@@ -0,0 +1,35 @@
+package isbn
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func Test_Normalize(t *testing.T) {
+	tests := []struct {
+		name        string
+		isbn        string
+		expected    string
+		expectedErr error
+	}{
+		{name: "isbn-13 with hyphens", isbn: "978-5-17-090630-7", expected: "9785170906307"},
+		{name: "isbn-10 is converted", isbn: "0-306-40615-2", expected: "9780306406157"},
+		{name: "isbn-10 with X check digit", isbn: "0-8044-2957-x", expected: "9780804429573"},
+		{name: "wrong isbn-13 checksum", isbn: "9785170906308", expectedErr: ErrWrongChecksum},
+		{name: "wrong isbn-10 checksum", isbn: "0306406153", expectedErr: ErrWrongChecksum},
+		{name: "letters", isbn: "97851709063A7", expectedErr: ErrWrongChecksum},
+		{name: "wrong length", isbn: "12345", expectedErr: ErrWrongLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Normalize(tt.isbn)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, res)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package time
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxLookaheadDays bounds the search for a business day, a calendar closed every day would loop forever.
+const maxLookaheadDays = 366
+
+// Calendar tells business days of a library from its days off: weekdays it is closed on and holidays.
+type Calendar struct {
+	location       *time.Location
+	closedWeekdays []time.Weekday
+	holidays       map[string]struct{}
+}
+
+// NewCalendar returns a calendar in the time zone, a nil location is UTC.
+func NewCalendar(loc *time.Location, closedWeekdays []time.Weekday, holidays []Date) *Calendar {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	c := &Calendar{
+		location:       loc,
+		closedWeekdays: slices.Clone(closedWeekdays),
+		holidays:       make(map[string]struct{}, len(holidays)),
+	}
+	for _, h := range holidays {
+		c.holidays[h.String()] = struct{}{}
+	}
+
+	return c
+}
+
+func (c *Calendar) Location() *time.Location {
+	return c.location
+}
+
+// Today returns the current day in the time zone of the calendar.
+func (c *Calendar) Today() Date {
+	return Today(c.location)
+}
+
+func (c *Calendar) IsBusinessDay(d Date) bool {
+	if slices.Contains(c.closedWeekdays, d.Weekday()) {
+		return false
+	}
+	_, holiday := c.holidays[d.String()]
+	return !holiday
+}
+
+// NextBusinessDay returns the day itself when it is a business day and the first one after it otherwise.
+// The day is returned unchanged when there is no business day within a year.
+func (c *Calendar) NextBusinessDay(d Date) Date {
+	for i := 0; i <= maxLookaheadDays; i++ {
+		day := d.AddDays(i)
+		if c.IsBusinessDay(day) {
+			return day
+		}
+	}
+	return d
+}
+
+// AddBusinessDays moves the day forward by the number of business days, a calendar without business
+// days leaves it where it is.
+func (c *Calendar) AddBusinessDays(d Date, days int) Date {
+	for ; days > 0; days-- {
+		next := c.NextBusinessDay(d.AddDays(1))
+		if !c.IsBusinessDay(next) {
+			return d
+		}
+		d = next
+	}
+	return d
+}
+
+// BusinessDaysBetween counts business days after from up to and including to.
+func (c *Calendar) BusinessDaysBetween(from, to Date) int {
+	days := 0
+	for d := from.AddDays(1); !d.After(to); d = d.AddDays(1) {
+		if c.IsBusinessDay(d) {
+			days++
+		}
+	}
+	return days
+}
+
+// DaysOverdue counts the business days a return is late by. A due date on a day off moves to the next
+// business day, so bringing the book back then is still in time.
+func (c *Calendar) DaysOverdue(tillDate, returnDate Date) int {
+	return c.BusinessDaysBetween(c.NextBusinessDay(tillDate), returnDate)
+}
+
+type calendarJSON struct {
+	Timezone       string   `json:"timezone"`
+	ClosedWeekdays []string `json:"closedWeekdays"`
+	Holidays       []Date   `json:"holidays"`
+}
+
+// MarshalJSON writes weekdays by their upper case names, MONDAY to SUNDAY.
+func (c *Calendar) MarshalJSON() ([]byte, error) {
+	res := calendarJSON{
+		Timezone:       c.location.String(),
+		ClosedWeekdays: make([]string, 0, len(c.closedWeekdays)),
+		Holidays:       make([]Date, 0, len(c.holidays)),
+	}
+	for _, w := range c.closedWeekdays {
+		res.ClosedWeekdays = append(res.ClosedWeekdays, strings.ToUpper(w.String()))
+	}
+	for h := range c.holidays {
+		d, err := NewDate(h)
+		if err != nil {
+			return nil, err
+		}
+		res.Holidays = append(res.Holidays, *d)
+	}
+	slices.SortFunc(res.Holidays, func(a, b Date) int {
+		return time.Time(a).Compare(time.Time(b))
+	})
+
+	return json.Marshal(res)
+}
+
+func (c *Calendar) UnmarshalJSON(b []byte) error {
+	data := calendarJSON{}
+	err := json.Unmarshal(b, &data)
+	if err != nil {
+		return err
+	}
+
+	loc := time.UTC
+	if data.Timezone != "" {
+		loc, err = time.LoadLocation(data.Timezone)
+		if err != nil {
+			return err
+		}
+	}
+
+	closedWeekdays := make([]time.Weekday, 0, len(data.ClosedWeekdays))
+	for _, name := range data.ClosedWeekdays {
+		w, err := ParseWeekday(name)
+		if err != nil {
+			return err
+		}
+		closedWeekdays = append(closedWeekdays, w)
+	}
+
+	*c = *NewCalendar(loc, closedWeekdays, data.Holidays)
+	return nil
+}
+
+// ParseWeekday reads a weekday name in any case, MONDAY or Monday.
+func ParseWeekday(name string) (time.Weekday, error) {
+	for w := time.Sunday; w <= time.Saturday; w++ {
+		if strings.EqualFold(w.String(), name) {
+			return w, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", name)
+}
@@ -0,0 +1,93 @@
+package time
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func mustDate(t *testing.T, date string) Date {
+	d, err := NewDate(date)
+	require.NoError(t, err)
+	return *d
+}
+
+func Test_DaysOverdue(t *testing.T) {
+	// weekends off, 2025-01-01 is a Wednesday holiday
+	c := NewCalendar(time.UTC, []time.Weekday{time.Saturday, time.Sunday}, []Date{mustDate(t, "2025-01-01")})
+
+	tests := []struct {
+		name       string
+		tillDate   string
+		returnDate string
+		expected   int
+	}{
+		{name: "returned early", tillDate: "2024-12-27", returnDate: "2024-12-20", expected: 0},
+		{name: "returned on the due date", tillDate: "2024-12-27", returnDate: "2024-12-27", expected: 0},
+		{name: "weekend is not counted", tillDate: "2024-12-27", returnDate: "2024-12-30", expected: 1},
+		{name: "holiday is not counted", tillDate: "2024-12-31", returnDate: "2025-01-02", expected: 1},
+		{name: "due on saturday, back on monday", tillDate: "2024-12-28", returnDate: "2024-12-30", expected: 0},
+		{name: "two weeks late", tillDate: "2024-12-20", returnDate: "2025-01-03", expected: 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, c.DaysOverdue(mustDate(t, tt.tillDate), mustDate(t, tt.returnDate)))
+		})
+	}
+}
+
+func Test_AddBusinessDays(t *testing.T) {
+	c := NewCalendar(time.UTC, []time.Weekday{time.Saturday, time.Sunday}, []Date{mustDate(t, "2025-01-01")})
+
+	require.Equal(t, "2025-01-02", c.AddBusinessDays(mustDate(t, "2024-12-27"), 3).String())
+	require.Equal(t, "2024-12-30", c.NextBusinessDay(mustDate(t, "2024-12-28")).String())
+
+	closed := NewCalendar(time.UTC, []time.Weekday{
+		time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday,
+	}, nil)
+	require.Equal(t, "2024-12-27", closed.AddBusinessDays(mustDate(t, "2024-12-27"), 3).String())
+}
+
+func Test_CalendarJSON(t *testing.T) {
+	body := `{"timezone":"Europe/Moscow","closedWeekdays":["SUNDAY"],"holidays":["2025-01-01","2025-01-07"]}`
+
+	c := &Calendar{}
+	require.NoError(t, json.Unmarshal([]byte(body), c))
+	require.Equal(t, "Europe/Moscow", c.Location().String())
+	require.False(t, c.IsBusinessDay(mustDate(t, "2025-01-05")))
+	require.False(t, c.IsBusinessDay(mustDate(t, "2025-01-07")))
+	require.True(t, c.IsBusinessDay(mustDate(t, "2025-01-04")))
+
+	res, err := json.Marshal(c)
+	require.NoError(t, err)
+	require.JSONEq(t, body, string(res))
+
+	require.Error(t, json.Unmarshal([]byte(`{"closedWeekdays":["FUNDAY"]}`), &Calendar{}))
+}
+
+func Test_DateIn(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	// 22:30 UTC is already the next day in Moscow
+	moment := time.Date(2024, 12, 31, 22, 30, 0, 0, time.UTC)
+	require.Equal(t, "2024-12-31", DateIn(moment, time.UTC).String())
+	require.Equal(t, "2025-01-01", DateIn(moment, moscow).String())
+}
+
+func Test_DateScan(t *testing.T) {
+	var d Date
+	require.NoError(t, d.Scan(time.Date(2024, 12, 31, 0, 0, 0, 0, time.FixedZone("", 3*60*60))))
+	require.Equal(t, "2024-12-31", d.String())
+
+	require.NoError(t, d.Scan([]byte("2025-01-02")))
+	require.Equal(t, "2025-01-02", d.String())
+
+	value, err := d.Value()
+	require.NoError(t, err)
+	require.Equal(t, "2025-01-02", value)
+
+	require.Error(t, d.Scan(42))
+}
@@ -1,10 +1,14 @@
 package time
 
 import (
+	"database/sql/driver"
+	"fmt"
 	"strings"
 	"time"
 )
 
+// Date is a calendar day. It is kept as midnight UTC so that days compare and count the same way
+// whatever the time zone of the library or the server is.
 type Date time.Time
 
 const dateFormat = "2006-01-02"
@@ -19,6 +23,17 @@ func NewDate(date string) (*Date, error) {
 	return &d, err
 }
 
+// DateIn returns the day the moment falls on in the time zone.
+func DateIn(t time.Time, loc *time.Location) Date {
+	t = t.In(loc)
+	return Date(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+}
+
+// Today returns the current day in the time zone.
+func Today(loc *time.Location) Date {
+	return DateIn(time.Now(), loc)
+}
+
 func (d *Date) UnmarshalJSON(b []byte) error {
 	str := string(b)
 	// Удаляем кавычки вокруг строки
@@ -31,6 +46,65 @@ func (d *Date) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (d *Date) String() string {
-	return time.Time(*d).Format(dateFormat)
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// Scan reads DATE columns and their text form.
+func (d *Date) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d = Date(time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC))
+		return nil
+	case []byte:
+		return d.Scan(string(v))
+	case string:
+		parsed, err := NewDate(v)
+		if err != nil {
+			return err
+		}
+		*d = *parsed
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into date", src)
+	}
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d Date) String() string {
+	return time.Time(d).Format(dateFormat)
+}
+
+// In returns the start of the day in the time zone.
+func (d Date) In(loc *time.Location) time.Time {
+	t := time.Time(d)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+func (d Date) Weekday() time.Weekday {
+	return time.Time(d).Weekday()
+}
+
+func (d Date) AddDays(days int) Date {
+	return Date(time.Time(d).AddDate(0, 0, days))
+}
+
+// Sub returns the number of days from other to d.
+func (d Date) Sub(other Date) int {
+	return int(time.Time(d).Sub(time.Time(other)).Round(time.Hour) / (24 * time.Hour))
+}
+
+func (d Date) Before(other Date) bool {
+	return time.Time(d).Before(time.Time(other))
+}
+
+func (d Date) After(other Date) bool {
+	return time.Time(d).After(time.Time(other))
+}
+
+func (d Date) Equal(other Date) bool {
+	return time.Time(d).Equal(time.Time(other))
 }
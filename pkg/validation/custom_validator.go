@@ -1,17 +1,109 @@
 package validation
 
 import (
+	"errors"
+	"fmt"
+	my_time "github.com/Erlendum/rsoi-lab-02/pkg/time"
 	"github.com/go-playground/validator/v10"
+	"reflect"
+	"strings"
 )
 
 type CustomValidator struct {
 	validator *validator.Validate
 }
 
+// FieldError describes an invalid field of a request by its JSON name.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
 func MustRegisterCustomValidator(v *validator.Validate) *CustomValidator {
+	// errors name the fields as the request JSON does
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
 	return &CustomValidator{validator: v}
 }
 
 func (cv *CustomValidator) Validate(i interface{}) error {
 	return cv.validator.Struct(i)
 }
+
+// FieldErrors describes every field the error of Validate complains about, other errors describe none.
+func FieldErrors(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+
+	res := make([]FieldError, 0, len(validationErrors))
+	for _, e := range validationErrors {
+		res = append(res, FieldError{Field: e.Field(), Message: message(e)})
+	}
+	return res
+}
+
+func message(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "uuid", "uuid4":
+		return "must be a UUID"
+	case "min", "gte":
+		return "must be at least " + e.Param()
+	case "max", "lte":
+		return "must be at most " + e.Param()
+	case "oneof":
+		return "must be one of " + e.Param()
+	}
+	return "is wrong"
+}
+
+// DateWindow parses the date of the field and checks that it falls after from and at most maxDays days later.
+func DateWindow(field, value string, from my_time.Date, maxDays int) (my_time.Date, *FieldError) {
+	if value == "" {
+		return my_time.Date{}, &FieldError{Field: field, Message: "is required"}
+	}
+
+	date, err := my_time.NewDate(value)
+	if err != nil {
+		return my_time.Date{}, &FieldError{Field: field, Message: "must be a date in YYYY-MM-DD format"}
+	}
+
+	if !date.After(from) {
+		return my_time.Date{}, &FieldError{Field: field, Message: "must be after " + from.String()}
+	}
+	if date.Sub(from) > maxDays {
+		return my_time.Date{}, &FieldError{Field: field, Message: fmt.Sprintf("must be at most %d days after %s", maxDays, from)}
+	}
+
+	return *date, nil
+}
+
+// DateFrom parses an optional date of the field, an empty one is from itself. The date must not be before from
+// and at most maxDays days later.
+func DateFrom(field, value string, from my_time.Date, maxDays int) (my_time.Date, *FieldError) {
+	if value == "" {
+		return from, nil
+	}
+
+	date, err := my_time.NewDate(value)
+	if err != nil {
+		return my_time.Date{}, &FieldError{Field: field, Message: "must be a date in YYYY-MM-DD format"}
+	}
+
+	if date.Before(from) {
+		return my_time.Date{}, &FieldError{Field: field, Message: "must not be before " + from.String()}
+	}
+	if date.Sub(from) > maxDays {
+		return my_time.Date{}, &FieldError{Field: field, Message: fmt.Sprintf("must be at most %d days after %s", maxDays, from)}
+	}
+
+	return *date, nil
+}